@@ -0,0 +1,103 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package adapter lets session stores be used from web frameworks that don't
+build on net/http, such as fasthttp or fiber.
+
+Stores read cookies from an *http.Request and write Set-Cookie headers to
+an http.ResponseWriter. Request builds a request from a RequestReader, and
+Writer collects headers written by stores and copies them to a
+ResponseWriter when flushed. A framework only needs two small types, for
+example with fasthttp:
+
+	type fastRequest struct{ ctx *fasthttp.RequestCtx }
+
+	func (r fastRequest) VisitCookies(fn func(name, value string)) {
+		r.ctx.Request.Header.VisitAllCookie(func(k, v []byte) {
+			fn(string(k), string(v))
+		})
+	}
+
+	type fastResponse struct{ ctx *fasthttp.RequestCtx }
+
+	func (w fastResponse) AddSetCookie(value string) {
+		w.ctx.Response.Header.Add("Set-Cookie", value)
+	}
+
+	func handler(ctx *fasthttp.RequestCtx) {
+		r := adapter.Request(ctx, fastRequest{ctx})
+		w := adapter.NewWriter(fastResponse{ctx})
+		defer w.Flush()
+
+		session, err := store.Get(r, "session-name")
+		// ...
+		err = session.Save(r, w)
+	}
+*/
+package adapter
+
+import (
+	"context"
+	"net/http"
+)
+
+// RequestReader reads the cookies of a request.
+type RequestReader interface {
+	// VisitCookies calls fn for each cookie of the request.
+	VisitCookies(fn func(name, value string))
+}
+
+// ResponseWriter adds Set-Cookie headers to a response.
+type ResponseWriter interface {
+	// AddSetCookie adds a Set-Cookie header with the given value.
+	AddSetCookie(value string)
+}
+
+// Request returns a GET request carrying the cookies of rr and ctx, to be
+// passed to session stores. The request has no URL or body.
+func Request(ctx context.Context, rr RequestReader) *http.Request {
+	r, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	rr.VisitCookies(func(name, value string) {
+		r.AddCookie(&http.Cookie{Name: name, Value: value})
+	})
+	return r
+}
+
+// NewWriter returns a Writer flushing Set-Cookie headers to rw.
+func NewWriter(rw ResponseWriter) *Writer {
+	return &Writer{
+		rw:     rw,
+		header: make(http.Header),
+	}
+}
+
+// Writer is an http.ResponseWriter collecting the headers written by
+// session stores. The body and status code are discarded.
+type Writer struct {
+	rw     ResponseWriter
+	header http.Header
+}
+
+// Header returns the collected headers.
+func (w *Writer) Header() http.Header {
+	return w.header
+}
+
+// Write discards b.
+func (w *Writer) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// WriteHeader does nothing.
+func (w *Writer) WriteHeader(statusCode int) {}
+
+// Flush copies the collected Set-Cookie headers to the ResponseWriter and
+// clears them. It must be called once sessions are saved.
+func (w *Writer) Flush() {
+	for _, v := range w.header.Values("Set-Cookie") {
+		w.rw.AddSetCookie(v)
+	}
+	w.header.Del("Set-Cookie")
+}
@@ -0,0 +1,59 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package adapter
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+// cookieMap is a RequestReader over a map of cookies.
+type cookieMap map[string]string
+
+func (m cookieMap) VisitCookies(fn func(name, value string)) {
+	for k, v := range m {
+		fn(k, v)
+	}
+}
+
+// headerList is a ResponseWriter recording Set-Cookie headers.
+type headerList []string
+
+func (l *headerList) AddSetCookie(value string) {
+	*l = append(*l, value)
+}
+
+func TestAdapter(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("some key"))
+
+	var headers headerList
+	r := Request(context.Background(), cookieMap{})
+	w := NewWriter(&headers)
+	session, err := store.Get(r, "s")
+	if err != nil {
+		t.Fatal("failed to get session", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = session.Save(r, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	w.Flush()
+	if len(headers) != 1 {
+		t.Fatalf("bad Set-Cookie headers: %v", headers)
+	}
+
+	c, err := http.ParseSetCookie(headers[0])
+	if err != nil {
+		t.Fatal("failed to parse cookie", err)
+	}
+	r = Request(context.Background(), cookieMap{c.Name: c.Value})
+	session, err = store.Get(r, "s")
+	if err != nil || session.IsNew || session.Values["foo"] != "bar" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+}
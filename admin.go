@@ -0,0 +1,88 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"io/fs"
+	"reflect"
+)
+
+// AdminStore is implemented by server-side stores that can enumerate the
+// sessions they hold, for administrative tooling.
+type AdminStore interface {
+	Store
+
+	// Walk calls fn for each unexpired session saved with the given name.
+	// Sessions that can't be decoded are skipped. If fn returns an error
+	// Walk stops and returns it.
+	Walk(name string, fn func(*Session) error) error
+
+	// FindByValue returns the unexpired sessions saved with the given
+	// name whose Values[key] is equal to value, for example all sessions
+	// where Values["user_id"] is 42. Backends with secondary indexes
+	// answer it without scanning; others can use ScanByValue.
+	FindByValue(name string, key, value interface{}) ([]*Session, error)
+}
+
+// ScanByValue implements AdminStore.FindByValue by walking all sessions of
+// the store, for backends without secondary indexes. Values are compared
+// with reflect.DeepEqual.
+func ScanByValue(store interface {
+	Walk(name string, fn func(*Session) error) error
+}, name string, key, value interface{}) ([]*Session, error) {
+	var found []*Session
+	err := store.Walk(name, func(s *Session) error {
+		if v, ok := s.Values[key]; ok && reflect.DeepEqual(v, value) {
+			found = append(found, s)
+		}
+		return nil
+	})
+	return found, err
+}
+
+// ExportByPrincipal returns snapshots of the sessions named name whose
+// Values[key] is equal to principal, for example all sessions of a user
+// for a data subject access request.
+func ExportByPrincipal(store AdminStore, name string, key,
+	principal interface{}) ([]*Snapshot, error) {
+	sessions, err := store.FindByValue(name, key, principal)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []*Snapshot
+	for _, s := range sessions {
+		snapshot, err := s.Export()
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// Walk calls fn for each unexpired session saved with the given name.
+//
+// See AdminStore.
+func (s *FilesystemStore) Walk(name string, fn func(*Session) error) error {
+	return s.walkFiles(func(_, id string, _ fs.FileInfo) error {
+		session := s.newSession(name)
+		session.ID = id
+		if s.load(context.Background(), session) != nil {
+			return nil
+		}
+		session.IsNew = false
+		return fn(session)
+	})
+}
+
+// FindByValue returns the unexpired sessions saved with the given name
+// whose Values[key] is equal to value. Session files are not indexed, so
+// all of them are read.
+//
+// See AdminStore.
+func (s *FilesystemStore) FindByValue(name string, key, value interface{}) ([]*Session, error) {
+	return ScanByValue(s, name, key, value)
+}
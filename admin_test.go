@@ -0,0 +1,29 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import "testing"
+
+func TestFindByValue(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("secret-key"))
+	saveFilesystemSession(t, store, "s", map[interface{}]interface{}{"user_id": 42})
+	saveFilesystemSession(t, store, "s", map[interface{}]interface{}{"user_id": 42, "theme": "dark"})
+	saveFilesystemSession(t, store, "s", map[interface{}]interface{}{"user_id": 7})
+	saveFilesystemSession(t, store, "s", map[interface{}]interface{}{"user_id": "42"})
+
+	var admin AdminStore = store
+	sessions, err := admin.FindByValue("s", "user_id", 42)
+	if err != nil {
+		t.Fatal("failed to find sessions", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("bad number of sessions: got %d, want 2", len(sessions))
+	}
+	for _, s := range sessions {
+		if s.IsNew || s.ID == "" || s.Values["user_id"] != 42 {
+			t.Fatalf("bad session: %q, %v", s.ID, s.Values)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrAsyncClosed is returned by Save and Delete when the AsyncWriter of
+// the store was closed.
+var ErrAsyncClosed = errors.New("sessions: async writer closed")
+
+// NewAsyncWriter returns an AsyncWriter queueing up to size writes and
+// starts its worker. onError, if not nil, is called with the errors of
+// failed writes.
+func NewAsyncWriter(size int, onError func(error)) *AsyncWriter {
+	a := &AsyncWriter{
+		onError: onError,
+		queue:   make(chan asyncWrite, size),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// AsyncWriter persists sessions of server-side stores in the background,
+// for latency-critical handlers. Set it as the Async field of
+// FilesystemStore, ObjectStore or CassandraStore: Save and Delete then
+// encode the session and write the cookie synchronously, and queue the
+// write to the backend.
+//
+// Writes are applied in order by a single worker. Save blocks while the
+// queue is full, until the request is canceled. A failed write is reported
+// to the error callback and not retried, and a request following Save
+// closely may load the previous values, so use it only where rare lost
+// updates are acceptable. Call Close on shutdown so queued writes are not
+// lost.
+type AsyncWriter struct {
+	onError func(error)
+	queue   chan asyncWrite
+	done    chan struct{}
+
+	mu     sync.RWMutex // guards closed and sends on queue
+	closed bool
+}
+
+type asyncWrite struct {
+	ctx   context.Context
+	write func(ctx context.Context) error
+}
+
+// Flush waits until the writes queued before it are applied, or ctx is
+// done.
+func (a *AsyncWriter) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	err := a.do(ctx, func(context.Context) error {
+		close(flushed)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting writes and waits until the queued ones are
+// applied, or ctx is done. Writes queued after Close fail with
+// ErrAsyncClosed.
+func (a *AsyncWriter) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// do queues write, or calls it if a is nil. The queued write is called
+// with a context carrying the values of ctx but not its cancellation.
+func (a *AsyncWriter) do(ctx context.Context, write func(ctx context.Context) error) error {
+	if a == nil {
+		return write(ctx)
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return ErrAsyncClosed
+	}
+	select {
+	case a.queue <- asyncWrite{context.WithoutCancel(ctx), write}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	for w := range a.queue {
+		if err := w.write(w.ctx); err != nil && a.onError != nil {
+			a.onError(err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// blockingBucket is a Bucket whose writes wait for release.
+type blockingBucket struct {
+	*memBucket
+	release chan struct{}
+	err     error
+}
+
+func (b *blockingBucket) Put(ctx context.Context, key string, data []byte) error {
+	<-b.release
+	if b.err != nil {
+		return b.err
+	}
+	return b.memBucket.Put(ctx, key, data)
+}
+
+func TestAsyncWriter(t *testing.T) {
+	bucket := &blockingBucket{
+		memBucket: &memBucket{objects: make(map[string][]byte)},
+		release:   make(chan struct{}),
+	}
+	store := NewObjectStore(bucket, []byte("some key"))
+	store.Async = NewAsyncWriter(1, nil)
+
+	// The cookie is written while the object is still queued.
+	cookie := encodeCookie(t, store, "s", "gopher")
+	if len(bucket.objects) != 0 {
+		t.Fatalf("expected the write to be pending: %v", bucket.objects)
+	}
+
+	// The worker is blocked on the first write and the queue holds the
+	// second one, so the third blocks until the request is canceled.
+	encodeCookie(t, store, "s", "gopher")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	if err := session.Save(req, httptest.NewRecorder()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	close(bucket.release)
+	if err := store.Async.Flush(context.Background()); err != nil {
+		t.Fatal("failed to flush", err)
+	}
+	if len(bucket.objects) != 2 {
+		t.Fatalf("expected 2 objects, got %d", len(bucket.objects))
+	}
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+	session, err := store.New(req, "s")
+	if err != nil || session.Values["user"] != "gopher" {
+		t.Fatalf("failed to load session: %v %v", session.Values, err)
+	}
+
+	// Deletes are applied in order after the queued writes.
+	if err = store.Delete(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+	if err = store.Async.Close(context.Background()); err != nil {
+		t.Fatal("failed to close", err)
+	}
+	if len(bucket.objects) != 1 {
+		t.Fatalf("expected 1 object, got %d", len(bucket.objects))
+	}
+	session, _ = store.New(req, "s")
+	if err = session.Save(req, httptest.NewRecorder()); !errors.Is(err, ErrAsyncClosed) {
+		t.Fatalf("expected ErrAsyncClosed, got %v", err)
+	}
+}
+
+func TestAsyncWriterError(t *testing.T) {
+	failed := errors.New("bucket unavailable")
+	bucket := &blockingBucket{
+		memBucket: &memBucket{objects: make(map[string][]byte)},
+		release:   make(chan struct{}),
+		err:       failed,
+	}
+	close(bucket.release)
+	errs := make(chan error, 1)
+	store := NewObjectStore(bucket, []byte("some key"))
+	store.Async = NewAsyncWriter(8, func(err error) { errs <- err })
+
+	encodeCookie(t, store, "s", "gopher")
+	if err := store.Async.Close(context.Background()); err != nil {
+		t.Fatal("failed to close", err)
+	}
+	if err := <-errs; !errors.Is(err, failed) {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+}
+
+func TestAsyncFilesystemStore(t *testing.T) {
+	async := NewAsyncWriter(8, nil)
+	store := NewFilesystemStoreWithOptions(t.TempDir(), WithKeyPairs([]byte("some key")),
+		WithAsyncWriter(async))
+	cookie := encodeCookie(t, store, "s", "gopher")
+	if err := async.Flush(context.Background()); err != nil {
+		t.Fatal("failed to flush", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+	session, err := store.New(req, "s")
+	if err != nil || session.Values["user"] != "gopher" {
+		t.Fatalf("failed to load session: %v %v", session.Values, err)
+	}
+	if err = store.Delete(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+	if err = async.Close(context.Background()); err != nil {
+		t.Fatal("failed to close", err)
+	}
+	if session, _ = store.New(req, "s"); !session.IsNew {
+		t.Fatal("expected the session file to be removed")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"time"
+)
+
+// Session values key for cached authorization data.
+const authzKey = "_authz"
+
+func init() {
+	RegisterType[Authz]("sessions.Authz")
+}
+
+// Authz is authorization data cached in a session: the roles of the user
+// and a bitset of permissions, along with the time it was fetched.
+type Authz struct {
+	Roles []string
+	// Permissions is a bitset: bit n is set if the user has permission n,
+	// as numbered by the application.
+	Permissions uint64
+	Fetched     time.Time
+}
+
+// HasRole reports whether role is one of the roles.
+func (a Authz) HasRole(role string) bool {
+	for _, r := range a.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether bit perm is set in the permissions.
+func (a Authz) Can(perm uint) bool {
+	return perm < 64 && a.Permissions&(1<<perm) != 0
+}
+
+// SetAuthz caches authorization data in the session. Fetched is set to the
+// current time if zero.
+//
+// Like other values, the data is authenticated by the store, so a client
+// can't grant itself roles; with CookieStore it counts towards the cookie
+// size.
+func (s *Session) SetAuthz(a Authz) {
+	if a.Fetched.IsZero() {
+		a.Fetched = time.Now()
+	}
+	s.initValues()
+	s.Values[authzKey] = a
+}
+
+// CachedAuthz returns the authorization data cached in the session, if
+// any, regardless of its age.
+func (s *Session) CachedAuthz() (Authz, bool) {
+	a, ok := s.Values[authzKey].(Authz)
+	return a, ok
+}
+
+// ClearAuthz removes the authorization data cached in the session, for
+// example after the roles of the user changed, so it is fetched again.
+func (s *Session) ClearAuthz() {
+	delete(s.Values, authzKey)
+}
+
+// NewAuthzCache returns an AuthzCache refreshing data older than ttl with
+// refresh.
+func NewAuthzCache(ttl time.Duration,
+	refresh func(r *http.Request, session *Session) (Authz, error)) *AuthzCache {
+	return &AuthzCache{
+		TTL:     ttl,
+		Refresh: refresh,
+	}
+}
+
+// AuthzCache bounds the staleness of authorization data cached in sessions,
+// saving a lookup per request while changes to roles take effect within
+// TTL.
+type AuthzCache struct {
+	// TTL is the maximum age of cached data. If zero, data is refreshed on
+	// every call.
+	TTL time.Duration
+	// Refresh fetches the authorization data of the user of the session,
+	// typically from a database.
+	Refresh func(r *http.Request, session *Session) (Authz, error)
+}
+
+// Get returns the authorization data cached in session, calling Refresh
+// first if there is none or it is older than TTL. Refreshed data is cached
+// in the session, which the caller then saves.
+//
+// If Refresh fails, its error is returned and the cached data is left
+// unchanged.
+func (c *AuthzCache) Get(r *http.Request, session *Session) (Authz, error) {
+	if a, ok := session.CachedAuthz(); ok && time.Since(a.Fetched) < c.TTL {
+		return a, nil
+	}
+	a, err := c.Refresh(r, session)
+	if err != nil {
+		return Authz{}, err
+	}
+	session.SetAuthz(a)
+	a, _ = session.CachedAuthz()
+	return a, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthzCache(t *testing.T) {
+	store := NewCookieStore([]byte("some key"))
+	calls := 0
+	var refreshErr error
+	cache := NewAuthzCache(time.Minute, func(r *http.Request, session *Session) (Authz, error) {
+		calls++
+		return Authz{Roles: []string{"admin"}, Permissions: 1 << 3}, refreshErr
+	})
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	a, err := cache.Get(req, session)
+	if err != nil {
+		t.Fatal("failed to get authz", err)
+	}
+	if !a.HasRole("admin") || a.HasRole("user") || !a.Can(3) || a.Can(4) || calls != 1 {
+		t.Fatalf("bad authz %+v after %d calls", a, calls)
+	}
+
+	// Cached data survives a round trip and is not refreshed while fresh.
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	session, err = store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to decode session", err)
+	}
+	if a, err = cache.Get(req, session); err != nil || !a.HasRole("admin") || calls != 1 {
+		t.Fatalf("expected cached authz, got %+v after %d calls: %v", a, calls, err)
+	}
+
+	// Stale data is refreshed; a failed refresh keeps the cached data.
+	stale := a
+	stale.Fetched = time.Now().Add(-2 * time.Minute)
+	session.SetAuthz(stale)
+	refreshErr = errors.New("db down")
+	if _, err = cache.Get(req, session); err != refreshErr || calls != 2 {
+		t.Fatalf("expected the refresh error after 2 calls, got %v after %d", err, calls)
+	}
+	if cached, _ := session.CachedAuthz(); !cached.Fetched.Equal(stale.Fetched) {
+		t.Fatal("expected the cached authz to be left unchanged")
+	}
+	refreshErr = nil
+	if a, err = cache.Get(req, session); err != nil || !a.Fetched.After(stale.Fetched) || calls != 3 {
+		t.Fatalf("expected refreshed authz, got %+v after %d calls: %v", a, calls, err)
+	}
+
+	session.ClearAuthz()
+	if _, ok := session.CachedAuthz(); ok {
+		t.Fatal("expected no cached authz")
+	}
+	if err := session.Set(authzKey, nil); err != ErrReservedKey {
+		t.Fatalf("expected ErrReservedKey, got %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// sessionBackend is the storage of a store built on backendStore, which
+// keeps the values of sessions server-side and only their ID in the
+// cookie.
+type sessionBackend interface {
+	Store
+	// loadSession reads the values of session, whose ID is set, and
+	// decodes them into session.Values.
+	loadSession(ctx context.Context, session *Session) error
+	// saveSession writes the values of session, whose ID is set, to
+	// expire after maxAge seconds. maxAge is 0 if the store has no
+	// maximum age.
+	saveSession(ctx context.Context, session *Session, maxAge int) error
+	// deleteSession deletes the values of the session id.
+	deleteSession(ctx context.Context, id string) error
+}
+
+// newBackendConfig applies opts over the default options of the stores
+// built on backendStore.
+func newBackendConfig(opts []StoreOption) *storeConfig {
+	return newStoreConfig(&Options{
+		Path:   "/",
+		MaxAge: 86400 * 30,
+	}, opts)
+}
+
+// newBackendStore returns a backendStore for backend configured by cfg.
+func newBackendStore(backend sessionBackend, cfg *storeConfig) backendStore {
+	s := backendStore{
+		Codecs:     cfg.codecs(),
+		Options:    cfg.options,
+		Entropy:    cfg.entropy,
+		FlashKey:   cfg.flashKey,
+		backend:    backend,
+		serializer: cfg.serializer,
+		hooks:      cfg.hooks,
+	}
+	s.MaxAge(s.Options.MaxAge)
+	return s
+}
+
+// backendStore implements the Store methods shared by the stores keeping
+// session values server-side: the cookie holds the session ID, encoded
+// with the codecs, and the backend holds the values.
+//
+// Of the StoreOptions, those configuring cookies, codecs, entropy, the
+// flashes key and the cookie hooks apply; the others are ignored.
+type backendStore struct {
+	Codecs  []securecookie.Codec
+	Options *Options // default configuration
+	// Entropy is the source of random bytes for session IDs. If nil,
+	// crypto/rand is used.
+	Entropy io.Reader
+	// PersistOptions saves the cookie attributes of sessions, such as
+	// Path, Domain and SameSite, with their values, so the cookies of
+	// loaded sessions match the ones the browser holds even if the store
+	// defaults changed since the sessions were created.
+	PersistOptions bool
+	// FlashKey is the default flashes key of sessions. If empty, "_flash"
+	// is used.
+	FlashKey string
+
+	backend sessionBackend
+	// serializer is the serializer set by WithSerializer, if any.
+	serializer securecookie.Serializer
+	hooks      cookieHooks
+}
+
+// Get returns a session for the given name after adding it to the registry.
+//
+// See CookieStore.Get().
+func (s *backendStore) Get(r *http.Request, name string) (*Session, error) {
+	return GetRegistry(r).Get(s.backend, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+//
+// See CookieStore.New().
+func (s *backendStore) New(r *http.Request, name string) (*Session, error) {
+	session := NewSession(s.backend, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+	session.flashKey = s.FlashKey
+	c, errCookie := r.Cookie(name)
+	if errCookie != nil {
+		return session, nil
+	}
+	err := decodeMulti(name, c.Value, &session.ID, s.Codecs...)
+	if err == nil {
+		_ = checkIssuedAt(session, c.Value, time.Time{})
+		err = s.backend.loadSession(r.Context(), session)
+	}
+	return session, loaded(session, err)
+}
+
+// Lookup returns the session for the given name and true if the request
+// carries a session cookie whose values are in the backend, without
+// creating a session otherwise.
+//
+// See the Lookup function.
+func (s *backendStore) Lookup(r *http.Request, name string) (*Session, bool, error) {
+	return lookup(s.backend, r, name)
+}
+
+// Save writes the values of the session to the backend and adds the
+// session cookie to the response.
+//
+// Setting Options.MaxAge to a negative value deletes the session.
+func (s *backendStore) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	maxAge := session.Options.maxAge(time.Now())
+	if maxAge < 0 {
+		return s.Delete(r, w, session)
+	}
+	if maxAge == 0 {
+		// Browser session cookies still need their values to expire.
+		maxAge = max(s.Options.MaxAge, 0)
+	}
+	if session.ID == "" {
+		id, err := generateID(s.Entropy, 32)
+		if err != nil {
+			return err
+		}
+		session.ID = id
+	}
+	if s.PersistOptions {
+		defer attachOptions(session)()
+	}
+	if err := s.backend.saveSession(r.Context(), session, maxAge); err != nil {
+		return err
+	}
+	encoded, err := encodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	return setCookie(r, w, session.Name(), encoded, session.Options, &s.hooks)
+}
+
+// Delete deletes the values of the session from the backend, clears the
+// session values and ID, and expires the session cookie.
+func (s *backendStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if session.ID != "" {
+		if err := s.backend.deleteSession(r.Context(), session.ID); err != nil {
+			return err
+		}
+	}
+	session.ID = ""
+	session.Values = make(map[interface{}]interface{})
+	session.fieldDigests = nil
+	session.Options.MaxAge = -1
+	return setCookie(r, w, session.Name(), "", session.Options, &s.hooks)
+}
+
+// MaxAge sets the maximum age for the store and the underlying cookie
+// implementation. Individual sessions can be deleted by setting
+// Options.MaxAge = -1 for that session.
+func (s *backendStore) MaxAge(age int) {
+	s.Options.MaxAge = age
+	setCodecsMaxAge(s.Codecs, age)
+}
+
+// LimitDecoding restricts the size and shape of decoded sessions.
+//
+// See CookieStore.LimitDecoding().
+func (s *backendStore) LimitDecoding(limits DecodeLimits) {
+	setSerializer(s.Codecs, s.serializer, &limits)
+}
+
+// storeCookieHooks returns the hooks applied to the session cookies.
+func (s *backendStore) storeCookieHooks() *cookieHooks {
+	return &s.hooks
+}
+
+// encodeValues encodes session.Values for the backend.
+func (s *backendStore) encodeValues(session *Session) (string, error) {
+	return encodeMulti(session.Name(), session.Values, s.Codecs...)
+}
+
+// decodeValues decodes the values read from the backend into
+// session.Values.
+func (s *backendStore) decodeValues(session *Session, data string) error {
+	if err := decodeMulti(session.Name(), data, &session.Values,
+		s.Codecs...); err != nil {
+		return err
+	}
+	session.backendSize = len(data)
+	restoreOptions(session)
+	afterDecode(session)
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBackendStoreOptions(t *testing.T) {
+	opts := []StoreOption{
+		WithKeyPairs([]byte("some key")),
+		WithPath("/app"),
+		WithMaxAge(60),
+		WithFlashKey("_notices"),
+	}
+	for name, store := range map[string]Store{
+		"memory": NewMemoryStoreWithOptions(opts...),
+		"field": NewFieldStoreWithOptions(
+			&memFields{sessions: make(map[string]map[string][]byte)}, opts...),
+		"object": NewObjectStoreWithOptions(
+			&memBucket{objects: make(map[string][]byte)}, opts...),
+		"cassandra": NewCassandraStoreWithOptions(&memCQL{rows: make(map[string]string),
+			ttls: make(map[string]int)}, "sessions.s", opts...),
+		"cosmos": NewCosmosStoreWithOptions(
+			&memContainer{items: make(map[string][]byte)}, opts...),
+		"table": NewTableStoreWithOptions(
+			&memTable{entities: make(map[[2]string][]byte)}, opts...),
+	} {
+		if storeHooks(store) == nil {
+			t.Fatalf("%s: expected cookie hooks", name)
+		}
+		req, _ := http.NewRequest("GET", "http://www.example.com/app", nil)
+		session, err := store.New(req, "s")
+		if err != nil {
+			t.Fatalf("%s: failed to create session: %v", name, err)
+		}
+		session.AddFlash("saved")
+		w := httptest.NewRecorder()
+		if err = session.Save(req, w); err != nil {
+			t.Fatalf("%s: failed to save session: %v", name, err)
+		}
+		c := w.Result().Cookies()[0]
+		if c.Path != "/app" || c.MaxAge != 60 {
+			t.Fatalf("%s: bad cookie: %v", name, c)
+		}
+
+		req.AddCookie(c)
+		session, err = store.New(req, "s")
+		if err != nil || session.IsNew {
+			t.Fatalf("%s: failed to load session: %v", name, err)
+		}
+		if flashes := session.Values["_notices"]; flashes == nil {
+			t.Fatalf("%s: bad flashes: %v", name, session.Values)
+		}
+	}
+}
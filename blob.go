@@ -0,0 +1,106 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// ErrBlobsNotSupported is returned when attaching or opening a blob of a
+// session whose store doesn't implement BlobStore.
+var ErrBlobsNotSupported = errors.New("sessions: store does not support blobs")
+
+// Directory name prefix for the blobs of a session in FilesystemStore.
+const blobDirPrefix = "blob_"
+
+// BlobStore is implemented by server-side stores that can keep short-lived
+// blobs attached to a session, such as an uploaded file awaiting
+// confirmation. Blobs are deleted with the session, either when it is
+// deleted or when it expires and is garbage-collected.
+type BlobStore interface {
+	// AttachBlob stores the content of r under name for session,
+	// replacing any blob with the same name.
+	AttachBlob(session *Session, name string, r io.Reader) error
+	// OpenBlob opens a blob of session. If it doesn't exist the error
+	// satisfies errors.Is(err, fs.ErrNotExist).
+	OpenBlob(session *Session, name string) (io.ReadCloser, error)
+}
+
+// AttachBlob stores the content of r under name with this session.
+//
+// The store must implement BlobStore. The session must be saved for the
+// blob to be kept with it.
+func (s *Session) AttachBlob(name string, r io.Reader) error {
+	bs, ok := s.store.(BlobStore)
+	if !ok {
+		return ErrBlobsNotSupported
+	}
+	return bs.AttachBlob(s, name, r)
+}
+
+// OpenBlob opens a blob attached to this session. The caller must close it.
+func (s *Session) OpenBlob(name string) (io.ReadCloser, error) {
+	bs, ok := s.store.(BlobStore)
+	if !ok {
+		return nil, ErrBlobsNotSupported
+	}
+	return bs.OpenBlob(s, name)
+}
+
+// AttachBlob stores the content of r in a file next to the session file.
+// A new session is assigned its ID, which is kept when it is saved.
+//
+// See BlobStore.
+func (s *FilesystemStore) AttachBlob(session *Session, name string, r io.Reader) error {
+	if err := checkBlobName(name); err != nil {
+		return err
+	}
+	if session.ID == "" {
+		id, err := generateID(s.Entropy, 32)
+		if err != nil {
+			return err
+		}
+		session.ID = id
+	}
+	return s.fsys.WriteFile(path.Join(s.blobDir(session.ID), name), r)
+}
+
+// OpenBlob opens a blob attached to session.
+//
+// See BlobStore.
+func (s *FilesystemStore) OpenBlob(session *Session, name string) (io.ReadCloser, error) {
+	if err := checkBlobName(name); err != nil {
+		return nil, err
+	}
+	if session.ID == "" {
+		return nil, fmt.Errorf("sessions: open blob %q: %w", name, fs.ErrNotExist)
+	}
+	return s.fsys.Open(path.Join(s.blobDir(session.ID), name))
+}
+
+// blobDir returns the directory holding the blobs of a session ID, next to
+// its session file.
+func (s *FilesystemStore) blobDir(id string) string {
+	return path.Join(path.Dir(s.filename(id)), blobDirPrefix+fileID(id))
+}
+
+// removeBlobs deletes the blobs of a session ID.
+func (s *FilesystemStore) removeBlobs(id string) error {
+	return s.fsys.RemoveAll(s.blobDir(id))
+}
+
+// checkBlobName returns an error unless name can be used as a file name.
+func checkBlobName(name string) error {
+	if name == "" || name == "." || name == ".." ||
+		strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, tempFilePrefix) {
+		return fmt.Errorf("sessions: invalid blob name: %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readBlob returns the content of a blob of session.
+func readBlob(t *testing.T, session *Session, name string) string {
+	t.Helper()
+	f, err := session.OpenBlob(name)
+	if err != nil {
+		t.Fatal("failed to open blob", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal("failed to read blob", err)
+	}
+	return string(data)
+}
+
+func TestFilesystemStoreBlobs(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	store.Shard(1)
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, err := store.New(req, "upload")
+	if err != nil {
+		t.Fatal("failed to create session", err)
+	}
+	if err = session.AttachBlob("data.csv", strings.NewReader("a,b\n1,2\n")); err != nil {
+		t.Fatal("failed to attach blob", err)
+	}
+	id := session.ID
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if session.ID != id {
+		t.Fatalf("session ID changed on save: %s, %s", id, session.ID)
+	}
+	if got := readBlob(t, session, "data.csv"); got != "a,b\n1,2\n" {
+		t.Fatalf("bad blob: %q", got)
+	}
+	if _, err = session.OpenBlob("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+	for _, name := range []string{"", "..", "a/b", tempFilePrefix + "x"} {
+		if err = session.AttachBlob(name, strings.NewReader("x")); err == nil {
+			t.Fatalf("expected an error for blob name %q", name)
+		}
+	}
+
+	// Blob directories are not mistaken for sessions.
+	count := 0
+	if err = store.Walk("upload", func(*Session) error { count++; return nil }); err != nil || count != 1 {
+		t.Fatalf("bad walk: %d sessions, %v", count, err)
+	}
+
+	// Deleting the session deletes its blobs.
+	session.Options.MaxAge = -1
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+	if _, err = os.Stat(store.osPath(store.blobDir(id))); !os.IsNotExist(err) {
+		t.Fatalf("expected blobs to be deleted: %v", err)
+	}
+}
+
+func TestFilesystemStoreBlobsGC(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	store.MaxAge(60)
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "upload")
+	if err := session.AttachBlob("data.csv", strings.NewReader("x")); err != nil {
+		t.Fatal("failed to attach blob", err)
+	}
+	if err := session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	past := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(store.osPath(store.filename(session.ID)), past, past); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := store.GC(); err != nil || n != 1 {
+		t.Fatalf("bad GC: %d, %v", n, err)
+	}
+	if _, err := os.Stat(store.osPath(store.blobDir(session.ID))); !os.IsNotExist(err) {
+		t.Fatalf("expected blobs to be deleted: %v", err)
+	}
+}
+
+func TestCookieStoreBlobs(t *testing.T) {
+	store := NewCookieStore([]byte("some key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "upload")
+	if err := session.AttachBlob("data.csv", strings.NewReader("x")); err != ErrBlobsNotSupported {
+		t.Fatalf("expected ErrBlobsNotSupported, got %v", err)
+	}
+}
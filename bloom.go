@@ -0,0 +1,213 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrListNotSupported is returned by the ListIDs methods of stores whose
+// backend can't list sessions.
+var ErrListNotSupported = errors.New("sessions: backend can't list sessions")
+
+// IDLister lists the IDs of the sessions held by a store, to rebuild an
+// IDFilter. ObjectStore, CassandraStore and FieldStore implement it if
+// their backend can list sessions.
+type IDLister interface {
+	// ListIDs calls add with the ID of each session.
+	ListIDs(ctx context.Context, add func(id string)) error
+}
+
+// NewIDFilter returns an IDFilter sized for the expected number of
+// sessions with the given false positive rate, such as 0.01.
+func NewIDFilter(expected int, falsePositiveRate float64) *IDFilter {
+	if expected < 1 {
+		expected = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.01
+	}
+	m := math.Ceil(-float64(expected) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / float64(expected) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &IDFilter{words: (int(m) + 63) / 64, hashes: k}
+}
+
+// IDFilter is a bloom filter of known session IDs, used by server-side
+// stores as a negative cache: lookups of IDs the filter has never seen,
+// such as expired or deleted sessions, are answered without querying the
+// backend.
+//
+// A new filter knows nothing of the sessions already in the backend, so it
+// reports every ID as possibly present until it is first rebuilt, usually
+// with RebuildEvery at startup. It then has no false negatives for IDs
+// saved through the store using it, but deleted IDs stay in it until the
+// next rebuild.
+//
+// Instances sharing a backend only add their own saves to their filters,
+// so a miss is trusted only for session cookies issued before the last
+// rebuild started, less filterClockSkew to allow for clock differences
+// between instances and delayed writes. Sessions whose cookies are newer,
+// possibly saved by another instance, and cookies without a timestamp,
+// such as those of codecs other than securecookie, are looked up in the
+// backend, so the filter never logs users out.
+type IDFilter struct {
+	words  int
+	hashes int
+	mu     sync.Mutex // serializes Rebuild
+	// swap serializes Add, which adds to both bit sets during a rebuild,
+	// with the start and the end of rebuilds.
+	swap    sync.RWMutex
+	current atomic.Pointer[[]atomic.Uint64] // nil until the first rebuild
+	next    *[]atomic.Uint64
+	// rebuilt is the time the last successful rebuild started, in Unix
+	// nanoseconds.
+	rebuilt atomic.Int64
+}
+
+// filterClockSkew is the margin by which a session cookie must predate the
+// last rebuild of an IDFilter for a miss to be trusted.
+const filterClockSkew = time.Minute
+
+// Add adds id to the filter.
+func (f *IDFilter) Add(id string) {
+	f.swap.RLock()
+	defer f.swap.RUnlock()
+	if current := f.current.Load(); current != nil {
+		f.add(current, id)
+	}
+	if f.next != nil {
+		f.add(f.next, id)
+	}
+}
+
+// MayContain reports whether id may have been added to the filter. It
+// returns false only if id was never added since the last rebuild, and
+// true for all IDs until the filter is first rebuilt.
+//
+// Stores also look up sessions the filter doesn't contain if their cookie
+// is more recent than the last rebuild; see IDFilter.
+func (f *IDFilter) MayContain(id string) bool {
+	current := f.current.Load()
+	if current == nil {
+		return true
+	}
+	bits := *current
+	h1, h2 := idHashes(id)
+	n := uint64(len(bits)) * 64
+	for i := 0; i < f.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % n
+		if bits[bit/64].Load()&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Rebuild replaces the content of the filter with the IDs passed to add by
+// list, typically all the sessions in the backend, dropping deleted IDs.
+// IDs added concurrently are kept. If list returns an error the filter is
+// left unchanged.
+//
+// Rebuild is not run automatically; applications should call it
+// periodically, or use RebuildEvery.
+func (f *IDFilter) Rebuild(list func(add func(id string)) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	next := f.newBits()
+	start := time.Now()
+	f.swap.Lock()
+	f.next = next
+	f.swap.Unlock()
+	err := list(func(id string) { f.add(next, id) })
+	f.swap.Lock()
+	defer f.swap.Unlock()
+	f.next = nil
+	if err != nil {
+		return err
+	}
+	f.rebuilt.Store(start.UnixNano())
+	f.current.Store(next)
+	return nil
+}
+
+// mayHold reports whether the server-side data of session, whose cookie
+// was just decoded, may exist: its ID may be in the filter, or its cookie
+// is too recent, or has no timestamp, for the filter to know it.
+func (f *IDFilter) mayHold(session *Session) bool {
+	if session.issuedAt.IsZero() {
+		return true
+	}
+	trusted := time.Unix(0, f.rebuilt.Load()).Add(-filterClockSkew)
+	return !session.issuedAt.Before(trusted) || f.MayContain(session.ID)
+}
+
+// RebuildEvery rebuilds the filter with the IDs listed by lister, usually
+// the store using the filter, right away and then every interval until ctx
+// is done. It returns immediately, rebuilding in a new goroutine. Errors
+// are passed to onError, if not nil; the filter is then left unchanged
+// until the next rebuild.
+//
+//	store.Filter = sessions.NewIDFilter(1000000, 0.01)
+//	store.Filter.RebuildEvery(ctx, store, 10*time.Minute, func(err error) {
+//		log.Print(err)
+//	})
+func (f *IDFilter) RebuildEvery(ctx context.Context, lister IDLister,
+	interval time.Duration, onError func(error)) {
+	rebuild := func() {
+		err := f.Rebuild(func(add func(id string)) error {
+			return lister.ListIDs(ctx, add)
+		})
+		if err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			rebuild()
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// newBits returns an empty bit set.
+func (f *IDFilter) newBits() *[]atomic.Uint64 {
+	bits := make([]atomic.Uint64, f.words)
+	return &bits
+}
+
+// add sets the bits of id in bits.
+func (f *IDFilter) add(bits *[]atomic.Uint64, id string) {
+	h1, h2 := idHashes(id)
+	n := uint64(len(*bits)) * 64
+	for i := 0; i < f.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % n
+		(*bits)[bit/64].Or(1 << (bit % 64))
+	}
+}
+
+// idHashes returns the two hashes of id combined to derive the bit
+// positions.
+func idHashes(id string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	h1 := h.Sum64()
+	h.Write([]byte{0})
+	return h1, h.Sum64() | 1
+}
@@ -0,0 +1,222 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingBucket counts the objects read from a memBucket.
+type countingBucket struct {
+	*memBucket
+	gets int
+}
+
+func (b *countingBucket) Get(ctx context.Context, key string) ([]byte, error) {
+	b.gets++
+	return b.memBucket.Get(ctx, key)
+}
+
+func TestIDFilter(t *testing.T) {
+	f := NewIDFilter(1000, 0.01)
+	f.Add("id0")
+	if !f.MayContain("other") {
+		t.Fatal("expected the filter to pass all IDs through until rebuilt")
+	}
+	if err := f.Rebuild(func(add func(string)) error { return nil }); err != nil {
+		t.Fatal("failed to rebuild filter", err)
+	}
+	for i := 0; i < 1000; i++ {
+		f.Add(fmt.Sprint("id", i))
+	}
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		if !f.MayContain(fmt.Sprint("id", i)) {
+			t.Fatalf("expected id%d to be in the filter", i)
+		}
+		if f.MayContain(fmt.Sprint("other", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Fatalf("too many false positives: %d", falsePositives)
+	}
+
+	if err := f.Rebuild(func(add func(string)) error {
+		add("id0")
+		return nil
+	}); err != nil {
+		t.Fatal("failed to rebuild filter", err)
+	}
+	if !f.MayContain("id0") || f.MayContain("id1") {
+		t.Fatal("expected the filter to only contain id0")
+	}
+	if err := f.Rebuild(func(add func(string)) error {
+		return errors.New("listing failed")
+	}); err == nil || !f.MayContain("id0") {
+		t.Fatalf("expected the filter to be unchanged: %v", err)
+	}
+}
+
+func TestIDFilterConcurrentAdd(t *testing.T) {
+	f := NewIDFilter(10000, 0.01)
+	var saved atomic.Int64
+	// Rebuilds list the IDs saved before they started; the others must be
+	// kept by Add.
+	list := func(add func(string)) error {
+		for i := int64(0); i < saved.Load(); i++ {
+			add(fmt.Sprint("id", i))
+		}
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := int64(0); i < 10000; i++ {
+			saved.Store(i + 1)
+			f.Add(fmt.Sprint("id", i))
+			if !f.MayContain(fmt.Sprint("id", i)) {
+				t.Errorf("expected id%d to be in the filter", i)
+				return
+			}
+		}
+	}()
+	for rebuilding := true; rebuilding; {
+		select {
+		case <-done:
+			rebuilding = false
+		default:
+		}
+		if err := f.Rebuild(list); err != nil {
+			t.Fatal("failed to rebuild filter", err)
+		}
+	}
+}
+
+func TestStoreListIDs(t *testing.T) {
+	bucket := &memBucket{objects: make(map[string][]byte)}
+	db := &memCQL{rows: make(map[string]string), ttls: make(map[string]int)}
+	backend := &memFields{sessions: make(map[string]map[string][]byte)}
+	for _, tc := range []struct {
+		name  string
+		store interface {
+			Store
+			IDLister
+		}
+		unsupported IDLister
+	}{
+		{"object", NewObjectStore(bucket, []byte("some key")),
+			NewObjectStore(struct{ Bucket }{bucket})},
+		{"cassandra", NewCassandraStore(db, "sessions.s", []byte("some key")),
+			NewCassandraStore(struct{ CQLSession }{db}, "sessions.s")},
+		{"field", NewFieldStore(backend, []byte("some key")),
+			NewFieldStore(struct{ FieldBackend }{backend})},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			encodeCookie(t, tc.store, "s", "gopher")
+			var ids []string
+			err := tc.store.ListIDs(context.Background(), func(id string) {
+				ids = append(ids, id)
+			})
+			if err != nil || len(ids) != 1 || len(ids[0]) < 32 {
+				t.Fatalf("bad IDs: %q, %v", ids, err)
+			}
+			err = tc.unsupported.ListIDs(context.Background(), func(string) {})
+			if !errors.Is(err, ErrListNotSupported) {
+				t.Fatalf("expected ErrListNotSupported, got %v", err)
+			}
+		})
+	}
+}
+
+func TestObjectStoreFilter(t *testing.T) {
+	bucket := &countingBucket{memBucket: &memBucket{objects: make(map[string][]byte)}}
+	store := NewObjectStore(bucket, []byte("some key"))
+	cookie := encodeCookie(t, store, "s", "gopher")
+
+	// A new filter passes lookups through until it is rebuilt.
+	store.Filter = NewIDFilter(100, 0.01)
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+	if session, err := store.New(req, "s"); err != nil || session.IsNew {
+		t.Fatalf("bad session: %v, %v", session, err)
+	}
+	if bucket.gets != 1 {
+		t.Fatalf("expected 1 lookup, got %d", bucket.gets)
+	}
+
+	// Once rebuilt from the bucket, the filter knows the session.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store.Filter.RebuildEvery(ctx, store, time.Hour, func(err error) {
+		t.Error("failed to rebuild filter", err)
+	})
+	for deadline := time.Now().Add(5 * time.Second); store.Filter.MayContain("missing"); {
+		if time.Now().After(deadline) {
+			t.Fatal("filter was not rebuilt")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if session, err := store.New(req, "s"); err != nil || session.IsNew {
+		t.Fatalf("bad session: %v, %v", session, err)
+	}
+	if bucket.gets != 2 {
+		t.Fatalf("expected 2 lookups, got %d", bucket.gets)
+	}
+
+	// A valid cookie for a session unknown to the filter is still looked
+	// up while it is more recent than the last rebuild.
+	store.Filter = NewIDFilter(100, 0.01)
+	if err := store.Filter.Rebuild(func(add func(string)) error { return nil }); err != nil {
+		t.Fatal("failed to rebuild filter", err)
+	}
+	if session, err := store.New(req, "s"); err != nil || session.IsNew {
+		t.Fatalf("bad session: %v, %v", session, err)
+	}
+	if bucket.gets != 3 {
+		t.Fatalf("expected 3 lookups, got %d", bucket.gets)
+	}
+
+	// Once the cookie predates the rebuild, the miss is trusted.
+	store.Filter.rebuilt.Add(int64(2 * filterClockSkew))
+	session, err := store.New(req, "s")
+	if !errors.Is(err, ErrObjectNotFound) || !session.IsNew {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+	if bucket.gets != 3 {
+		t.Fatalf("expected the bucket not to be queried, got %d lookups", bucket.gets)
+	}
+}
+
+func TestObjectStoreFilterInstances(t *testing.T) {
+	// Two instances share a bucket, each with its own rebuilt filter.
+	bucket := &memBucket{objects: make(map[string][]byte)}
+	a := NewObjectStore(bucket, []byte("some key"))
+	b := NewObjectStore(bucket, []byte("some key"))
+	for _, store := range []*ObjectStore{a, b} {
+		store.Filter = NewIDFilter(100, 0.01)
+		err := store.Filter.Rebuild(func(add func(string)) error {
+			return store.ListIDs(context.Background(), add)
+		})
+		if err != nil {
+			t.Fatal("failed to rebuild filter", err)
+		}
+	}
+
+	// A session saved by b is found by a, whose filter doesn't know it.
+	cookie := encodeCookie(t, b, "s", "gopher")
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+	session, err := a.New(req, "s")
+	if err != nil || session.IsNew || session.Values["user"] != "gopher" {
+		t.Fatalf("bad session: %v, %v", session, err)
+	}
+}
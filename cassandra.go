@@ -0,0 +1,211 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrRowNotFound is returned by CQLSession.QueryRow when a query returns no
+// rows.
+var ErrRowNotFound = errors.New("sessions: row not found")
+
+// Consistency is a CQL consistency level. Values are those of the CQL
+// binary protocol, so they convert directly to the types of drivers such
+// as gocql.Consistency.
+type Consistency uint16
+
+// Consistency levels.
+const (
+	ConsistencyAny         Consistency = 0x00
+	ConsistencyOne         Consistency = 0x01
+	ConsistencyTwo         Consistency = 0x02
+	ConsistencyThree       Consistency = 0x03
+	ConsistencyQuorum      Consistency = 0x04
+	ConsistencyAll         Consistency = 0x05
+	ConsistencyLocalQuorum Consistency = 0x06
+	ConsistencyEachQuorum  Consistency = 0x07
+	ConsistencyLocalOne    Consistency = 0x0A
+)
+
+// CQLSession runs CQL statements against a Cassandra or ScyllaDB cluster.
+// It is used by CassandraStore and implemented by a thin adapter over a
+// driver, for example with gocql:
+//
+//	type gocqlSession struct{ s *gocql.Session }
+//
+//	func (g gocqlSession) Exec(ctx context.Context, c sessions.Consistency,
+//		stmt string, args ...interface{}) error {
+//		return g.s.Query(stmt, args...).WithContext(ctx).
+//			Consistency(gocql.Consistency(c)).Exec()
+//	}
+//
+//	func (g gocqlSession) QueryRow(ctx context.Context, c sessions.Consistency,
+//		stmt string, args []interface{}, dest ...interface{}) error {
+//		err := g.s.Query(stmt, args...).WithContext(ctx).
+//			Consistency(gocql.Consistency(c)).Scan(dest...)
+//		if err == gocql.ErrNotFound {
+//			return sessions.ErrRowNotFound
+//		}
+//		return err
+//	}
+//
+// For very high scale deployments, create the driver session with a
+// token-aware host selection policy, such as
+// gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy()), so queries are
+// routed to a replica of the session row.
+type CQLSession interface {
+	// Exec runs a statement that returns no rows.
+	Exec(ctx context.Context, c Consistency, stmt string, args ...interface{}) error
+	// QueryRow runs a query and scans the columns of the first row into
+	// dest, or returns an error wrapping ErrRowNotFound.
+	QueryRow(ctx context.Context, c Consistency, stmt string, args []interface{},
+		dest ...interface{}) error
+}
+
+// CQLIterator is implemented by CQLSessions that can run queries returning
+// several rows, so CassandraStore can list its sessions to rebuild an
+// IDFilter. With gocql:
+//
+//	func (g gocqlSession) Iter(ctx context.Context, c sessions.Consistency,
+//		stmt string, args, dest []interface{}, row func() error) error {
+//		iter := g.s.Query(stmt, args...).WithContext(ctx).
+//			Consistency(gocql.Consistency(c)).Iter()
+//		for iter.Scan(dest...) {
+//			if err := row(); err != nil {
+//				iter.Close()
+//				return err
+//			}
+//		}
+//		return iter.Close()
+//	}
+type CQLIterator interface {
+	// Iter runs a query, scanning the columns of each row into dest and
+	// then calling row.
+	Iter(ctx context.Context, c Consistency, stmt string, args, dest []interface{},
+		row func() error) error
+}
+
+// CassandraSchema returns the CQL statement creating the table used by
+// CassandraStore. table may be qualified with a keyspace.
+//
+// Rows expire with their TTL; time-window compaction keeps expired rows
+// from accumulating.
+func CassandraSchema(table string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id text PRIMARY KEY, data text) "+
+		"WITH compaction = {'class': 'TimeWindowCompactionStrategy'}", table)
+}
+
+// NewCassandraStore returns a new CassandraStore keeping sessions in table,
+// which is created with the statement returned by CassandraSchema.
+//
+// See NewCookieStore() for a description of the other parameters.
+func NewCassandraStore(session CQLSession, table string, keyPairs ...[]byte) *CassandraStore {
+	return NewCassandraStoreWithOptions(session, table, WithKeyPairs(keyPairs...))
+}
+
+// NewCassandraStoreWithOptions returns a new CassandraStore keeping
+// sessions in table, configured by opts.
+//
+// Options not set default to the values used by NewCassandraStore().
+func NewCassandraStoreWithOptions(session CQLSession, table string,
+	opts ...StoreOption) *CassandraStore {
+	cfg := newBackendConfig(opts)
+	s := &CassandraStore{
+		Session:          session,
+		Table:            table,
+		ReadConsistency:  ConsistencyLocalQuorum,
+		WriteConsistency: ConsistencyLocalQuorum,
+		Async:            cfg.async,
+	}
+	s.backendStore = newBackendStore(s, cfg)
+	return s
+}
+
+// CassandraStore stores sessions in a Cassandra or ScyllaDB table, one row
+// per session. Rows are written with a TTL of MaxAge, so the cluster
+// deletes expired sessions.
+//
+// Read and write consistency levels are tunable separately. The default,
+// ConsistencyLocalQuorum for both, makes a saved session visible to the
+// next request served from the same datacenter.
+type CassandraStore struct {
+	// backendStore provides Codecs, Options, Entropy, PersistOptions,
+	// FlashKey and the Store methods.
+	backendStore
+	Session          CQLSession
+	Table            string
+	ReadConsistency  Consistency
+	WriteConsistency Consistency
+	// Filter, if set, is a negative cache of the sessions in the table:
+	// sessions it doesn't contain are not looked up unless their cookie is
+	// more recent than its last rebuild. Saved sessions are added to it.
+	Filter *IDFilter
+	// Async, if set, writes and deletes rows in the background. See
+	// AsyncWriter.
+	Async *AsyncWriter
+}
+
+// saveSession writes the row of a session with a TTL of maxAge.
+func (s *CassandraStore) saveSession(ctx context.Context, session *Session, maxAge int) error {
+	encoded, err := s.encodeValues(session)
+	if err != nil {
+		return err
+	}
+	stmt := "INSERT INTO " + s.Table + " (id, data) VALUES (?, ?) USING TTL ?"
+	id, data := session.ID, encoded
+	err = s.Async.do(ctx, func(ctx context.Context) error {
+		return s.Session.Exec(ctx, s.WriteConsistency, stmt, id, data, maxAge)
+	})
+	if err != nil {
+		return err
+	}
+	session.backendSize = len(encoded)
+	if s.Filter != nil {
+		s.Filter.Add(session.ID)
+	}
+	return nil
+}
+
+// deleteSession deletes the row of a session.
+func (s *CassandraStore) deleteSession(ctx context.Context, id string) error {
+	stmt := "DELETE FROM " + s.Table + " WHERE id = ?"
+	return s.Async.do(ctx, func(ctx context.Context) error {
+		return s.Session.Exec(ctx, s.WriteConsistency, stmt, id)
+	})
+}
+
+// ListIDs calls add with the ID of each session in the table. It returns
+// ErrListNotSupported if the CQL session doesn't implement CQLIterator.
+func (s *CassandraStore) ListIDs(ctx context.Context, add func(id string)) error {
+	iter, ok := s.Session.(CQLIterator)
+	if !ok {
+		return ErrListNotSupported
+	}
+	var id string
+	return iter.Iter(ctx, s.ReadConsistency, "SELECT id FROM "+s.Table, nil,
+		[]interface{}{&id}, func() error {
+			add(id)
+			return nil
+		})
+}
+
+// loadSession reads the row of a session and decodes it into
+// session.Values.
+func (s *CassandraStore) loadSession(ctx context.Context, session *Session) error {
+	if s.Filter != nil && !s.Filter.mayHold(session) {
+		return ErrRowNotFound
+	}
+	var data string
+	stmt := "SELECT data FROM " + s.Table + " WHERE id = ?"
+	err := s.Session.QueryRow(ctx, s.ReadConsistency, stmt,
+		[]interface{}{session.ID}, &data)
+	if err != nil {
+		return err
+	}
+	return s.decodeValues(session, data)
+}
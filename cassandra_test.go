@@ -0,0 +1,103 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memCQL is a CQLSession understanding the statements of CassandraStore.
+type memCQL struct {
+	mu            sync.Mutex
+	rows          map[string]string
+	ttls          map[string]int
+	consistencies []Consistency
+}
+
+func (m *memCQL) Exec(ctx context.Context, c Consistency, stmt string, args ...interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.consistencies = append(m.consistencies, c)
+	id := args[0].(string)
+	switch {
+	case strings.HasPrefix(stmt, "INSERT INTO sessions.s "):
+		m.rows[id] = args[1].(string)
+		m.ttls[id] = args[2].(int)
+	case strings.HasPrefix(stmt, "DELETE FROM sessions.s "):
+		delete(m.rows, id)
+	default:
+		return fmt.Errorf("unexpected statement: %s", stmt)
+	}
+	return nil
+}
+
+func (m *memCQL) QueryRow(ctx context.Context, c Consistency, stmt string,
+	args []interface{}, dest ...interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.consistencies = append(m.consistencies, c)
+	data, ok := m.rows[args[0].(string)]
+	if !ok {
+		return ErrRowNotFound
+	}
+	*dest[0].(*string) = data
+	return nil
+}
+
+func (m *memCQL) Iter(ctx context.Context, c Consistency, stmt string,
+	args, dest []interface{}, row func() error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stmt != "SELECT id FROM sessions.s" {
+		return fmt.Errorf("unexpected statement: %s", stmt)
+	}
+	for id := range m.rows {
+		*dest[0].(*string) = id
+		if err := row(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestCassandraStore(t *testing.T) {
+	db := &memCQL{rows: make(map[string]string), ttls: make(map[string]int)}
+	store := NewCassandraStore(db, "sessions.s", []byte("some key"))
+	store.ReadConsistency = ConsistencyOne
+	cookie := encodeCookie(t, store, "s", "gopher")
+	for id := range db.rows {
+		if db.ttls[id] != 86400*30 {
+			t.Fatalf("bad TTL: %d", db.ttls[id])
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+	session, err := store.New(req, "s")
+	if err != nil || session.IsNew || session.Values["user"] != "gopher" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+	if want := []Consistency{ConsistencyLocalQuorum, ConsistencyOne}; fmt.Sprint(db.consistencies) != fmt.Sprint(want) {
+		t.Fatalf("bad consistency levels: got %v, want %v", db.consistencies, want)
+	}
+	if err = Destroy(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal("failed to destroy session", err)
+	}
+	if len(db.rows) != 0 {
+		t.Fatalf("expected no rows: %v", db.rows)
+	}
+	if session, err = store.New(req, "s"); err == nil || !session.IsNew {
+		t.Fatal("expected deleted session to fail to load")
+	}
+	if !strings.Contains(CassandraSchema("sessions.s"), "sessions.s (id text PRIMARY KEY, data text)") {
+		t.Fatalf("bad schema: %s", CassandraSchema("sessions.s"))
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+// ErrChannelMismatch is returned by ChannelBoundStore when a session is
+// presented over a different TLS channel than the one it is bound to.
+var ErrChannelMismatch = errors.New("sessions: session bound to another channel")
+
+// Session values key for the channel binding.
+const channelKey = "_channel"
+
+// ChannelBinding returns a value identifying the TLS channel of a request,
+// and false if the request has no such channel.
+type ChannelBinding func(r *http.Request) ([]byte, bool)
+
+// ClientCertBinding returns a ChannelBinding to the SHA-256 fingerprint of
+// the client certificate, for deployments using mutual TLS.
+func ClientCertBinding() ChannelBinding {
+	return func(r *http.Request) ([]byte, bool) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			return nil, false
+		}
+		sum := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+		return sum[:], true
+	}
+}
+
+// KeyingMaterialBinding returns a ChannelBinding to keying material
+// exported from the TLS connection with the given label (RFC 5705).
+//
+// The keying material is specific to a connection, so sessions end when
+// the client opens a new one. It suits short-lived, high-security sessions.
+func KeyingMaterialBinding(label string) ChannelBinding {
+	return func(r *http.Request) ([]byte, bool) {
+		if r.TLS == nil {
+			return nil, false
+		}
+		ekm, err := r.TLS.ExportKeyingMaterial(label, nil, 32)
+		if err != nil {
+			return nil, false
+		}
+		return ekm, true
+	}
+}
+
+// NewChannelBoundStore returns a ChannelBoundStore wrapping store.
+func NewChannelBoundStore(store Store, binding ChannelBinding) *ChannelBoundStore {
+	return &ChannelBoundStore{
+		Store:   store,
+		Binding: binding,
+	}
+}
+
+// ChannelBoundStore wraps a Store and binds sessions to the TLS channel
+// they are saved from, so a stolen cookie can't be replayed from another
+// channel. It is an opt-in mode for high-security applications, such as
+// internal admin tools using mutual TLS.
+//
+// Sessions are bound when saved over a channel. A bound session presented
+// without the same channel is returned as a new session along with
+// ErrChannelMismatch.
+type ChannelBoundStore struct {
+	Store   Store
+	Binding ChannelBinding
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *ChannelBoundStore) Get(r *http.Request, name string) (*Session, error) {
+	return GetRegistry(r).Get(s, name)
+}
+
+// Unwrap returns the wrapped store.
+func (s *ChannelBoundStore) Unwrap() Store {
+	return s.Store
+}
+
+// New returns a session for the given name without adding it to the
+// registry. If the session is bound to another channel, a new session is
+// returned with ErrChannelMismatch.
+func (s *ChannelBoundStore) New(r *http.Request, name string) (*Session, error) {
+	session, err := s.Store.New(r, name)
+	if session == nil {
+		return nil, err
+	}
+	session.store = s
+	if err != nil || session.IsNew {
+		return session, err
+	}
+	bound, ok := session.Values[channelKey].([]byte)
+	if !ok {
+		return session, nil
+	}
+	current, ok := s.Binding(r)
+	if !ok || subtle.ConstantTimeCompare(bound, current) != 1 {
+		session.ID = ""
+		session.Values = make(map[interface{}]interface{})
+		session.IsNew = true
+		return session, ErrChannelMismatch
+	}
+	return session, nil
+}
+
+// Save binds the session to the channel of the request, if any, and saves
+// it in the wrapped store.
+func (s *ChannelBoundStore) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if binding, ok := s.Binding(r); ok {
+		session.Values[channelKey] = binding
+	}
+	return s.Store.Save(r, w, session)
+}
+
+// Delete deletes the session from the wrapped store.
+func (s *ChannelBoundStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	return deleteSession(s.Store, r, w, session)
+}
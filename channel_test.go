@@ -0,0 +1,51 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// tlsRequest returns a request presenting a client certificate with the
+// given raw content, or no TLS connection if raw is empty.
+func tlsRequest(raw string, cookie *http.Cookie) *http.Request {
+	req, _ := http.NewRequest("GET", "https://www.example.com", nil)
+	if raw != "" {
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{{Raw: []byte(raw)}},
+		}
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestChannelBoundStore(t *testing.T) {
+	store := NewChannelBoundStore(NewCookieStore([]byte("some key")), ClientCertBinding())
+	req := tlsRequest("alice", nil)
+	w := httptest.NewRecorder()
+	session, _ := store.New(req, "s")
+	session.Values["user"] = "alice"
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	session, err := store.New(tlsRequest("alice", cookie), "s")
+	if err != nil || session.Values["user"] != "alice" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+	for _, raw := range []string{"mallory", ""} {
+		session, err = store.New(tlsRequest(raw, cookie), "s")
+		if err != ErrChannelMismatch || !session.IsNew || len(session.Values) != 0 {
+			t.Fatalf("%q: expected ErrChannelMismatch, got %v, %v", raw, session.Values, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"net/http"
+	"strings"
+)
+
+// Session values key for captured client hints.
+const hintsKey = "_hints"
+
+// DefaultHintHeaders are the request headers captured by CaptureHints when
+// none are given: the preferred languages and the user agent client hints.
+var DefaultHintHeaders = []string{
+	"Accept-Language",
+	"Sec-CH-UA",
+	"Sec-CH-UA-Platform",
+	"Sec-CH-UA-Mobile",
+}
+
+// CaptureHints records a compact hash of the given request headers in the
+// session, or of DefaultHintHeaders if none are given, replacing any hints
+// captured before. It is typically called after login.
+//
+// Only hashes are kept, so the session stays small and doesn't carry the
+// header values. Like other values, they are authenticated by the store, so
+// a client can't forge them.
+func (s *Session) CaptureHints(r *http.Request, headers ...string) {
+	if len(headers) == 0 {
+		headers = DefaultHintHeaders
+	}
+	hints := make(map[string]int64, len(headers))
+	for _, h := range headers {
+		hints[http.CanonicalHeaderKey(h)] = hintHash(r.Header.Values(h))
+	}
+	s.initValues()
+	s.Values[hintsKey] = hints
+}
+
+// HintDrift returns the fraction of the headers captured by CaptureHints
+// whose value differs in r, from 0 when all match to 1 when none do. It
+// returns 0 if no hints were captured.
+//
+// Browsers update their user agent and users change their languages, so
+// drift is a signal to combine with others, for example to require
+// re-authentication above a threshold, rather than proof of a stolen
+// session.
+func (s *Session) HintDrift(r *http.Request) float64 {
+	hints, _ := s.Values[hintsKey].(map[string]int64)
+	if len(hints) == 0 {
+		return 0
+	}
+	changed := 0
+	for h, sum := range hints {
+		if hintHash(r.Header.Values(h)) != sum {
+			changed++
+		}
+	}
+	return float64(changed) / float64(len(hints))
+}
+
+// hintHash returns a truncated SHA-256 hash of header values.
+func hintHash(values []string) int64 {
+	sum := sha256.Sum256([]byte(strings.Join(values, "\n")))
+	return int64(binary.BigEndian.Uint64(sum[:8]))
+}
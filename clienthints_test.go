@@ -0,0 +1,46 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientHints(t *testing.T) {
+	store := NewCookieStore([]byte("secret-key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.Header.Set("Accept-Language", "en-US")
+	req.Header.Set("Sec-CH-UA-Platform", `"macOS"`)
+	session, _ := store.New(req, "s")
+	if drift := session.HintDrift(req); drift != 0 {
+		t.Fatalf("expected no drift without hints, got %v", drift)
+	}
+	session.CaptureHints(req)
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.Header.Set("Accept-Language", "en-US")
+	req.Header.Set("Sec-CH-UA-Platform", `"macOS"`)
+	req.AddCookie(w.Result().Cookies()[0])
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to decode session", err)
+	}
+	if drift := session.HintDrift(req); drift != 0 {
+		t.Fatalf("expected no drift, got %v", drift)
+	}
+	req.Header.Set("Sec-CH-UA-Platform", `"Windows"`)
+	if drift := session.HintDrift(req); drift != 0.25 {
+		t.Fatalf("expected a drift of 0.25, got %v", drift)
+	}
+	if err := session.Set(hintsKey, nil); err != ErrReservedKey {
+		t.Fatalf("expected ErrReservedKey, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+)
+
+// Closer is implemented by stores doing work in the background, such as
+// queued writes, that must complete before the server exits.
+type Closer interface {
+	// Close waits for the pending work of the store to complete, or ctx
+	// to be done, and releases its background resources.
+	Close(ctx context.Context) error
+}
+
+// CloseStore closes store and the stores it wraps that implement Closer,
+// from the outermost, within the deadline of ctx. Call it on shutdown,
+// after the HTTP server stopped serving requests:
+//
+//	if err := srv.Shutdown(ctx); err != nil { ... }
+//	if err := sessions.CloseStore(ctx, store); err != nil { ... }
+//
+// All the layers are closed even if some fail; the errors are returned as
+// a MultiError.
+func CloseStore(ctx context.Context, store Store) error {
+	var errMulti MultiError
+	for ; store != nil; store = Unwrap(store) {
+		if c, ok := store.(Closer); ok {
+			if err := c.Close(ctx); err != nil {
+				errMulti = append(errMulti, err)
+			}
+		}
+	}
+	if errMulti != nil {
+		return errMulti
+	}
+	return nil
+}
+
+// Close applies the writes queued by Async, if set, and stops it. Saving
+// sessions afterwards fails with ErrAsyncClosed.
+func (s *FilesystemStore) Close(ctx context.Context) error {
+	if s.Async == nil {
+		return nil
+	}
+	return s.Async.Close(ctx)
+}
+
+// Close applies the writes queued by Async, if set, and stops it. Saving
+// sessions afterwards fails with ErrAsyncClosed.
+func (s *ObjectStore) Close(ctx context.Context) error {
+	if s.Async == nil {
+		return nil
+	}
+	return s.Async.Close(ctx)
+}
+
+// Close applies the writes queued by Async, if set, and stops it. Saving
+// sessions afterwards fails with ErrAsyncClosed. The CQL session is not
+// closed, since it is usually shared with the rest of the application.
+func (s *CassandraStore) Close(ctx context.Context) error {
+	if s.Async == nil {
+		return nil
+	}
+	return s.Async.Close(ctx)
+}
+
+// Close waits for the operations mirrored so far to complete, then closes
+// the candidate store with CloseStore. The primary store is closed by
+// CloseStore, which unwraps the ShadowStore.
+func (s *ShadowStore) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return CloseStore(ctx, s.Candidate)
+}
@@ -0,0 +1,63 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCloseStore(t *testing.T) {
+	bucket := &blockingBucket{
+		memBucket: &memBucket{objects: make(map[string][]byte)},
+		release:   make(chan struct{}),
+	}
+	base := NewObjectStore(bucket, []byte("some key"))
+	base.Async = NewAsyncWriter(8, nil)
+	store := Chain(base, Traced(NewStats()))
+	encodeCookie(t, store, "s", "gopher")
+
+	// The write is blocked, so the deadline is exceeded.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := CloseStore(ctx, store); !errors.Is(err.(MultiError)[0], context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+
+	close(bucket.release)
+	if err := CloseStore(context.Background(), store); err != nil {
+		t.Fatal("failed to close store", err)
+	}
+	if len(bucket.objects) != 1 {
+		t.Fatalf("expected the queued write to be applied, got %d objects", len(bucket.objects))
+	}
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	if err := session.Save(req, httptest.NewRecorder()); !errors.Is(err, ErrAsyncClosed) {
+		t.Fatalf("expected ErrAsyncClosed, got %v", err)
+	}
+}
+
+func TestCloseShadowStore(t *testing.T) {
+	primary := NewObjectStore(&memBucket{objects: make(map[string][]byte)}, []byte("some key"))
+	bucket := &memBucket{objects: make(map[string][]byte)}
+	candidate := NewObjectStore(bucket, []byte("some key"))
+	candidate.Async = NewAsyncWriter(8, nil)
+	store := NewShadowStore(primary, candidate, nil)
+	encodeCookie(t, store, "s", "gopher")
+
+	if err := CloseStore(context.Background(), store); err != nil {
+		t.Fatal("failed to close store", err)
+	}
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+	if len(bucket.objects) != 1 {
+		t.Fatalf("expected the mirrored write to be applied, got %d objects", len(bucket.objects))
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Command sessiongen generates a strongly-typed wrapper over *sessions.Session
+from a struct definition.
+
+Given a schema struct in the current package:
+
+	//go:generate go run github.com/gorilla/sessions/cmd/sessiongen -type AppSessionSchema
+
+	type AppSessionSchema struct {
+		UserID int64  `session:"user_id"`
+		Cart   []Item `session:"cart"`
+	}
+
+sessiongen writes a file declaring an AppSession type wrapping *sessions.Session
+with a getter, a setter and a deleter per field:
+
+	s := NewAppSession(session)
+	s.SetUserID(42)
+	id := s.UserID() // int64
+
+Values are stored in session.Values under the key given by the "session"
+struct tag, or the field name when there is no tag. Fields tagged with
+`session:"-"` are ignored. Field types that aren't predeclared are registered
+with encoding/gob in an init function, except interface types such as error
+or fmt.Stringer, whose values have their own concrete types to register.
+
+Flags:
+
+	-type    name of the schema struct (required)
+	-name    name of the generated wrapper; defaults to the schema name
+	         without its "Schema" suffix
+	-output  output file name; defaults to <name>_session.go in lower case
+*/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("sessiongen: ")
+	typeName := flag.String("type", "", "name of the schema struct")
+	name := flag.String("name", "", "name of the generated wrapper")
+	output := flag.String("output", "", "output file name")
+	flag.Parse()
+	if *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *name == "" {
+		*name = strings.TrimSuffix(*typeName, "Schema")
+	}
+	if *output == "" {
+		*output = strings.ToLower(*name) + "_session.go"
+	}
+
+	src, err := generateDir(".", *typeName, *name, *output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*output, src, 0600); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// field describes a schema field.
+type field struct {
+	Name     string
+	Key      string
+	Type     string
+	Register bool
+}
+
+// schema describes the code to generate.
+type schema struct {
+	Package string
+	Name    string
+	Imports []string
+	Fields  []field
+}
+
+// generateDir parses the Go files in dir, skipping tests and the output
+// file, and generates the wrapper for typeName.
+func generateDir(dir, typeName, name, output string) ([]byte, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, path := range paths {
+		base := filepath.Base(path)
+		if strings.HasSuffix(base, "_test.go") || base == filepath.Base(output) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return generate(fset, files, typeName, name)
+}
+
+// generate returns the formatted source of the wrapper for typeName.
+func generate(fset *token.FileSet, files []*ast.File, typeName, name string) ([]byte, error) {
+	if name == typeName {
+		return nil, fmt.Errorf("wrapper name %q must differ from the schema name", name)
+	}
+	info := typeInfo(fset, files)
+	for _, f := range files {
+		st := findStruct(f, typeName)
+		if st == nil {
+			continue
+		}
+		s := schema{Package: f.Name.Name, Name: name}
+		used := make(map[string]bool)
+		for _, fd := range st.Fields.List {
+			ast.Inspect(fd.Type, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok {
+					if x, ok := sel.X.(*ast.Ident); ok {
+						used[x.Name] = true
+					}
+				}
+				return true
+			})
+			var typ bytes.Buffer
+			if err := printer.Fprint(&typ, fset, fd.Type); err != nil {
+				return nil, err
+			}
+			for _, ident := range fd.Names {
+				key := ident.Name
+				if fd.Tag != nil {
+					tag, err := strconv.Unquote(fd.Tag.Value)
+					if err != nil {
+						return nil, err
+					}
+					if v, ok := reflect.StructTag(tag).Lookup("session"); ok {
+						key = v
+					}
+				}
+				if key == "-" {
+					continue
+				}
+				s.Fields = append(s.Fields, field{
+					Name:     ident.Name,
+					Key:      key,
+					Type:     typ.String(),
+					Register: needsRegister(info, fd.Type),
+				})
+			}
+		}
+		if len(s.Fields) == 0 {
+			return nil, fmt.Errorf("struct %s has no fields", typeName)
+		}
+		s.Imports = fileImports(f, used)
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, s); err != nil {
+			return nil, err
+		}
+		return format.Source(buf.Bytes())
+	}
+	return nil, fmt.Errorf("struct %s not found", typeName)
+}
+
+// findStruct returns the struct type declared as name in f, or nil.
+func findStruct(f *ast.File, name string) *ast.StructType {
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if ts.Name.Name != name {
+				continue
+			}
+			if st, ok := ts.Type.(*ast.StructType); ok {
+				return st
+			}
+		}
+	}
+	return nil
+}
+
+// fileImports returns the import specs of f for the package names in used.
+func fileImports(f *ast.File, used map[string]bool) []string {
+	var imports []string
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if !used[name] {
+			continue
+		}
+		if spec.Name != nil {
+			imports = append(imports, spec.Name.Name+" "+spec.Path.Value)
+		} else {
+			imports = append(imports, spec.Path.Value)
+		}
+	}
+	return imports
+}
+
+// typeInfo type-checks files to resolve the named types of the schema.
+// Errors are ignored since the package may not build before its wrapper is
+// generated; types that can't be resolved are left out of the result.
+func typeInfo(fset *token.FileSet, files []*ast.File) *types.Info {
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	if len(files) == 0 {
+		return info
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {},
+	}
+	conf.Check(files[0].Name.Name, fset, files, info)
+	return info
+}
+
+// needsRegister reports whether the field type expr must be registered with
+// encoding/gob. Interface types are never registered: *new(T) is nil for
+// them, and gob.Register panics on nil.
+func needsRegister(info *types.Info, expr ast.Expr) bool {
+	if t := info.TypeOf(expr); t != nil && types.IsInterface(t) {
+		return false
+	}
+	return !isPredeclared(expr)
+}
+
+// isPredeclared reports whether expr is built only from predeclared types,
+// which encoding/gob registers by itself. Interface types are included since
+// they can't be registered.
+func isPredeclared(expr ast.Expr) bool {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return predeclared[t.Name]
+	case *ast.InterfaceType:
+		return true
+	case *ast.ArrayType:
+		return isPredeclared(t.Elt)
+	case *ast.MapType:
+		return isPredeclared(t.Key) && isPredeclared(t.Value)
+	}
+	return false
+}
+
+var predeclared = map[string]bool{
+	"bool": true, "string": true, "byte": true, "rune": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"uintptr": true, "float32": true, "float64": true,
+	"complex64": true, "complex128": true, "any": true, "error": true,
+}
+
+var tmpl = template.Must(template.New("").Parse(`// Code generated by sessiongen; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Fields}}{{if .Register}}
+	"encoding/gob"
+{{- break}}{{end}}{{end}}
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+
+	"github.com/gorilla/sessions"
+)
+
+// {{.Name}} is a typed wrapper over *sessions.Session.
+type {{.Name}} struct {
+	*sessions.Session
+}
+
+// New{{.Name}} wraps s.
+func New{{.Name}}(s *sessions.Session) {{.Name}} {
+	return {{.Name}}{Session: s}
+}
+{{$name := .Name}}
+{{- range .Fields}}
+// {{.Name}} returns the {{printf "%q" .Key}} session value. It returns the zero
+// value if it is not set or has a different type.
+func (s {{$name}}) {{.Name}}() {{.Type}} {
+	v, _ := s.Values[{{printf "%q" .Key}}].({{.Type}})
+	return v
+}
+
+// Set{{.Name}} sets the {{printf "%q" .Key}} session value.
+func (s {{$name}}) Set{{.Name}}(v {{.Type}}) {
+	s.Values[{{printf "%q" .Key}}] = v
+}
+
+// Delete{{.Name}} removes the {{printf "%q" .Key}} session value.
+func (s {{$name}}) Delete{{.Name}}() {
+	delete(s.Values, {{printf "%q" .Key}})
+}
+{{end}}
+{{- range .Fields}}{{if .Register}}
+func init() {
+{{- range $.Fields}}{{if .Register}}
+	gob.Register(*new({{.Type}}))
+{{- end}}{{end}}
+}
+{{break}}{{end}}{{end}}`))
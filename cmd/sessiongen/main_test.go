@@ -0,0 +1,84 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const testSchema = `package app
+
+import (
+	"fmt"
+	"time"
+)
+
+type Item struct {
+	SKU string
+}
+
+type Notice interface {
+	Text() string
+}
+
+type AppSessionSchema struct {
+	UserID  int64 ` + "`session:\"user_id\"`" + `
+	Cart    []Item
+	Seen    time.Time
+	Scratch string ` + "`session:\"-\"`" + `
+	Err     error
+	Label   fmt.Stringer
+	Notice  Notice
+}
+`
+
+func TestGenerate(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "schema.go", testSchema, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := generate(fset, []*ast.File{f}, "AppSessionSchema", "AppSession")
+	if err != nil {
+		t.Fatal("failed to generate", err)
+	}
+	out := string(src)
+	for _, want := range []string{
+		"package app",
+		"\t\"time\"",
+		"type AppSession struct {\n\t*sessions.Session\n}",
+		"func (s AppSession) UserID() int64 {",
+		`v, _ := s.Values["user_id"].(int64)`,
+		"func (s AppSession) SetCart(v []Item) {",
+		"func (s AppSession) DeleteSeen() {",
+		"gob.Register(*new([]Item))",
+		"gob.Register(*new(time.Time))",
+		"func (s AppSession) Label() fmt.Stringer {",
+		"\t\"fmt\"",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{
+		"Scratch",
+		"gob.Register(*new(int64))",
+		"gob.Register(*new(error))",
+		"gob.Register(*new(fmt.Stringer))",
+		"gob.Register(*new(Notice))",
+	} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("generated code contains %q:\n%s", unwanted, out)
+		}
+	}
+
+	if _, err = generate(fset, []*ast.File{f}, "Missing", "AppSession"); err == nil {
+		t.Fatal("expected an error for a missing struct")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/securecookie"
+)
+
+// FormatVersion is the version of the encoding of session cookies and of
+// the session data of server-side stores. It is incremented when a release
+// encodes sessions in a way earlier releases can't decode, so applications
+// can detect the change before rolling back. Sessions encoded by earlier
+// releases are always decoded: frozen cookies of every format version are
+// kept in testdata/compat and checked by the tests.
+const FormatVersion = 1
+
+// encodeMulti encodes a value using a group of codecs, like
+// securecookie.EncodeMulti.
+//
+// Errors defined by this package and raised while serializing are
+// returned directly instead of being buried in a securecookie.MultiError.
+// Values that would lose data, or fail to serialize, are reported with
+// ErrUnserializable.
+func encodeMulti(name string, value interface{},
+	codecs ...securecookie.Codec) (string, error) {
+	if err := checkValues(value, false); err != nil {
+		return "", err
+	}
+	encoded, err := securecookie.EncodeMulti(name, value, codecs...)
+	if err != nil {
+		if cause := packageCause(err); cause != nil {
+			return "", cause
+		}
+		if cause := checkValues(value, true); cause != nil {
+			return "", cause
+		}
+	}
+	return encoded, err
+}
+
+// decodeMulti decodes a value using a group of codecs, like
+// securecookie.DecodeMulti.
+//
+// Errors defined by this package and raised while deserializing are
+// returned directly instead of being buried in a securecookie.MultiError.
+func decodeMulti(name, value string, dst interface{},
+	codecs ...securecookie.Codec) error {
+	err := securecookie.DecodeMulti(name, value, dst, codecs...)
+	if err == nil {
+		return nil
+	}
+	if cause := packageCause(err); cause != nil {
+		return cause
+	}
+	return err
+}
+
+// decodeMultiPrimary is like decodeMulti but also reports whether the value
+// was decoded by the first codec, which holds the current keys.
+func decodeMultiPrimary(name, value string, dst interface{},
+	codecs ...securecookie.Codec) (bool, error) {
+	if len(codecs) > 1 && decodeMulti(name, value, dst, codecs[0]) == nil {
+		return true, nil
+	}
+	err := decodeMulti(name, value, dst, codecs...)
+	return len(codecs) <= 1, err
+}
+
+// packageCause returns the first cause in err that wraps an error defined
+// by this package, or nil.
+func packageCause(err error) error {
+	var errs []error
+	if multi, ok := err.(securecookie.MultiError); ok {
+		errs = multi
+	} else {
+		errs = []error{err}
+	}
+	for _, e := range errs {
+		if c, ok := e.(interface{ Cause() error }); ok && c.Cause() != nil {
+			e = c.Cause()
+		}
+		if errors.Is(e, ErrDecodeLimitExceeded) || errors.Is(e, ErrUnregisteredType) ||
+			errors.Is(e, ErrUnsupportedValue) {
+			return e
+		}
+	}
+	return nil
+}
+
+// withoutMaxAge returns copies of the securecookie codecs that don't check
+// the timestamp of decoded values. Other codecs are returned as is.
+//
+// It is used for server-side data whose lifetime is tracked by the store.
+func withoutMaxAge(codecs []securecookie.Codec) []securecookie.Codec {
+	out := make([]securecookie.Codec, len(codecs))
+	for i, codec := range codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			cp := *sc
+			codec = cp.MaxAge(0)
+		}
+		out[i] = codec
+	}
+	return out
+}
+
+// cookieTimestamp returns the unverified timestamp embedded in a value
+// encoded by securecookie, possibly prefixed by a PassphraseCodec.
+func cookieTimestamp(value string) (int64, bool) {
+	if prefix, encoded, ok := strings.Cut(value, "."); ok && strings.HasPrefix(prefix, "p") {
+		value = encoded
+	}
+	b, err := base64.URLEncoding.DecodeString(value)
+	if err != nil {
+		return 0, false
+	}
+	i := bytes.IndexByte(b, '|')
+	if i < 0 {
+		return 0, false
+	}
+	t, err := strconv.ParseInt(string(b[:i]), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return t, true
+}
@@ -0,0 +1,209 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var updateCompat = flag.Bool("update-compat", false,
+	"add missing cases to the golden file of the current FormatVersion")
+
+// compatEntry is a frozen session in a golden file of testdata/compat.
+type compatEntry struct {
+	Cookie string `json:"cookie"`
+	// File is the session file of server-side stores.
+	File string `json:"file,omitempty"`
+}
+
+// compatCase builds the store decoding a frozen session. Cases must never
+// be removed or changed once their sessions are frozen: add new ones.
+type compatCase struct {
+	name  string
+	store func(dir string) Store
+}
+
+// newStore returns the store of the case with a MaxAge of 0, so frozen
+// sessions don't expire.
+func (c compatCase) newStore(dir string) Store {
+	store := c.store(dir)
+	store.(interface{ MaxAge(int) }).MaxAge(0)
+	return store
+}
+
+var (
+	compatHashKey  = []byte("compat-hash-key-0123456789abcdef")
+	compatBlockKey = []byte("compat-block-key-0123456789abcde")
+)
+
+var compatCases = []compatCase{
+	{"cookie-gob", func(string) Store {
+		return NewCookieStore(compatHashKey)
+	}},
+	{"cookie-gob-aes", func(string) Store {
+		return NewCookieStore(compatHashKey, compatBlockKey)
+	}},
+	{"cookie-typed-json", func(string) Store {
+		return NewCookieStoreWithOptions(WithKeyPairs(compatHashKey, compatBlockKey),
+			WithSerializer(TypedJSONEncoder{}))
+	}},
+	{"cookie-deterministic", func(string) Store {
+		return NewCookieStoreWithOptions(WithKeyPairs(compatHashKey, compatBlockKey),
+			WithDeterministicEncoding(0))
+	}},
+	{"cookie-paseto-local", func(string) Store {
+		return NewCookieStoreWithOptions(WithPASETO(NewPASETOLocalCodec(compatHashKey)))
+	}},
+	{"cookie-passphrase", func(string) Store {
+		return NewCookieStoreFromPassphrase(string(compatHashKey), "")
+	}},
+	{"cookie-passphrase-context", func(string) Store {
+		return NewCookieStoreFromPassphrase(string(compatHashKey), "compat")
+	}},
+	{"filesystem-gob-aes", func(dir string) Store {
+		return NewFilesystemStore(dir, compatHashKey, compatBlockKey)
+	}},
+}
+
+// compatValues are the values of the frozen sessions.
+func compatValues(session *Session) {
+	session.Values["user"] = "gopher"
+	session.Values["visits"] = 42
+	session.AddFlash("welcome")
+}
+
+// TestCompat checks that sessions frozen in the golden files of every
+// FormatVersion are still decoded.
+func TestCompat(t *testing.T) {
+	if *updateCompat {
+		updateCompatFile(t)
+	}
+	files, err := filepath.Glob(filepath.Join("testdata", "compat", "format*.json"))
+	if err != nil {
+		t.Fatal("failed to list golden files", err)
+	}
+	current := fmt.Sprintf("format%d.json", FormatVersion)
+	found := false
+	for _, file := range files {
+		found = found || filepath.Base(file) == current
+		entries := readCompatFile(t, file)
+		for _, c := range compatCases {
+			entry, ok := entries[c.name]
+			if !ok {
+				if filepath.Base(file) == current {
+					t.Errorf("%s: missing case %s, run go test -update-compat", file, c.name)
+				}
+				continue
+			}
+			checkCompatEntry(t, file, c, entry)
+			delete(entries, c.name)
+		}
+		for name := range entries {
+			t.Errorf("%s: case %s was removed", file, name)
+		}
+	}
+	if !found {
+		t.Fatalf("missing golden file %s, run go test -update-compat", current)
+	}
+}
+
+func checkCompatEntry(t *testing.T, file string, c compatCase, entry compatEntry) {
+	t.Helper()
+	dir := t.TempDir()
+	store := c.newStore(dir)
+	if fs, ok := store.(*FilesystemStore); ok {
+		var id string
+		if err := decodeMulti("s", entry.Cookie, &id, fs.Codecs...); err != nil {
+			t.Fatalf("%s: %s: failed to decode the session ID: %v", file, c.name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fs.filename(id)), []byte(entry.File), 0600); err != nil {
+			t.Fatal("failed to write session file", err)
+		}
+	}
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: entry.Cookie})
+	session, err := store.New(req, "s")
+	if err != nil || session.IsNew {
+		t.Fatalf("%s: %s: failed to decode session: %v", file, c.name, err)
+	}
+	want := NewSession(store, "s")
+	compatValues(want)
+	if !reflect.DeepEqual(session.Values, want.Values) {
+		t.Fatalf("%s: %s: bad values: got %v, want %v", file, c.name, session.Values, want.Values)
+	}
+}
+
+func readCompatFile(t *testing.T, file string) map[string]compatEntry {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal("failed to read golden file", err)
+	}
+	entries := make(map[string]compatEntry)
+	if err = json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("%s: %v", file, err)
+	}
+	return entries
+}
+
+// updateCompatFile adds the missing cases to the golden file of the
+// current FormatVersion. Existing entries are never rewritten.
+func updateCompatFile(t *testing.T) {
+	file := filepath.Join("testdata", "compat", fmt.Sprintf("format%d.json", FormatVersion))
+	entries := make(map[string]compatEntry)
+	if _, err := os.Stat(file); err == nil {
+		entries = readCompatFile(t, file)
+	}
+	for _, c := range compatCases {
+		if _, ok := entries[c.name]; ok {
+			continue
+		}
+		dir := t.TempDir()
+		store := c.store(dir)
+		if cs, ok := store.(*CookieStore); ok {
+			// Don't embed an expiration, as PASETO tokens do. Server-side
+			// stores delete sessions saved with a MaxAge of 0.
+			cs.MaxAge(0)
+		}
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		session, _ := store.New(req, "s")
+		compatValues(session)
+		w := httptest.NewRecorder()
+		if err := session.Save(req, w); err != nil {
+			t.Fatalf("%s: failed to save session: %v", c.name, err)
+		}
+		entry := compatEntry{Cookie: w.Result().Cookies()[0].Value}
+		if fs, ok := store.(*FilesystemStore); ok {
+			data, err := os.ReadFile(filepath.Join(dir, fs.filename(session.ID)))
+			if err != nil {
+				t.Fatal("failed to read session file", err)
+			}
+			entry.File = string(data)
+		}
+		entries[c.name] = entry
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "\t")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(entries); err != nil {
+		t.Fatal("failed to encode golden file", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal("failed to create golden file directory", err)
+	}
+	if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal("failed to write golden file", err)
+	}
+}
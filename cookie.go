@@ -4,7 +4,14 @@
 
 package sessions
 
-import "net/http"
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // newCookieFromOptions returns an http.Cookie with the options set.
 func newCookieFromOptions(name, value string, options *Options) *http.Cookie {
@@ -21,3 +28,267 @@ func newCookieFromOptions(name, value string, options *Options) *http.Cookie {
 	}
 
 }
+
+// setCookie adds a Set-Cookie header for a session cookie to w, or passes
+// the cookie to the writer of hooks if set. hooks are those of the store
+// and may be nil.
+//
+// The header is formatted by net/http unless options.Format is set. If the
+// session was already saved during the request, the previous header for
+// the same cookie is replaced, so a single header is sent. The domain is
+// derived from the request if options.DomainFunc is set, attributes are
+// relaxed for localhost if options.RelaxLocalhost is set, SameSite=None is
+// omitted for clients detected by the SameSite fallback hook, and the
+// cookie is suppressed or made session-only if the consent hook returns
+// false.
+func setCookie(r *http.Request, w http.ResponseWriter, name, value string,
+	options *Options, hooks *cookieHooks) error {
+	if hooks == nil {
+		hooks = &cookieHooks{}
+	}
+	capture, _ := requestContext(r).Value(cookieCaptureKey{}).(func(*http.Cookie))
+	if capture != nil {
+		// The request is synthetic, so no attribute is derived from it.
+		r = nil
+	}
+	if options.DomainFunc != nil && r != nil {
+		opts := *options
+		opts.Domain = options.DomainFunc(r)
+		options = &opts
+	}
+	if options.RelaxLocalhost {
+		options = options.Relaxed(r)
+	}
+	if options.SameSite == http.SameSiteNoneMode && hooks.sameSiteFallback != nil &&
+		r != nil && hooks.sameSiteFallback(r) {
+		opts := *options
+		opts.SameSite = http.SameSiteDefaultMode
+		options = &opts
+	}
+	if hooks.consent != nil && r != nil && options.maxAge(time.Now()) >= 0 &&
+		!hooks.consent(r) {
+		if hooks.withoutConsent == ConsentSuppress {
+			return nil
+		}
+		opts := *options
+		opts.MaxAge = 0
+		opts.Expires = time.Time{}
+		options = &opts
+	}
+	cookie := NewCookie(name, value, options)
+	if capture != nil {
+		capture(cookie)
+		return nil
+	}
+	if hooks.writer != nil {
+		return hooks.writer.WriteCookie(w, cookie)
+	}
+	var v string
+	if options.Format == nil {
+		v = cookie.String()
+	} else {
+		var err error
+		if v, err = FormatCookie(cookie, options.Format); err != nil {
+			return err
+		}
+	}
+	if v != "" {
+		replaceSetCookie(w.Header(), cookie, v)
+	}
+	return nil
+}
+
+// cookieCaptureKey is the request context key of the function receiving
+// the cookies set by savedCookie, in place of the response.
+type cookieCaptureKey struct{}
+
+// savedCookie saves session with store, capturing the cookies instead of
+// writing them, and returns the session cookie that was set.
+//
+// The session is encoded even if unchanged, and the state deciding whether
+// the next Save sets a cookie is kept, so calling savedCookie doesn't
+// prevent the next Save from sending the cookie.
+func savedCookie(store Store, session *Session) (*http.Cookie, error) {
+	var saved *http.Cookie
+	capture := func(c *http.Cookie) {
+		if c.Name == session.Name() {
+			saved = c
+		}
+	}
+	ctx := context.WithValue(context.Background(), cookieCaptureKey{}, capture)
+	r, err := http.NewRequestWithContext(ctx, "GET", "/", nil)
+	if err != nil {
+		return nil, err
+	}
+	digest, reissue := session.loadedDigest, session.needsReissue
+	session.loadedDigest = nil
+	err = store.Save(r, discardResponse{make(http.Header)}, session)
+	session.loadedDigest, session.needsReissue = digest, reissue
+	if err != nil {
+		return nil, err
+	}
+	if saved == nil {
+		return nil, http.ErrNoCookie
+	}
+	return saved, nil
+}
+
+// replaceSetCookie sets v as the Set-Cookie header for cookie, replacing
+// a header previously set for a cookie with the same name, path and
+// domain.
+func replaceSetCookie(h http.Header, cookie *http.Cookie, v string) {
+	headers := h["Set-Cookie"]
+	for i, header := range headers {
+		c, err := http.ParseSetCookie(header)
+		if err != nil {
+			continue
+		}
+		if c.Name == cookie.Name && c.Path == cookie.Path &&
+			strings.TrimPrefix(c.Domain, ".") == strings.TrimPrefix(cookie.Domain, ".") {
+			headers[i] = v
+			return
+		}
+	}
+	h.Add("Set-Cookie", v)
+}
+
+// Cookie attribute names accepted in CookieFormat.Order.
+const (
+	AttrPath        = "Path"
+	AttrDomain      = "Domain"
+	AttrExpires     = "Expires"
+	AttrMaxAge      = "Max-Age"
+	AttrHttpOnly    = "HttpOnly"
+	AttrSecure      = "Secure"
+	AttrSameSite    = "SameSite"
+	AttrPartitioned = "Partitioned"
+)
+
+// defaultAttrOrder is the attribute order used by net/http.
+var defaultAttrOrder = []string{
+	AttrPath, AttrDomain, AttrExpires, AttrMaxAge,
+	AttrHttpOnly, AttrSecure, AttrSameSite, AttrPartitioned,
+}
+
+// CookieFormat controls how Set-Cookie headers are written, bypassing the
+// net/http serialization, for intermediaries that are picky about the
+// attribute order or value quoting.
+//
+// Unlike net/http, which drops invalid attributes silently, cookies are
+// validated strictly against RFC 6265bis and invalid ones are rejected.
+type CookieFormat struct {
+	// Order lists attribute names in the order they are written. Attributes
+	// not listed are written afterwards in the net/http order.
+	Order []string
+	// Quote wraps the cookie value in double quotes.
+	Quote bool
+}
+
+// FormatCookie returns the Set-Cookie header value for c using format.
+func FormatCookie(c *http.Cookie, format *CookieFormat) (string, error) {
+	if !isCookieNameValid(c.Name) {
+		return "", fmt.Errorf("sessions: invalid cookie name %q", c.Name)
+	}
+	if strings.IndexFunc(c.Value, isNotCookieOctet) >= 0 {
+		return "", fmt.Errorf("sessions: invalid cookie value for %q", c.Name)
+	}
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	if format.Quote {
+		b.WriteByte('"')
+		b.WriteString(c.Value)
+		b.WriteByte('"')
+	} else {
+		b.WriteString(c.Value)
+	}
+
+	written := make(map[string]bool)
+	order := append(append([]string(nil), format.Order...), defaultAttrOrder...)
+	for _, attr := range order {
+		if written[attr] {
+			continue
+		}
+		written[attr] = true
+		v, ok, err := cookieAttr(c, attr)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			continue
+		}
+		b.WriteString("; ")
+		b.WriteString(v)
+	}
+	return b.String(), nil
+}
+
+// cookieAttr returns the formatted attribute of c, and false if the
+// attribute is not set.
+func cookieAttr(c *http.Cookie, attr string) (string, bool, error) {
+	switch attr {
+	case AttrPath:
+		if c.Path == "" {
+			return "", false, nil
+		}
+		if strings.IndexFunc(c.Path, isNotAttrValue) >= 0 {
+			return "", false, fmt.Errorf("sessions: invalid cookie path %q", c.Path)
+		}
+		return "Path=" + c.Path, true, nil
+	case AttrDomain:
+		if c.Domain == "" {
+			return "", false, nil
+		}
+		domain := strings.TrimPrefix(c.Domain, ".")
+		if domain == "" || strings.IndexFunc(domain, isNotDomainChar) >= 0 {
+			return "", false, fmt.Errorf("sessions: invalid cookie domain %q", c.Domain)
+		}
+		return "Domain=" + domain, true, nil
+	case AttrExpires:
+		if c.Expires.IsZero() || c.Expires.Year() < 1601 {
+			return "", false, nil
+		}
+		return "Expires=" + c.Expires.UTC().Format(http.TimeFormat), true, nil
+	case AttrMaxAge:
+		if c.MaxAge > 0 {
+			return "Max-Age=" + strconv.Itoa(c.MaxAge), true, nil
+		} else if c.MaxAge < 0 {
+			return "Max-Age=0", true, nil
+		}
+		return "", false, nil
+	case AttrHttpOnly:
+		return "HttpOnly", c.HttpOnly, nil
+	case AttrSecure:
+		return "Secure", c.Secure, nil
+	case AttrSameSite:
+		switch c.SameSite {
+		case http.SameSiteNoneMode:
+			return "SameSite=None", true, nil
+		case http.SameSiteLaxMode:
+			return "SameSite=Lax", true, nil
+		case http.SameSiteStrictMode:
+			return "SameSite=Strict", true, nil
+		}
+		return "", false, nil
+	case AttrPartitioned:
+		return "Partitioned", c.Partitioned, nil
+	}
+	return "", false, fmt.Errorf("sessions: unknown cookie attribute %q", attr)
+}
+
+// isNotCookieOctet reports whether r is not a cookie-octet as defined by
+// RFC 6265.
+func isNotCookieOctet(r rune) bool {
+	return r < 0x21 || r > 0x7e || r == '"' || r == ',' || r == ';' || r == '\\'
+}
+
+// isNotAttrValue reports whether r is not allowed in an attribute value.
+func isNotAttrValue(r rune) bool {
+	return r < 0x20 || r > 0x7e || r == ';'
+}
+
+// isNotDomainChar reports whether r is not allowed in a domain name.
+func isNotDomainChar(r rune) bool {
+	return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' ||
+		'0' <= r && r <= '9' || r == '-' || r == '.')
+}
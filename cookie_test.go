@@ -5,7 +5,12 @@
 package sessions
 
 import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Test for creating new http.Cookie from name, value and options
@@ -65,3 +70,259 @@ func TestNewCookieFromOptions(t *testing.T) {
 		}
 	}
 }
+
+func TestNewCookieExpiry(t *testing.T) {
+	// Far-future ages don't overflow.
+	cookie := NewCookie("s", "v", &Options{MaxAge: math.MaxInt})
+	if cookie.Expires.Before(time.Now().AddDate(100, 0, 0)) || !strings.Contains(cookie.String(), "Expires=") {
+		t.Fatalf("bad far-future cookie: %s", cookie.String())
+	}
+
+	expires := time.Now().Add(90 * 24 * time.Hour).Truncate(time.Second)
+	cookie = NewCookie("s", "v", &Options{MaxAge: 60, Expires: expires})
+	if !cookie.Expires.Equal(expires) || cookie.MaxAge < 90*24*3600-1 || cookie.MaxAge > 90*24*3600 {
+		t.Fatalf("bad cookie with Expires: %v, %d", cookie.Expires, cookie.MaxAge)
+	}
+
+	cookie = NewCookie("s", "v", &Options{MaxAge: 60, Expires: time.Now().Add(-time.Hour)})
+	if cookie.MaxAge >= 0 {
+		t.Fatalf("expected a deleted cookie, got Max-Age %d", cookie.MaxAge)
+	}
+}
+
+func TestDomainFunc(t *testing.T) {
+	store := NewCookieStoreWithOptions(WithKeyPairs([]byte("some key")),
+		WithDomain("example.com"),
+		WithDomainFunc(func(r *http.Request) string {
+			return strings.TrimPrefix(r.Host, "www.")
+		}))
+	for _, host := range []string{"www.example.com", "www.example.co.uk"} {
+		req, _ := http.NewRequest("GET", "http://"+host, nil)
+		w := httptest.NewRecorder()
+		session, _ := store.New(req, "s")
+		if err := session.Save(req, w); err != nil {
+			t.Fatal("failed to save session", err)
+		}
+		if got := w.Result().Cookies()[0].Domain; got != strings.TrimPrefix(host, "www.") {
+			t.Fatalf("bad domain for %s: %s", host, got)
+		}
+	}
+}
+
+func TestFormatCookie(t *testing.T) {
+	expires := time.Date(2030, time.January, 2, 3, 4, 5, 0, time.UTC)
+	cookie := &http.Cookie{
+		Name:     "session",
+		Value:    "abc123",
+		Path:     "/",
+		Domain:   ".example.com",
+		Expires:  expires,
+		MaxAge:   3600,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	tests := []struct {
+		format *CookieFormat
+		want   string
+	}{
+		// Same output as net/http.
+		{&CookieFormat{}, "session=abc123; Path=/; Domain=example.com; " +
+			"Expires=Wed, 02 Jan 2030 03:04:05 GMT; Max-Age=3600; HttpOnly; Secure; SameSite=Lax"},
+		// Proxies that only look at the first attributes for security flags.
+		{&CookieFormat{Order: []string{AttrSecure, AttrHttpOnly, AttrSameSite}},
+			"session=abc123; Secure; HttpOnly; SameSite=Lax; Path=/; Domain=example.com; " +
+				"Expires=Wed, 02 Jan 2030 03:04:05 GMT; Max-Age=3600"},
+		// Proxies that drop Expires when it comes before Max-Age.
+		{&CookieFormat{Order: []string{AttrMaxAge, AttrExpires}, Quote: true},
+			"session=\"abc123\"; Max-Age=3600; Expires=Wed, 02 Jan 2030 03:04:05 GMT; " +
+				"Path=/; Domain=example.com; HttpOnly; Secure; SameSite=Lax"},
+	}
+	for i, v := range tests {
+		got, err := FormatCookie(cookie, v.format)
+		if err != nil {
+			t.Fatalf("%v: failed to format cookie: %v", i+1, err)
+		}
+		if got != v.want {
+			t.Fatalf("%v: bad cookie:\ngot  %q\nwant %q", i+1, got, v.want)
+		}
+	}
+	if got, want := cookie.String(), tests[0].want; got != want {
+		t.Fatalf("net/http output changed:\ngot  %q\nwant %q", got, want)
+	}
+
+	invalid := []*http.Cookie{
+		{Name: "bad name", Value: "v"},
+		{Name: "n", Value: "a;b"},
+		{Name: "n", Value: "v", Path: "/a;b"},
+		{Name: "n", Value: "v", Domain: "exa mple.com"},
+	}
+	for i, c := range invalid {
+		if _, err := FormatCookie(c, &CookieFormat{}); err == nil {
+			t.Fatalf("%v: expected an error for %+v", i+1, c)
+		}
+	}
+	if _, err := FormatCookie(cookie, &CookieFormat{Order: []string{"Foo"}}); err == nil {
+		t.Fatal("expected an error for an unknown attribute")
+	}
+}
+
+func TestCookieStoreFormat(t *testing.T) {
+	store := NewCookieStoreWithOptions(
+		WithKeyPairs([]byte("secret-key")),
+		WithCookieFormat(&CookieFormat{Order: []string{AttrSameSite, AttrSecure}}),
+	)
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	session, _ := store.New(req, "s")
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if got := w.Header().Get("Set-Cookie"); !strings.Contains(got, "; SameSite=None; Secure; Path=/") {
+		t.Fatalf("bad Set-Cookie header: %q", got)
+	}
+}
+
+func TestSetCookieDeduplicates(t *testing.T) {
+	store := NewCookieStore([]byte("secret-key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	w.Header().Add("Set-Cookie", "other=1; Path=/")
+
+	session, _ := store.Get(req, "s")
+	session.Values["step"] = "middleware"
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	session.Values["step"] = "handler"
+	if err := Save(req, w); err != nil {
+		t.Fatal("failed to save sessions", err)
+	}
+	// A cookie with the same name but another path is kept.
+	other := NewSession(store, "s")
+	other.Options = &Options{Path: "/admin"}
+	if err := other.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+
+	headers := w.Header()["Set-Cookie"]
+	if len(headers) != 3 || headers[0] != "other=1; Path=/" {
+		t.Fatalf("bad Set-Cookie headers: %q", headers)
+	}
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.Header.Add("Cookie", headers[1])
+	session, err := store.New(req, "s")
+	if err != nil || session.Values["step"] != "handler" {
+		t.Fatalf("bad final session: %v, %v", session.Values, err)
+	}
+}
+
+func TestStoreCookie(t *testing.T) {
+	cs := NewCookieStore([]byte("secret-key"))
+	fs := NewFilesystemStore(t.TempDir(), []byte("secret-key"))
+	for _, store := range []interface {
+		Store
+		Cookie(*Session) (*http.Cookie, error)
+	}{cs, fs} {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		session, _ := store.New(req, "s")
+		session.Values["user"] = "gopher"
+		cookie, err := store.Cookie(session)
+		if err != nil {
+			t.Fatal("failed to create cookie", err)
+		}
+		if cookie.Name != "s" || cookie.Path != "/" || cookie.MaxAge != 86400*30 {
+			t.Fatalf("bad cookie: %v", cookie)
+		}
+		req.AddCookie(cookie)
+		if session, err = store.New(req, "s"); err != nil || session.Values["user"] != "gopher" {
+			t.Fatalf("bad session: %v, %v", session.Values, err)
+		}
+	}
+}
+
+func TestStoreCookieKeepsState(t *testing.T) {
+	store := NewCookieStoreWithOptions(WithKeyPairs([]byte("secret-key")), WithSkipUnchanged())
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	session.Values["user"] = "gopher"
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+
+	req.AddCookie(w.Result().Cookies()[0])
+	session, _ = store.New(req, "s")
+	// The cookie of an unchanged session is still returned.
+	if _, err := store.Cookie(session); err != nil {
+		t.Fatal("failed to create cookie", err)
+	}
+	if w = httptest.NewRecorder(); session.Save(req, w) != nil || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("expected the unchanged session to be skipped, got %v", w.Result().Cookies())
+	}
+	// Creating a cookie doesn't make the next Save skip a changed session.
+	session.Values["user"] = "gopher2"
+	if _, err := store.Cookie(session); err != nil {
+		t.Fatal("failed to create cookie", err)
+	}
+	if w = httptest.NewRecorder(); session.Save(req, w) != nil || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("expected the changed session to be saved, got %v", w.Result().Cookies())
+	}
+}
+
+func TestConsent(t *testing.T) {
+	consent := func(r *http.Request) bool { return r.Header.Get("Consent") == "yes" }
+	for _, tc := range []struct {
+		fallback ConsentFallback
+		consent  string
+		cookies  int
+		maxAge   int
+	}{
+		{ConsentSuppress, "yes", 1, 60},
+		{ConsentSuppress, "no", 0, 0},
+		{ConsentSessionOnly, "no", 1, 0},
+	} {
+		store := NewCookieStoreWithOptions(WithKeyPairs([]byte("secret-key")),
+			WithMaxAge(60), WithConsent(consent, tc.fallback))
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.Header.Set("Consent", tc.consent)
+		w := httptest.NewRecorder()
+		session, _ := store.New(req, "s")
+		if err := session.Save(req, w); err != nil {
+			t.Fatal("failed to save session", err)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != tc.cookies || (len(cookies) == 1 && cookies[0].MaxAge != tc.maxAge) {
+			t.Fatalf("bad cookies for %+v: %v", tc, cookies)
+		}
+
+		// Deleting a session doesn't need consent.
+		w = httptest.NewRecorder()
+		if err := Destroy(req, w, session); err != nil || len(w.Result().Cookies()) != 1 {
+			t.Fatalf("expected the cookie to be deleted: %v", err)
+		}
+	}
+}
+
+func TestCookieWriter(t *testing.T) {
+	var cookies []*http.Cookie
+	writer := CookieWriterFunc(func(w http.ResponseWriter, c *http.Cookie) error {
+		cookies = append(cookies, c)
+		return nil
+	})
+	store := NewCookieStoreWithOptions(WithKeyPairs([]byte("secret-key")),
+		WithCookieWriter(writer))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	session.Values["user"] = "gopher"
+	if err := session.Save(req, nil); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if len(cookies) != 1 || cookies[0].Name != "s" || cookies[0].Value == "" {
+		t.Fatalf("bad cookies: %v", cookies)
+	}
+	c, err := store.Cookie(session)
+	if err != nil || c.Name != "s" || len(cookies) != 1 {
+		t.Fatalf("bad cookie: %v, %v", c, err)
+	}
+}
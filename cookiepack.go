@@ -0,0 +1,96 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// CookiePacking evicts low-priority values from sessions whose cookie
+// would exceed the maximum length, so Save still succeeds, for values that
+// can be recomputed or are nice to have, such as cached preferences. Set
+// it as CookieStore.Packing.
+//
+// Only the keys listed in Priorities are evicted, lowest priority first;
+// keys with the same priority are evicted in the order of their formatted
+// names. Evicted values are removed from the session and passed to
+// OnEvict, which can report them or move them to a backing store. If the
+// cookie is still too long once every listed key is evicted, Save fails as
+// without packing and the session keeps its values.
+type CookiePacking struct {
+	// MaxLength is the budget of the encoded cookie. If 0, values are only
+	// evicted when the codecs fail because the cookie is too long, which
+	// is 4096 bytes by default for securecookie.
+	MaxLength int
+	// Priorities maps the evictable keys to their priority.
+	Priorities map[interface{}]int
+	// OnEvict, if set, is called with the evicted values before the cookie
+	// is written. If it returns an error, Save fails with it.
+	OnEvict func(r *http.Request, session *Session, evicted map[interface{}]interface{}) error
+}
+
+// pack calls encode, evicting values from session until the result fits.
+func (p *CookiePacking) pack(r *http.Request, session *Session,
+	encode func() (string, error)) (string, error) {
+	var evicted map[interface{}]interface{}
+	keys := p.evictable(session)
+	for {
+		encoded, err := encode()
+		if p.tooLong(encoded, err) && len(keys) > 0 {
+			if evicted == nil {
+				evicted = make(map[interface{}]interface{})
+			}
+			evicted[keys[0]] = session.Values[keys[0]]
+			delete(session.Values, keys[0])
+			keys = keys[1:]
+			continue
+		}
+		if err == nil && p.MaxLength > 0 && len(encoded) > p.MaxLength {
+			err = fmt.Errorf("sessions: encoded session is too long (%d)", len(encoded))
+		}
+		if err == nil && len(evicted) > 0 && p.OnEvict != nil {
+			err = p.OnEvict(r, session, evicted)
+		}
+		if err != nil {
+			// Keep the session as it was if it isn't saved.
+			for key, value := range evicted {
+				session.Values[key] = value
+			}
+		}
+		return encoded, err
+	}
+}
+
+// tooLong reports whether an encoding result exceeds the budget.
+func (p *CookiePacking) tooLong(encoded string, err error) bool {
+	if err != nil {
+		// The codecs of securecookie and this package don't export the
+		// error for values that are too long.
+		return strings.Contains(err.Error(), "too long")
+	}
+	return p.MaxLength > 0 && len(encoded) > p.MaxLength
+}
+
+// evictable returns the keys of session listed in Priorities, in eviction
+// order.
+func (p *CookiePacking) evictable(session *Session) []interface{} {
+	var keys []interface{}
+	for key := range p.Priorities {
+		if _, ok := session.Values[key]; ok && !session.isReserved(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := p.Priorities[keys[i]], p.Priorities[keys[j]]
+		if pi != pj {
+			return pi < pj
+		}
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
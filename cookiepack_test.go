@@ -0,0 +1,82 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCookiePacking(t *testing.T) {
+	var evicted map[interface{}]interface{}
+	store := NewCookieStoreWithOptions(WithKeyPairs([]byte("some key")),
+		WithCookiePacking(&CookiePacking{
+			Priorities: map[interface{}]int{"recent": 1, "theme": 2, "avatar": 1},
+			OnEvict: func(r *http.Request, s *Session, values map[interface{}]interface{}) error {
+				evicted = values
+				return nil
+			},
+		}))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	session.Values["user"] = "gopher"
+	session.Values["avatar"] = strings.Repeat("a", 2000)
+	session.Values["recent"] = strings.Repeat("r", 2000)
+	session.Values["theme"] = "dark"
+	if err := session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	// avatar and recent have the same priority and avatar sorts first.
+	if len(evicted) != 1 || evicted["avatar"] == nil {
+		t.Fatalf("expected avatar to be evicted, got %v", evicted)
+	}
+	if session.Values["avatar"] != nil || session.Values["recent"] == nil || session.Values["theme"] != "dark" {
+		t.Fatalf("bad session values: %v", session.Redacted())
+	}
+
+	// Unlisted keys are never evicted, and a failed save keeps the values.
+	session.Values["avatar"] = strings.Repeat("a", 2000)
+	session.Values["user"] = strings.Repeat("u", 4000)
+	evicted = nil
+	if err := session.Save(req, httptest.NewRecorder()); err == nil {
+		t.Fatal("expected save to fail")
+	}
+	if evicted != nil || session.Values["avatar"] == nil || session.Values["recent"] == nil {
+		t.Fatalf("expected the values to be kept, evicted %v", evicted)
+	}
+}
+
+func TestCookiePackingMaxLength(t *testing.T) {
+	failed := errors.New("backing store unavailable")
+	store := NewCookieStore([]byte("some key"))
+	store.Packing = &CookiePacking{
+		MaxLength:  200,
+		Priorities: map[interface{}]int{"cache": 0},
+		OnEvict: func(r *http.Request, s *Session, values map[interface{}]interface{}) error {
+			return failed
+		},
+	}
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	session.Values["cache"] = strings.Repeat("c", 200)
+	if err := session.Save(req, httptest.NewRecorder()); !errors.Is(err, failed) {
+		t.Fatalf("expected the OnEvict error, got %v", err)
+	}
+	if session.Values["cache"] == nil {
+		t.Fatal("expected the value to be restored")
+	}
+
+	store.Packing.OnEvict = nil
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if value := w.Result().Cookies()[0].Value; len(value) > 200 || session.Values["cache"] != nil {
+		t.Fatalf("expected the cookie to fit in 200 bytes, got %d", len(value))
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import "net/http"
+
+// CookiePolicy selects the cookie New decodes when a request carries
+// several cookies with the session name, for example a stale cookie set
+// on a parent domain. To try each cookie, use NewExact with a Matcher.
+type CookiePolicy int
+
+const (
+	// CookieFirst selects the first cookie of the request. This is the
+	// default.
+	CookieFirst CookiePolicy = iota
+	// CookieLast selects the last cookie of the request. Browsers send
+	// cookies with equal paths oldest first, so this is usually the most
+	// recently created one.
+	CookieLast
+	// CookieNewest selects the cookie with the most recent timestamp
+	// embedded by securecookie. The timestamp is not verified before the
+	// selection.
+	CookieNewest
+)
+
+// CookieLongestPath selects the cookie with the longest path. Browsers
+// send cookies with longer paths first, so it is the same as CookieFirst.
+const CookieLongestPath = CookieFirst
+
+// pickCookie returns the cookie selected by policy among cookies.
+func pickCookie(cookies []*http.Cookie, policy CookiePolicy) *http.Cookie {
+	if len(cookies) == 0 {
+		return nil
+	}
+	switch policy {
+	case CookieLast:
+		return cookies[len(cookies)-1]
+	case CookieNewest:
+		newest, newestTime := cookies[0], int64(-1)
+		for _, c := range cookies {
+			if t, ok := cookieTimestamp(c.Value); ok && t > newestTime {
+				newest, newestTime = c, t
+			}
+		}
+		return newest
+	}
+	return cookies[0]
+}
@@ -0,0 +1,140 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// ErrItemNotFound is returned by CosmosContainer.ReadItem when there is no
+// item with the given ID.
+var ErrItemNotFound = errors.New("sessions: item not found")
+
+// CosmosContainer is an Azure Cosmos DB container used by CosmosStore. It
+// is implemented by a thin adapter over the azcosmos package, for example:
+//
+//	type cosmosContainer struct{ c *azcosmos.ContainerClient }
+//
+//	func (a cosmosContainer) ReadItem(ctx context.Context, id string) ([]byte, error) {
+//		resp, err := a.c.ReadItem(ctx, azcosmos.NewPartitionKeyString(id), id, nil)
+//		var re *azcore.ResponseError
+//		if errors.As(err, &re) && re.StatusCode == http.StatusNotFound {
+//			return nil, sessions.ErrItemNotFound
+//		}
+//		return resp.Value, err
+//	}
+//
+//	func (a cosmosContainer) UpsertItem(ctx context.Context, id string, item []byte) error {
+//		_, err := a.c.UpsertItem(ctx, azcosmos.NewPartitionKeyString(id), item, nil)
+//		return err
+//	}
+//
+//	func (a cosmosContainer) DeleteItem(ctx context.Context, id string) error {
+//		_, err := a.c.DeleteItem(ctx, azcosmos.NewPartitionKeyString(id), id, nil)
+//		var re *azcore.ResponseError
+//		if errors.As(err, &re) && re.StatusCode == http.StatusNotFound {
+//			return nil
+//		}
+//		return err
+//	}
+//
+// This package doesn't depend on the Azure SDK: creating and authenticating
+// the container client is left to the application, for example with the
+// azidentity credential chain:
+//
+//	cred, err := azidentity.NewDefaultAzureCredential(nil)
+//	client, err := azcosmos.NewClient(endpoint, cred, nil)
+//	container, err := client.NewContainer("app", "sessions")
+type CosmosContainer interface {
+	// ReadItem returns the item with the given ID, or an error wrapping
+	// ErrItemNotFound.
+	ReadItem(ctx context.Context, id string) ([]byte, error)
+	// UpsertItem creates or replaces the item with the given ID.
+	UpsertItem(ctx context.Context, id string, item []byte) error
+	// DeleteItem deletes the item with the given ID. Deleting an item that
+	// doesn't exist is not an error.
+	DeleteItem(ctx context.Context, id string) error
+}
+
+// cosmosItem is the item of a session in a Cosmos DB container.
+type cosmosItem struct {
+	ID   string `json:"id"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl"`
+}
+
+// NewCosmosStore returns a new CosmosStore keeping sessions in container.
+//
+// See NewCookieStore() for a description of the other parameters.
+func NewCosmosStore(container CosmosContainer, keyPairs ...[]byte) *CosmosStore {
+	return NewCosmosStoreWithOptions(container, WithKeyPairs(keyPairs...))
+}
+
+// NewCosmosStoreWithOptions returns a new CosmosStore keeping sessions in
+// container, configured by opts.
+//
+// Options not set default to the values used by NewCosmosStore().
+func NewCosmosStoreWithOptions(container CosmosContainer, opts ...StoreOption) *CosmosStore {
+	s := &CosmosStore{Container: container}
+	s.backendStore = newBackendStore(s, newBackendConfig(opts))
+	return s
+}
+
+// CosmosStore stores sessions in an Azure Cosmos DB container, one item
+// per session. Items are written with a time to live of MaxAge, so Cosmos
+// DB deletes expired sessions.
+//
+// The container must be partitioned on /id and have time to live enabled,
+// with no default expiry (a default time to live of -1), so items expire
+// according to their own "ttl" property.
+type CosmosStore struct {
+	// backendStore provides Codecs, Options, Entropy, PersistOptions,
+	// FlashKey and the Store methods.
+	backendStore
+	Container CosmosContainer
+}
+
+// saveSession writes the item of a session with a time to live of maxAge.
+func (s *CosmosStore) saveSession(ctx context.Context, session *Session, maxAge int) error {
+	encoded, err := s.encodeValues(session)
+	if err != nil {
+		return err
+	}
+	ttl := maxAge
+	if ttl <= 0 {
+		// A ttl of -1 never expires the item.
+		ttl = -1
+	}
+	item, err := json.Marshal(cosmosItem{ID: session.ID, Data: encoded, TTL: ttl})
+	if err != nil {
+		return err
+	}
+	if err = s.Container.UpsertItem(ctx, session.ID, item); err != nil {
+		return err
+	}
+	session.backendSize = len(encoded)
+	return nil
+}
+
+// deleteSession deletes the item of a session.
+func (s *CosmosStore) deleteSession(ctx context.Context, id string) error {
+	return s.Container.DeleteItem(ctx, id)
+}
+
+// loadSession reads the item of a session and decodes it into
+// session.Values.
+func (s *CosmosStore) loadSession(ctx context.Context, session *Session) error {
+	data, err := s.Container.ReadItem(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+	var item cosmosItem
+	if err = json.Unmarshal(data, &item); err != nil {
+		return err
+	}
+	return s.decodeValues(session, item.Data)
+}
@@ -0,0 +1,85 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// memContainer is an in-memory CosmosContainer.
+type memContainer struct {
+	mu    sync.Mutex
+	items map[string][]byte
+}
+
+func (c *memContainer) ReadItem(ctx context.Context, id string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.items[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+	return item, nil
+}
+
+func (c *memContainer) UpsertItem(ctx context.Context, id string, item []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[id] = item
+	return nil
+}
+
+func (c *memContainer) DeleteItem(ctx context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, id)
+	return nil
+}
+
+func TestCosmosStore(t *testing.T) {
+	container := &memContainer{items: make(map[string][]byte)}
+	store := NewCosmosStore(container, []byte("some key"))
+	cookie := encodeCookie(t, store, "s", "gopher")
+	if len(container.items) != 1 {
+		t.Fatalf("bad items: %v", container.items)
+	}
+	for id, data := range container.items {
+		var item struct {
+			ID  string `json:"id"`
+			TTL int    `json:"ttl"`
+		}
+		if err := json.Unmarshal(data, &item); err != nil {
+			t.Fatal("failed to decode item", err)
+		}
+		if item.ID != id || item.TTL != 86400*30 {
+			t.Fatalf("bad item: %s", data)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+	session, err := store.Get(req, "s")
+	if err != nil || session.IsNew || session.Values["user"] != "gopher" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+
+	session.Options.MaxAge = -1
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+	if len(container.items) != 0 {
+		t.Fatalf("expected the item to be deleted: %v", container.items)
+	}
+	session, err = store.New(req, "s")
+	if err == nil || !session.IsNew {
+		t.Fatalf("expected a new session and an error: %v, %v", session.Values, err)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrCSRFTokenMismatch is returned by CSRFStore.Verify when a mutating
+// request doesn't carry the CSRF token of its session.
+var ErrCSRFTokenMismatch = errors.New("sessions: CSRF token mismatch")
+
+// Default names used by CSRFStore.
+const (
+	DefaultCSRFCookie = "XSRF-TOKEN"
+	DefaultCSRFHeader = "X-CSRF-Token"
+)
+
+// Session values key for the CSRF secret.
+const csrfKey = "_csrf"
+
+// NewCSRFStore returns a CSRFStore wrapping store, deriving tokens with
+// key.
+func NewCSRFStore(store Store, key []byte) *CSRFStore {
+	return &CSRFStore{
+		Store:      store,
+		Key:        key,
+		CookieName: DefaultCSRFCookie,
+		HeaderName: DefaultCSRFHeader,
+	}
+}
+
+// CSRFStore wraps a Store and implements the double-submit cookie pattern
+// for single-page applications: when a session is saved, a companion
+// cookie readable by scripts carries a token derived from the session, and
+// scripts send it back in a header with mutating requests, which handlers
+// check with Verify.
+//
+// The token is an HMAC of a random secret kept in the session values, so
+// it changes with the secret, which is created when the session is first
+// saved and replaced by RotateCSRF, for example after login. The companion
+// cookie has the attributes of the session cookie, except HttpOnly, and is
+// expired when the session is deleted.
+type CSRFStore struct {
+	Store Store
+	// Key authenticates tokens. It must be kept secret.
+	Key []byte
+	// CookieName is the name of the companion cookie.
+	CookieName string
+	// HeaderName is the request header carrying the token.
+	HeaderName string
+	// Entropy is the source of random bytes for secrets. If nil,
+	// crypto/rand is used.
+	Entropy io.Reader
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *CSRFStore) Get(r *http.Request, name string) (*Session, error) {
+	return GetRegistry(r).Get(s, name)
+}
+
+// Unwrap returns the wrapped store.
+func (s *CSRFStore) Unwrap() Store {
+	return s.Store
+}
+
+// New returns a session for the given name without adding it to the
+// registry.
+func (s *CSRFStore) New(r *http.Request, name string) (*Session, error) {
+	session, err := s.Store.New(r, name)
+	if session != nil {
+		session.store = s
+	}
+	return session, err
+}
+
+// Save creates the CSRF secret of the session if needed, saves the session
+// in the wrapped store, and sets the companion cookie.
+func (s *CSRFStore) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if session.Options.maxAge(time.Now()) < 0 {
+		return s.Delete(r, w, session)
+	}
+	if _, ok := session.Values[csrfKey].(string); !ok {
+		if err := s.RotateCSRF(session); err != nil {
+			return err
+		}
+	}
+	if err := s.Store.Save(r, w, session); err != nil {
+		return err
+	}
+	return setCookie(r, w, s.CookieName, s.Token(session), s.cookieOptions(session),
+		storeHooks(s.Store))
+}
+
+// Delete deletes the session from the wrapped store and expires the
+// companion cookie.
+func (s *CSRFStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if err := deleteSession(s.Store, r, w, session); err != nil {
+		return err
+	}
+	opts := s.cookieOptions(session)
+	opts.MaxAge = -1
+	return setCookie(r, w, s.CookieName, "", opts, storeHooks(s.Store))
+}
+
+// RotateCSRF replaces the CSRF secret of the session, invalidating its
+// previous token. The new token is sent when the session is saved.
+func (s *CSRFStore) RotateCSRF(session *Session) error {
+	secret, err := generateID(s.Entropy, 32)
+	if err != nil {
+		return err
+	}
+	session.initValues()
+	session.Values[csrfKey] = secret
+	return nil
+}
+
+// Token returns the CSRF token of the session, or "" if it has no secret
+// yet.
+func (s *CSRFStore) Token(session *Session) string {
+	secret, ok := session.Values[csrfKey].(string)
+	if !ok {
+		return ""
+	}
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(secret))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns ErrCSRFTokenMismatch if r is a mutating request (other
+// than GET, HEAD, OPTIONS and TRACE) whose header doesn't carry the token
+// of the session.
+func (s *CSRFStore) Verify(r *http.Request, session *Session) error {
+	if isSafeMethod(r.Method) {
+		return nil
+	}
+	token := s.Token(session)
+	got := r.Header.Get(s.HeaderName)
+	if token == "" || !hmac.Equal([]byte(got), []byte(token)) {
+		return ErrCSRFTokenMismatch
+	}
+	return nil
+}
+
+// cookieOptions returns the options of the companion cookie.
+func (s *CSRFStore) cookieOptions(session *Session) *Options {
+	opts := *session.Options
+	opts.HttpOnly = false
+	return &opts
+}
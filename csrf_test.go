@@ -0,0 +1,68 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRFStore(t *testing.T) {
+	store := NewCSRFStore(NewCookieStore([]byte("secret-key")), []byte("csrf-key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	var sessionCookie, tokenCookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		switch c.Name {
+		case "s":
+			sessionCookie = c
+		case DefaultCSRFCookie:
+			tokenCookie = c
+		}
+	}
+	if sessionCookie == nil || tokenCookie == nil || tokenCookie.HttpOnly ||
+		tokenCookie.Value != store.Token(session) {
+		t.Fatalf("bad cookies: %v", w.Result().Cookies())
+	}
+
+	post := func(token string) *http.Request {
+		req, _ := http.NewRequest("POST", "http://www.example.com", nil)
+		req.AddCookie(sessionCookie)
+		if token != "" {
+			req.Header.Set(DefaultCSRFHeader, token)
+		}
+		return req
+	}
+	req = post(tokenCookie.Value)
+	session, _ = store.New(req, "s")
+	if err := store.Verify(req, session); err != nil {
+		t.Fatal("expected the token to be accepted", err)
+	}
+	for _, token := range []string{"", "forged"} {
+		if err := store.Verify(post(token), session); err != ErrCSRFTokenMismatch {
+			t.Fatalf("expected ErrCSRFTokenMismatch for %q, got %v", token, err)
+		}
+	}
+
+	if err := store.RotateCSRF(session); err != nil {
+		t.Fatal("failed to rotate secret", err)
+	}
+	if err := store.Verify(req, session); err != ErrCSRFTokenMismatch {
+		t.Fatalf("expected the previous token to be rejected, got %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	if err := store.Delete(req, w, session); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 2 || cookies[1].MaxAge >= 0 {
+		t.Fatalf("expected both cookies to be expired: %v", cookies)
+	}
+}
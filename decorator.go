@@ -0,0 +1,116 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+// Decorator wraps a store to add behavior to it, such as tracing or
+// encryption. The returned store should implement Unwrapper.
+type Decorator func(Store) Store
+
+// Unwrapper is implemented by stores wrapping another store, such as
+// TracedStore and EncryptedStore.
+type Unwrapper interface {
+	// Unwrap returns the wrapped store.
+	Unwrap() Store
+}
+
+// Chain returns base wrapped by decorators, in order: the first decorator
+// wraps base and the last one is the outermost store. For example
+//
+//	store := sessions.Chain(base,
+//		sessions.Encrypted(key),
+//		sessions.Traced(stats),
+//	)
+//
+// is equivalent to NewTracedStore(NewEncryptedStore(base, key), stats):
+// values are encrypted before being passed to base, and tracing covers the
+// encryption.
+func Chain(base Store, decorators ...Decorator) Store {
+	store := base
+	for _, decorate := range decorators {
+		store = decorate(store)
+	}
+	return store
+}
+
+// Unwrap returns the store wrapped by store, or nil if it doesn't
+// implement Unwrapper.
+func Unwrap(store Store) Store {
+	if u, ok := store.(Unwrapper); ok {
+		return u.Unwrap()
+	}
+	return nil
+}
+
+// StoreAs finds the first store in the chain of store that has type T,
+// starting with store itself and following Unwrap. It is used to configure
+// a layer after building a chain:
+//
+//	if fs, ok := sessions.StoreAs[*sessions.FilesystemStore](store); ok {
+//		fs.MaxLength(8192)
+//	}
+func StoreAs[T any](store Store) (T, bool) {
+	for store != nil {
+		if t, ok := store.(T); ok {
+			return t, true
+		}
+		store = Unwrap(store)
+	}
+	var zero T
+	return zero, false
+}
+
+// Base returns the innermost store of the chain of store.
+func Base(store Store) Store {
+	for {
+		inner := Unwrap(store)
+		if inner == nil {
+			return store
+		}
+		store = inner
+	}
+}
+
+// Traced returns a Decorator wrapping stores with NewTracedStore.
+func Traced(tracer Tracer) Decorator {
+	return func(store Store) Store {
+		return NewTracedStore(store, tracer)
+	}
+}
+
+// Encrypted returns a Decorator wrapping stores with NewEncryptedStore.
+func Encrypted(keys ...EncryptionKey) Decorator {
+	return func(store Store) Store {
+		return NewEncryptedStore(store, keys...)
+	}
+}
+
+// ChannelBound returns a Decorator wrapping stores with
+// NewChannelBoundStore.
+func ChannelBound(binding ChannelBinding) Decorator {
+	return func(store Store) Store {
+		return NewChannelBoundStore(store, binding)
+	}
+}
+
+// CSRFProtected returns a Decorator wrapping stores with NewCSRFStore.
+func CSRFProtected(key []byte) Decorator {
+	return func(store Store) Store {
+		return NewCSRFStore(store, key)
+	}
+}
+
+// Versioned returns a Decorator wrapping stores with NewVersionStore.
+func Versioned() Decorator {
+	return func(store Store) Store {
+		return NewVersionStore(store)
+	}
+}
+
+// Tarpitted returns a Decorator wrapping stores with NewTarpitStore.
+func Tarpitted() Decorator {
+	return func(store Store) Store {
+		return NewTarpitStore(store)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	base := NewCookieStore([]byte("some key"))
+	stats := NewStats()
+	key := EncryptionKey{ID: 1, Secret: bytes.Repeat([]byte("a"), 32)}
+	store := Chain(base, Encrypted(key), Versioned(), Traced(stats))
+
+	traced, ok := store.(*TracedStore)
+	if !ok {
+		t.Fatalf("expected the last decorator to be outermost, got %T", store)
+	}
+	if _, ok := traced.Store.(*VersionStore); !ok {
+		t.Fatalf("unexpected wrapped store %T", traced.Store)
+	}
+	if enc, ok := StoreAs[*EncryptedStore](store); !ok || enc.Store != base {
+		t.Fatalf("expected to find the encrypted store wrapping base: %v", ok)
+	}
+	if _, ok := StoreAs[*FilesystemStore](store); ok {
+		t.Fatal("found a store not in the chain")
+	}
+	if got := Base(store); got != base {
+		t.Fatalf("bad base store: %T", got)
+	}
+	if got := Unwrap(base); got != nil {
+		t.Fatalf("expected nil, got %T", got)
+	}
+
+	value := encodeCookie(t, store, "s", "gopher")
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: value})
+	session, err := store.New(req, "s")
+	if err != nil || session.Values["user"] != "gopher" {
+		t.Fatalf("failed to load session through the chain: %v %v", session.Values, err)
+	}
+	if snap := stats.Snapshot(); snap.Saves != 1 || snap.Loads != 1 {
+		t.Fatalf("unexpected stats: %+v", snap)
+	}
+}
+
+func TestValidateUnwrapsDecorators(t *testing.T) {
+	base := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	base.MaxLength(64)
+	store := Chain(base, Versioned())
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to create session", err)
+	}
+	session.Values["data"] = strings.Repeat("x", 128)
+	if err = session.Validate(); err == nil {
+		t.Fatal("expected the filesystem store to reject the session")
+	}
+	if err = session.Save(req, httptest.NewRecorder()); err == nil {
+		t.Fatal("expected save to fail")
+	}
+}
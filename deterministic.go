@@ -0,0 +1,176 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// errTimestampExpired is returned by DeterministicCodec.Decode for values
+// older than MaxAge.
+var errTimestampExpired = errors.New("sessions: expired timestamp")
+
+// NewDeterministicCodec returns a DeterministicCodec authenticating values
+// with hashKey and, if blockKey is not nil, encrypting them with AES-GCM.
+// The block key must be 16, 24 or 32 bytes. Timestamps are rounded down to
+// window; see DeterministicCodec.
+//
+// Like securecookie.New, it doesn't fail: an invalid key is reported by
+// Encode and Decode.
+func NewDeterministicCodec(hashKey, blockKey []byte, window time.Duration) *DeterministicCodec {
+	c := &DeterministicCodec{
+		hashKey:   hashKey,
+		window:    window,
+		maxAge:    86400 * 30,
+		maxLength: 4096,
+		sz:        TypedJSONEncoder{},
+	}
+	if blockKey != nil {
+		c.aead, c.err = newGCM(blockKey)
+		mac := hmac.New(sha256.New, blockKey)
+		mac.Write([]byte("sessions: deterministic nonce"))
+		c.nonceKey = mac.Sum(nil)
+	}
+	if len(hashKey) == 0 {
+		c.err = errors.New("sessions: hash key is not set")
+	}
+	return c
+}
+
+// DeterministicCodec is a securecookie.Codec producing the same output for
+// the same name and value within a time window, so unchanged sessions keep
+// identical cookie bytes, for CDN caching keyed on cookies and cheap change
+// detection.
+//
+// Values are serialized with TypedJSONEncoder, which sorts map entries.
+// The timestamp embedded like securecookie's is rounded down to window,
+// so sessions expire up to one window earlier than MaxAge; with a zero
+// window, no timestamp is embedded and only the Max-Age of the cookie,
+// which clients may ignore, bounds its lifetime. Encryption uses a nonce
+// derived from the content, which reveals whether two encrypted values are
+// equal but nothing else.
+type DeterministicCodec struct {
+	hashKey   []byte
+	nonceKey  []byte
+	aead      cipher.AEAD
+	window    time.Duration
+	maxAge    int
+	maxLength int
+	sz        securecookie.Serializer
+	err       error
+}
+
+// MaxAge sets the maximum age of values in seconds. A value of 0 disables
+// the check.
+func (c *DeterministicCodec) MaxAge(age int) *DeterministicCodec {
+	c.maxAge = age
+	return c
+}
+
+// MaxLength sets the maximum length of encoded values. A value of 0
+// disables the check. The default is 4096.
+func (c *DeterministicCodec) MaxLength(l int) *DeterministicCodec {
+	c.maxLength = l
+	return c
+}
+
+// SetSerializer sets the serializer of values. It must produce the same
+// output for equal values for encoding to stay deterministic, which
+// securecookie.GobEncoder doesn't do for maps.
+func (c *DeterministicCodec) SetSerializer(sz securecookie.Serializer) *DeterministicCodec {
+	c.sz = sz
+	return c
+}
+
+// Encode encodes value under name.
+func (c *DeterministicCodec) Encode(name string, value interface{}) (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	b, err := c.sz.Serialize(value)
+	if err != nil {
+		return "", err
+	}
+	if c.aead != nil {
+		mac := hmac.New(sha256.New, c.nonceKey)
+		mac.Write([]byte(name))
+		mac.Write([]byte{0})
+		mac.Write(b)
+		nonce := mac.Sum(nil)[:c.aead.NonceSize()]
+		b = c.aead.Seal(nonce, nonce, b, []byte(name))
+	}
+	var ts int64
+	if c.window > 0 {
+		ts = time.Now().Truncate(c.window).Unix()
+	}
+	b = []byte(fmt.Sprintf("%d|%s|", ts, base64.URLEncoding.EncodeToString(b)))
+	sum := c.mac(name, b[:len(b)-1])
+	encoded := base64.URLEncoding.EncodeToString(append(b, sum...))
+	if c.maxLength != 0 && len(encoded) > c.maxLength {
+		return "", fmt.Errorf("sessions: encoded value is too long (%d)", len(encoded))
+	}
+	return encoded, nil
+}
+
+// Decode decodes value, encoded under name, into dst.
+func (c *DeterministicCodec) Decode(name, value string, dst interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.maxLength != 0 && len(value) > c.maxLength {
+		return fmt.Errorf("sessions: value is too long (%d)", len(value))
+	}
+	b, err := base64.URLEncoding.DecodeString(value)
+	if err != nil {
+		return err
+	}
+	parts := bytes.SplitN(b, []byte("|"), 3)
+	if len(parts) != 3 {
+		return securecookie.ErrMacInvalid
+	}
+	signed := b[:len(parts[0])+len(parts[1])+1]
+	if !hmac.Equal(parts[2], c.mac(name, signed)) {
+		return securecookie.ErrMacInvalid
+	}
+	ts, err := strconv.ParseInt(string(parts[0]), 10, 64)
+	if err != nil {
+		return err
+	}
+	if c.window > 0 && c.maxAge > 0 && time.Now().Unix()-ts > int64(c.maxAge) {
+		return errTimestampExpired
+	}
+	if b, err = base64.URLEncoding.DecodeString(string(parts[1])); err != nil {
+		return err
+	}
+	if c.aead != nil {
+		n := c.aead.NonceSize()
+		if len(b) < n {
+			return errors.New("sessions: the value could not be decrypted")
+		}
+		if b, err = c.aead.Open(nil, b[:n], b[n:], []byte(name)); err != nil {
+			return errors.New("sessions: the value could not be decrypted")
+		}
+	}
+	return c.sz.Deserialize(b, dst)
+}
+
+// mac returns the HMAC of name and b.
+func (c *DeterministicCodec) mac(name string, b []byte) []byte {
+	mac := hmac.New(sha256.New, c.hashKey)
+	mac.Write([]byte(name))
+	mac.Write([]byte{'|'})
+	mac.Write(b)
+	return mac.Sum(nil)
+}
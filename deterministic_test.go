@@ -0,0 +1,87 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestDeterministicEncoding(t *testing.T) {
+	store := NewCookieStoreWithOptions(
+		WithKeyPairs([]byte("some key"), []byte("0123456789abcdef")),
+		WithDeterministicEncoding(time.Hour))
+
+	encode := func(keys ...string) string {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		w := httptest.NewRecorder()
+		session, _ := store.New(req, "s")
+		for _, k := range keys {
+			session.Values[k] = "value of " + k
+		}
+		if err := session.Save(req, w); err != nil {
+			t.Fatal("failed to save session", err)
+		}
+		return w.Result().Cookies()[0].Value
+	}
+	a := encode("a", "b", "c", "d", "e")
+	if b := encode("e", "d", "c", "b", "a"); a != b {
+		t.Fatalf("expected identical cookies, got %q and %q", a, b)
+	}
+	if c := encode("a", "b", "c", "d"); a == c {
+		t.Fatal("expected different values to have different cookies")
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: a})
+	session, err := store.New(req, "s")
+	if err != nil || session.Values["c"] != "value of c" {
+		t.Fatalf("failed to decode session: %v, %v", session.Values, err)
+	}
+	if issued := session.IssuedAt(); !issued.Equal(time.Now().Truncate(time.Hour)) {
+		t.Fatalf("expected the issue time to be rounded to the window, got %v", issued)
+	}
+	if bytes.Contains([]byte(a), []byte("value")) {
+		t.Fatal("expected the values to be encrypted")
+	}
+
+	tampered := []byte(a)
+	tampered[10] ^= 1
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: string(tampered)})
+	if _, err = store.New(req, "s"); err == nil {
+		t.Fatal("expected tampered cookies to be rejected")
+	}
+}
+
+func TestDeterministicCodec(t *testing.T) {
+	codec := NewDeterministicCodec([]byte("some key"), nil, 0)
+	values := map[interface{}]interface{}{}
+	for i := 0; i < 20; i++ {
+		values[fmt.Sprint(i)] = i
+	}
+	first, err := codec.Encode("s", values)
+	if err != nil {
+		t.Fatal("failed to encode", err)
+	}
+	for i := 0; i < 10; i++ {
+		if again, _ := codec.Encode("s", values); again != first {
+			t.Fatal("expected identical encodings")
+		}
+	}
+	if err = codec.Decode("other", first, new(map[interface{}]interface{})); err != securecookie.ErrMacInvalid {
+		t.Fatalf("expected ErrMacInvalid for another name, got %v", err)
+	}
+	if _, err = NewDeterministicCodec(nil, nil, 0).Encode("s", values); err == nil {
+		t.Fatal("expected an error without a hash key")
+	}
+}
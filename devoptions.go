@@ -0,0 +1,77 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ProdOptions returns options suited to production: cookies are sent over
+// HTTPS only, hidden from scripts and not sent on cross-site subrequests.
+func ProdOptions() *Options {
+	return &Options{
+		Path:     "/",
+		MaxAge:   86400 * 30,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// DevOptions returns ProdOptions with RelaxLocalhost set, so the same
+// configuration works on a development machine serving plain HTTP on
+// localhost, where browsers drop Secure cookies.
+func DevOptions() *Options {
+	o := ProdOptions()
+	o.RelaxLocalhost = true
+	return o
+}
+
+// Relaxed returns the options to use for a response to r: if r is a plain
+// HTTP request to localhost or a loopback address, a copy without the
+// Secure and Partitioned attributes, and with SameSite=None downgraded to
+// Lax, which requires Secure; otherwise o itself.
+//
+// The Host header is set by the client, so r.RemoteAddr must be a loopback
+// address too. Behind a reverse proxy running on the same machine, every
+// request comes from a loopback address: don't set RelaxLocalhost there.
+func (o *Options) Relaxed(r *http.Request) *Options {
+	if r == nil || r.TLS != nil || !isLocalhost(r.Host) || !isLoopback(r.RemoteAddr) {
+		return o
+	}
+	opts := *o
+	opts.Secure = false
+	opts.Partitioned = false
+	if opts.SameSite == http.SameSiteNoneMode {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	return &opts
+}
+
+// isLocalhost reports whether host, with an optional port, names the local
+// machine.
+func isLocalhost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLoopback reports whether addr, an IP address with an optional port, is
+// a loopback address.
+func isLoopback(addr string) bool {
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		addr = h
+	}
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,69 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"encoding/gob"
+	"time"
+)
+
+// Session values key for elevation markers.
+const elevationKey = "_elevated"
+
+func init() {
+	gob.Register(map[string]int64{})
+}
+
+// Elevate marks the session as elevated for scope during ttl, for example
+// after the user re-authenticated to access billing settings.
+//
+// Markers are stored in the session values, so they are authenticated like
+// any other value, and carry their expiry time: IsElevated reports false
+// once it has passed, and expired markers are dropped when the session is
+// decoded by the built-in stores.
+func (s *Session) Elevate(scope string, ttl time.Duration) {
+	markers, _ := s.Values[elevationKey].(map[string]int64)
+	if markers == nil {
+		markers = make(map[string]int64)
+	}
+	markers[scope] = time.Now().Add(ttl).Unix()
+	s.initValues()
+	s.Values[elevationKey] = markers
+}
+
+// IsElevated reports whether the session has an unexpired elevation marker
+// for scope.
+func (s *Session) IsElevated(scope string) bool {
+	markers, _ := s.Values[elevationKey].(map[string]int64)
+	expires, ok := markers[scope]
+	return ok && time.Now().Unix() < expires
+}
+
+// Demote removes the elevation marker for scope.
+func (s *Session) Demote(scope string) {
+	markers, _ := s.Values[elevationKey].(map[string]int64)
+	delete(markers, scope)
+	if len(markers) == 0 {
+		delete(s.Values, elevationKey)
+	}
+}
+
+// pruneElevations removes expired elevation markers.
+func pruneElevations(s *Session) {
+	markers, ok := s.Values[elevationKey].(map[string]int64)
+	if !ok {
+		delete(s.Values, elevationKey)
+		return
+	}
+	now := time.Now().Unix()
+	for scope, expires := range markers {
+		if now >= expires {
+			delete(markers, scope)
+		}
+	}
+	if len(markers) == 0 {
+		delete(s.Values, elevationKey)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestElevate(t *testing.T) {
+	store := NewCookieStore([]byte("secret-key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	session, _ := store.New(req, "s")
+
+	if session.IsElevated("billing") {
+		t.Fatal("new session must not be elevated")
+	}
+	session.Elevate("billing", time.Hour)
+	session.Elevate("admin", -time.Second)
+	if !session.IsElevated("billing") || session.IsElevated("admin") {
+		t.Fatalf("bad elevation: %v", session.Values[elevationKey])
+	}
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+
+	req.Header.Add("Cookie", w.Header().Get("Set-Cookie"))
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to load session", err)
+	}
+	markers := session.Values[elevationKey].(map[string]int64)
+	if _, ok := markers["admin"]; ok || len(markers) != 1 {
+		t.Fatalf("expected expired marker to be pruned: %v", markers)
+	}
+	if !session.IsElevated("billing") {
+		t.Fatal("expected session to be elevated")
+	}
+	session.Demote("billing")
+	if session.IsElevated("billing") || session.Values[elevationKey] != nil {
+		t.Fatalf("expected session to be demoted: %v", session.Values)
+	}
+}
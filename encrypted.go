@@ -0,0 +1,199 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/securecookie"
+)
+
+var (
+	// ErrNoEncryptionKey is returned by EncryptedStore when its key ring
+	// is empty.
+	ErrNoEncryptionKey = errors.New("sessions: no encryption key")
+	// ErrUnknownEncryptionKey is returned by EncryptedStore when a session
+	// was encrypted with a key that is no longer in the key ring.
+	ErrUnknownEncryptionKey = errors.New("sessions: unknown encryption key")
+	// ErrDecryptionFailed is returned by EncryptedStore when encrypted
+	// values can't be decrypted.
+	ErrDecryptionFailed = errors.New("sessions: session values could not be decrypted")
+)
+
+// Session values key for the encrypted values.
+const encryptedValuesKey = "_enc"
+
+// EncryptionKey is an AES key of 16, 24 or 32 bytes, identified by ID in
+// the payloads it encrypts.
+type EncryptionKey struct {
+	ID     uint32
+	Secret []byte
+}
+
+// NewEncryptedStore returns an EncryptedStore wrapping store. The first key
+// encrypts new payloads; all keys decrypt.
+func NewEncryptedStore(store Store, keys ...EncryptionKey) *EncryptedStore {
+	return &EncryptedStore{
+		Store: store,
+		Keys:  keys,
+	}
+}
+
+// EncryptedStore wraps a Store and encrypts session values with AES-GCM
+// before the wrapped store sees them, so they are encrypted at rest in any
+// backend, such as Redis, SQL or files, without relying on its support.
+//
+// Values are serialized and replaced by a single encrypted value while the
+// wrapped store saves them, then restored. To rotate keys, add a new key
+// at the front of Keys, and remove the old one once the sessions it
+// encrypted have expired. Sessions saved before the store was wrapped are
+// read unencrypted, and encrypted on their next save.
+type EncryptedStore struct {
+	Store Store
+	// Keys is the key ring. The first key encrypts; all keys decrypt.
+	Keys []EncryptionKey
+	// Serializer serializes values before encryption. The default is
+	// securecookie.GobEncoder.
+	Serializer securecookie.Serializer
+	// Entropy is the source of random nonces. If nil, crypto/rand is used.
+	Entropy io.Reader
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *EncryptedStore) Get(r *http.Request, name string) (*Session, error) {
+	return GetRegistry(r).Get(s, name)
+}
+
+// Unwrap returns the wrapped store.
+func (s *EncryptedStore) Unwrap() Store {
+	return s.Store
+}
+
+// New returns a session for the given name without adding it to the
+// registry, decrypting its values.
+func (s *EncryptedStore) New(r *http.Request, name string) (*Session, error) {
+	session, err := s.Store.New(r, name)
+	if session == nil {
+		return nil, err
+	}
+	session.store = s
+	payload, ok := session.Values[encryptedValuesKey].([]byte)
+	if err != nil || !ok {
+		return session, err
+	}
+	values := make(map[interface{}]interface{})
+	if err = s.decrypt(payload, &values); err != nil {
+		session.ID = ""
+		session.Values = make(map[interface{}]interface{})
+		session.IsNew = true
+		return session, err
+	}
+	session.Values = values
+	afterDecode(session)
+	return session, nil
+}
+
+// Save encrypts the session values and saves the session in the wrapped
+// store. The session keeps its plaintext values.
+func (s *EncryptedStore) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if session.Options != nil && session.Options.MaxAge < 0 {
+		return s.Store.Save(r, w, session)
+	}
+	payload, err := s.encrypt(session.Values)
+	if err != nil {
+		return err
+	}
+	values := session.Values
+	session.Values = map[interface{}]interface{}{encryptedValuesKey: payload}
+	err = s.Store.Save(r, w, session)
+	session.Values = values
+	return err
+}
+
+// Delete deletes the session from the wrapped store.
+func (s *EncryptedStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	return deleteSession(s.Store, r, w, session)
+}
+
+// serializer returns the configured serializer.
+func (s *EncryptedStore) serializer() securecookie.Serializer {
+	if s.Serializer != nil {
+		return s.Serializer
+	}
+	return securecookie.GobEncoder{}
+}
+
+// encrypt serializes values and encrypts them with the current key. The
+// payload is the key ID, the nonce and the sealed values.
+func (s *EncryptedStore) encrypt(values map[interface{}]interface{}) ([]byte, error) {
+	if len(s.Keys) == 0 {
+		return nil, ErrNoEncryptionKey
+	}
+	plaintext, err := s.serializer().Serialize(values)
+	if err != nil {
+		return nil, err
+	}
+	key := s.Keys[0]
+	aead, err := newGCM(key.Secret)
+	if err != nil {
+		return nil, err
+	}
+	entropy := s.Entropy
+	if entropy == nil {
+		entropy = rand.Reader
+	}
+	payload := make([]byte, 4+aead.NonceSize(), 4+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	binary.BigEndian.PutUint32(payload, key.ID)
+	nonce := payload[4:]
+	if _, err = io.ReadFull(entropy, nonce); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoEntropy, err)
+	}
+	return aead.Seal(payload, nonce, plaintext, payload[:4]), nil
+}
+
+// decrypt decrypts a payload written by encrypt into dst.
+func (s *EncryptedStore) decrypt(payload []byte, dst interface{}) error {
+	if len(payload) < 4 {
+		return ErrDecryptionFailed
+	}
+	id := binary.BigEndian.Uint32(payload)
+	for _, key := range s.Keys {
+		if key.ID != id {
+			continue
+		}
+		aead, err := newGCM(key.Secret)
+		if err != nil {
+			return err
+		}
+		if len(payload) < 4+aead.NonceSize() {
+			return ErrDecryptionFailed
+		}
+		nonce := payload[4 : 4+aead.NonceSize()]
+		plaintext, err := aead.Open(nil, nonce, payload[4+aead.NonceSize():], payload[:4])
+		if err != nil {
+			return ErrDecryptionFailed
+		}
+		return s.serializer().Deserialize(plaintext, dst)
+	}
+	return fmt.Errorf("%w: %d", ErrUnknownEncryptionKey, id)
+}
+
+// newGCM returns an AES-GCM AEAD using secret.
+func newGCM(secret []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
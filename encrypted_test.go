@@ -0,0 +1,55 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	backend := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	oldKey := EncryptionKey{ID: 1, Secret: bytes.Repeat([]byte("a"), 32)}
+	newKey := EncryptionKey{ID: 2, Secret: bytes.Repeat([]byte("b"), 16)}
+	store := NewEncryptedStore(backend, oldKey)
+	load := func(value string) (*Session, error) {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(&http.Cookie{Name: "s", Value: value})
+		return store.New(req, "s")
+	}
+
+	value := encodeCookie(t, store, "s", "gopher")
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: value})
+	raw, err := backend.New(req, "s")
+	if err != nil || len(raw.Values) != 1 || raw.Values[encryptedValuesKey] == nil {
+		t.Fatalf("expected the backend to see encrypted values only: %v, %v", raw.Values, err)
+	}
+	session, err := load(value)
+	if err != nil || session.Values["user"] != "gopher" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+
+	// Rotation: sessions encrypted with the old key remain readable.
+	store.Keys = []EncryptionKey{newKey, oldKey}
+	if session, err = load(value); err != nil || session.Values["user"] != "gopher" {
+		t.Fatalf("bad session after rotation: %v, %v", session.Values, err)
+	}
+	rotated := encodeCookie(t, store, "s", "rotated")
+	store.Keys = []EncryptionKey{newKey}
+	if session, err = load(rotated); err != nil || session.Values["user"] != "rotated" {
+		t.Fatalf("bad rotated session: %v, %v", session.Values, err)
+	}
+	if session, err = load(value); !errors.Is(err, ErrUnknownEncryptionKey) || !session.IsNew {
+		t.Fatalf("expected ErrUnknownEncryptionKey, got %v", err)
+	}
+
+	store.Keys = []EncryptionKey{{ID: 2, Secret: bytes.Repeat([]byte("c"), 16)}}
+	if _, err = load(rotated); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected ErrDecryptionFailed, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Snapshot is a JSON-safe copy of a session, used for data portability
+// requests and to move sessions between stores.
+//
+// Values are converted to JSON-compatible types: keys are formatted as
+// strings and nested maps get string keys too. Types are not preserved, so
+// after ImportSession numbers become float64 and structs become maps.
+type Snapshot struct {
+	Name       string                 `json:"name"`
+	ID         string                 `json:"id,omitempty"`
+	Values     map[string]interface{} `json:"values"`
+	ExportedAt time.Time              `json:"exported_at"`
+}
+
+// Export returns a JSON-safe snapshot of the session.
+//
+// It returns an error if a value can't be represented in JSON.
+func (s *Session) Export() (*Snapshot, error) {
+	values, err := jsonSafe(reflect.ValueOf(s.Values))
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{
+		Name:       s.name,
+		ID:         s.ID,
+		Values:     values.(map[string]interface{}),
+		ExportedAt: time.Now().UTC(),
+	}
+	if _, err := json.Marshal(snapshot); err != nil {
+		return nil, fmt.Errorf("sessions: can't export session %q: %v", s.name, err)
+	}
+	return snapshot, nil
+}
+
+// jsonSafe converts maps with non-string keys, recursively, so the value
+// can be marshaled by encoding/json.
+func jsonSafe(v reflect.Value) (interface{}, error) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, err := jsonSafe(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(iter.Key().Interface())] = elem
+		}
+		return m, nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface(), nil
+		}
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			elem, err := jsonSafe(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			s[i] = elem
+		}
+		return s, nil
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64,
+		reflect.Complex128:
+		return nil, fmt.Errorf("sessions: can't export value of type %s", v.Type())
+	}
+	return v.Interface(), nil
+}
+
+// importSession decodes a JSON snapshot into a session created by
+// newSession.
+func importSession(newSession func(name string) *Session,
+	data []byte) (*Session, error) {
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	if !isCookieNameValid(snapshot.Name) {
+		return nil, fmt.Errorf("sessions: invalid character in cookie name: %s",
+			snapshot.Name)
+	}
+	session := newSession(snapshot.Name)
+	session.ID = snapshot.ID
+	for k, v := range snapshot.Values {
+		session.Values[k] = v
+	}
+	return session, nil
+}
+
+// ImportSession recreates a session from a JSON-encoded Snapshot. The
+// session is not saved.
+func (s *CookieStore) ImportSession(data []byte) (*Session, error) {
+	return importSession(s.newSession, data)
+}
+
+// ImportSession recreates a session from a JSON-encoded Snapshot. The
+// session is not saved; saving it writes the session file under the
+// snapshot ID.
+func (s *FilesystemStore) ImportSession(data []byte) (*Session, error) {
+	return importSession(s.newSession, data)
+}
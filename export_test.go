@@ -0,0 +1,63 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("secret-key"))
+	saveFilesystemSession(t, store, "s", map[interface{}]interface{}{
+		"user": "alice",
+		"cart": []interface{}{"book", 2},
+		42:     []interface{}{"answer"},
+	})
+	saveFilesystemSession(t, store, "s", map[interface{}]interface{}{"user": "alice"})
+	saveFilesystemSession(t, store, "s", map[interface{}]interface{}{"user": "bob"})
+	saveFilesystemSession(t, store, "other", map[interface{}]interface{}{"user": "alice"})
+
+	snapshots, err := ExportByPrincipal(store, "s", "user", "alice")
+	if err != nil {
+		t.Fatal("failed to export sessions", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("bad number of snapshots: got %d, want 2", len(snapshots))
+	}
+	var snapshot *Snapshot
+	for _, v := range snapshots {
+		if len(v.Values) == 3 {
+			snapshot = v
+		}
+	}
+	if snapshot == nil || snapshot.Name != "s" || snapshot.ID == "" {
+		t.Fatalf("bad snapshots: %+v", snapshots)
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal("failed to marshal snapshot", err)
+	}
+
+	session, err := NewCookieStore([]byte("secret-key")).ImportSession(data)
+	if err != nil {
+		t.Fatal("failed to import session", err)
+	}
+	if session.Name() != "s" || session.ID != snapshot.ID {
+		t.Fatalf("bad session: %q, %q", session.Name(), session.ID)
+	}
+	if session.Values["user"] != "alice" {
+		t.Fatalf("bad user: %v", session.Values["user"])
+	}
+	if v, ok := session.Values["42"].([]interface{}); !ok || v[0] != "answer" {
+		t.Fatalf("bad int key value: %#v", session.Values["42"])
+	}
+
+	bad := NewSession(store, "s")
+	bad.Values["ch"] = make(chan int)
+	if _, err = bad.Export(); err == nil {
+		t.Fatal("expected an error exporting a channel")
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrSessionNotFound is returned when the server-side data of a
+	// session doesn't exist.
+	ErrSessionNotFound = errors.New("sessions: session not found")
+
+	errMalformedField = errors.New("sessions: malformed session field")
+)
+
+// FieldBackend stores sessions as sets of fields, and can update some
+// fields without rewriting the others, such as a Redis hash updated with
+// HSET and HDEL, or a JSON column updated with JSON_SET. It is used by
+// FieldStore.
+type FieldBackend interface {
+	// LoadFields returns the fields of a session, or an error wrapping
+	// ErrSessionNotFound.
+	LoadFields(ctx context.Context, id string) (map[string][]byte, error)
+	// UpdateFields sets and deletes fields of a session, creating it if
+	// needed, and sets its time to live.
+	UpdateFields(ctx context.Context, id string, set map[string][]byte,
+		del []string, ttl time.Duration) error
+	// DeleteFields deletes a session and all its fields. Deleting a
+	// session that doesn't exist is not an error.
+	DeleteFields(ctx context.Context, id string) error
+}
+
+// NewFieldStore returns a new FieldStore keeping sessions in backend.
+//
+// See NewCookieStore() for a description of the other parameters.
+func NewFieldStore(backend FieldBackend, keyPairs ...[]byte) *FieldStore {
+	return NewFieldStoreWithOptions(backend, WithKeyPairs(keyPairs...))
+}
+
+// NewFieldStoreWithOptions returns a new FieldStore keeping sessions in
+// backend, configured by opts.
+//
+// Options not set default to the values used by NewFieldStore().
+func NewFieldStoreWithOptions(backend FieldBackend, opts ...StoreOption) *FieldStore {
+	s := &FieldStore{Backend: backend}
+	s.backendStore = newBackendStore(s, newBackendConfig(opts))
+	return s
+}
+
+// FieldStore stores each session value in its own field of a FieldBackend
+// and, when a session is saved, writes only the values that changed since
+// it was loaded. This reduces write amplification for large sessions of
+// which a request changes one key.
+//
+// Changes are detected by comparing the gob encoding of each value with
+// the one loaded, so values mutated in place are detected too; maps are
+// encoded in random order, so values holding maps may be rewritten even if
+// unchanged. Fields are encoded with the codecs, so they are
+// authenticated and optionally encrypted; their expiry is the time to live
+// of the backend record, refreshed on each save.
+type FieldStore struct {
+	// backendStore provides Codecs, Options, Entropy, PersistOptions,
+	// FlashKey and the Store methods.
+	backendStore
+	Backend FieldBackend
+	// Filter, if set, is a negative cache of the sessions in the backend:
+	// sessions it doesn't contain are not looked up unless their cookie is
+	// more recent than its last rebuild. Saved sessions are added to it.
+	Filter *IDFilter
+}
+
+// saveSession writes the values of the session that changed since it was
+// loaded, with a time to live of maxAge.
+func (s *FieldStore) saveSession(ctx context.Context, session *Session, maxAge int) error {
+	set := make(map[string][]byte)
+	digests := make(map[string][sha256.Size]byte, len(session.Values))
+	for k, v := range session.Values {
+		name, digest, err := fieldDigest(k, v)
+		if err != nil {
+			return err
+		}
+		digests[name] = digest
+		if old, ok := session.fieldDigests[name]; ok && old == digest {
+			continue
+		}
+		encoded, err := encodeMulti(session.Name(), []interface{}{k, v}, s.Codecs...)
+		if err != nil {
+			return err
+		}
+		set[name] = []byte(encoded)
+	}
+	var del []string
+	for name := range session.fieldDigests {
+		if _, ok := digests[name]; !ok {
+			del = append(del, name)
+		}
+	}
+	err := s.Backend.UpdateFields(ctx, session.ID, set, del, maxAgeDuration(maxAge))
+	if err != nil {
+		return err
+	}
+	if s.Filter != nil {
+		s.Filter.Add(session.ID)
+	}
+	session.fieldDigests = digests
+	return nil
+}
+
+// deleteSession deletes the fields of a session.
+func (s *FieldStore) deleteSession(ctx context.Context, id string) error {
+	return s.Backend.DeleteFields(ctx, id)
+}
+
+// ListIDs calls add with the ID of each session in the backend. It returns
+// ErrListNotSupported if the backend doesn't implement IDLister.
+func (s *FieldStore) ListIDs(ctx context.Context, add func(id string)) error {
+	lister, ok := s.Backend.(IDLister)
+	if !ok {
+		return ErrListNotSupported
+	}
+	return lister.ListIDs(ctx, add)
+}
+
+// loadSession reads the fields of a session and decodes them into
+// session.Values.
+func (s *FieldStore) loadSession(ctx context.Context, session *Session) error {
+	if s.Filter != nil && !s.Filter.mayHold(session) {
+		return ErrSessionNotFound
+	}
+	fields, err := s.Backend.LoadFields(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+	// Unchanged fields keep the timestamp of their last write, so only
+	// the backend time to live limits their age.
+	codecs := withoutMaxAge(s.Codecs)
+	session.fieldDigests = make(map[string][sha256.Size]byte, len(fields))
+	for name, data := range fields {
+		var entry []interface{}
+		if err = decodeMulti(session.Name(), string(data), &entry, codecs...); err != nil {
+			return err
+		}
+		if len(entry) != 2 {
+			return errMalformedField
+		}
+		_, digest, err := fieldDigest(entry[0], entry[1])
+		if err != nil {
+			return err
+		}
+		session.Values[entry[0]] = entry[1]
+		session.fieldDigests[name] = digest
+	}
+	restoreOptions(session)
+	afterDecode(session)
+	return nil
+}
+
+// fieldDigest returns the field name of a session value, derived from its
+// key, and the digest of its encoding.
+func fieldDigest(k, v interface{}) (string, [sha256.Size]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(&k); err != nil {
+		return "", [sha256.Size]byte{}, err
+	}
+	key := sha256.Sum256(buf.Bytes())
+	if err := enc.Encode(&v); err != nil {
+		return "", [sha256.Size]byte{}, err
+	}
+	return hex.EncodeToString(key[:16]), sha256.Sum256(buf.Bytes()), nil
+}
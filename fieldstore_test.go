@@ -0,0 +1,111 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memFields is an in-memory FieldBackend recording the fields written.
+type memFields struct {
+	mu       sync.Mutex
+	sessions map[string]map[string][]byte
+	written  []string
+}
+
+func (m *memFields) LoadFields(ctx context.Context, id string) (map[string][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fields, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	out := make(map[string][]byte, len(fields))
+	for k, v := range fields {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (m *memFields) UpdateFields(ctx context.Context, id string, set map[string][]byte,
+	del []string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fields := m.sessions[id]
+	if fields == nil {
+		fields = make(map[string][]byte)
+		m.sessions[id] = fields
+	}
+	m.written = m.written[:0]
+	for k, v := range set {
+		fields[k] = v
+		m.written = append(m.written, k)
+	}
+	for _, k := range del {
+		delete(fields, k)
+	}
+	return nil
+}
+
+func (m *memFields) DeleteFields(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *memFields) ListIDs(ctx context.Context, add func(id string)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range m.sessions {
+		add(id)
+	}
+	return nil
+}
+
+func TestFieldStore(t *testing.T) {
+	backend := &memFields{sessions: make(map[string]map[string][]byte)}
+	store := NewFieldStore(backend, []byte("some key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	session, _ := store.New(req, "s")
+	session.Values["user"] = "gopher"
+	session.Values["cart"] = []string{"a", "b"}
+	session.Values["theme"] = "dark"
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if len(backend.written) != 3 {
+		t.Fatalf("expected all fields to be written: %v", backend.written)
+	}
+
+	req.AddCookie(w.Result().Cookies()[0])
+	session, err := store.New(req, "s")
+	if err != nil || len(session.Values) != 3 || session.Values["user"] != "gopher" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+	session.Values["cart"].([]string)[1] = "c"
+	delete(session.Values, "theme")
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if len(backend.written) != 1 || len(backend.sessions[session.ID]) != 2 {
+		t.Fatalf("expected one field written and one deleted: %v, %v",
+			backend.written, backend.sessions[session.ID])
+	}
+
+	session, err = store.New(req, "s")
+	if err != nil || len(session.Values) != 2 || session.Values["cart"].([]string)[1] != "c" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+	if err = Destroy(req, httptest.NewRecorder(), session); err != nil || len(backend.sessions) != 0 {
+		t.Fatalf("failed to destroy session: %v, %v", backend.sessions, err)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// File name prefix for temporary files written by FilesystemStore.
+	tempFilePrefix = "tmp_session_"
+	// Age after which GC removes temporary files, left behind by a crash.
+	staleTempAge = time.Hour
+	// Number of locks used to serialize writes to session files.
+	lockStripes = 64
+)
+
+// WritableFS is the file system used by FilesystemStore, for example to
+// keep sessions in memory in tests. Names are slash-separated paths
+// relative to the root of the file system, as in fs.FS.
+//
+// Implementations must be safe for concurrent use.
+type WritableFS interface {
+	fs.FS
+	// WriteFile replaces the named file with the content of r, creating
+	// parent directories as needed. Readers must never observe a
+	// partially written file.
+	WriteFile(name string, r io.Reader) error
+	// Remove removes the named file.
+	Remove(name string) error
+	// RemoveAll removes the named directory and its content. Removing a
+	// directory that doesn't exist is not an error.
+	RemoveAll(name string) error
+	// Chtimes changes the access and modification times of the named
+	// file.
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// DirFS returns a WritableFS for the directory dir of the operating
+// system, such as a local disk or a mounted network file system.
+func DirFS(dir string) WritableFS {
+	return dirFS(dir)
+}
+
+// dirFS is a WritableFS rooted at a directory.
+type dirFS string
+
+// join returns the operating system path of name.
+func (d dirFS) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(string(d), filepath.FromSlash(name)), nil
+}
+
+func (d dirFS) Open(name string) (fs.File, error) {
+	p, err := d.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (d dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := d.join("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(p)
+}
+
+func (d dirFS) WriteFile(name string, r io.Reader) error {
+	p, err := d.join("write", name)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(p, r)
+}
+
+func (d dirFS) Remove(name string) error {
+	p, err := d.join("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+func (d dirFS) RemoveAll(name string) error {
+	p, err := d.join("removeall", name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+func (d dirFS) Chtimes(name string, atime, mtime time.Time) error {
+	p, err := d.join("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(p, atime, mtime)
+}
+
+// lock returns the lock guarding writes to the file of a session ID.
+//
+// Writes to a session are serialized by a lock chosen among a fixed set by
+// hashing the ID, so independent stores and sessions rarely contend. Reads
+// don't lock: files are replaced atomically.
+func (s *FilesystemStore) lock(id string) *sync.Mutex {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return &s.locks[h.Sum32()%lockStripes]
+}
+
+// Shard spreads session files across levels of subdirectories, each named
+// after two hexadecimal characters of a hash of the session ID, for example
+// "3f/a2/session_...". This keeps directories small when there are many
+// sessions. A value of 0, the default, stores all files in the root
+// directory of the store.
+//
+// Files written before sharding was enabled are still read, and are moved
+// to their shard when the session is saved again.
+func (s *FilesystemStore) Shard(levels int) {
+	if levels < 0 {
+		levels = 0
+	}
+	s.shards = levels
+}
+
+// filename returns the name of the file for a session ID.
+func (s *FilesystemStore) filename(id string) string {
+	base := sessionFilePrefix + fileID(id)
+	if s.shards == 0 {
+		return base
+	}
+	sum := sha256.Sum256([]byte(id))
+	digest := hex.EncodeToString(sum[:])
+	var parts []string
+	for i := 0; i < s.shards && 2*i+2 <= len(digest); i++ {
+		parts = append(parts, digest[2*i:2*i+2])
+	}
+	return path.Join(append(parts, base)...)
+}
+
+// legacyFilename returns the name of a session file in the root directory,
+// where files are stored when sharding is disabled.
+func (s *FilesystemStore) legacyFilename(id string) string {
+	return sessionFilePrefix + fileID(id)
+}
+
+// fileID returns the last element of a session ID, so it can't point to
+// another directory.
+func fileID(id string) string {
+	return path.Base(filepath.Base(id))
+}
+
+// openFile opens the file for a session ID, falling back to the unsharded
+// location.
+func (s *FilesystemStore) openFile(id string) (fs.File, error) {
+	f, err := s.fsys.Open(s.filename(id))
+	if errors.Is(err, fs.ErrNotExist) && s.shards > 0 {
+		return s.fsys.Open(s.legacyFilename(id))
+	}
+	return f, err
+}
+
+// walkFiles calls fn for each session file, including files in shard
+// directories. Only directories named like shards are visited.
+func (s *FilesystemStore) walkFiles(fn func(name, id string, info fs.FileInfo) error) error {
+	return walkShard(s.fsys, ".", s.shards, fn)
+}
+
+func walkShard(fsys fs.FS, dir string, levels int, fn func(name, id string, info fs.FileInfo) error) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := path.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if levels > 0 && isShardName(entry.Name()) {
+				if err := walkShard(fsys, name, levels-1, fn); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return err
+				}
+			}
+			continue
+		}
+		if !strings.HasPrefix(entry.Name(), sessionFilePrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if err := fn(name, strings.TrimPrefix(entry.Name(), sessionFilePrefix), info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isShardName reports whether name is two lowercase hexadecimal characters.
+func isShardName(name string) bool {
+	if len(name) != 2 {
+		return false
+	}
+	for _, c := range name {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// requestContext returns the context of r, or the background context if r
+// is nil, as when saving a session with Cookie.
+func requestContext(r *http.Request) context.Context {
+	if r == nil {
+		return context.Background()
+	}
+	return r.Context()
+}
+
+// contextReader reads from r until ctx is done, so file I/O is aborted when
+// the request is canceled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// writeFileAtomic copies r to a temporary file in the directory of
+// filename, creating it if needed, syncs it and renames it to filename.
+// A crash can leave the temporary file behind; GC removes it.
+func writeFileAtomic(filename string, r io.Reader) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, tempFilePrefix)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	// Sync before renaming, so a crash can't leave an empty or truncated
+	// file under the final name.
+	if _, err = io.Copy(f, r); err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,305 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// osPath returns the path on disk of a file of a store using DirFS.
+func (s *FilesystemStore) osPath(name string) string {
+	return filepath.Join(string(s.fsys.(dirFS)), filepath.FromSlash(name))
+}
+
+func TestFilesystemStoreShard(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFilesystemStore(dir, []byte("some key"))
+
+	// A session saved before sharding was enabled.
+	legacy := saveFilesystemSession(t, store, "s", map[interface{}]interface{}{"v": 1})
+	if filepath.Dir(legacy) != dir {
+		t.Fatalf("bad legacy file name: %s", legacy)
+	}
+
+	store.Shard(2)
+	filename := saveFilesystemSession(t, store, "s", map[interface{}]interface{}{"v": 2})
+	rel, err := filepath.Rel(dir, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) != 3 || !isShardName(parts[0]) || !isShardName(parts[1]) {
+		t.Fatalf("bad sharded file name: %s", rel)
+	}
+
+	count := 0
+	err = store.Walk("s", func(s *Session) error {
+		count++
+		return nil
+	})
+	if err != nil || count != 2 {
+		t.Fatalf("bad walk: %d sessions, %v", count, err)
+	}
+
+	// Loading and saving the legacy session moves it to its shard.
+	id := strings.TrimPrefix(filepath.Base(legacy), sessionFilePrefix)
+	session := store.newSession("s")
+	session.ID = id
+	if err = store.load(context.Background(), session); err != nil || session.Values["v"] != 1 {
+		t.Fatalf("failed to load legacy session: %v, %v", session.Values, err)
+	}
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if _, err = os.Stat(legacy); !os.IsNotExist(err) {
+		t.Fatalf("expected legacy file to be removed: %v", err)
+	}
+	if _, err = os.Stat(store.osPath(store.filename(id))); err != nil {
+		t.Fatalf("expected sharded file: %v", err)
+	}
+
+	// No temporary files are left behind.
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if strings.HasPrefix(d.Name(), tempFilePrefix) {
+			t.Errorf("temporary file left: %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// memFS is an in-memory WritableFS.
+type memFS struct {
+	mu    sync.Mutex
+	files fstest.MapFS
+}
+
+func (m *memFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.Open(name)
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.ReadDir(name)
+}
+
+func (m *memFS) WriteFile(name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = &fstest.MapFile{Data: data, Mode: 0600, ModTime: time.Now()}
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *memFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k := range m.files {
+		if k == name || strings.HasPrefix(k, name+"/") {
+			delete(m.files, k)
+		}
+	}
+	return nil
+}
+
+func (m *memFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[name]
+	if !ok {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrNotExist}
+	}
+	f.ModTime = mtime
+	return nil
+}
+
+func TestFilesystemStoreWithFS(t *testing.T) {
+	fsys := &memFS{files: make(fstest.MapFS)}
+	store := NewFilesystemStoreWithOptions("", WithKeyPairs([]byte("some key")), WithFS(fsys))
+	store.Shard(1)
+	cookie := encodeCookie(t, store, "s", "gopher")
+	if len(fsys.files) != 1 {
+		t.Fatalf("bad files: %v", fsys.files)
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+	session, err := store.New(req, "s")
+	if err != nil || session.Values["user"] != "gopher" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+	if err = session.Touch(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to touch session", err)
+	}
+	count := 0
+	if err = store.Walk("s", func(*Session) error { count++; return nil }); err != nil || count != 1 {
+		t.Fatalf("bad walk: %d sessions, %v", count, err)
+	}
+	if err = Destroy(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal("failed to destroy session", err)
+	}
+	if len(fsys.files) != 0 {
+		t.Fatalf("expected no files: %v", fsys.files)
+	}
+}
+
+func TestFilesystemStoreConcurrentSave(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to create session", err)
+	}
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			s := store.newSession("s")
+			s.ID = session.ID
+			s.Values["i"] = i
+			done <- s.Save(req, httptest.NewRecorder())
+		}(i)
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-done; err != nil {
+			t.Fatal("failed to save session", err)
+		}
+	}
+	loaded := store.newSession("s")
+	loaded.ID = session.ID
+	if err = store.load(context.Background(), loaded); err != nil {
+		t.Fatal("failed to load session", err)
+	}
+	if _, ok := loaded.Values["i"].(int); !ok {
+		t.Fatalf("bad session values: %v", loaded.Values)
+	}
+}
+
+// benchmarkFilesystemStore saves and loads distinct sessions in parallel
+// using the given number of stores.
+func benchmarkFilesystemStore(b *testing.B, stores int) {
+	var all []*FilesystemStore
+	for i := 0; i < stores; i++ {
+		all = append(all, NewFilesystemStore(b.TempDir(), []byte("some key")))
+	}
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	var next int32
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		n := int(atomic.AddInt32(&next, 1))
+		store := all[n%len(all)]
+		session, _ := store.New(req, "s")
+		session.ID = strconv.Itoa(n)
+		session.Values["foo"] = "bar"
+		for pb.Next() {
+			if err := store.save(context.Background(), session); err != nil {
+				b.Fatal(err)
+			}
+			if err := store.load(context.Background(), session); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkFilesystemStoreSingle(b *testing.B) {
+	benchmarkFilesystemStore(b, 1)
+}
+
+func BenchmarkFilesystemStoreMultiple(b *testing.B) {
+	benchmarkFilesystemStore(b, 4)
+}
+
+func TestFilesystemStoreCanceled(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFilesystemStore(dir, []byte("some key"))
+	cookie := encodeCookie(t, store, "s", "gopher")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+	session, err := store.New(req, "s")
+	if !errors.Is(err, context.Canceled) || !session.IsNew {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	session.Values["user"] = "other"
+	if err = session.Save(req, httptest.NewRecorder()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("expected a single session file, got %d entries", len(entries))
+	}
+}
+
+func TestFilesystemStoreIDEncoding(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFilesystemStoreWithOptions(dir, WithKeyPairs([]byte("some key")),
+		WithIDEncoding(base64.RawURLEncoding))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	if err := session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if len(session.ID) != base64.RawURLEncoding.EncodedLen(32) {
+		t.Fatalf("expected a base64 session ID, got %q", session.ID)
+	}
+
+	// A cookie authenticated with the store keys but smuggling a path.
+	encoded, err := securecookie.EncodeMulti("s", "../../etc/passwd", store.Codecs...)
+	if err != nil {
+		t.Fatal("failed to encode cookie", err)
+	}
+	req.AddCookie(&http.Cookie{Name: "s", Value: encoded})
+	if _, err = store.New(req, "s"); !errors.Is(err, ErrInvalidSessionID) {
+		t.Fatalf("expected ErrInvalidSessionID, got %v", err)
+	}
+
+	session, _ = store.New(httptest.NewRequest("GET", "/", nil), "s")
+	session.ID = "a/b"
+	if err = session.Save(req, httptest.NewRecorder()); !errors.Is(err, ErrInvalidSessionID) {
+		t.Fatalf("expected ErrInvalidSessionID, got %v", err)
+	}
+}
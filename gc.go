@@ -0,0 +1,247 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// ExpireCallback is invoked by garbage collection with the decoded contents
+// of an expired session, right after the session is deleted. It can be used
+// to archive values or emit analytics.
+//
+// Callbacks are best-effort: sessions that can't be decoded, or that exceed
+// the rate limit, are deleted without a callback.
+type ExpireCallback struct {
+	// Func is called with each expired session. The session is not saved
+	// afterwards, so changes to it are discarded. Func is called while the
+	// store holds the lock of the session, so it must not save it.
+	Func func(session *Session)
+	// Names lists the session names tried when decoding expired sessions.
+	// Server-side stores authenticate the payload with the session name, so
+	// it can't be decoded without it.
+	Names []string
+	// Interval is the minimum time between two calls to Func. Zero means
+	// no limit.
+	Interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// allow reports whether Func may be called now.
+func (c *ExpireCallback) allow() bool {
+	if c.Interval <= 0 {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.Before(c.next) {
+		return false
+	}
+	c.next = now.Add(c.Interval)
+	return true
+}
+
+// call decodes data with each of the configured names and calls Func with
+// the first session that decodes. Panics in Func are recovered.
+func (c *ExpireCallback) call(store Store, id, data string,
+	codecs []securecookie.Codec) {
+	if c.Func == nil || !c.allow() {
+		return
+	}
+	for _, name := range c.Names {
+		session := NewSession(store, name)
+		session.ID = id
+		if err := decodeMulti(name, data, &session.Values, codecs...); err != nil {
+			continue
+		}
+		func() {
+			defer func() { _ = recover() }()
+			c.Func(session)
+		}()
+		return
+	}
+}
+
+// OnExpire registers a callback invoked by GC for each expired session.
+// Passing nil removes it.
+func (s *FilesystemStore) OnExpire(cb *ExpireCallback) {
+	s.onExpire = cb
+}
+
+// DefaultGCAgeBuckets are the upper bounds of the age buckets of a
+// GCReport when GCOptions.AgeBuckets is empty.
+var DefaultGCAgeBuckets = []time.Duration{
+	time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+	30 * 24 * time.Hour,
+	90 * 24 * time.Hour,
+}
+
+// GCOptions configures the RunGC methods of the stores.
+type GCOptions struct {
+	// DryRun reports the expired sessions without deleting them, so
+	// retention settings can be validated before enabling cleanup.
+	DryRun bool
+	// AgeBuckets are the increasing upper bounds of the age buckets of
+	// the report. If empty, DefaultGCAgeBuckets is used.
+	AgeBuckets []time.Duration
+}
+
+// GCReport describes a garbage collection run.
+type GCReport struct {
+	DryRun bool
+	// Scanned is the number of sessions examined.
+	Scanned int
+	// Deleted is the number of expired sessions deleted, or that would be
+	// deleted in a dry run.
+	Deleted int
+	// Failed is the number of expired sessions that couldn't be deleted.
+	Failed int
+	// TempFiles is the number of stale temporary files deleted, or that
+	// would be deleted in a dry run. They are left behind when the
+	// process crashes while writing a file.
+	TempFiles int
+	// AgeBuckets are the upper bounds of the age buckets.
+	AgeBuckets []time.Duration
+	// AgeCounts counts the expired sessions by the time since their last
+	// save: AgeCounts[i] counts those younger than AgeBuckets[i] and not
+	// counted before, and the last element those older than all bounds.
+	AgeCounts []int
+}
+
+// newGCReport returns an empty report of a run configured by opts.
+func newGCReport(opts GCOptions) *GCReport {
+	buckets := opts.AgeBuckets
+	if len(buckets) == 0 {
+		buckets = DefaultGCAgeBuckets
+	}
+	return &GCReport{
+		DryRun:     opts.DryRun,
+		AgeBuckets: buckets,
+		AgeCounts:  make([]int, len(buckets)+1),
+	}
+}
+
+// observe counts an expired session of the given age.
+func (r *GCReport) observe(age time.Duration) {
+	i := 0
+	for i < len(r.AgeBuckets) && age >= r.AgeBuckets[i] {
+		i++
+	}
+	r.AgeCounts[i]++
+}
+
+// GC deletes session files that have not been modified within the store
+// MaxAge, along with their blobs, and temporary files left behind by a
+// crash. It returns the number of deleted sessions.
+//
+// GC is not run automatically; applications should call it periodically.
+func (s *FilesystemStore) GC() (int, error) {
+	report, err := s.RunGC(GCOptions{})
+	return report.Deleted, err
+}
+
+// RunGC is like GC but returns a report of the run, and can run without
+// deleting anything. Sessions that fail to be deleted are counted, and the
+// first error is returned once all sessions have been examined.
+func (s *FilesystemStore) RunGC(opts GCOptions) (*GCReport, error) {
+	report := newGCReport(opts)
+	now := time.Now()
+	first := s.removeStaleTemp(now.Add(-staleTempAge), opts.DryRun, report)
+	maxAge := s.options().MaxAge
+	if maxAge <= 0 {
+		return report, first
+	}
+	cutoff := now.Add(-maxAgeDuration(maxAge))
+	err := s.walkFiles(func(filename, id string, info fs.FileInfo) error {
+		report.Scanned++
+		if info.ModTime().After(cutoff) {
+			return nil
+		}
+		if opts.DryRun {
+			report.Deleted++
+			report.observe(now.Sub(info.ModTime()))
+			return nil
+		}
+		mu := s.lock(id)
+		mu.Lock()
+		// The session may have been saved or deleted since it was listed.
+		if current, err := fs.Stat(s.fsys, filename); errors.Is(err, fs.ErrNotExist) ||
+			(err == nil && current.ModTime().After(cutoff)) {
+			mu.Unlock()
+			return nil
+		}
+		// The callback gets the contents of the deleted file, read while
+		// the session is locked so it can't be saved meanwhile.
+		cb := s.onExpire
+		var data []byte
+		var errRead error
+		if cb != nil {
+			data, errRead = fs.ReadFile(s.fsys, filename)
+		}
+		err := s.fsys.Remove(filename)
+		if err == nil && cb != nil && errRead == nil {
+			cb.call(s, id, string(data), withoutMaxAge(s.Codecs))
+		}
+		if err == nil || errors.Is(err, fs.ErrNotExist) {
+			err = s.removeBlobs(id)
+		}
+		mu.Unlock()
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			report.Failed++
+			if first == nil {
+				first = err
+			}
+			return nil
+		}
+		report.Deleted++
+		report.observe(now.Sub(info.ModTime()))
+		return nil
+	})
+	if err == nil {
+		err = first
+	}
+	return report, err
+}
+
+// removeStaleTemp deletes the temporary files not modified since cutoff,
+// counting them in report, and returns the first error.
+func (s *FilesystemStore) removeStaleTemp(cutoff time.Time, dryRun bool,
+	report *GCReport) error {
+	var first error
+	err := fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasPrefix(d.Name(), tempFilePrefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		if !dryRun {
+			if err = s.fsys.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				if first == nil {
+					first = err
+				}
+				return nil
+			}
+		}
+		report.TempFiles++
+		return nil
+	})
+	if first == nil {
+		first = err
+	}
+	return first
+}
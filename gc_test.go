@@ -0,0 +1,186 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// saveFilesystemSession saves a session with the given values and returns
+// its file name.
+func saveFilesystemSession(t *testing.T, store *FilesystemStore, name string,
+	values map[interface{}]interface{}) string {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, err := store.New(req, name)
+	if err != nil {
+		t.Fatal("failed to create session", err)
+	}
+	for k, v := range values {
+		session.Values[k] = v
+	}
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	return store.osPath(store.filename(session.ID))
+}
+
+func TestFilesystemStoreGC(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	store.MaxAge(60)
+
+	expired := []string{
+		saveFilesystemSession(t, store, "cart", map[interface{}]interface{}{"item": "a"}),
+		saveFilesystemSession(t, store, "cart", map[interface{}]interface{}{"item": "b"}),
+	}
+	fresh := saveFilesystemSession(t, store, "cart", map[interface{}]interface{}{"item": "c"})
+	past := time.Now().Add(-2 * time.Minute)
+	for _, filename := range expired {
+		if err := os.Chtimes(filename, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archived []interface{}
+	store.OnExpire(&ExpireCallback{
+		Func: func(s *Session) {
+			if _, err := os.Stat(store.osPath(store.filename(s.ID))); !os.IsNotExist(err) {
+				t.Errorf("expected session %s to be deleted before the callback", s.ID)
+			}
+			archived = append(archived, s.Values["item"])
+		},
+		Names:    []string{"other", "cart"},
+		Interval: time.Hour,
+	})
+	n, err := store.GC()
+	if err != nil {
+		t.Fatal("failed to collect sessions", err)
+	}
+	if n != 2 {
+		t.Fatalf("bad number of deleted sessions: got %d, want 2", n)
+	}
+	// The interval allows a single callback per hour.
+	if len(archived) != 1 || (archived[0] != "a" && archived[0] != "b") {
+		t.Fatalf("bad archived values: %v", archived)
+	}
+	for _, filename := range expired {
+		if _, err := os.Stat(filename); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be deleted", filename)
+		}
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Fatalf("expected %s to be kept: %v", fresh, err)
+	}
+}
+
+func TestFilesystemStoreGCRemoveError(t *testing.T) {
+	fsys := failingRemoveFS{&memFS{files: make(map[string]*fstest.MapFile)}}
+	store := NewFilesystemStoreWithOptions("", WithKeyPairs([]byte("some key")),
+		WithFS(fsys), WithMaxAge(60))
+	encodeCookie(t, store, "cart", "gopher")
+	for _, f := range fsys.files {
+		f.ModTime = time.Now().Add(-2 * time.Minute)
+	}
+
+	called := false
+	store.OnExpire(&ExpireCallback{
+		Func:  func(*Session) { called = true },
+		Names: []string{"cart"},
+	})
+	report, err := store.RunGC(GCOptions{})
+	if err == nil || report.Failed != 1 || report.Deleted != 0 {
+		t.Fatalf("expected the removal to fail: %+v, %v", report, err)
+	}
+	if called {
+		t.Fatal("expected no callback for a session that wasn't deleted")
+	}
+}
+
+func TestFilesystemStoreGCDryRun(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	store.MaxAge(60)
+	ages := []time.Duration{2 * time.Minute, 2 * time.Hour, 3 * time.Hour}
+	var files []string
+	for _, age := range ages {
+		filename := saveFilesystemSession(t, store, "cart", nil)
+		past := time.Now().Add(-age)
+		if err := os.Chtimes(filename, past, past); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, filename)
+	}
+	saveFilesystemSession(t, store, "cart", nil)
+
+	report, err := store.RunGC(GCOptions{
+		DryRun:     true,
+		AgeBuckets: []time.Duration{time.Hour},
+	})
+	if err != nil {
+		t.Fatal("failed to collect sessions", err)
+	}
+	if report.Scanned != 4 || report.Deleted != 3 || report.Failed != 0 {
+		t.Fatalf("bad report: %+v", report)
+	}
+	if report.AgeCounts[0] != 1 || report.AgeCounts[1] != 2 {
+		t.Fatalf("bad age distribution: %v", report.AgeCounts)
+	}
+	for _, filename := range files {
+		if _, err := os.Stat(filename); err != nil {
+			t.Fatalf("expected %s to be kept by a dry run: %v", filename, err)
+		}
+	}
+
+	stats := NewStats()
+	stats.RecordGCReport(report)
+	report, err = store.RunGC(GCOptions{})
+	if err != nil || report.Deleted != 3 {
+		t.Fatalf("bad report: %+v, %v", report, err)
+	}
+	stats.RecordGCReport(report)
+	if snap := stats.Snapshot(); snap.GCRuns != 1 || snap.GCDeleted != 3 || snap.GCFailed != 0 {
+		t.Fatalf("bad statistics: %+v", snap)
+	}
+}
+
+func TestFilesystemStoreGCTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFilesystemStore(dir, []byte("some key"))
+	saveFilesystemSession(t, store, "cart", nil)
+	stale := filepath.Join(dir, tempFilePrefix+"stale")
+	recent := filepath.Join(dir, tempFilePrefix+"recent")
+	for _, filename := range []string{stale, recent} {
+		if err := os.WriteFile(filename, []byte("partial"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-2 * staleTempAge)
+	if err := os.Chtimes(stale, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := store.RunGC(GCOptions{DryRun: true})
+	if err != nil || report.TempFiles != 1 {
+		t.Fatalf("bad report: %+v, %v", report, err)
+	}
+	if _, err = os.Stat(stale); err != nil {
+		t.Fatalf("expected %s to be kept by a dry run: %v", stale, err)
+	}
+	report, err = store.RunGC(GCOptions{})
+	if err != nil || report.TempFiles != 1 || report.Deleted != 0 {
+		t.Fatalf("bad report: %+v, %v", report, err)
+	}
+	if _, err = os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be deleted", stale)
+	}
+	if _, err = os.Stat(recent); err != nil {
+		t.Fatalf("expected %s to be kept: %v", recent, err)
+	}
+}
@@ -0,0 +1,392 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errGobScan is returned by scanGob for payloads it can't parse, which are
+// left for encoding/gob to reject.
+var errGobScan = errors.New("sessions: malformed gob payload")
+
+// Type ids predefined by encoding/gob.
+const (
+	gobBool      = 1
+	gobInt       = 2
+	gobUint      = 3
+	gobFloat     = 4
+	gobBytes     = 5
+	gobString    = 6
+	gobComplex   = 7
+	gobInterface = 8
+	gobFirstUser = 64
+)
+
+// Kinds of the types defined in a gob stream, numbered after the fields of
+// the wireType struct of encoding/gob.
+const (
+	gobArrayT = iota + 1
+	gobSliceT
+	gobStructT
+	gobMapT
+	gobEncoderT
+	gobBinaryMarshalerT
+	gobTextMarshalerT
+)
+
+// gobType is a type defined in a gob stream.
+type gobType struct {
+	kind   int
+	elem   int   // element type of arrays, slices and maps
+	key    int   // key type of maps
+	length int   // length of arrays
+	fields []int // field types of structs
+}
+
+// scanGob checks the values and nesting depth of the gob payload src
+// against limits without decoding it, so payloads exceeding them are
+// rejected before encoding/gob allocates their values.
+//
+// Values are counted like limitWalker counts decoded values, except that
+// gob doesn't transmit the zero fields of structs and the contents of
+// values implementing GobEncoder, such as time.Time, so the counts are
+// lower bounds, and limitWalker checks the decoded values exactly.
+func scanGob(src []byte, limits DecodeLimits) error {
+	s := &gobScanner{
+		w:      limitWalker{limits: limits},
+		stream: src,
+		types:  make(map[int]*gobType),
+	}
+	id, err := s.typeSequence(false)
+	if err != nil {
+		return err
+	}
+	return s.value(id, 0)
+}
+
+// gobScanner walks a gob stream as encoding/gob decodes it.
+type gobScanner struct {
+	w      limitWalker
+	stream []byte // messages not read yet
+	buf    []byte // rest of the current message
+	types  map[int]*gobType
+}
+
+// recvMessage reads the next message of the stream into buf.
+func (s *gobScanner) recvMessage() error {
+	n, rest, err := readGobUint(s.stream)
+	if err != nil || n > uint64(len(rest)) {
+		return errGobScan
+	}
+	s.buf, s.stream = rest[:n], rest[n:]
+	return nil
+}
+
+// uint reads an unsigned integer from buf.
+func (s *gobScanner) uint() (uint64, error) {
+	x, rest, err := readGobUint(s.buf)
+	s.buf = rest
+	return x, err
+}
+
+// int reads a signed integer from buf.
+func (s *gobScanner) int() (int, error) {
+	x, err := s.uint()
+	if x&1 != 0 {
+		return int(^(x >> 1)), err
+	}
+	return int(x >> 1), err
+}
+
+// bytes skips a byte count followed by as many bytes, returning the count.
+func (s *gobScanner) bytes() (int, error) {
+	n, err := s.uint()
+	if err != nil || n > uint64(len(s.buf)) {
+		return 0, errGobScan
+	}
+	s.buf = s.buf[n:]
+	return int(n), nil
+}
+
+// typeSequence reads the type definitions preceding a value and returns
+// the type id of the value.
+func (s *gobScanner) typeSequence(isInterface bool) (int, error) {
+	for {
+		if len(s.buf) == 0 {
+			if err := s.recvMessage(); err != nil {
+				return 0, err
+			}
+		}
+		id, err := s.int()
+		if err != nil {
+			return 0, err
+		}
+		if id >= 0 {
+			return id, nil
+		}
+		if err = s.recvType(-id); err != nil {
+			return 0, err
+		}
+		// Within an interface, the count of the next message may follow.
+		if len(s.buf) > 0 {
+			if !isInterface {
+				return 0, errGobScan
+			}
+			if _, err = s.uint(); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+// recvType reads the definition of the type id, a wireType struct.
+func (s *gobScanner) recvType(id int) error {
+	if id < gobFirstUser || s.types[id] != nil {
+		return errGobScan
+	}
+	t := &gobType{}
+	err := s.fields(func(field int) error {
+		if t.kind != 0 || field < gobArrayT || field > gobTextMarshalerT {
+			return errGobScan
+		}
+		t.kind = field
+		return s.fields(func(field int) error {
+			if field == 1 { // CommonType
+				return s.fields(func(field int) error {
+					if field == 1 { // Name
+						_, err := s.bytes()
+						return err
+					}
+					_, err := s.int() // Id
+					return err
+				})
+			}
+			switch {
+			case t.kind == gobStructT && field == 2: // Field
+				n, err := s.uint()
+				if err != nil || n > uint64(len(s.buf)) {
+					return errGobScan
+				}
+				for i := uint64(0); i < n; i++ {
+					fieldType := 0
+					err = s.fields(func(field int) error {
+						if field == 1 { // Name
+							_, err := s.bytes()
+							return err
+						}
+						var err error
+						fieldType, err = s.int() // Id
+						return err
+					})
+					if err != nil {
+						return err
+					}
+					t.fields = append(t.fields, fieldType)
+				}
+				return nil
+			case t.kind == gobMapT && field == 2:
+				return s.setInt(&t.key)
+			case (t.kind == gobArrayT || t.kind == gobSliceT || t.kind == gobMapT) &&
+				(field == 2 || field == 3):
+				if t.kind == gobArrayT && field == 3 {
+					return s.setInt(&t.length)
+				}
+				return s.setInt(&t.elem)
+			}
+			return errGobScan
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if t.kind == 0 {
+		return errGobScan
+	}
+	s.types[id] = t
+	return nil
+}
+
+// setInt reads a signed integer into x.
+func (s *gobScanner) setInt(x *int) error {
+	var err error
+	*x, err = s.int()
+	return err
+}
+
+// fields reads the fields of a struct, calling fn with the number of each
+// field, starting at 1, to read its value.
+func (s *gobScanner) fields(fn func(field int) error) error {
+	field := 0
+	for len(s.buf) > 0 {
+		delta, err := s.uint()
+		if err != nil {
+			return err
+		}
+		if delta == 0 {
+			return nil
+		}
+		if delta > 1<<20 {
+			return errGobScan
+		}
+		field += int(delta)
+		if err = fn(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value reads a top-level value, or the value of an interface, of type id.
+func (s *gobScanner) value(id, depth int) error {
+	if t := s.types[id]; t != nil && t.kind == gobStructT {
+		return s.item(id, depth)
+	}
+	// Other values are preceded by a zero field delta.
+	delta, err := s.uint()
+	if err != nil || delta != 0 {
+		return errGobScan
+	}
+	return s.item(id, depth)
+}
+
+// item reads a value of type id found at the given depth, counting the
+// elements of maps, slices and arrays and the fields of structs.
+func (s *gobScanner) item(id, depth int) error {
+	var err error
+	switch id {
+	case gobBool, gobInt, gobUint, gobFloat:
+		_, err = s.uint()
+		return err
+	case gobComplex:
+		if _, err = s.uint(); err == nil {
+			_, err = s.uint()
+		}
+		return err
+	case gobString:
+		_, err = s.bytes()
+		return err
+	case gobBytes:
+		if err = s.w.enter(depth + 1); err != nil {
+			return err
+		}
+		n, err := s.bytes()
+		if err != nil {
+			return err
+		}
+		return s.w.count(n)
+	case gobInterface:
+		return s.iface(depth)
+	}
+	t := s.types[id]
+	if t == nil {
+		return errGobScan
+	}
+	if t.kind >= gobEncoderT {
+		_, err = s.bytes()
+		return err
+	}
+	if err = s.w.enter(depth + 1); err != nil {
+		return err
+	}
+	switch t.kind {
+	case gobStructT:
+		return s.fields(func(field int) error {
+			if field > len(t.fields) {
+				return errGobScan
+			}
+			if err := s.w.count(1); err != nil {
+				return err
+			}
+			return s.item(t.fields[field-1], depth+1)
+		})
+	case gobMapT:
+		n, err := s.length()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err = s.item(t.key, depth+1); err != nil {
+				return err
+			}
+			if err = s.item(t.elem, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		n, err := s.length()
+		if err != nil {
+			return err
+		}
+		if t.kind == gobArrayT && n != t.length {
+			return errGobScan
+		}
+		for i := 0; i < n; i++ {
+			if len(s.buf) == 0 {
+				return errGobScan
+			}
+			if err = s.item(t.elem, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// length reads the length of a map, slice or array and counts its
+// elements.
+func (s *gobScanner) length() (int, error) {
+	n, err := s.uint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(s.stream)+len(s.buf)) {
+		// Every element takes at least one byte.
+		if err = s.w.count(int(min(n, 1<<31))); err != nil {
+			return 0, err
+		}
+		return 0, errGobScan
+	}
+	return int(n), s.w.count(int(n))
+}
+
+// iface reads an interface value: the name of its concrete type, the type
+// definitions it needs, its type id, its byte count and the value.
+func (s *gobScanner) iface(depth int) error {
+	n, err := s.bytes()
+	if err != nil || n == 0 {
+		return err
+	}
+	id, err := s.typeSequence(true)
+	if err != nil {
+		return err
+	}
+	if _, err = s.uint(); err != nil {
+		return err
+	}
+	return s.value(id, depth)
+}
+
+// readGobUint decodes an unsigned integer as encoded by encoding/gob from b,
+// returning the rest of b.
+func readGobUint(b []byte) (uint64, []byte, error) {
+	if len(b) == 0 {
+		return 0, b, errGobScan
+	}
+	if b[0] <= 0x7f {
+		return uint64(b[0]), b[1:], nil
+	}
+	n := -int(int8(b[0]))
+	if n > 8 || n >= len(b) {
+		return 0, b, fmt.Errorf("%w: bad unsigned integer", errGobScan)
+	}
+	var x uint64
+	for _, c := range b[1 : n+1] {
+		x = x<<8 | uint64(c)
+	}
+	return x, b[n+1:], nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNoEntropy is returned when random bytes for a session ID can't be
+	// read from the entropy source.
+	ErrNoEntropy = errors.New("sessions: failed to read random bytes for session ID")
+	// ErrInvalidSessionID is returned by FilesystemStore for session IDs
+	// with characters not allowed in file names, such as path separators.
+	ErrInvalidSessionID = errors.New("sessions: invalid session ID")
+)
+
+var base32RawStdEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// IDEncoding encodes the random bytes of session IDs, such as
+// base64.RawURLEncoding. *base32.Encoding and *base64.Encoding implement
+// it.
+type IDEncoding interface {
+	EncodeToString(src []byte) string
+}
+
+// maxSessionIDLength bounds the length of IDs accepted by validSessionID.
+const maxSessionIDLength = 200
+
+// generateID returns a random identifier of n bytes read from entropy,
+// encoded with alphanumeric characters only. If entropy is nil,
+// crypto/rand is used.
+func generateID(entropy io.Reader, n int) (string, error) {
+	return generateEncodedID(entropy, n, nil)
+}
+
+// generateEncodedID is like generateID but encodes the identifier with enc,
+// or unpadded base32 if enc is nil.
+func generateEncodedID(entropy io.Reader, n int, enc IDEncoding) (string, error) {
+	if entropy == nil {
+		entropy = rand.Reader
+	}
+	if enc == nil {
+		enc = base32RawStdEncoding
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(entropy, b); err != nil {
+		return "", ErrNoEntropy
+	}
+	return enc.EncodeToString(b), nil
+}
+
+// validSessionID reports whether id is non-empty, not too long, and only
+// contains ASCII letters, digits, '-', '_' and '=', which are safe in file
+// names on all platforms.
+func validSessionID(id string) bool {
+	if id == "" || len(id) > maxSessionIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '=') {
+			return false
+		}
+	}
+	return true
+}
+
+// formatCookieID returns the value stored in a cookie for a session ID of
+// the given key generation: "<gen>.<id>", or the bare ID for generation 0.
+// IDs never contain a dot.
+func formatCookieID(id string, gen int64) string {
+	if gen == 0 {
+		return id
+	}
+	return strconv.FormatInt(gen, 10) + "." + id
+}
+
+// parseCookieID splits a value written by formatCookieID.
+func parseCookieID(v string) (id string, gen int64) {
+	prefix, id, ok := strings.Cut(v, ".")
+	if !ok {
+		return v, 0
+	}
+	gen, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil {
+		return v, 0
+	}
+	return id, gen
+}
@@ -0,0 +1,106 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/gob"
+)
+
+// Session values key for idempotency tokens.
+const idempotencyKey = "_idem"
+
+// maxIdempotencyTokens bounds the tokens kept per form; the oldest are
+// dropped first.
+const maxIdempotencyTokens = 10
+
+func init() {
+	gob.Register(map[string][]string{})
+}
+
+// NewIdempotencyToken returns a new single-use token for form, to embed in
+// the form as a hidden field. The session must be saved for the token to
+// be accepted. Up to 10 tokens are kept per form, so a user can open the
+// form in several tabs.
+func (s *Session) NewIdempotencyToken(form string) (string, error) {
+	token, err := generateID(nil, 20)
+	if err != nil {
+		return "", err
+	}
+	tokens, _ := s.Values[idempotencyKey].(map[string][]string)
+	if tokens == nil {
+		tokens = make(map[string][]string)
+	}
+	list := append(tokens[form], token)
+	if len(list) > maxIdempotencyTokens {
+		list = list[len(list)-maxIdempotencyTokens:]
+	}
+	tokens[form] = list
+	s.initValues()
+	s.Values[idempotencyKey] = tokens
+	return token, nil
+}
+
+// ConsumeIdempotencyToken removes token from the tokens of form and
+// reports whether it was there, that is whether the submission is the
+// first one. The session must then be saved.
+//
+// With FilesystemStore the token is also removed from the stored session
+// under its lock, so only one of several concurrent submissions succeeds.
+// With other stores, concurrent requests loading the session before either
+// saved it may all succeed.
+func (s *Session) ConsumeIdempotencyToken(form, token string) (bool, error) {
+	if c, ok := s.store.(tokenConsumer); ok && s.ID != "" {
+		consumed, err := c.consumeToken(context.Background(), s, form, token)
+		if err != nil || !consumed {
+			return false, err
+		}
+	}
+	return consumeToken(s.Values, form, token), nil
+}
+
+// tokenConsumer is implemented by stores consuming idempotency tokens
+// atomically in the stored session.
+type tokenConsumer interface {
+	consumeToken(ctx context.Context, session *Session, form, token string) (bool, error)
+}
+
+// consumeToken removes token from the tokens of form in values and reports
+// whether it was there.
+func consumeToken(values map[interface{}]interface{}, form, token string) bool {
+	tokens, _ := values[idempotencyKey].(map[string][]string)
+	list := tokens[form]
+	for i, t := range list {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			tokens[form] = append(list[:i:i], list[i+1:]...)
+			if len(tokens[form]) == 0 {
+				delete(tokens, form)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// consumeToken removes token from the stored session under its lock.
+func (s *FilesystemStore) consumeToken(ctx context.Context, session *Session,
+	form, token string) (bool, error) {
+	mu := s.lock(session.ID)
+	mu.Lock()
+	defer mu.Unlock()
+	stored := s.newSession(session.Name())
+	stored.ID = session.ID
+	if err := s.load(ctx, stored); err != nil {
+		return false, err
+	}
+	if !consumeToken(stored.Values, form, token) {
+		return false, nil
+	}
+	if s.PersistOptions {
+		defer attachOptions(stored)()
+	}
+	return true, s.saveLocked(ctx, stored)
+}
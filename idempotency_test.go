@@ -0,0 +1,65 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIdempotencyToken(t *testing.T) {
+	session := NewSession(nil, "s")
+	token, err := session.NewIdempotencyToken("checkout")
+	if err != nil {
+		t.Fatal("failed to create token", err)
+	}
+	if ok, _ := session.ConsumeIdempotencyToken("other", token); ok {
+		t.Fatal("expected the token to be bound to its form")
+	}
+	if ok, _ := session.ConsumeIdempotencyToken("checkout", token); !ok {
+		t.Fatal("expected the token to be consumed")
+	}
+	if ok, _ := session.ConsumeIdempotencyToken("checkout", token); ok {
+		t.Fatal("expected the token to be consumed once")
+	}
+	for i := 0; i < maxIdempotencyTokens+1; i++ {
+		if _, err = session.NewIdempotencyToken("checkout"); err != nil {
+			t.Fatal("failed to create token", err)
+		}
+	}
+	if n := len(session.Values[idempotencyKey].(map[string][]string)["checkout"]); n != maxIdempotencyTokens {
+		t.Fatalf("expected %d tokens, got %d", maxIdempotencyTokens, n)
+	}
+}
+
+func TestFilesystemStoreIdempotencyToken(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	token, _ := session.NewIdempotencyToken("checkout")
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+
+	// Two submissions load the session before either saves it.
+	var loaded []*Session
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("POST", "http://www.example.com", nil)
+		req.AddCookie(w.Result().Cookies()[0])
+		s, err := store.New(req, "s")
+		if err != nil {
+			t.Fatal("failed to load session", err)
+		}
+		loaded = append(loaded, s)
+	}
+	if ok, err := loaded[0].ConsumeIdempotencyToken("checkout", token); !ok || err != nil {
+		t.Fatalf("expected the first submission to succeed: %v", err)
+	}
+	if ok, err := loaded[1].ConsumeIdempotencyToken("checkout", token); ok || err != nil {
+		t.Fatalf("expected the second submission to fail: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// IdentityChange describes a change of an identity key between the time a
+// session was loaded and the time it was saved or deleted.
+type IdentityChange struct {
+	// Kind is "login" when the key was set, "logout" when it was removed,
+	// or "switch" when it changed from one value to another.
+	Kind    string
+	Name    string
+	Key     interface{}
+	Old     interface{}
+	New     interface{}
+	Request *http.Request
+	Time    time.Time
+}
+
+// NewIdentityStore returns an IdentityStore wrapping store and watching
+// the given identity keys.
+func NewIdentityStore(store Store, keys ...interface{}) *IdentityStore {
+	return &IdentityStore{
+		Store: store,
+		Keys:  keys,
+	}
+}
+
+// IdentityStore wraps a Store and reports changes of identity keys, such
+// as "user_id", when sessions are saved or deleted, making logins, logouts
+// and user switches observable for audit logs without changes to the
+// handlers performing them.
+//
+// Values are compared with reflect.DeepEqual to their value when the
+// session was loaded.
+type IdentityStore struct {
+	Store Store
+	Keys  []interface{}
+	// OnIdentityChange, if set, is called for each identity key that
+	// changed, once the session has been saved or deleted.
+	OnIdentityChange func(IdentityChange)
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *IdentityStore) Get(r *http.Request, name string) (*Session, error) {
+	return GetRegistry(r).Get(s, name)
+}
+
+// Unwrap returns the wrapped store.
+func (s *IdentityStore) Unwrap() Store {
+	return s.Store
+}
+
+// New returns a session for the given name without adding it to the
+// registry, and records the values of its identity keys.
+func (s *IdentityStore) New(r *http.Request, name string) (*Session, error) {
+	session, err := s.Store.New(r, name)
+	if session == nil {
+		return nil, err
+	}
+	session.store = s
+	session.loadedIdentity = s.identity(session.Values)
+	return session, err
+}
+
+// Save saves the session in the wrapped store and reports the identity
+// keys that changed since it was loaded or last saved.
+func (s *IdentityStore) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if err := s.Store.Save(r, w, session); err != nil {
+		return err
+	}
+	s.report(r, session)
+	return nil
+}
+
+// Delete deletes the session from the wrapped store and reports the
+// identity keys it held as logouts.
+func (s *IdentityStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if err := deleteSession(s.Store, r, w, session); err != nil {
+		return err
+	}
+	s.report(r, session)
+	return nil
+}
+
+// identity returns the values of the identity keys present in values.
+func (s *IdentityStore) identity(values map[interface{}]interface{}) map[interface{}]interface{} {
+	identity := make(map[interface{}]interface{}, len(s.Keys))
+	for _, key := range s.Keys {
+		if v, ok := values[key]; ok {
+			identity[key] = v
+		}
+	}
+	return identity
+}
+
+// report calls OnIdentityChange for each identity key that changed, and
+// records the current values.
+func (s *IdentityStore) report(r *http.Request, session *Session) {
+	current := s.identity(session.Values)
+	if s.OnIdentityChange != nil {
+		now := time.Now()
+		for _, key := range s.Keys {
+			old, hadOld := session.loadedIdentity[key]
+			cur, hasCur := current[key]
+			var kind string
+			switch {
+			case !hadOld && hasCur:
+				kind = "login"
+			case hadOld && !hasCur:
+				kind = "logout"
+			case hadOld && !reflect.DeepEqual(old, cur):
+				kind = "switch"
+			default:
+				continue
+			}
+			s.OnIdentityChange(IdentityChange{
+				Kind:    kind,
+				Name:    session.Name(),
+				Key:     key,
+				Old:     old,
+				New:     cur,
+				Request: r,
+				Time:    now,
+			})
+		}
+	}
+	session.loadedIdentity = current
+}
@@ -0,0 +1,58 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIdentityStore(t *testing.T) {
+	var events []IdentityChange
+	store := NewIdentityStore(NewCookieStore([]byte("secret-key")), "user_id")
+	store.OnIdentityChange = func(e IdentityChange) {
+		events = append(events, e)
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	session.Values["user_id"] = "alice"
+	session.Values["theme"] = "dark"
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	// Saving again without changes reports nothing.
+	if err := session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if len(events) != 1 || events[0].Kind != "login" || events[0].New != "alice" {
+		t.Fatalf("bad events after login: %+v", events)
+	}
+
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to decode session", err)
+	}
+	session.Values["user_id"] = "bob"
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if err = store.Delete(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	if e := events[1]; e.Kind != "switch" || e.Old != "alice" || e.New != "bob" {
+		t.Fatalf("bad switch event: %+v", e)
+	}
+	if e := events[2]; e.Kind != "logout" || e.Old != "bob" || e.New != nil {
+		t.Fatalf("bad logout event: %+v", e)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import "time"
+
+// Session values keys for the idle lock: the time the session was locked,
+// and the time of its last activity, in Unix seconds.
+const (
+	lockedKey     = "_locked"
+	lastActiveKey = "_active"
+)
+
+// Lock locks the session, for example when the user steps away. A locked
+// session keeps its values, so in-progress work is preserved, but the
+// application should require the user to re-authenticate before using it;
+// see IsLocked.
+func (s *Session) Lock() {
+	s.initValues()
+	s.Values[lockedKey] = time.Now().Unix()
+}
+
+// ClearLock unlocks the session and records activity, typically after the
+// user re-authenticated.
+func (s *Session) ClearLock() {
+	s.initValues()
+	delete(s.Values, lockedKey)
+	s.Values[lastActiveKey] = time.Now().Unix()
+}
+
+// IsLocked reports whether the session is locked, either by Lock or
+// because it was idle for longer than Options.IdleLock.
+func (s *Session) IsLocked() bool {
+	_, ok := s.Values[lockedKey]
+	return ok
+}
+
+// enforceIdleLock locks a decoded session that was idle for longer than
+// Options.IdleLock, and records activity otherwise.
+func enforceIdleLock(s *Session) {
+	if s.Options == nil || s.Options.IdleLock <= 0 {
+		return
+	}
+	now := time.Now()
+	if last, ok := s.Values[lastActiveKey].(int64); ok && !s.IsLocked() &&
+		now.Sub(time.Unix(last, 0)) > s.Options.IdleLock {
+		s.Values[lockedKey] = now.Unix()
+	}
+	s.Values[lastActiveKey] = now.Unix()
+}
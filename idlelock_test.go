@@ -0,0 +1,54 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIdleLock(t *testing.T) {
+	store := NewCookieStoreWithOptions(WithKeyPairs([]byte("some key")),
+		WithIdleLock(time.Minute))
+	roundTrip := func(session *Session) *Session {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		w := httptest.NewRecorder()
+		if err := session.Save(req, w); err != nil {
+			t.Fatal("failed to save session", err)
+		}
+		req.AddCookie(w.Result().Cookies()[0])
+		session, err := store.New(req, "s")
+		if err != nil {
+			t.Fatal("failed to load session", err)
+		}
+		return session
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	session.Values["draft"] = "hello"
+	session = roundTrip(session)
+	if session.IsLocked() {
+		t.Fatal("active session must not be locked")
+	}
+
+	session.Values[lastActiveKey] = time.Now().Add(-time.Hour).Unix()
+	session = roundTrip(session)
+	if !session.IsLocked() || session.Values["draft"] != "hello" {
+		t.Fatalf("expected idle session to be locked and keep its values: %v", session.Values)
+	}
+
+	session.ClearLock()
+	if session = roundTrip(session); session.IsLocked() {
+		t.Fatal("unlocked session must not be locked")
+	}
+	session.Lock()
+	if session = roundTrip(session); !session.IsLocked() {
+		t.Fatal("expected session to be locked")
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrImpersonating is returned by ImpersonationStore.Impersonate when
+	// the session is already impersonating a user.
+	ErrImpersonating = errors.New("sessions: session is already impersonating a user")
+	// ErrNotImpersonating is returned by ImpersonationStore.EndImpersonation
+	// when the session is not impersonating a user.
+	ErrNotImpersonating = errors.New("sessions: session is not impersonating a user")
+)
+
+// Session values keys for the impersonation record and the values of the
+// original session.
+const (
+	impersonationKey     = "_imp"
+	impersonationOrigKey = "_imp_orig"
+)
+
+func init() {
+	RegisterType[Impersonation]("sessions.Impersonation")
+	gob.Register(map[interface{}]interface{}{})
+}
+
+// Impersonation describes a session in which an administrator acts as
+// another user.
+type Impersonation struct {
+	Admin   string
+	User    string
+	Started time.Time
+	Expires time.Time
+}
+
+// ImpersonationEvent is emitted for audit when an impersonation starts or
+// ends.
+type ImpersonationEvent struct {
+	// Kind is "start", "end" when ended explicitly, or "expire".
+	Kind          string
+	Name          string
+	Impersonation Impersonation
+	Time          time.Time
+}
+
+// NewImpersonationStore returns an ImpersonationStore wrapping store.
+func NewImpersonationStore(store Store, maxLifetime time.Duration) *ImpersonationStore {
+	return &ImpersonationStore{
+		Store:       store,
+		MaxLifetime: maxLifetime,
+	}
+}
+
+// ImpersonationStore wraps a Store and supports time-boxed impersonation:
+// an administrator's session is turned into a session of another user,
+// and the administrator's session is restored when the impersonation ends
+// or expires.
+//
+// The values of the original session are kept inside the impersonation
+// session, so this works with any store; with CookieStore they count
+// towards the cookie size.
+type ImpersonationStore struct {
+	Store Store
+	// MaxLifetime caps the duration of impersonations. If zero, the
+	// duration passed to Impersonate is used as is.
+	MaxLifetime time.Duration
+	// OnEvent, if set, is called when an impersonation starts, ends or
+	// expires, for audit logs.
+	OnEvent func(ImpersonationEvent)
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *ImpersonationStore) Get(r *http.Request, name string) (*Session, error) {
+	return GetRegistry(r).Get(s, name)
+}
+
+// Unwrap returns the wrapped store.
+func (s *ImpersonationStore) Unwrap() Store {
+	return s.Store
+}
+
+// New returns a session for the given name without adding it to the
+// registry. If its impersonation expired, the original session is
+// restored.
+func (s *ImpersonationStore) New(r *http.Request, name string) (*Session, error) {
+	session, err := s.Store.New(r, name)
+	if session == nil {
+		return nil, err
+	}
+	session.store = s
+	if imp, ok := CurrentImpersonation(session); ok && !time.Now().Before(imp.Expires) {
+		s.restore(session, "expire")
+	}
+	return session, err
+}
+
+// Save saves the session in the wrapped store.
+func (s *ImpersonationStore) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	return s.Store.Save(r, w, session)
+}
+
+// Delete deletes the session from the wrapped store. Deleting an
+// impersonation session also deletes the original session.
+func (s *ImpersonationStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	return deleteSession(s.Store, r, w, session)
+}
+
+// Impersonate turns session into an empty session in which admin acts as
+// user for at most ttl, capped to MaxLifetime. The caller then sets the
+// values identifying user, and saves the session.
+func (s *ImpersonationStore) Impersonate(session *Session, admin, user string,
+	ttl time.Duration) error {
+	if _, ok := CurrentImpersonation(session); ok {
+		return ErrImpersonating
+	}
+	if s.MaxLifetime > 0 && ttl > s.MaxLifetime {
+		ttl = s.MaxLifetime
+	}
+	now := time.Now()
+	imp := Impersonation{
+		Admin:   admin,
+		User:    user,
+		Started: now,
+		Expires: now.Add(ttl),
+	}
+	original := session.Values
+	session.Values = map[interface{}]interface{}{
+		impersonationKey:     imp,
+		impersonationOrigKey: original,
+	}
+	s.emit(session, "start", imp, now)
+	return nil
+}
+
+// EndImpersonation restores the original session of the administrator.
+// The caller then saves the session.
+func (s *ImpersonationStore) EndImpersonation(session *Session) error {
+	if !s.restore(session, "end") {
+		return ErrNotImpersonating
+	}
+	return nil
+}
+
+// restore replaces an impersonation session by the original session and
+// emits an event of the given kind.
+func (s *ImpersonationStore) restore(session *Session, kind string) bool {
+	imp, ok := CurrentImpersonation(session)
+	if !ok {
+		return false
+	}
+	original, _ := session.Values[impersonationOrigKey].(map[interface{}]interface{})
+	if original == nil {
+		original = make(map[interface{}]interface{})
+	}
+	session.Values = original
+	s.emit(session, kind, imp, time.Now())
+	return true
+}
+
+// emit calls OnEvent, if set.
+func (s *ImpersonationStore) emit(session *Session, kind string,
+	imp Impersonation, now time.Time) {
+	if s.OnEvent != nil {
+		s.OnEvent(ImpersonationEvent{
+			Kind:          kind,
+			Name:          session.Name(),
+			Impersonation: imp,
+			Time:          now,
+		})
+	}
+}
+
+// CurrentImpersonation returns the impersonation of the session, if any.
+func CurrentImpersonation(session *Session) (Impersonation, bool) {
+	imp, ok := session.Values[impersonationKey].(Impersonation)
+	return imp, ok
+}
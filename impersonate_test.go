@@ -0,0 +1,78 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestImpersonationStore(t *testing.T) {
+	var events []string
+	store := NewImpersonationStore(NewCookieStore([]byte("some key")), time.Hour)
+	store.OnEvent = func(e ImpersonationEvent) {
+		events = append(events, e.Kind+":"+e.Impersonation.Admin+">"+e.Impersonation.User)
+	}
+	roundTrip := func(session *Session) *Session {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		w := httptest.NewRecorder()
+		if err := session.Save(req, w); err != nil {
+			t.Fatal("failed to save session", err)
+		}
+		req.AddCookie(w.Result().Cookies()[0])
+		session, err := store.New(req, "s")
+		if err != nil {
+			t.Fatal("failed to load session", err)
+		}
+		return session
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	session.Values["user"] = "admin"
+	if err := store.Impersonate(session, "admin", "gopher", 24*time.Hour); err != nil {
+		t.Fatal("failed to impersonate", err)
+	}
+	if err := store.Impersonate(session, "admin", "other", time.Hour); !errors.Is(err, ErrImpersonating) {
+		t.Fatalf("expected ErrImpersonating, got %v", err)
+	}
+	session.Values["user"] = "gopher"
+	session = roundTrip(session)
+	imp, ok := CurrentImpersonation(session)
+	if !ok || session.Values["user"] != "gopher" || imp.Expires.Sub(imp.Started) != time.Hour {
+		t.Fatalf("bad impersonation: %+v, %v", imp, session.Values)
+	}
+
+	if err := store.EndImpersonation(session); err != nil {
+		t.Fatal("failed to end impersonation", err)
+	}
+	if session = roundTrip(session); session.Values["user"] != "admin" {
+		t.Fatalf("expected the admin session to be restored: %v", session.Values)
+	}
+	if err := store.EndImpersonation(session); !errors.Is(err, ErrNotImpersonating) {
+		t.Fatalf("expected ErrNotImpersonating, got %v", err)
+	}
+
+	// Expired impersonations are ended when the session is loaded.
+	_ = store.Impersonate(session, "admin", "gopher", -time.Second)
+	session.Values["user"] = "gopher"
+	if session = roundTrip(session); session.Values["user"] != "admin" {
+		t.Fatalf("expected the admin session to be restored: %v", session.Values)
+	}
+
+	want := []string{"start:admin>gopher", "end:admin>gopher", "start:admin>gopher", "expire:admin>gopher"}
+	if len(events) != len(want) {
+		t.Fatalf("bad events: got %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("bad events: got %v, want %v", events, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestIsNew pins when stores report sessions as new: IsNew is false only
+// when a valid, unexpired cookie was decoded and, for server-side stores,
+// its data was found.
+func TestIsNew(t *testing.T) {
+	key := []byte("some key")
+	cookie := NewCookieStore(key)
+	fsys := NewFilesystemStore(t.TempDir(), key)
+	object := NewObjectStore(&memBucket{objects: make(map[string][]byte)}, key)
+	cassandra := NewCassandraStore(&memCQL{rows: make(map[string]string),
+		ttls: make(map[string]int)}, "sessions.s", key)
+	field := NewFieldStore(&memFields{sessions: make(map[string]map[string][]byte)}, key)
+	for name, tc := range map[string]struct {
+		store   Store
+		options *Options
+	}{
+		"cookie":     {cookie, cookie.Options},
+		"filesystem": {fsys, fsys.Options},
+		"object":     {object, object.Options},
+		"cassandra":  {cassandra, cassandra.Options},
+		"field":      {field, field.Options},
+	} {
+		check := func(c *http.Cookie, wantNew, wantErr bool) {
+			t.Helper()
+			req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+			if c != nil {
+				req.AddCookie(c)
+			}
+			session, err := tc.store.New(req, "s")
+			if session.IsNew != wantNew || (err != nil) != wantErr {
+				t.Fatalf("%s: expected IsNew=%v and error=%v, got %v and %v",
+					name, wantNew, wantErr, session.IsNew, err)
+			}
+			if session.IsNew && (session.ID != "" || len(session.Values) != 0) {
+				t.Fatalf("%s: expected an empty new session, got %+v", name, session)
+			}
+		}
+		valid := &http.Cookie{Name: "s", Value: encodeCookie(t, tc.store, "s", "gopher")}
+
+		// No cookie, a valid cookie and an invalid cookie.
+		check(nil, true, false)
+		check(valid, false, false)
+		check(&http.Cookie{Name: "s", Value: "invalid"}, true, true)
+
+		// Expired according to Options.Expires.
+		tc.options.Expires = time.Now().Add(-time.Minute)
+		check(valid, true, true)
+		tc.options.Expires = time.Time{}
+
+		// Server-side data missing.
+		if _, ok := tc.store.(*CookieStore); ok {
+			continue
+		}
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(valid)
+		session, _ := tc.store.New(req, "s")
+		if err := Destroy(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatalf("%s: failed to delete session: %v", name, err)
+		}
+		check(valid, true, true)
+	}
+}
+
+func TestIsNewExact(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	value := encodeCookie(t, store, "s", "gopher")
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: value})
+
+	session, err := store.NewExact(req, "s", MatchValue("user", "gopher"))
+	if err != nil || session.IsNew {
+		t.Fatalf("expected the matching session, got IsNew=%v: %v", session.IsNew, err)
+	}
+	session, err = store.NewExact(req, "s", MatchValue("user", "other"))
+	if err != nil || !session.IsNew || session.ID != "" {
+		t.Fatalf("expected a new session, got %+v: %v", session, err)
+	}
+}
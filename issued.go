@@ -0,0 +1,36 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrIssuedBeforeNotBefore is returned when decoding a session cookie
+// issued before the NotBefore time of the store.
+var ErrIssuedBeforeNotBefore = errors.New("sessions: session cookie issued before the store NotBefore time")
+
+// IssuedAt returns the time the session cookie of the request was issued,
+// as recorded by securecookie, or the zero time for new sessions and
+// cookies encoded by other codecs. The timestamp is authenticated along
+// with the cookie, so it can't be forged by the client.
+func (s *Session) IssuedAt() time.Time {
+	return s.issuedAt
+}
+
+// checkIssuedAt records the timestamp of the decoded cookie value in
+// session, and returns ErrIssuedBeforeNotBefore if it is before notBefore.
+// Cookies without a timestamp are rejected when notBefore is set.
+func checkIssuedAt(session *Session, value string, notBefore time.Time) error {
+	session.issuedAt = time.Time{}
+	if t, ok := cookieTimestamp(value); ok {
+		session.issuedAt = time.Unix(t, 0)
+	}
+	if !notBefore.IsZero() && (session.issuedAt.IsZero() || session.issuedAt.Before(notBefore)) {
+		return ErrIssuedBeforeNotBefore
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIssuedAt(t *testing.T) {
+	for name, store := range map[string]interface {
+		Store
+		setNotBefore(time.Time)
+	}{
+		"cookie":     notBeforeCookieStore{NewCookieStore([]byte("some key"))},
+		"filesystem": notBeforeFilesystemStore{NewFilesystemStore(t.TempDir(), []byte("some key"))},
+	} {
+		before := time.Now().Add(-time.Second)
+		value := encodeCookie(t, store, "s", "gopher")
+
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(&http.Cookie{Name: "s", Value: value})
+		session, err := store.New(req, "s")
+		if err != nil {
+			t.Fatalf("%s: failed to decode session: %v", name, err)
+		}
+		if issued := session.IssuedAt(); issued.Before(before) || issued.After(time.Now()) {
+			t.Fatalf("%s: bad issue time %v", name, issued)
+		}
+
+		store.setNotBefore(time.Now().Add(time.Hour))
+		session, err = store.New(req, "s")
+		if !errors.Is(err, ErrIssuedBeforeNotBefore) {
+			t.Fatalf("%s: expected ErrIssuedBeforeNotBefore, got %v", name, err)
+		}
+		if !session.IsNew || len(session.Values) != 0 || session.ID != "" {
+			t.Fatalf("%s: expected a new session, got %+v", name, session)
+		}
+	}
+}
+
+type notBeforeCookieStore struct{ *CookieStore }
+
+func (s notBeforeCookieStore) setNotBefore(t time.Time) { s.NotBefore = t }
+
+type notBeforeFilesystemStore struct{ *FilesystemStore }
+
+func (s notBeforeFilesystemStore) setNotBefore(t time.Time) { s.NotBefore = t }
@@ -0,0 +1,312 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// ErrNoJWKSKeys is returned when a JSON Web Key Set holds no symmetric
+// signing keys.
+var ErrNoJWKSKeys = errors.New("sessions: key set has no usable keys")
+
+// DefaultJWKSRefresh is how long a JWKS caches a key set when Refresh is
+// zero.
+const DefaultJWKSRefresh = time.Hour
+
+// jwksRetry bounds how often a key set is fetched again after a failed
+// fetch, or to look for a key that signed a cookie no known key verifies.
+const jwksRetry = time.Minute
+
+// maxJWKSSize bounds the size of a key set document.
+const maxJWKSSize = 1 << 20
+
+// NewJWKS returns a JWKS fetching the key set at url, cached for refresh.
+func NewJWKS(url string, refresh time.Duration) *JWKS {
+	return &JWKS{
+		URL:     url,
+		Refresh: refresh,
+	}
+}
+
+// JWKS is a source of codec keys published as a JSON Web Key Set
+// (RFC 7517), so the keys validating sessions can be distributed to other
+// services with standard discovery, and rotated by publishing a new set.
+//
+// Symmetric keys ("kty": "oct") are used, in the order of the set: the
+// first one signs new cookies and the others only verify cookies, so a new
+// key is rolled out by prepending it and an old one retired by removing
+// it. A key with "use": "enc" is the encryption key of the signing key
+// with the same "kid". Other keys are ignored.
+//
+// Use Codec as the codec of a store to follow rotations, or pass the JWKS
+// to WithKeyProvider to read the keys once.
+type JWKS struct {
+	URL string
+	// Client fetches the key set. If nil, a client with a 10 second
+	// timeout is used.
+	Client *http.Client
+	// Refresh is how long the key set is cached. If zero,
+	// DefaultJWKSRefresh is used.
+	Refresh time.Duration
+	// Configure, if set, is called with each codec created from the keys,
+	// for example to set its MaxAge or serializer, since stores don't
+	// configure codecs they don't know.
+	Configure func(*securecookie.SecureCookie)
+
+	mu       sync.Mutex
+	codecs   []securecookie.Codec
+	pairs    [][]byte
+	next     time.Time
+	fetched  time.Time
+	inflight *jwksFetch
+}
+
+// jwksFetch is a fetch of a key set in progress.
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// jwk is a JSON Web Key, restricted to the members used here.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+}
+
+// Fetch fetches the key set now, replacing the cached keys if it holds
+// usable keys. If the key set is already being fetched, Fetch waits for
+// that fetch instead.
+func (k *JWKS) Fetch(ctx context.Context) error {
+	return k.fetch(ctx, true)
+}
+
+// KeyPairs returns the key pairs of the key set, fetching it if the cache
+// is stale, or nil if it can't be fetched.
+func (k *JWKS) KeyPairs() [][]byte {
+	pairs, _, _ := k.keys()
+	return pairs
+}
+
+// Codec returns a codec encoding with the current signing key and
+// decoding with any key of the set, following key rotations.
+func (k *JWKS) Codec() securecookie.Codec {
+	return jwksCodec{k}
+}
+
+// current returns the codecs of the key set, refreshing it if the cache
+// is stale.
+func (k *JWKS) current() ([]securecookie.Codec, error) {
+	_, codecs, err := k.keys()
+	if len(codecs) == 0 {
+		if err == nil {
+			err = ErrNoJWKSKeys
+		}
+		return nil, err
+	}
+	return codecs, nil
+}
+
+// keys returns the cached key set, fetching it first if the cache is
+// stale. While another goroutine fetches it, the cached keys are returned
+// without waiting, unless there are none yet.
+func (k *JWKS) keys() ([][]byte, []securecookie.Codec, error) {
+	k.mu.Lock()
+	stale := !time.Now().Before(k.next)
+	cached := k.codecs != nil
+	k.mu.Unlock()
+	var err error
+	if stale {
+		err = k.fetch(context.Background(), !cached)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.pairs, k.codecs, err
+}
+
+// reload fetches the key set unless it was fetched within jwksRetry, and
+// returns the new codecs, or false if it wasn't fetched.
+func (k *JWKS) reload() ([]securecookie.Codec, bool) {
+	k.mu.Lock()
+	recent := time.Since(k.fetched) < jwksRetry
+	k.mu.Unlock()
+	if recent || k.fetch(context.Background(), true) != nil {
+		return nil, false
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.codecs, true
+}
+
+// fetch fetches the key set without holding k.mu, so the cached keys stay
+// available meanwhile. Only one goroutine fetches at a time: if a fetch is
+// in progress, fetch waits for it and returns its error when wait is set,
+// and returns nil right away otherwise. Cached keys are kept when a fetch
+// fails, and fetching is retried after jwksRetry.
+func (k *JWKS) fetch(ctx context.Context, wait bool) error {
+	k.mu.Lock()
+	if f := k.inflight; f != nil {
+		k.mu.Unlock()
+		if !wait {
+			return nil
+		}
+		select {
+		case <-f.done:
+			return f.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	f := &jwksFetch{done: make(chan struct{})}
+	k.inflight = f
+	k.fetched = time.Now()
+	k.mu.Unlock()
+
+	pairs, codecs, err := k.download(ctx)
+
+	now := time.Now()
+	k.mu.Lock()
+	if err == nil {
+		refresh := k.Refresh
+		if refresh <= 0 {
+			refresh = DefaultJWKSRefresh
+		}
+		k.pairs, k.codecs, k.next = pairs, codecs, now.Add(refresh)
+	} else if retry := now.Add(jwksRetry); k.next.Before(retry) {
+		k.next = retry
+	}
+	k.inflight = nil
+	k.mu.Unlock()
+	f.err = err
+	close(f.done)
+	return err
+}
+
+// download fetches and parses the key set.
+func (k *JWKS) download(ctx context.Context) ([][]byte, []securecookie.Codec, error) {
+	client := k.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.URL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("sessions: fetching key set: %s", resp.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	body := io.LimitReader(resp.Body, maxJWKSSize)
+	if err = json.NewDecoder(body).Decode(&set); err != nil {
+		return nil, nil, fmt.Errorf("sessions: decoding key set: %w", err)
+	}
+	pairs, err := jwksKeyPairs(set.Keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	codecs := securecookie.CodecsFromPairs(pairs...)
+	for _, codec := range codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok && k.Configure != nil {
+			k.Configure(sc)
+		}
+	}
+	return pairs, codecs, nil
+}
+
+// jwksKeyPairs returns the key pairs of the symmetric keys of a set.
+func jwksKeyPairs(keys []jwk) ([][]byte, error) {
+	enc := make(map[string][]byte)
+	for _, key := range keys {
+		if key.Kty == "oct" && key.Use == "enc" && key.Kid != "" {
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil {
+				return nil, fmt.Errorf("sessions: key %q: %w", key.Kid, err)
+			}
+			enc[key.Kid] = secret
+		}
+	}
+	var pairs [][]byte
+	for _, key := range keys {
+		if key.Kty != "oct" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		secret, err := base64.RawURLEncoding.DecodeString(key.K)
+		if err != nil {
+			return nil, fmt.Errorf("sessions: key %q: %w", key.Kid, err)
+		}
+		// Pairs are flattened: the encryption key, possibly nil, always
+		// follows its signing key.
+		pairs = append(pairs, secret, enc[key.Kid])
+	}
+	if len(pairs) == 0 {
+		return nil, ErrNoJWKSKeys
+	}
+	return pairs, nil
+}
+
+// jwksCodec is a codec using the current keys of a JWKS.
+type jwksCodec struct {
+	k *JWKS
+}
+
+func (c jwksCodec) Encode(name string, value interface{}) (string, error) {
+	codecs, err := c.k.current()
+	if err != nil {
+		return "", err
+	}
+	return securecookie.EncodeMulti(name, value, codecs...)
+}
+
+// Decode decodes with any key of the set. If no key verifies the value,
+// the set is fetched again, at most once per jwksRetry, in case a new key
+// was published since it was cached.
+func (c jwksCodec) Decode(name, value string, dst interface{}) error {
+	codecs, err := c.k.current()
+	if err != nil {
+		return err
+	}
+	if err = securecookie.DecodeMulti(name, value, dst, codecs...); err == nil ||
+		!macInvalid(err) {
+		return err
+	}
+	if codecs, ok := c.k.reload(); ok {
+		return securecookie.DecodeMulti(name, value, dst, codecs...)
+	}
+	return err
+}
+
+// macInvalid reports whether err means no codec verified the value.
+func macInvalid(err error) bool {
+	multi, ok := err.(securecookie.MultiError)
+	if !ok {
+		return err == securecookie.ErrMacInvalid
+	}
+	for _, e := range multi {
+		if e != securecookie.ErrMacInvalid {
+			return false
+		}
+	}
+	return true
+}
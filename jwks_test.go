@@ -0,0 +1,176 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// keySetServer serves a JSON Web Key Set of symmetric keys.
+type keySetServer struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (s *keySetServer) set(keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func (s *keySetServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jwks []string
+	for _, k := range s.keys {
+		jwks = append(jwks, fmt.Sprintf(`{"kty":"oct","kid":%q,"k":%q}`,
+			k, base64.RawURLEncoding.EncodeToString([]byte("key "+k))))
+	}
+	jwks = append(jwks, `{"kty":"RSA","kid":"ignored","n":"AQAB","e":"AQAB"}`)
+	fmt.Fprintf(w, `{"keys":[%s]}`, strings.Join(jwks, ","))
+}
+
+func TestJWKS(t *testing.T) {
+	server := &keySetServer{}
+	server.set("a")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	jwks := NewJWKS(ts.URL, time.Hour)
+	store := NewCookieStore()
+	store.Codecs = []securecookie.Codec{jwks.Codec()}
+	cookieA := encodeCookie(t, store, "s", "gopher")
+
+	decode := func(value string) error {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(&http.Cookie{Name: "s", Value: value})
+		_, err := store.New(req, "s")
+		return err
+	}
+
+	// A new key signs new cookies while the old one still verifies.
+	server.set("b", "a")
+	if err := jwks.Fetch(context.Background()); err != nil {
+		t.Fatal("failed to fetch key set", err)
+	}
+	cookieB := encodeCookie(t, store, "s", "gopher")
+	if err := decode(cookieA); err != nil {
+		t.Fatal("failed to decode cookie signed with the old key", err)
+	}
+	if securecookie.New([]byte("key b"), nil).Decode("s", cookieB, new(map[interface{}]interface{})) != nil {
+		t.Fatal("expected new cookies to be signed with the first key")
+	}
+
+	// Cookies signed by a key published since the set was cached are
+	// verified after fetching it again.
+	server.set("c")
+	other := NewCookieStore([]byte("key c"))
+	cookieC := encodeCookie(t, other, "s", "gopher")
+	if err := decode(cookieC); err == nil {
+		t.Fatal("expected the set not to be fetched again so soon")
+	}
+	jwks.mu.Lock()
+	jwks.fetched = time.Time{}
+	jwks.mu.Unlock()
+	if err := decode(cookieC); err != nil {
+		t.Fatal("failed to decode cookie signed with a new key", err)
+	}
+	if err := decode(cookieA); err == nil {
+		t.Fatal("expected the retired key to be rejected")
+	}
+
+	if pairs := jwks.KeyPairs(); len(pairs) != 2 || string(pairs[0]) != "key c" || pairs[1] != nil {
+		t.Fatalf("bad key pairs: %q", pairs)
+	}
+}
+
+func TestJWKSEncryptionKey(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"keys":[{"kty":"oct","kid":"1","use":"sig","k":%q},{"kty":"oct","kid":"1","use":"enc","k":%q}]}`,
+			base64.RawURLEncoding.EncodeToString([]byte("signing key")),
+			base64.RawURLEncoding.EncodeToString([]byte("0123456789abcdef")))
+	}))
+	defer ts.Close()
+
+	store := NewCookieStoreWithOptions(WithKeyProvider(NewJWKS(ts.URL, 0)))
+	value := encodeCookie(t, store, "s", "gopher")
+	if securecookie.New([]byte("signing key"), nil).Decode("s", value, new(map[interface{}]interface{})) == nil {
+		t.Fatal("expected the cookie to be encrypted")
+	}
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: value})
+	if session, err := store.New(req, "s"); err != nil || session.Values["user"] != "gopher" {
+		t.Fatalf("failed to decode session: %v", err)
+	}
+}
+
+func TestJWKSFetchOutsideLock(t *testing.T) {
+	server := &keySetServer{}
+	server.set("a")
+	var requests atomic.Int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			<-release
+		}
+		server.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	jwks := NewJWKS(ts.URL, time.Hour)
+	if err := jwks.Fetch(context.Background()); err != nil {
+		t.Fatal("failed to fetch key set", err)
+	}
+	jwks.mu.Lock()
+	jwks.next = time.Time{}
+	jwks.mu.Unlock()
+
+	// One goroutine refreshes the stale set while the others keep using
+	// the cached keys.
+	refreshed := make(chan error)
+	go func() {
+		_, err := jwks.current()
+		refreshed <- err
+	}()
+	for requests.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := jwks.Codec().Encode("s", "gopher"); err != nil {
+			t.Fatal("failed to encode with the cached keys", err)
+		}
+	}
+	close(release)
+	if err := <-refreshed; err != nil {
+		t.Fatal("failed to refresh key set", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestJWKSSizeLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"padding":%q,"keys":[{"kty":"oct","k":"a2V5"}]}`,
+			strings.Repeat("x", maxJWKSSize))
+	}))
+	defer ts.Close()
+
+	if err := NewJWKS(ts.URL, 0).Fetch(context.Background()); err == nil {
+		t.Fatal("expected an oversized key set to be rejected")
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/gorilla/securecookie"
+)
+
+// ErrDecodeLimitExceeded is returned when a session payload exceeds the
+// configured DecodeLimits.
+var ErrDecodeLimitExceeded = errors.New("sessions: decode limit exceeded")
+
+// DecodeLimits restricts the size and shape of decoded session data, so a
+// crafted cookie or a poisoned server-side record can't exhaust memory.
+//
+// With securecookie.GobEncoder and TypedJSONEncoder, MaxValues and
+// MaxDepth are enforced before the values exceeding them are decoded: gob
+// payloads are scanned before decoding, and TypedJSONEncoder checks each
+// nested map or list before decoding its elements. With other serializers
+// they are checked once the payload is decoded, so set MaxBytes as well.
+//
+// A zero value for any field means no limit.
+type DecodeLimits struct {
+	// MaxBytes is the maximum size of the serialized payload, checked after
+	// authentication and decryption and before deserialization.
+	MaxBytes int
+	// MaxValues is the maximum number of values in the payload, counting the
+	// elements of nested maps, slices and arrays and the fields of structs.
+	MaxValues int
+	// MaxDepth is the maximum nesting depth of maps, slices, arrays and
+	// structs. The session values map itself has depth 1.
+	MaxDepth int
+}
+
+// LimitSerializer returns a serializer that enforces limits when
+// deserializing with sz. Serialization is not affected.
+//
+// If sz is nil securecookie.GobEncoder is used. If sz already enforces
+// limits, they are replaced.
+func LimitSerializer(sz securecookie.Serializer, limits DecodeLimits) securecookie.Serializer {
+	if l, ok := sz.(limitSerializer); ok {
+		sz = l.Serializer
+	}
+	if sz == nil {
+		sz = securecookie.GobEncoder{}
+	}
+	return limitSerializer{Serializer: sz, limits: limits}
+}
+
+// limitSerializer wraps a serializer and enforces DecodeLimits.
+type limitSerializer struct {
+	securecookie.Serializer
+	limits DecodeLimits
+}
+
+// Deserialize decodes src into dst and checks the result against the limits.
+// On failure dst is cleared so partially decoded data is never exposed.
+func (l limitSerializer) Deserialize(src []byte, dst interface{}) error {
+	if l.limits.MaxBytes > 0 && len(src) > l.limits.MaxBytes {
+		return fmt.Errorf("%w: payload is %d bytes, limit is %d",
+			ErrDecodeLimitExceeded, len(src), l.limits.MaxBytes)
+	}
+	if l.limits.MaxValues <= 0 && l.limits.MaxDepth <= 0 {
+		return l.Serializer.Deserialize(src, dst)
+	}
+	switch sz := l.Serializer.(type) {
+	case TypedJSONEncoder:
+		err := sz.deserialize(src, dst, &limitWalker{limits: l.limits})
+		if errors.Is(err, ErrDecodeLimitExceeded) {
+			clearValue(dst)
+		}
+		return err
+	case securecookie.GobEncoder:
+		// Malformed payloads are left for encoding/gob to report.
+		if err := scanGob(src, l.limits); errors.Is(err, ErrDecodeLimitExceeded) {
+			return err
+		}
+	}
+	if err := l.Serializer.Deserialize(src, dst); err != nil {
+		return err
+	}
+	w := limitWalker{limits: l.limits}
+	if err := w.walk(reflect.ValueOf(dst), 0); err != nil {
+		clearValue(dst)
+		return err
+	}
+	return nil
+}
+
+// limitWalker counts values and nesting depth of a decoded payload.
+type limitWalker struct {
+	limits DecodeLimits
+	values int
+}
+
+func (w *limitWalker) walk(v reflect.Value, depth int) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+	default:
+		return nil
+	}
+	depth++
+	if err := w.enter(depth); err != nil {
+		return err
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if err := w.count(v.Len()); err != nil {
+			return err
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := w.walk(iter.Key(), depth); err != nil {
+				return err
+			}
+			if err := w.walk(iter.Value(), depth); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if err := w.count(v.Len()); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := w.walk(v.Index(i), depth); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		if err := w.count(v.NumField()); err != nil {
+			return err
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if err := w.walk(v.Field(i), depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// enter checks the depth of a nested map, slice, array or struct.
+func (w *limitWalker) enter(depth int) error {
+	if w.limits.MaxDepth > 0 && depth > w.limits.MaxDepth {
+		return fmt.Errorf("%w: nesting deeper than %d",
+			ErrDecodeLimitExceeded, w.limits.MaxDepth)
+	}
+	return nil
+}
+
+// count adds n values to the count.
+func (w *limitWalker) count(n int) error {
+	w.values += n
+	if w.limits.MaxValues > 0 && w.values > w.limits.MaxValues {
+		return fmt.Errorf("%w: more than %d values",
+			ErrDecodeLimitExceeded, w.limits.MaxValues)
+	}
+	return nil
+}
+
+// clearValue resets the value pointed to by dst.
+func clearValue(dst interface{}) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	v = v.Elem()
+	if v.Kind() == reflect.Map && !v.IsNil() {
+		v.Clear()
+		return
+	}
+	v.Set(reflect.Zero(v.Type()))
+}
+
+// setSerializer sets sz on the codecs, wrapped to enforce limits if not
+// nil. If sz is nil, the serializer of each codec is kept: the serializer
+// set on PASETO, deterministic and passphrase codecs, and gob for
+// securecookie codecs, whose serializer can't be read back.
+func setSerializer(codecs []securecookie.Codec, sz securecookie.Serializer, limits *DecodeLimits) {
+	if sz == nil && limits == nil {
+		return
+	}
+	wrap := func(current securecookie.Serializer) securecookie.Serializer {
+		if sz != nil {
+			current = sz
+		}
+		if limits != nil {
+			return LimitSerializer(current, *limits)
+		}
+		return current
+	}
+	for _, codec := range codecs {
+		switch c := codec.(type) {
+		case *securecookie.SecureCookie:
+			c.SetSerializer(wrap(securecookie.GobEncoder{}))
+		case *DeterministicCodec:
+			c.SetSerializer(wrap(c.sz))
+		case *PASETOCodec:
+			c.SetSerializer(wrap(c.sz))
+		case *PassphraseCodec:
+			c.mu.Lock()
+			current := c.sz
+			c.mu.Unlock()
+			if current == nil {
+				current = securecookie.GobEncoder{}
+			}
+			c.SetSerializer(wrap(current))
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestDecodeLimits(t *testing.T) {
+	tests := []struct {
+		limits DecodeLimits
+		values map[interface{}]interface{}
+		fail   bool
+	}{
+		{DecodeLimits{}, map[interface{}]interface{}{"a": strings.Repeat("x", 1024)}, false},
+		{DecodeLimits{MaxBytes: 256}, map[interface{}]interface{}{"a": strings.Repeat("x", 1024)}, true},
+		{DecodeLimits{MaxBytes: 4096}, map[interface{}]interface{}{"a": strings.Repeat("x", 1024)}, false},
+		{DecodeLimits{MaxValues: 2}, map[interface{}]interface{}{"a": 1, "b": 2}, false},
+		{DecodeLimits{MaxValues: 2}, map[interface{}]interface{}{"a": 1, "b": 2, "c": 3}, true},
+		{DecodeLimits{MaxValues: 3}, map[interface{}]interface{}{"a": []interface{}{1, 2, 3}}, true},
+		{DecodeLimits{MaxDepth: 2}, map[interface{}]interface{}{"a": []interface{}{1}}, false},
+		{DecodeLimits{MaxDepth: 2}, map[interface{}]interface{}{"a": []interface{}{[]interface{}{1}}}, true},
+	}
+	for i, v := range tests {
+		store := NewCookieStore([]byte("secret-key"))
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		w := httptest.NewRecorder()
+		session := NewSession(store, "limits")
+		session.Values = v.values
+		if err := session.Save(req, w); err != nil {
+			t.Fatalf("%v: failed to save session: %v", i+1, err)
+		}
+
+		store.LimitDecoding(v.limits)
+		req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+		req.Header.Add("Cookie", w.Header().Get("Set-Cookie"))
+		session, err := store.New(req, "limits")
+		if v.fail {
+			if !errors.Is(err, ErrDecodeLimitExceeded) {
+				t.Fatalf("%v: expected ErrDecodeLimitExceeded, got %v", i+1, err)
+			}
+			if len(session.Values) != 0 {
+				t.Fatalf("%v: expected no values, got %v", i+1, session.Values)
+			}
+		} else if err != nil {
+			t.Fatalf("%v: failed to decode session: %v", i+1, err)
+		}
+	}
+}
+
+// limitsItem is a registered type nesting values of other types in an
+// interface, so gob defines their types within the value.
+type limitsItem struct {
+	Name  string
+	Tags  []string
+	Attrs map[string]int
+	Next  interface{}
+}
+
+type limitsLeaf struct {
+	Values [3]float64
+	When   time.Time
+}
+
+func init() {
+	gob.Register(limitsItem{})
+	gob.Register(limitsLeaf{})
+	gob.Register([]interface{}{})
+	gob.Register(map[string]interface{}{})
+}
+
+func TestScanGob(t *testing.T) {
+	tests := []map[interface{}]interface{}{
+		{},
+		{"a": 1, 2: "b", "c": nil, "d": []byte("bytes"), "e": 1.5, "f": complex(1, 2), "g": true},
+		{"flashes": []interface{}{"a", 1, nil, []interface{}{"nested"}}},
+		{"m": map[string]interface{}{"x": map[string]interface{}{"y": []interface{}{1}}}},
+		{"item": limitsItem{Name: "a", Tags: []string{"x", "y"}, Attrs: map[string]int{"k": 1}}},
+		{"item": limitsItem{Next: limitsItem{Next: limitsLeaf{
+			Values: [3]float64{1, 2, 3}, When: time.Now()}}}},
+		{"leaf": limitsLeaf{}, "items": []interface{}{limitsItem{Next: 1}, limitsItem{}}},
+	}
+	for i, values := range tests {
+		src, err := securecookie.GobEncoder{}.Serialize(values)
+		if err != nil {
+			t.Fatalf("%d: failed to serialize: %v", i, err)
+		}
+		w := limitWalker{}
+		if err = w.walk(reflect.ValueOf(&values), 0); err != nil {
+			t.Fatalf("%d: failed to walk: %v", i, err)
+		}
+		// The scan parses the payload, counting at most the decoded values.
+		if err = scanGob(src, DecodeLimits{MaxValues: w.values, MaxDepth: 16}); err != nil {
+			t.Fatalf("%d: failed to scan: %v", i, err)
+		}
+	}
+
+	for i, v := range []struct {
+		limits DecodeLimits
+		values map[interface{}]interface{}
+	}{
+		{DecodeLimits{MaxValues: 50}, map[interface{}]interface{}{"a": make([]interface{}, 100)}},
+		{DecodeLimits{MaxValues: 50}, map[interface{}]interface{}{"a": make([]byte, 100)}},
+		{DecodeLimits{MaxDepth: 2}, map[interface{}]interface{}{"a": []interface{}{[]interface{}{1}}}},
+		{DecodeLimits{MaxDepth: 3}, map[interface{}]interface{}{"a": limitsItem{Next: limitsItem{Tags: []string{"x"}}}}},
+	} {
+		src, _ := securecookie.GobEncoder{}.Serialize(v.values)
+		if err := scanGob(src, v.limits); !errors.Is(err, ErrDecodeLimitExceeded) {
+			t.Fatalf("%d: expected ErrDecodeLimitExceeded, got %v", i, err)
+		}
+	}
+
+	// A slice claiming more elements than the payload holds is counted
+	// before it is decoded.
+	src, _ := securecookie.GobEncoder{}.Serialize(map[interface{}]interface{}{"a": []interface{}{1}})
+	i := bytes.LastIndexByte(src, 1) // the length of the slice
+	if src[i] != 1 {
+		t.Fatalf("unexpected encoding: %x", src)
+	}
+	src[i] = 100
+	if err := scanGob(src, DecodeLimits{MaxValues: 50}); !errors.Is(err, ErrDecodeLimitExceeded) {
+		t.Fatalf("expected ErrDecodeLimitExceeded, got %v", err)
+	}
+}
+
+// FuzzGobScan checks that scanGob never rejects a payload that encoding/gob
+// decodes within the limits: its counts are lower bounds of the decoded
+// values and depth.
+func FuzzGobScan(f *testing.F) {
+	for _, values := range []map[interface{}]interface{}{
+		{},
+		{"a": 1, 2: "b", "c": nil, "d": []byte("bytes"), "e": 1.5, "f": complex(1, 2), "g": true},
+		{"flashes": []interface{}{"a", 1, nil, []interface{}{"nested"}}},
+		{"m": map[string]interface{}{"x": map[string]interface{}{"y": []interface{}{1}}}},
+		{"item": limitsItem{Next: limitsItem{Next: limitsLeaf{
+			Values: [3]float64{1, 2, 3}, When: time.Now()}}}},
+	} {
+		src, err := securecookie.GobEncoder{}.Serialize(values)
+		if err != nil {
+			f.Fatal("failed to serialize", err)
+		}
+		f.Add(src)
+	}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		var values map[interface{}]interface{}
+		if err := (securecookie.GobEncoder{}).Deserialize(src, &values); err != nil {
+			return
+		}
+		w := limitWalker{}
+		if err := w.walk(reflect.ValueOf(&values), 0); err != nil {
+			t.Fatal("failed to walk", err)
+		}
+		depth := 1
+		for ; depth < 64; depth++ {
+			dw := limitWalker{limits: DecodeLimits{MaxDepth: depth}}
+			if dw.walk(reflect.ValueOf(&values), 0) == nil {
+				break
+			}
+		}
+		limits := DecodeLimits{MaxValues: max(w.values, 1), MaxDepth: depth}
+		if err := scanGob(src, limits); err != nil && !errors.Is(err, errGobScan) {
+			t.Fatalf("bad scan of %x with %+v: %v", src, limits, err)
+		}
+	})
+}
+
+func TestLimitDecodingSerializer(t *testing.T) {
+	for _, store := range []*CookieStore{
+		NewCookieStoreWithOptions(WithKeyPairs([]byte("secret-key")),
+			WithSerializer(TypedJSONEncoder{})),
+		NewCookieStoreWithOptions(WithDeterministicEncoding(time.Hour), WithKeyPairs([]byte("secret-key"))),
+		NewCookieStoreFromPassphrase("correct horse battery staple", "example.com"),
+	} {
+		value := encodeCookie(t, store, "s", "gopher")
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(&http.Cookie{Name: "s", Value: value})
+
+		// The configured serializer is kept.
+		store.LimitDecoding(DecodeLimits{MaxValues: 8})
+		session, err := store.New(req, "s")
+		if err != nil || session.Values["user"] != "gopher" {
+			t.Fatalf("%T: failed to decode session: %v %v", store.Codecs[0], session.Values, err)
+		}
+		store.LimitDecoding(DecodeLimits{MaxBytes: 4})
+		if _, err = store.New(req, "s"); !errors.Is(err, ErrDecodeLimitExceeded) {
+			t.Fatalf("%T: expected ErrDecodeLimitExceeded, got %v", store.Codecs[0], err)
+		}
+	}
+}
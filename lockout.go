@@ -0,0 +1,124 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"encoding/gob"
+	"time"
+)
+
+// Session values key for lockout failure times.
+const lockoutKey = "_lockout"
+
+func init() {
+	gob.Register(map[string][]int64{})
+}
+
+// LockoutPolicy configures Lockout.
+type LockoutPolicy struct {
+	// MaxFailures is the number of failures within Window after which the
+	// action is locked.
+	MaxFailures int
+	// Window is the duration during which a failure is counted.
+	Window time.Duration
+}
+
+// Lockout returns the lockout state of action in session, for example to
+// lock a session out of "login" after 5 failures within 15 minutes:
+//
+//	lock := sessions.Lockout(session, "login", sessions.LockoutPolicy{
+//		MaxFailures: 5,
+//		Window:      15 * time.Minute,
+//	})
+//	if lock.Locked() {
+//		w.Header().Set("Retry-After", strconv.Itoa(int(lock.RetryAfter().Seconds())+1))
+//		http.Error(w, "too many attempts", http.StatusTooManyRequests)
+//		return
+//	}
+//	if !checkPassword(r) {
+//		lock.Fail()
+//	} else {
+//		lock.Reset()
+//	}
+//	session.Save(r, w)
+//
+// Failures are recorded in the session values, so the session must be
+// saved. With CookieStore the client can discard the cookie to reset its
+// failures; use a server-side store for protection against brute force.
+func Lockout(session *Session, action string, policy LockoutPolicy) *LockoutState {
+	return &LockoutState{session: session, action: action, policy: policy}
+}
+
+// LockoutState is the lockout state of an action in a session.
+type LockoutState struct {
+	session *Session
+	action  string
+	policy  LockoutPolicy
+}
+
+// Locked reports whether the action is locked.
+func (l *LockoutState) Locked() bool {
+	return l.RetryAfter() > 0
+}
+
+// RetryAfter returns the time left until the action is unlocked, or 0 if
+// it is not locked.
+func (l *LockoutState) RetryAfter() time.Duration {
+	failures := l.failures(time.Now())
+	if l.policy.MaxFailures <= 0 || len(failures) < l.policy.MaxFailures {
+		return 0
+	}
+	// The action is unlocked when enough failures leave the window.
+	oldest := failures[len(failures)-l.policy.MaxFailures]
+	return time.Until(time.Unix(0, oldest).Add(l.policy.Window))
+}
+
+// Fail records a failure and reports whether the action is now locked.
+func (l *LockoutState) Fail() bool {
+	now := time.Now()
+	failures := append(l.failures(now), now.UnixNano())
+	if n := l.policy.MaxFailures; n > 0 && len(failures) > n {
+		failures = failures[len(failures)-n:]
+	}
+	l.set(failures)
+	return l.Locked()
+}
+
+// Reset forgets the failures, for example after a successful attempt.
+func (l *LockoutState) Reset() {
+	l.set(nil)
+}
+
+// failures returns the failure times within the window, oldest first.
+func (l *LockoutState) failures(now time.Time) []int64 {
+	all, _ := l.session.Values[lockoutKey].(map[string][]int64)
+	cutoff := now.Add(-l.policy.Window).UnixNano()
+	var failures []int64
+	for _, t := range all[l.action] {
+		if t > cutoff {
+			failures = append(failures, t)
+		}
+	}
+	return failures
+}
+
+// set stores the failure times of the action.
+func (l *LockoutState) set(failures []int64) {
+	all, _ := l.session.Values[lockoutKey].(map[string][]int64)
+	if all == nil {
+		all = make(map[string][]int64)
+	}
+	if len(failures) == 0 {
+		delete(all, l.action)
+	} else {
+		all[l.action] = failures
+	}
+	if len(all) == 0 {
+		delete(l.session.Values, lockoutKey)
+	} else {
+		l.session.initValues()
+		l.session.Values[lockoutKey] = all
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	policy := LockoutPolicy{MaxFailures: 3, Window: time.Minute}
+
+	lock := Lockout(session, "login", policy)
+	for i := 0; i < 2; i++ {
+		if lock.Fail() {
+			t.Fatalf("locked after %d failures", i+1)
+		}
+	}
+	if !lock.Fail() || !lock.Locked() {
+		t.Fatal("expected the action to be locked")
+	}
+	if d := lock.RetryAfter(); d <= 0 || d > time.Minute {
+		t.Fatalf("bad retry delay: %v", d)
+	}
+	if Lockout(session, "reset", policy).Locked() {
+		t.Fatal("expected other actions to be unlocked")
+	}
+
+	// The state is saved with the session.
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to load session", err)
+	}
+	lock = Lockout(session, "login", policy)
+	if !lock.Locked() {
+		t.Fatal("expected the loaded session to be locked")
+	}
+	lock.Reset()
+	if lock.Locked() || len(session.Values) != 0 {
+		t.Fatalf("bad reset: %v", session.Values)
+	}
+
+	// Failures outside the window are not counted.
+	session.Values[lockoutKey] = map[string][]int64{
+		"login": {time.Now().Add(-2 * time.Minute).UnixNano(), time.Now().Add(-2 * time.Minute).UnixNano()},
+	}
+	if lock.Fail() {
+		t.Fatal("expected old failures to be ignored")
+	}
+}
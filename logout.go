@@ -0,0 +1,87 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// ErrInvalidLogoutToken is returned by LogoutSigner.Verify when a token is
+// malformed, forged or expired.
+var ErrInvalidLogoutToken = errors.New("sessions: invalid logout token")
+
+// logoutTokenName binds the signature of logout tokens to their purpose,
+// so they can't be confused with session cookies signed with the same keys.
+const logoutTokenName = "_logout"
+
+// LogoutAssertion states that a session was logged out.
+type LogoutAssertion struct {
+	// Subject identifies the user, as passed to Mint.
+	Subject string
+	// SessionID is the ID of the session, or its revocation ID for
+	// sessions of a RevocableCookieStore. It may be empty.
+	SessionID string
+	IssuedAt  time.Time
+	Expires   time.Time
+}
+
+// NewLogoutSigner returns a LogoutSigner minting tokens valid for five
+// minutes.
+//
+// See NewCookieStore() for a description of key pairs.
+func NewLogoutSigner(keyPairs ...[]byte) *LogoutSigner {
+	return &LogoutSigner{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		TTL:    5 * time.Minute,
+	}
+}
+
+// LogoutSigner mints and verifies short-lived signed logout tokens, so a
+// service logging a user out can propagate the logout to sibling services
+// sharing its keys, without shared session storage. The receiving service
+// verifies the token and ends the matching sessions, for example with
+// RevocationList.Revoke or PrincipalIndex.Remove.
+//
+// Tokens are safe to replay, since logging out twice has no effect, so
+// they are not single-use.
+type LogoutSigner struct {
+	Codecs []securecookie.Codec
+	// TTL is the lifetime of minted tokens.
+	TTL time.Duration
+}
+
+// Mint returns a token asserting that session, belonging to subject, was
+// logged out. Call it before deleting the session, which clears its ID.
+func (l *LogoutSigner) Mint(session *Session, subject string) (string, error) {
+	id := session.ID
+	if rid, ok := session.Values[revocationIDKey].(string); ok {
+		id = rid
+	}
+	now := time.Now()
+	assertion := LogoutAssertion{
+		Subject:   subject,
+		SessionID: id,
+		IssuedAt:  now,
+		Expires:   now.Add(l.TTL),
+	}
+	return encodeMulti(logoutTokenName, assertion, l.Codecs...)
+}
+
+// Verify checks the signature and expiry of a token minted by Mint and
+// returns its assertion.
+func (l *LogoutSigner) Verify(token string) (*LogoutAssertion, error) {
+	var assertion LogoutAssertion
+	if err := decodeMulti(logoutTokenName, token, &assertion, l.Codecs...); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLogoutToken, err)
+	}
+	if !time.Now().Before(assertion.Expires) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidLogoutToken)
+	}
+	return &assertion, nil
+}
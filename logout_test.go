@@ -0,0 +1,56 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLogoutSigner(t *testing.T) {
+	list := NewMemoryRevocationList()
+	store := NewRevocableCookieStore(list, []byte("some key"))
+	signer := NewLogoutSigner([]byte("shared key"))
+	sibling := NewLogoutSigner([]byte("shared key"))
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	session, _ := store.New(req, "s")
+	session.Values["user"] = "gopher"
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	token, err := signer.Mint(session, "gopher")
+	if err != nil {
+		t.Fatal("failed to mint logout token", err)
+	}
+
+	assertion, err := sibling.Verify(token)
+	if err != nil {
+		t.Fatal("failed to verify logout token", err)
+	}
+	if assertion.Subject != "gopher" || assertion.SessionID != session.Values[revocationIDKey] {
+		t.Fatalf("bad assertion: %+v", assertion)
+	}
+	if err = list.Revoke(assertion.SessionID, assertion.Expires); err != nil {
+		t.Fatal("failed to revoke session", err)
+	}
+	req.AddCookie(w.Result().Cookies()[0])
+	if session, _ = store.New(req, "s"); !session.IsNew {
+		t.Fatal("expected the session to be revoked")
+	}
+
+	if _, err = NewLogoutSigner([]byte("other key")).Verify(token); !errors.Is(err, ErrInvalidLogoutToken) {
+		t.Fatalf("expected ErrInvalidLogoutToken, got %v", err)
+	}
+	signer.TTL = -time.Second
+	token, _ = signer.Mint(session, "gopher")
+	if _, err = sibling.Verify(token); !errors.Is(err, ErrInvalidLogoutToken) {
+		t.Fatalf("expected expired token to be rejected, got %v", err)
+	}
+}
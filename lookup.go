@@ -0,0 +1,80 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+)
+
+// Looker is implemented by stores that can look up an existing session
+// without creating one. The stores of this package implement it, so types
+// embedding one of them and overriding New should also override Lookup.
+type Looker interface {
+	// Lookup should return the session for the given name and true if the
+	// request carries one, and (nil, false, nil) if it doesn't or the
+	// store has no data for it.
+	Lookup(r *http.Request, name string) (*Session, bool, error)
+}
+
+// Lookup returns the session for the given name if the request carries
+// one, and reports whether it does. Unlike Store.Get and Store.New it never
+// creates a session: it returns (nil, false, nil) when the request has no
+// session cookie or the store has no data for it, so read paths such as
+// "is the user logged in?" checks don't start sessions by accident.
+//
+// Other errors, such as a session cookie that fails to decode, are
+// returned. The session is not added to the registry.
+//
+// Stores implementing Looker are called directly; for others the session
+// is loaded with Store.New.
+func Lookup(store Store, r *http.Request, name string) (*Session, bool, error) {
+	if l, ok := store.(Looker); ok {
+		return l.Lookup(r, name)
+	}
+	return lookup(store, r, name)
+}
+
+// lookup implements Lookup with store.New.
+func lookup(store Store, r *http.Request, name string) (*Session, bool, error) {
+	session, err := store.New(r, name)
+	if err != nil {
+		if isNotFound(err) {
+			err = nil
+		}
+		return nil, false, err
+	}
+	if session == nil || session.IsNew {
+		return nil, false, nil
+	}
+	return session, true, nil
+}
+
+// notFoundErrors are the errors of the stores meaning the server-side data
+// of a session doesn't exist. Stores with their own error must add it here,
+// so Lookup and the decode telemetry both recognize it.
+var notFoundErrors = []error{
+	fs.ErrNotExist,
+	ErrSessionNotFound,
+	ErrObjectNotFound,
+	ErrRowNotFound,
+	ErrItemNotFound,
+	ErrEntityNotFound,
+}
+
+// isNotFound reports whether err means the server-side data of a session
+// doesn't exist or expired.
+func isNotFound(err error) bool {
+	if errors.Is(err, errSessionFileExpired) {
+		return true
+	}
+	for _, target := range notFoundErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
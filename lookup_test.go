@@ -0,0 +1,129 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	store := NewCookieStore([]byte("some key"))
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, ok, err := Lookup(store, req, "s")
+	if session != nil || ok || err != nil {
+		t.Fatalf("expected no session, got %v, %v, %v", session, ok, err)
+	}
+	if _, registered := GetRegistry(req).sessions["s"]; registered {
+		t.Fatal("expected Lookup not to register a session")
+	}
+
+	value := encodeCookie(t, store, "s", "gopher")
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: value})
+	session, ok, err = Lookup(store, req, "s")
+	if err != nil {
+		t.Fatal("failed to look up session", err)
+	}
+	if !ok || session.Values["user"] != "gopher" {
+		t.Fatalf("expected the session to be found, got %v", session)
+	}
+
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: "invalid"})
+	if _, ok, err = Lookup(store, req, "s"); ok || err == nil {
+		t.Fatal("expected an error for an invalid cookie")
+	}
+}
+
+func TestLookupFilesystemStore(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	value := encodeCookie(t, store, "s", "gopher")
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: value})
+	session, ok, err := Lookup(store, req, "s")
+	if err != nil || !ok {
+		t.Fatal("failed to look up session", err)
+	}
+	if err := store.fsys.Remove(store.filename(session.ID)); err != nil {
+		t.Fatal("failed to remove session file", err)
+	}
+	if session, ok, err = Lookup(store, req, "s"); session != nil || ok || err != nil {
+		t.Fatalf("expected no session, got %v, %v, %v", session, ok, err)
+	}
+}
+
+func TestLookupAzureStores(t *testing.T) {
+	container := &memContainer{items: make(map[string][]byte)}
+	table := &memTable{entities: make(map[[2]string][]byte)}
+	for _, tc := range []struct {
+		name   string
+		store  Store
+		delete func(id string)
+	}{
+		{"cosmos", NewCosmosStore(container, []byte("some key")), func(id string) {
+			delete(container.items, id)
+		}},
+		{"table", NewTableStore(table, []byte("some key")), func(id string) {
+			delete(table.entities, [2]string{id, ""})
+		}},
+	} {
+		value := encodeCookie(t, tc.store, "s", "gopher")
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(&http.Cookie{Name: "s", Value: value})
+		session, ok, err := Lookup(tc.store, req, "s")
+		if err != nil || !ok {
+			t.Fatalf("%s: failed to look up session: %v", tc.name, err)
+		}
+		tc.delete(session.ID)
+		if session, ok, err = Lookup(tc.store, req, "s"); session != nil || ok || err != nil {
+			t.Fatalf("%s: expected no session, got %v, %v, %v", tc.name, session, ok, err)
+		}
+	}
+}
+
+// lookerStore counts the calls of its Lookup method.
+type lookerStore struct {
+	*CookieStore
+	lookups int
+}
+
+func (s *lookerStore) Lookup(r *http.Request, name string) (*Session, bool, error) {
+	s.lookups++
+	return s.CookieStore.Lookup(r, name)
+}
+
+func TestLooker(t *testing.T) {
+	for _, store := range []Store{
+		NewCookieStore([]byte("some key")),
+		NewFilesystemStore(t.TempDir(), []byte("some key")),
+		NewMemoryStore([]byte("some key")),
+		NewObjectStore(&memBucket{objects: make(map[string][]byte)}, []byte("some key")),
+	} {
+		l, ok := store.(Looker)
+		if !ok {
+			t.Fatalf("%T doesn't implement Looker", store)
+		}
+		value := encodeCookie(t, store, "s", "gopher")
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(&http.Cookie{Name: "s", Value: value})
+		session, ok, err := l.Lookup(req, "s")
+		if err != nil || !ok || session.Values["user"] != "gopher" {
+			t.Fatalf("%T: bad session: %v, %v, %v", store, session, ok, err)
+		}
+		req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+		if session, ok, err = l.Lookup(req, "s"); session != nil || ok || err != nil {
+			t.Fatalf("%T: expected no session, got %v, %v, %v", store, session, ok, err)
+		}
+	}
+
+	store := &lookerStore{CookieStore: NewCookieStore([]byte("some key"))}
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	if _, _, err := Lookup(store, req, "s"); err != nil || store.lookups != 1 {
+		t.Fatalf("expected Lookup to call the store, got %d calls, %v", store.lookups, err)
+	}
+}
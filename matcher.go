@@ -0,0 +1,213 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ErrTooManyCookies is returned by NewExact when no session was found
+// within the limits set by ExactLimits, for example because a client sent
+// dozens of forged cookies with the session name.
+var ErrTooManyCookies = errors.New("sessions: too many session cookies")
+
+// DefaultMaxExactCookies is the number of cookies with the same name
+// NewExact decodes when ExactLimits.MaxCookies is zero.
+const DefaultMaxExactCookies = 10
+
+// ExactLimits bounds the work done by NewExact for a request, so clients
+// can't cheaply burn CPU by sending many forged session cookies.
+type ExactLimits struct {
+	// MaxCookies is the maximum number of cookies decoded, newest first.
+	// If zero, DefaultMaxExactCookies is used; if negative, there is no
+	// limit.
+	MaxCookies int
+	// Budget is the maximum time spent decoding cookies. If zero, there
+	// is no limit.
+	Budget time.Duration
+	// Workers is the number of cookies decoded concurrently, to cut the
+	// latency of requests carrying many cookies with the session name,
+	// for server-side stores in particular. If zero or one, cookies are
+	// decoded one at a time. The matcher is still called from the calling
+	// goroutine in the same order, so the same session is selected, but
+	// OnDecodeFailure may be called concurrently.
+	Workers int
+}
+
+// Matcher selects a session when a request carries several cookies with
+// the same name, for example a stale cookie set for a parent domain or
+// path.
+//
+// It is called with each successfully decoded session and the cookie it
+// was decoded from. Note that browsers don't send the Path and Domain
+// attributes back, so only the cookie Name and Value are set.
+type Matcher func(s *Session, c *http.Cookie) bool
+
+// Indexed returns an IndexMatcher calling m, ignoring the cookie index.
+func (m Matcher) Indexed() IndexMatcher {
+	return func(s *Session, c *http.Cookie, index int) bool {
+		return m(s, c)
+	}
+}
+
+// IndexMatcher is like Matcher but also receives the index of the cookie
+// among the cookies with the same name, in the order sent by the client.
+// It allows selecting a session by cookie order or raw value without
+// parsing the cookies again.
+type IndexMatcher func(s *Session, c *http.Cookie, index int) bool
+
+// MatchValue returns a Matcher accepting sessions where Values[key] is
+// equal to want.
+func MatchValue(key, want interface{}) Matcher {
+	return func(s *Session, c *http.Cookie) bool {
+		v, ok := s.Values[key]
+		return ok && reflect.DeepEqual(v, want)
+	}
+}
+
+// MatchNewest returns a Matcher accepting any session. Since candidates are
+// tried newest first, it selects the most recently issued valid cookie.
+func MatchNewest() Matcher {
+	return func(s *Session, c *http.Cookie) bool {
+		return true
+	}
+}
+
+// MatchByID returns a Matcher accepting the session with the given ID.
+func MatchByID(id string) Matcher {
+	return func(s *Session, c *http.Cookie) bool {
+		return s.ID == id
+	}
+}
+
+// newExact returns the first session accepted by match among the cookies
+// named name in r.
+//
+// Cookies are tried from the most to the least recently issued, according
+// to the timestamp embedded by securecookie. newSession creates an empty
+// session and decode loads a cookie into it. If no session matches, a new
+// session is returned along with the first decode error, if any, or
+// ErrTooManyCookies if limits stopped the search.
+func newExact(r *http.Request, name string, match IndexMatcher,
+	limits ExactLimits, newSession func() *Session,
+	decode func(*Session, *http.Cookie) error) (*Session, error) {
+	cookies := r.CookiesNamed(name)
+	order := make([]int, len(cookies))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		ti, _ := cookieTimestamp(cookies[order[i]].Value)
+		tj, _ := cookieTimestamp(cookies[order[j]].Value)
+		return ti > tj
+	})
+	max := limits.MaxCookies
+	if max == 0 {
+		max = DefaultMaxExactCookies
+	}
+	if limits.Workers > 1 {
+		return newExactConcurrent(cookies, order, match, max, limits,
+			newSession, decode)
+	}
+	start := time.Now()
+	var firstErr error
+	for n, i := range order {
+		if (max > 0 && n >= max) ||
+			(n > 0 && limits.Budget > 0 && time.Since(start) > limits.Budget) {
+			return newSession(), ErrTooManyCookies
+		}
+		c := cookies[i]
+		session := newSession()
+		if err := loaded(session, decode(session, c)); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if match(session, c, i) {
+			return session, nil
+		}
+	}
+	return newSession(), firstErr
+}
+
+// exactResult is the result of decoding a candidate cookie.
+type exactResult struct {
+	session *Session
+	err     error
+	// overBudget is set if the cookie wasn't decoded because the budget
+	// was spent.
+	overBudget bool
+}
+
+// newExactConcurrent is like newExact but decodes the cookies with
+// limits.Workers goroutines. cookies are sorted by order.
+func newExactConcurrent(cookies []*http.Cookie, order []int,
+	match IndexMatcher, max int, limits ExactLimits,
+	newSession func() *Session,
+	decode func(*Session, *http.Cookie) error) (*Session, error) {
+	n := len(order)
+	if max > 0 && n > max {
+		n = max
+	}
+	results := make([]chan exactResult, n)
+	for k := range results {
+		results[k] = make(chan exactResult, 1)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for k := 0; k < n; k++ {
+			select {
+			case next <- k:
+			case <-done:
+				return
+			}
+		}
+	}()
+	start := time.Now()
+	for w := 0; w < limits.Workers && w < n; w++ {
+		go func() {
+			for k := range next {
+				if k > 0 && limits.Budget > 0 && time.Since(start) > limits.Budget {
+					results[k] <- exactResult{overBudget: true}
+					continue
+				}
+				session := newSession()
+				err := loaded(session, decode(session, cookies[order[k]]))
+				results[k] <- exactResult{session: session, err: err}
+			}
+		}()
+	}
+
+	// Results are checked in order, so the first match is returned as
+	// soon as the cookies before it are known not to match.
+	var firstErr error
+	for k := 0; k < n; k++ {
+		res := <-results[k]
+		if res.overBudget {
+			return newSession(), ErrTooManyCookies
+		}
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
+		}
+		if match(res.session, cookies[order[k]], order[k]) {
+			return res.session, nil
+		}
+	}
+	if n < len(order) {
+		return newSession(), ErrTooManyCookies
+	}
+	return newSession(), firstErr
+}
@@ -0,0 +1,219 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// encodeCookie saves a session with the given user and returns the value
+// of the cookie.
+func encodeCookie(t *testing.T, store Store, name, user string) string {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	session, err := store.New(req, name)
+	if err != nil {
+		t.Fatal("failed to create session", err)
+	}
+	session.Values["user"] = user
+	if err = session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	return w.Result().Cookies()[0].Value
+}
+
+func TestNewExact(t *testing.T) {
+	store := NewCookieStore([]byte("secret-key"))
+	other := NewCookieStore([]byte("other-key"))
+	parent := encodeCookie(t, store, "s", "parent")
+	child := encodeCookie(t, store, "s", "child")
+	foreign := encodeCookie(t, other, "s", "foreign")
+	// A forged cookie claiming to be the newest must be skipped.
+	forged := base64.URLEncoding.EncodeToString([]byte("9999999999|x|y"))
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	for _, v := range []string{foreign, forged, parent, child} {
+		req.AddCookie(&http.Cookie{Name: "s", Value: v})
+	}
+
+	// Cookies issued within the same second keep the request order.
+	newest := "parent"
+	tp, _ := cookieTimestamp(parent)
+	tc, _ := cookieTimestamp(child)
+	if tc > tp {
+		newest = "child"
+	}
+
+	tests := []struct {
+		match Matcher
+		user  interface{}
+	}{
+		{MatchValue("user", "child"), "child"},
+		{MatchValue("user", "parent"), "parent"},
+		{MatchValue("user", "foreign"), nil},
+		{MatchNewest(), newest},
+		{func(s *Session, c *http.Cookie) bool { return c.Value == child }, "child"},
+	}
+	for i, v := range tests {
+		session, err := store.NewExact(req, "s", v.match)
+		if v.user == nil {
+			if !session.IsNew || err == nil {
+				t.Fatalf("%v: expected a new session and an error, got %v, %v", i+1, session.Values, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: failed to get session: %v", i+1, err)
+		}
+		if session.IsNew || session.Values["user"] != v.user {
+			t.Fatalf("%v: bad session: got %v, want user %v", i+1, session.Values, v.user)
+		}
+	}
+}
+
+func TestFilesystemStoreNewExact(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("secret-key"))
+	first := encodeCookie(t, store, "s", "first")
+	second := encodeCookie(t, store, "s", "second")
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: first})
+	req.AddCookie(&http.Cookie{Name: "s", Value: second})
+
+	session, err := store.GetExact(req, "s", MatchValue("user", "second"))
+	if err != nil {
+		t.Fatal("failed to get session", err)
+	}
+	id := session.ID
+	session, err = store.NewExact(req, "s", MatchByID(id))
+	if err != nil || session.ID != id || session.Values["user"] != "second" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+	// The registered session is returned by Get.
+	session, err = store.Get(req, "s")
+	if err != nil || session.ID != id {
+		t.Fatalf("bad registered session: %v, %v", session.ID, err)
+	}
+}
+
+func TestQueryExact(t *testing.T) {
+	store := NewCookieStore([]byte("secret-key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	for _, user := range []string{"first", "second", "third"} {
+		req.AddCookie(&http.Cookie{Name: "s", Value: encodeCookie(t, store, "s", user)})
+	}
+	session, err := store.QueryExact(req, "s", func(s *Session, c *http.Cookie, index int) bool {
+		return index == 1
+	})
+	if err != nil || session.Values["user"] != "second" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+}
+
+func TestCookiePolicy(t *testing.T) {
+	store := NewCookieStore([]byte("secret-key"))
+	stale := encodeCookie(t, NewCookieStore([]byte("other-key")), "s", "stale")
+	current := encodeCookie(t, store, "s", "current")
+	old := base64.URLEncoding.EncodeToString([]byte("100|x|y"))
+
+	for _, tc := range []struct {
+		policy  CookiePolicy
+		cookies []string
+		ok      bool
+	}{
+		{CookieFirst, []string{stale, current}, false},
+		{CookieLongestPath, []string{current, stale}, true},
+		{CookieLast, []string{stale, current}, true},
+		{CookieNewest, []string{current, old}, true},
+		{CookieNewest, []string{old, current}, true},
+	} {
+		store.CookiePolicy = tc.policy
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		for _, v := range tc.cookies {
+			req.AddCookie(&http.Cookie{Name: "s", Value: v})
+		}
+		session, err := store.New(req, "s")
+		if ok := err == nil && session.Values["user"] == "current"; ok != tc.ok {
+			t.Fatalf("policy %d: got %v, %v", tc.policy, session.Values, err)
+		}
+	}
+}
+
+func TestExactLimits(t *testing.T) {
+	store := NewCookieStore([]byte("secret-key"))
+	valid := encodeCookie(t, store, "s", "gopher")
+	forged := encodeCookie(t, NewCookieStore([]byte("other-key")), "s", "forged")
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	for i := 0; i < DefaultMaxExactCookies; i++ {
+		req.AddCookie(&http.Cookie{Name: "s", Value: forged})
+	}
+	req.AddCookie(&http.Cookie{Name: "s", Value: valid})
+
+	var decoded int
+	store.OnDecodeFailure = func(DecodeFailure) { decoded++ }
+	session, err := store.NewExact(req, "s", MatchValue("user", "gopher"))
+	if !errors.Is(err, ErrTooManyCookies) || !session.IsNew || decoded != DefaultMaxExactCookies {
+		t.Fatalf("expected ErrTooManyCookies after %d cookies, got %v after %d",
+			DefaultMaxExactCookies, err, decoded)
+	}
+	store.ExactLimits.MaxCookies = -1
+	if session, err = store.NewExact(req, "s", MatchValue("user", "gopher")); err != nil || session.IsNew {
+		t.Fatalf("bad session without limit: %v, %v", session.Values, err)
+	}
+	store.ExactLimits.Budget = time.Nanosecond
+	if _, err = store.NewExact(req, "s", MatchValue("user", "gopher")); !errors.Is(err, ErrTooManyCookies) {
+		t.Fatalf("expected the budget to be exceeded, got %v", err)
+	}
+}
+
+func TestNewExactWorkers(t *testing.T) {
+	store := NewCookieStore([]byte("secret-key"))
+	forged := encodeCookie(t, NewCookieStore([]byte("other-key")), "s", "forged")
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	for i := 0; i < 20; i++ {
+		req.AddCookie(&http.Cookie{Name: "s", Value: forged})
+		if i%5 == 4 {
+			user := fmt.Sprintf("user%d", i/5)
+			req.AddCookie(&http.Cookie{Name: "s", Value: encodeCookie(t, store, "s", user)})
+		}
+	}
+	store.ExactLimits.MaxCookies = -1
+
+	var failures atomic.Int32
+	store.OnDecodeFailure = func(DecodeFailure) { failures.Add(1) }
+	want, err := store.NewExact(req, "s", MatchNewest())
+	if err != nil {
+		t.Fatal("failed to get session", err)
+	}
+	store.ExactLimits.Workers = 4
+	for i := 0; i < 10; i++ {
+		session, err := store.NewExact(req, "s", MatchNewest())
+		if err != nil || session.Values["user"] != want.Values["user"] {
+			t.Fatalf("expected %v, got %v, %v", want.Values["user"], session.Values["user"], err)
+		}
+		if session, err = store.NewExact(req, "s", MatchValue("user", "user2")); err != nil || session.IsNew {
+			t.Fatalf("bad session: %v, %v", session.Values, err)
+		}
+	}
+	if session, err := store.NewExact(req, "s", MatchValue("user", "nobody")); err == nil || !session.IsNew {
+		t.Fatalf("expected a new session and an error, got %v, %v", session.Values, err)
+	}
+	if failures.Load() == 0 {
+		t.Fatal("expected decode failures to be reported")
+	}
+
+	store.ExactLimits.MaxCookies = 3
+	if _, err = store.NewExact(req, "s", MatchValue("user", "nobody")); !errors.Is(err, ErrTooManyCookies) {
+		t.Fatalf("expected ErrTooManyCookies, got %v", err)
+	}
+}
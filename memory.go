@@ -0,0 +1,340 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidSnapshot is returned by MemoryStore.Restore when the input
+	// is not a snapshot.
+	ErrInvalidSnapshot = errors.New("sessions: invalid snapshot")
+	// ErrSnapshotVersion is returned by MemoryStore.Restore for snapshots
+	// written in a format this version doesn't know.
+	ErrSnapshotVersion = errors.New("sessions: unsupported snapshot version")
+)
+
+// Snapshot format. The header line is followed by a line per session
+// holding its ID, the time it was saved, its encoded values and a CRC-32
+// of the rest of the line, separated by spaces. IDs and encoded values
+// never contain spaces or newlines.
+const (
+	snapshotMagic   = "gorilla/sessions memory snapshot v"
+	snapshotVersion = 1
+)
+
+// NewMemoryStore returns a new MemoryStore.
+//
+// See NewCookieStore() for a description of the parameters.
+func NewMemoryStore(keyPairs ...[]byte) *MemoryStore {
+	return NewMemoryStoreWithOptions(WithKeyPairs(keyPairs...))
+}
+
+// NewMemoryStoreWithOptions returns a new MemoryStore configured by opts.
+//
+// Options not set default to the values used by NewMemoryStore().
+func NewMemoryStoreWithOptions(opts ...StoreOption) *MemoryStore {
+	s := &MemoryStore{sessions: make(map[string]memoryEntry)}
+	s.backendStore = newBackendStore(s, newBackendConfig(opts))
+	return s
+}
+
+// MemoryStore stores sessions in memory, for tests and small deployments
+// running a single process.
+//
+// Expired sessions are removed when they are loaded, and a few are
+// checked each time a session is saved, so they don't accumulate in a busy
+// store. Purge removes all of them, and RunPurge or RunSnapshots call it
+// periodically.
+//
+// Sessions are lost when the process exits unless they are saved with
+// Snapshot, or periodically with RunSnapshots, and loaded back with
+// Restore when the process starts. Values are kept encoded with the
+// codecs, so snapshots are authenticated, and encrypted if the key pairs
+// have encryption keys.
+type MemoryStore struct {
+	// backendStore provides Codecs, Options, Entropy, PersistOptions,
+	// FlashKey and the Store methods.
+	backendStore
+	// OnSnapshotError, if set, is called by RunSnapshots when writing a
+	// snapshot fails. Snapshots are attempted again at the next interval.
+	OnSnapshotError func(error)
+
+	mu       sync.RWMutex
+	sessions map[string]memoryEntry
+}
+
+// memoryEntry is a session held by a MemoryStore.
+type memoryEntry struct {
+	data  string
+	saved time.Time
+}
+
+// purgeSample is the number of sessions checked for expiry on each save.
+const purgeSample = 4
+
+// saveSession keeps the encoded values of a session, and removes expired
+// sessions among a few others.
+func (s *MemoryStore) saveSession(ctx context.Context, session *Session, maxAge int) error {
+	encoded, err := s.encodeValues(session)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	// Map iteration starts at a random entry, so each save samples other
+	// sessions and expired ones are removed as the store is used.
+	n := 0
+	for id, e := range s.sessions {
+		if n++; n > purgeSample {
+			break
+		}
+		if s.expired(e, now) {
+			delete(s.sessions, id)
+		}
+	}
+	s.sessions[session.ID] = memoryEntry{data: encoded, saved: now}
+	s.mu.Unlock()
+	session.backendSize = len(encoded)
+	return nil
+}
+
+// deleteSession removes a session.
+func (s *MemoryStore) deleteSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of sessions held, including expired sessions not
+// removed yet.
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.sessions)
+}
+
+// Purge removes the sessions saved more than MaxAge ago and returns how
+// many were removed.
+func (s *MemoryStore) Purge() int {
+	report, _ := s.RunGC(GCOptions{})
+	return report.Deleted
+}
+
+// RunGC is like Purge but returns a report of the run, and can run without
+// removing anything. It never fails; the error is for symmetry with the
+// RunGC methods of the other stores.
+func (s *MemoryStore) RunGC(opts GCOptions) (*GCReport, error) {
+	report := newGCReport(opts)
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, e := range s.sessions {
+		report.Scanned++
+		if !s.expired(e, now) {
+			continue
+		}
+		if !opts.DryRun {
+			delete(s.sessions, id)
+		}
+		report.Deleted++
+		report.observe(now.Sub(e.saved))
+	}
+	return report, nil
+}
+
+// expired reports whether an entry is older than MaxAge.
+func (s *MemoryStore) expired(e memoryEntry, now time.Time) bool {
+	age := s.Options.MaxAge
+	return age > 0 && now.Sub(e.saved) > maxAgeDuration(age)
+}
+
+// loadSession decodes the values of a session into session.Values. An
+// expired session is removed.
+func (s *MemoryStore) loadSession(ctx context.Context, session *Session) error {
+	s.mu.RLock()
+	e, ok := s.sessions[session.ID]
+	s.mu.RUnlock()
+	if ok && s.expired(e, time.Now()) {
+		s.mu.Lock()
+		if current, found := s.sessions[session.ID]; found && current == e {
+			delete(s.sessions, session.ID)
+		}
+		s.mu.Unlock()
+		ok = false
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return s.decodeValues(session, e.data)
+}
+
+// Snapshot writes the unexpired sessions to w in a versioned format read
+// by Restore.
+func (s *MemoryStore) Snapshot(w io.Writer) error {
+	now := time.Now()
+	s.mu.RLock()
+	lines := make([]string, 0, len(s.sessions))
+	for id, e := range s.sessions {
+		if !s.expired(e, now) {
+			lines = append(lines, snapshotLine(id, e))
+		}
+	}
+	s.mu.RUnlock()
+	sort.Strings(lines)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s%d\n", snapshotMagic, snapshotVersion)
+	for _, line := range lines {
+		bw.WriteString(line)
+	}
+	return bw.Flush()
+}
+
+// Restore adds the sessions of a snapshot written by Snapshot, replacing
+// sessions with the same ID, and returns how many were restored and how
+// many were skipped.
+//
+// Loading is tolerant of corruption: lines that are truncated or fail
+// their checksum are skipped, as are expired sessions, so a damaged
+// snapshot loses only the sessions it damaged. The values themselves are
+// authenticated when sessions are loaded.
+func (s *MemoryStore) Restore(r io.Reader) (restored, skipped int, err error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, 0, err
+	}
+	v, ok := strings.CutPrefix(strings.TrimSuffix(header, "\n"), snapshotMagic)
+	if !ok {
+		return 0, 0, ErrInvalidSnapshot
+	}
+	if version, err := strconv.Atoi(v); err != nil || version != snapshotVersion {
+		return 0, 0, fmt.Errorf("%w: %q", ErrSnapshotVersion, v)
+	}
+	now := time.Now()
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return restored, skipped, err
+		}
+		if line == "" {
+			return restored, skipped, nil
+		}
+		id, e, ok := parseSnapshotLine(line)
+		if !ok || s.expired(e, now) {
+			skipped++
+		} else {
+			s.mu.Lock()
+			s.sessions[id] = e
+			s.mu.Unlock()
+			restored++
+		}
+		if err == io.EOF {
+			return restored, skipped, nil
+		}
+	}
+}
+
+// SnapshotFile writes a snapshot to the named file, replacing it
+// atomically so a crash never leaves a partial snapshot behind.
+func (s *MemoryStore) SnapshotFile(filename string) error {
+	var buf bytes.Buffer
+	if err := s.Snapshot(&buf); err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, &buf)
+}
+
+// RestoreFile restores the snapshot in the named file. A missing file is
+// not an error, so it can be called unconditionally at startup.
+func (s *MemoryStore) RestoreFile(filename string) (restored, skipped int, err error) {
+	f, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	return s.Restore(f)
+}
+
+// RunSnapshots purges expired sessions and writes a snapshot to the named
+// file every interval until ctx is done, then writes a last snapshot and
+// returns its error, or ctx.Err(). Errors of periodic snapshots are passed
+// to OnSnapshotError.
+func (s *MemoryStore) RunSnapshots(ctx context.Context, interval time.Duration,
+	filename string) error {
+	for {
+		if sleepUntil(ctx, time.Now().Add(interval)) != nil {
+			s.Purge()
+			if err := s.SnapshotFile(filename); err != nil {
+				return err
+			}
+			return ctx.Err()
+		}
+		s.Purge()
+		if err := s.SnapshotFile(filename); err != nil && s.OnSnapshotError != nil {
+			s.OnSnapshotError(err)
+		}
+	}
+}
+
+// RunPurge purges expired sessions every interval until ctx is done, then
+// returns ctx.Err(). It is not needed with RunSnapshots, which purges
+// before each snapshot.
+func (s *MemoryStore) RunPurge(ctx context.Context, interval time.Duration) error {
+	for {
+		if err := sleepUntil(ctx, time.Now().Add(interval)); err != nil {
+			return err
+		}
+		s.Purge()
+	}
+}
+
+// snapshotLine formats an entry as a snapshot line.
+func snapshotLine(id string, e memoryEntry) string {
+	body := id + " " + strconv.FormatInt(e.saved.Unix(), 10) + " " + e.data
+	return fmt.Sprintf("%s %08x\n", body, crc32.ChecksumIEEE([]byte(body)))
+}
+
+// parseSnapshotLine parses a snapshot line, reporting false if it is
+// truncated or corrupted.
+func parseSnapshotLine(line string) (string, memoryEntry, bool) {
+	line, complete := strings.CutSuffix(line, "\n")
+	i := strings.LastIndexByte(line, ' ')
+	if !complete || i < 0 {
+		return "", memoryEntry{}, false
+	}
+	body := line[:i]
+	sum, err := strconv.ParseUint(line[i+1:], 16, 32)
+	if err != nil || uint32(sum) != crc32.ChecksumIEEE([]byte(body)) {
+		return "", memoryEntry{}, false
+	}
+	fields := strings.Split(body, " ")
+	if len(fields) != 3 || !validSessionID(fields[0]) {
+		return "", memoryEntry{}, false
+	}
+	saved, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return "", memoryEntry{}, false
+	}
+	return fields[0], memoryEntry{data: fields[2], saved: time.Unix(saved, 0)}, true
+}
@@ -0,0 +1,161 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore([]byte("some key"))
+	value := encodeCookie(t, store, "s", "gopher")
+	encodeCookie(t, store, "s", "other")
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: value})
+	session, err := store.New(req, "s")
+	if err != nil || session.IsNew || session.Values["user"] != "gopher" {
+		t.Fatalf("failed to load session: %+v, %v", session, err)
+	}
+
+	var buf bytes.Buffer
+	if err := store.Snapshot(&buf); err != nil {
+		t.Fatal("failed to write snapshot", err)
+	}
+	restoredStore := NewMemoryStore([]byte("some key"))
+	restored, skipped, err := restoredStore.Restore(bytes.NewReader(buf.Bytes()))
+	if err != nil || restored != 2 || skipped != 0 {
+		t.Fatalf("bad restore: %d restored, %d skipped: %v", restored, skipped, err)
+	}
+	session, err = restoredStore.New(req, "s")
+	if err != nil || session.Values["user"] != "gopher" {
+		t.Fatalf("failed to load restored session: %+v, %v", session, err)
+	}
+
+	// Corrupted and truncated lines are skipped.
+	lines := strings.SplitAfter(buf.String(), "\n")
+	corrupted := lines[0] + strings.Replace(lines[1], " ", "  ", 1) + lines[2][:len(lines[2])/2]
+	restoredStore = NewMemoryStore([]byte("some key"))
+	restored, skipped, err = restoredStore.Restore(strings.NewReader(corrupted))
+	if err != nil || restored != 0 || skipped != 2 {
+		t.Fatalf("bad restore: %d restored, %d skipped: %v", restored, skipped, err)
+	}
+
+	if _, _, err = store.Restore(strings.NewReader("garbage\n")); err != ErrInvalidSnapshot {
+		t.Fatalf("expected ErrInvalidSnapshot, got %v", err)
+	}
+	if _, _, err = store.Restore(strings.NewReader(snapshotMagic + "2\n")); !errors.Is(err, ErrSnapshotVersion) {
+		t.Fatalf("expected ErrSnapshotVersion, got %v", err)
+	}
+}
+
+func TestMemoryStoreSnapshotFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "sessions.snapshot")
+	store := NewMemoryStore([]byte("some key"))
+	if restored, _, err := store.RestoreFile(filename); err != nil || restored != 0 {
+		t.Fatalf("expected a missing snapshot to be ignored: %v", err)
+	}
+	value := encodeCookie(t, store, "s", "gopher")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := store.RunSnapshots(ctx, time.Hour, filename); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	store = NewMemoryStore([]byte("some key"))
+	if restored, _, err := store.RestoreFile(filename); err != nil || restored != 1 {
+		t.Fatalf("failed to restore snapshot: %d restored: %v", restored, err)
+	}
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: value})
+	if session, err := store.New(req, "s"); err != nil || session.Values["user"] != "gopher" {
+		t.Fatalf("failed to load restored session: %+v, %v", session, err)
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore([]byte("some key"))
+	store.MaxAge(60)
+	expire := func() {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		for id, e := range store.sessions {
+			e.saved = e.saved.Add(-2 * time.Minute)
+			store.sessions[id] = e
+		}
+	}
+
+	// Expired sessions are removed when they are loaded.
+	value := encodeCookie(t, store, "s", "gopher")
+	expire()
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: value})
+	if _, err := store.New(req, "s"); !errors.Is(err, ErrSessionNotFound) || store.Len() != 0 {
+		t.Fatalf("expected the session to be removed: %d sessions, %v", store.Len(), err)
+	}
+
+	// Saving a session checks others.
+	encodeCookie(t, store, "s", "gopher")
+	expire()
+	encodeCookie(t, store, "s", "other")
+	if n := store.Len(); n != 1 {
+		t.Fatalf("expected the expired session to be removed: %d sessions", n)
+	}
+
+	// RunPurge removes the others periodically.
+	expire()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- store.RunPurge(ctx, time.Millisecond) }()
+	for deadline := time.Now().Add(5 * time.Second); store.Len() != 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected RunPurge to remove the expired session")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestMemoryStoreGCDryRun(t *testing.T) {
+	store := NewMemoryStore([]byte("some key"))
+	store.MaxAge(60)
+	ages := []time.Duration{2 * time.Minute, 2 * time.Hour, 0}
+	for range ages {
+		encodeCookie(t, store, "s", "gopher")
+	}
+	i := 0
+	for id, e := range store.sessions {
+		e.saved = e.saved.Add(-ages[i])
+		store.sessions[id] = e
+		i++
+	}
+
+	report, err := store.RunGC(GCOptions{
+		DryRun:     true,
+		AgeBuckets: []time.Duration{time.Hour},
+	})
+	if err != nil || report.Scanned != 3 || report.Deleted != 2 {
+		t.Fatalf("bad report: %+v, %v", report, err)
+	}
+	if report.AgeCounts[0] != 1 || report.AgeCounts[1] != 1 {
+		t.Fatalf("bad age distribution: %v", report.AgeCounts)
+	}
+	if n := store.Len(); n != 3 {
+		t.Fatalf("expected a dry run to keep the sessions: %d sessions", n)
+	}
+	if n := store.Purge(); n != 2 || store.Len() != 1 {
+		t.Fatalf("bad purge: %d removed, %d left", n, store.Len())
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+)
+
+// ErrorHandler handles an error loading or saving sessions, for example by
+// redirecting to a login page or writing a JSON error.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+// SetErrorHandler sets the handler called when saving the sessions of the
+// request fails. See Registry.ErrorHandler.
+func SetErrorHandler(r *http.Request, h ErrorHandler) {
+	GetRegistry(r).ErrorHandler = h
+}
+
+// Middleware loads sessions before calling the next handler and saves all
+// sessions of the request right before the response is written, so
+// handlers don't have to call Save.
+type Middleware struct {
+	// Store is the store of the sessions named in Names.
+	Store Store
+	// Names lists the sessions loaded before calling the next handler.
+	// Sessions can also be loaded by the handler with Store.Get.
+	Names []string
+	// ErrorHandler is called when a session can't be decoded, instead of
+	// calling the next handler, and when saving sessions fails, instead of
+	// writing the response of the next handler. If nil, decoding errors
+	// are ignored, so the sessions are new, and saving errors are dropped.
+	ErrorHandler ErrorHandler
+	// SaveStatus reports whether sessions are saved for a response with
+	// the given status code. Otherwise no session cookie is sent, so that
+	// failed requests don't issue cookies or extend their expiry. If nil,
+	// sessions are saved for 2xx and 3xx responses.
+	SaveStatus func(status int) bool
+}
+
+// saveStatus reports whether sessions are saved for status.
+func (m *Middleware) saveStatus(status int) bool {
+	if m.SaveStatus != nil {
+		return m.SaveStatus(status)
+	}
+	return status >= 200 && status < 400
+}
+
+// Handler returns a handler calling next with sessions loaded and saved.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registry := GetRegistry(r)
+		// Keep a handler set by an outer middleware with SetErrorHandler.
+		if m.ErrorHandler != nil {
+			registry.ErrorHandler = m.ErrorHandler
+		}
+		for _, name := range m.Names {
+			_, err := registry.Get(m.Store, name)
+			if err != nil && m.ErrorHandler != nil {
+				m.ErrorHandler(w, r, err)
+				return
+			}
+		}
+		sw := &saveWriter{ResponseWriter: w, registry: registry, m: m}
+		next.ServeHTTP(sw, r)
+		sw.save(http.StatusOK)
+	})
+}
+
+// saveWriter saves the sessions of a request once the response status is
+// known, before the response is written. If saving fails and an error
+// handler wrote the response, the response of the handler is discarded.
+type saveWriter struct {
+	http.ResponseWriter
+	registry *Registry
+	m        *Middleware
+	saved    bool
+	failed   bool
+}
+
+// save saves the sessions once, or removes their cookies if the status
+// doesn't allow saving.
+func (w *saveWriter) save(status int) {
+	if w.saved {
+		return
+	}
+	w.saved = true
+	if !w.m.saveStatus(status) {
+		w.dropCookies()
+		return
+	}
+	if err := w.registry.Save(w.ResponseWriter); err != nil && w.registry.ErrorHandler != nil {
+		w.failed = true
+	}
+}
+
+// dropCookies removes the Set-Cookie headers of the registered sessions,
+// added if the handler saved them itself.
+func (w *saveWriter) dropCookies() {
+	h := w.Header()
+	var kept []string
+	for _, v := range h.Values("Set-Cookie") {
+		if c, err := http.ParseSetCookie(v); err == nil {
+			if _, ok := w.registry.sessions[c.Name]; ok {
+				continue
+			}
+		}
+		kept = append(kept, v)
+	}
+	h.Del("Set-Cookie")
+	for _, v := range kept {
+		h.Add("Set-Cookie", v)
+	}
+}
+
+func (w *saveWriter) WriteHeader(code int) {
+	w.save(code)
+	if !w.failed {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *saveWriter) Write(b []byte) (int, error) {
+	w.save(http.StatusOK)
+	if w.failed {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *saveWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
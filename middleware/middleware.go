@@ -0,0 +1,111 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package middleware wires sessions.Middleware into common routers, so
+sessions are loaded before handlers run and saved before the response is
+written, with per-route opt-out.
+
+Config.Handler has the func(http.Handler) http.Handler shape accepted by
+most routers:
+
+	cfg := &middleware.Config{Store: store, Names: []string{"session-name"}}
+
+	// net/http, Go 1.22+ patterns:
+	mux := http.NewServeMux()
+	mux.Handle("GET /account", accountHandler)
+	mux.Handle("GET /healthz", middleware.NoSessions(healthHandler))
+	http.ListenAndServe(":8080", middleware.ServeMux(mux, cfg))
+
+	// gorilla/mux:
+	r := mux.NewRouter()
+	r.Use(cfg.Handler)
+	r.Handle("/healthz", middleware.NoSessions(healthHandler))
+
+	// chi:
+	r := chi.NewRouter()
+	r.With(cfg.Handler).Get("/account", account)
+	r.Get("/healthz", health)
+
+	// echo:
+	e := echo.New()
+	e.Use(echo.WrapMiddleware(cfg.Handler))
+
+Routes wrapped with NoSessions neither load nor save sessions when the
+middleware can see the route handler: with ServeMux, and with routers that
+run middleware after routing such as gorilla/mux and chi's With. Otherwise
+Config.Skip selects the requests to leave alone.
+*/
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// Config configures the session middleware. Store, Names, ErrorHandler and
+// SaveStatus are the same as in sessions.Middleware.
+type Config struct {
+	Store        sessions.Store
+	Names        []string
+	ErrorHandler sessions.ErrorHandler
+	SaveStatus   func(status int) bool
+	// Skip, if set, reports whether sessions are neither loaded nor saved
+	// for a request, for example for static assets or health checks.
+	Skip func(r *http.Request) bool
+}
+
+// Handler returns a handler calling next with sessions loaded and saved,
+// unless next was wrapped with NoSessions or Skip reports true.
+func (c *Config) Handler(next http.Handler) http.Handler {
+	if isOptOut(next) {
+		return next
+	}
+	m := &sessions.Middleware{
+		Store:        c.Store,
+		Names:        c.Names,
+		ErrorHandler: c.ErrorHandler,
+		SaveStatus:   c.SaveStatus,
+	}
+	h := m.Handler(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.Skip != nil && c.Skip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ServeMux returns a handler serving requests with mux, with sessions
+// loaded and saved unless the handler of the matching pattern was wrapped
+// with NoSessions or c.Skip reports true.
+func ServeMux(mux *http.ServeMux, c *Config) http.Handler {
+	h := c.Handler(mux)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, _ := mux.Handler(r); isOptOut(route) {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// NoSessions marks h as a route that doesn't use sessions, so the
+// middleware neither loads nor saves them for it.
+func NoSessions(h http.Handler) http.Handler {
+	return optOut{h}
+}
+
+// optOut is a handler wrapped with NoSessions.
+type optOut struct {
+	http.Handler
+}
+
+// isOptOut reports whether h was wrapped with NoSessions.
+func isOptOut(h http.Handler) bool {
+	_, ok := h.(optOut)
+	return ok
+}
@@ -0,0 +1,76 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+// sessionHandler sets a value in the session "s" of store.
+func sessionHandler(store sessions.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := store.Get(r, "s")
+		session.Values["foo"] = "bar"
+		_, _ = io.WriteString(w, "ok")
+	})
+}
+
+func serve(t *testing.T, h http.Handler, url string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Body.String() != "ok" {
+		t.Fatalf("bad response for %s: %d %q", url, w.Code, w.Body.String())
+	}
+	return w.Result()
+}
+
+func TestServeMux(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("some key"))
+	cfg := &Config{
+		Store: store,
+		Names: []string{"s"},
+		Skip: func(r *http.Request) bool {
+			return strings.HasPrefix(r.URL.Path, "/static/")
+		},
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /account", sessionHandler(store))
+	mux.Handle("GET /healthz", NoSessions(sessionHandler(store)))
+	mux.Handle("GET /static/", sessionHandler(store))
+	h := ServeMux(mux, cfg)
+
+	for url, want := range map[string]int{
+		"http://www.example.com/account":    1,
+		"http://www.example.com/healthz":    0,
+		"http://www.example.com/static/app": 0,
+	} {
+		if got := len(serve(t, h, url).Cookies()); got != want {
+			t.Fatalf("expected %d cookies for %s, got %d", want, url, got)
+		}
+	}
+}
+
+func TestHandlerNoSessions(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("some key"))
+	cfg := &Config{Store: store, Names: []string{"s"}}
+
+	// Routers running middleware after routing pass the route handler.
+	h := cfg.Handler(sessionHandler(store))
+	if got := len(serve(t, h, "http://www.example.com").Cookies()); got != 1 {
+		t.Fatalf("expected 1 cookie, got %d", got)
+	}
+	h = cfg.Handler(NoSessions(sessionHandler(store)))
+	if got := len(serve(t, h, "http://www.example.com").Cookies()); got != 0 {
+		t.Fatalf("expected no cookies, got %d", got)
+	}
+}
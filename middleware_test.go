@@ -0,0 +1,138 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// failingStore is a CookieStore whose Save always fails.
+type failingStore struct {
+	*CookieStore
+}
+
+func (s failingStore) Save(r *http.Request, w http.ResponseWriter, session *Session) error {
+	return errors.New("save failed")
+}
+
+func TestMiddleware(t *testing.T) {
+	store := NewCookieStore([]byte("some key"))
+	var handled error
+	m := &Middleware{
+		Store: store,
+		Names: []string{"s"},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			handled = err
+			http.Error(w, "session error", http.StatusBadRequest)
+		},
+	}
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := store.Get(r, "s")
+		session.Values["foo"] = "bar"
+		_, _ = io.WriteString(w, "ok")
+	}))
+
+	// Sessions are saved before the response is written.
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if handled != nil || w.Body.String() != "ok" || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("bad response: %v, %q, %v", handled, w.Body.String(), w.Result().Cookies())
+	}
+
+	// Decoding errors are passed to the error handler.
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: "invalid"})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if handled == nil || w.Code != http.StatusBadRequest {
+		t.Fatalf("expected the error handler to be called: %v, %d", handled, w.Code)
+	}
+}
+
+func TestMiddlewareSaveError(t *testing.T) {
+	store := failingStore{NewCookieStore([]byte("some key"))}
+	var handled error
+	m := &Middleware{
+		Store: store,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			handled = err
+			http.Error(w, "session error", http.StatusInternalServerError)
+		},
+	}
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := GetRegistry(r).Get(store, "s"); err != nil {
+			t.Error("failed to get session", err)
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "ok")
+	}))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if handled == nil || w.Code != http.StatusInternalServerError || w.Body.String() != "session error\n" {
+		t.Fatalf("bad response: %v, %d, %q", handled, w.Code, w.Body.String())
+	}
+}
+
+func TestMiddlewareKeepsErrorHandler(t *testing.T) {
+	store := failingStore{NewCookieStore([]byte("some key"))}
+	var handled error
+	inner := (&Middleware{Store: store}).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := GetRegistry(r).Get(store, "s"); err != nil {
+			t.Error("failed to get session", err)
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetErrorHandler(r, func(w http.ResponseWriter, r *http.Request, err error) {
+			handled = err
+			http.Error(w, "session error", http.StatusInternalServerError)
+		})
+		inner.ServeHTTP(w, r)
+	})
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if handled == nil || w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the outer error handler to be called: %v, %d", handled, w.Code)
+	}
+}
+
+func TestMiddlewareSaveStatus(t *testing.T) {
+	store := NewCookieStore([]byte("some key"))
+	m := &Middleware{Store: store, Names: []string{"s"}}
+	for _, v := range []struct {
+		status  int
+		save    bool
+		cookies int
+	}{
+		{http.StatusOK, false, 1},
+		{http.StatusFound, false, 1},
+		{http.StatusNotFound, false, 0},
+		{http.StatusInternalServerError, true, 0},
+	} {
+		h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session, _ := store.Get(r, "s")
+			session.Values["foo"] = "bar"
+			if v.save {
+				if err := session.Save(r, w); err != nil {
+					t.Error("failed to save session", err)
+				}
+			}
+			w.WriteHeader(v.status)
+		}))
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if got := len(w.Result().Cookies()); got != v.cookies {
+			t.Fatalf("%d: bad number of cookies: got %d, want %d", v.status, got, v.cookies)
+		}
+	}
+}
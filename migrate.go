@@ -0,0 +1,133 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// MigrationProgress reports the progress of a Migrator.
+type MigrationProgress struct {
+	// Migrated is the number of sessions saved in the destination store.
+	Migrated int
+	// Skipped is the number of sessions dropped by Transform.
+	Skipped int
+	// Failed is the number of sessions that couldn't be saved, when
+	// ContinueOnError is set.
+	Failed int
+}
+
+// NewMigrator returns a Migrator copying the sessions with the given names
+// from src to dst.
+func NewMigrator(src AdminStore, dst Store, names ...string) *Migrator {
+	return &Migrator{
+		Source: src,
+		Dest:   dst,
+		Names:  names,
+	}
+}
+
+// Migrator copies sessions from one store to another, for example from a
+// FilesystemStore to a database-backed store, without logging users out.
+//
+// Sessions keep their ID, so existing cookies remain valid as long as the
+// destination store uses the same keys and cookie format as the source.
+// The destination store counts the age of migrated sessions from the
+// migration. Sessions saved in the source while the migration runs may be
+// missed: run it again, or switch the application to the destination
+// store before running it.
+type Migrator struct {
+	Source AdminStore
+	Dest   Store
+	// Names lists the session names to migrate.
+	Names []string
+	// Transform, if set, is called with each session before it is saved,
+	// and can change its values. If it returns false the session is
+	// skipped.
+	Transform func(*Session) (bool, error)
+	// Interval is the minimum time between two saves in the destination
+	// store, to limit its load. Zero means no limit.
+	Interval time.Duration
+	// OnProgress, if set, is called after each session.
+	OnProgress func(MigrationProgress)
+	// ContinueOnError, if set, counts sessions that fail to be saved and
+	// continues, instead of stopping at the first error.
+	ContinueOnError bool
+}
+
+// Run migrates the sessions and returns the final progress. It stops when
+// ctx is done.
+func (m *Migrator) Run(ctx context.Context) (MigrationProgress, error) {
+	var progress MigrationProgress
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	if err != nil {
+		return progress, err
+	}
+	w := discardResponse{make(http.Header)}
+	var next time.Time
+	for _, name := range m.Names {
+		err = m.Source.Walk(name, func(session *Session) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if m.Transform != nil {
+				keep, err := m.Transform(session)
+				if err != nil {
+					return err
+				}
+				if !keep {
+					progress.Skipped++
+					m.report(progress)
+					return nil
+				}
+			}
+			if err := sleepUntil(ctx, next); err != nil {
+				return err
+			}
+			next = time.Now().Add(m.Interval)
+			session.store = m.Dest
+			if err := m.Dest.Save(r, w, session); err != nil {
+				if !m.ContinueOnError {
+					return fmt.Errorf("sessions: migrating session %s: %w", session.ID, err)
+				}
+				progress.Failed++
+			} else {
+				progress.Migrated++
+			}
+			m.report(progress)
+			return nil
+		})
+		if err != nil {
+			return progress, err
+		}
+	}
+	return progress, nil
+}
+
+// report calls OnProgress, if set.
+func (m *Migrator) report(progress MigrationProgress) {
+	if m.OnProgress != nil {
+		m.OnProgress(progress)
+	}
+}
+
+// sleepUntil waits until t or until ctx is done.
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
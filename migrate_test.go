@@ -0,0 +1,53 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestMigrator(t *testing.T) {
+	key := []byte("some key")
+	src := NewFilesystemStore(t.TempDir(), key)
+	cookies := []string{
+		encodeCookie(t, src, "s", "alice"),
+		encodeCookie(t, src, "s", "bob"),
+		encodeCookie(t, src, "s", "guest"),
+	}
+	bucket := &memBucket{objects: make(map[string][]byte)}
+	dst := NewObjectStore(bucket, key)
+
+	var reports []MigrationProgress
+	m := NewMigrator(src, dst, "s")
+	m.Transform = func(s *Session) (bool, error) {
+		s.Values["migrated"] = true
+		return s.Values["user"] != "guest", nil
+	}
+	m.OnProgress = func(p MigrationProgress) { reports = append(reports, p) }
+	progress, err := m.Run(context.Background())
+	if err != nil {
+		t.Fatal("failed to migrate sessions", err)
+	}
+	if progress.Migrated != 2 || progress.Skipped != 1 || len(reports) != 3 {
+		t.Fatalf("bad progress: %+v, %v", progress, reports)
+	}
+
+	for i, user := range []string{"alice", "bob"} {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(&http.Cookie{Name: "s", Value: cookies[i]})
+		session, err := dst.New(req, "s")
+		if err != nil || session.Values["user"] != user || session.Values["migrated"] != true {
+			t.Fatalf("bad migrated session: %v, %v", session.Values, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = m.Run(ctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
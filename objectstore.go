@@ -0,0 +1,142 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrObjectNotFound is returned by Bucket.Get when an object doesn't exist.
+var ErrObjectNotFound = errors.New("sessions: object not found")
+
+// Bucket is an object storage bucket, such as an S3-compatible or Google
+// Cloud Storage bucket, used by ObjectStore. Adapters for the client
+// libraries of each provider implement it.
+//
+// The bucket must provide strong read-after-write consistency, which S3
+// and GCS do for single objects, so a session saved in one request is seen
+// by the next one.
+type Bucket interface {
+	// Get returns the content of the object with the given key, or an
+	// error wrapping ErrObjectNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Put creates or replaces the object with the given key.
+	Put(ctx context.Context, key string, data []byte) error
+	// Delete deletes the object with the given key. Deleting an object
+	// that doesn't exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// BucketLister is implemented by Buckets that can list their objects, so
+// ObjectStore can list its sessions to rebuild an IDFilter.
+type BucketLister interface {
+	// List calls fn with the key of each object whose key starts with
+	// prefix.
+	List(ctx context.Context, prefix string, fn func(key string)) error
+}
+
+// NewObjectStore returns a new ObjectStore keeping sessions in bucket.
+//
+// See NewCookieStore() for a description of the other parameters.
+func NewObjectStore(bucket Bucket, keyPairs ...[]byte) *ObjectStore {
+	return NewObjectStoreWithOptions(bucket, WithKeyPairs(keyPairs...))
+}
+
+// NewObjectStoreWithOptions returns a new ObjectStore keeping sessions in
+// bucket, configured by opts.
+//
+// Options not set default to the values used by NewObjectStore().
+func NewObjectStoreWithOptions(bucket Bucket, opts ...StoreOption) *ObjectStore {
+	cfg := newBackendConfig(opts)
+	s := &ObjectStore{
+		Bucket: bucket,
+		Prefix: "sessions/",
+		Async:  cfg.async,
+	}
+	s.backendStore = newBackendStore(s, cfg)
+	return s
+}
+
+// ObjectStore stores sessions in an object storage bucket, for
+// applications that want durable sessions without running a database.
+//
+// Each session is an object named Prefix followed by the session ID. The
+// encoded values carry the time they were saved, so sessions expire after
+// MaxAge even if the object remains. Objects are not deleted when they
+// expire: configure a lifecycle rule on the bucket deleting objects under
+// Prefix older than MaxAge.
+type ObjectStore struct {
+	// backendStore provides Codecs, Options, Entropy, PersistOptions,
+	// FlashKey and the Store methods.
+	backendStore
+	Bucket Bucket
+	// Prefix is prepended to session IDs to form object keys, so a
+	// lifecycle rule can target sessions. The default is "sessions/".
+	Prefix string
+	// Filter, if set, is a negative cache of the sessions in the bucket:
+	// sessions it doesn't contain are not looked up unless their cookie is
+	// more recent than its last rebuild. Saved sessions are added to it.
+	Filter *IDFilter
+	// Async, if set, writes and deletes objects in the background. See
+	// AsyncWriter.
+	Async *AsyncWriter
+}
+
+// saveSession writes the object of a session.
+func (s *ObjectStore) saveSession(ctx context.Context, session *Session, maxAge int) error {
+	encoded, err := s.encodeValues(session)
+	if err != nil {
+		return err
+	}
+	key, data := s.Prefix+session.ID, []byte(encoded)
+	err = s.Async.do(ctx, func(ctx context.Context) error {
+		return s.Bucket.Put(ctx, key, data)
+	})
+	if err != nil {
+		return err
+	}
+	session.backendSize = len(encoded)
+	if s.Filter != nil {
+		s.Filter.Add(session.ID)
+	}
+	return nil
+}
+
+// deleteSession deletes the object of a session.
+func (s *ObjectStore) deleteSession(ctx context.Context, id string) error {
+	key := s.Prefix + id
+	return s.Async.do(ctx, func(ctx context.Context) error {
+		return s.Bucket.Delete(ctx, key)
+	})
+}
+
+// ListIDs calls add with the ID of each session in the bucket, including
+// expired sessions whose object was not deleted yet. It returns
+// ErrListNotSupported if the bucket doesn't implement BucketLister.
+func (s *ObjectStore) ListIDs(ctx context.Context, add func(id string)) error {
+	lister, ok := s.Bucket.(BucketLister)
+	if !ok {
+		return ErrListNotSupported
+	}
+	return lister.List(ctx, s.Prefix, func(key string) {
+		add(strings.TrimPrefix(key, s.Prefix))
+	})
+}
+
+// loadSession reads the object of a session and decodes it into
+// session.Values.
+func (s *ObjectStore) loadSession(ctx context.Context, session *Session) error {
+	if s.Filter != nil && !s.Filter.mayHold(session) {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, s.Prefix+session.ID)
+	}
+	data, err := s.Bucket.Get(ctx, s.Prefix+session.ID)
+	if err != nil {
+		return err
+	}
+	return s.decodeValues(session, string(data))
+}
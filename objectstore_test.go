@@ -0,0 +1,89 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memBucket is an in-memory Bucket.
+type memBucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (b *memBucket) Get(ctx context.Context, key string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	return data, nil
+}
+
+func (b *memBucket) Put(ctx context.Context, key string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[key] = data
+	return nil
+}
+
+func (b *memBucket) Delete(ctx context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.objects, key)
+	return nil
+}
+
+func (b *memBucket) List(ctx context.Context, prefix string, fn func(key string)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			fn(key)
+		}
+	}
+	return nil
+}
+
+func TestObjectStore(t *testing.T) {
+	bucket := &memBucket{objects: make(map[string][]byte)}
+	store := NewObjectStore(bucket, []byte("some key"))
+	cookie := encodeCookie(t, store, "s", "gopher")
+	if len(bucket.objects) != 1 {
+		t.Fatalf("bad objects: %v", bucket.objects)
+	}
+	for key := range bucket.objects {
+		if !strings.HasPrefix(key, "sessions/") {
+			t.Fatalf("bad object key: %s", key)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+	session, err := store.Get(req, "s")
+	if err != nil || session.IsNew || session.Values["user"] != "gopher" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+
+	session.Options.MaxAge = -1
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+	if len(bucket.objects) != 0 {
+		t.Fatalf("expected the object to be deleted: %v", bucket.objects)
+	}
+	session, err = store.New(req, "s")
+	if err == nil || !session.IsNew {
+		t.Fatalf("expected a new session and an error: %v, %v", session.Values, err)
+	}
+}
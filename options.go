@@ -4,7 +4,14 @@
 
 package sessions
 
-import "net/http"
+import (
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
 
 // Options stores configuration for a session or session store.
 //
@@ -12,13 +19,482 @@ import "net/http"
 type Options struct {
 	Path   string
 	Domain string
+	// DomainFunc, if set, derives the cookie domain from the request when
+	// the session is saved, overriding Domain. It allows serving several
+	// domains, such as example.com and example.co.uk, from one store.
+	DomainFunc func(r *http.Request) string
 	// MaxAge=0 means no Max-Age attribute specified and the cookie will be
 	// deleted after the browser session ends.
 	// MaxAge<0 means delete cookie immediately.
 	// MaxAge>0 means Max-Age attribute present and given in seconds.
-	MaxAge      int
+	MaxAge int
+	// Expires sets an absolute expiry for the cookie, for example to
+	// remember a user until a fixed date. If set, it takes precedence
+	// over a MaxAge of 0 or more, and the session is deleted once it has
+	// passed. Stores still reject sessions older than their own MaxAge.
+	Expires time.Time
+	// IdleLock, if positive, locks sessions idle for longer than this
+	// duration when they are decoded, instead of expiring them; see
+	// Session.IsLocked. Activity is recorded when a session is loaded, and
+	// persisted when it is saved.
+	IdleLock    time.Duration
 	Secure      bool
 	HttpOnly    bool
 	Partitioned bool
 	SameSite    http.SameSite
+	// Format controls the serialization of the Set-Cookie header. If nil,
+	// the header is formatted by net/http.
+	Format *CookieFormat
+	// RelaxLocalhost, if set, relaxes the cookie attributes for plain HTTP
+	// requests to localhost from a loopback address, so sessions work in
+	// development with production settings. See Relaxed and DevOptions.
+	RelaxLocalhost bool
+}
+
+// CookieWriter writes session cookies when they are saved, in place of
+// adding Set-Cookie headers to the response. w is the response writer
+// passed to Save, and may be nil. See WithCookieWriter.
+type CookieWriter interface {
+	WriteCookie(w http.ResponseWriter, cookie *http.Cookie) error
+}
+
+// CookieWriterFunc adapts a function to a CookieWriter.
+type CookieWriterFunc func(w http.ResponseWriter, cookie *http.Cookie) error
+
+// WriteCookie calls f(w, cookie).
+func (f CookieWriterFunc) WriteCookie(w http.ResponseWriter, cookie *http.Cookie) error {
+	return f(w, cookie)
+}
+
+// cookieHooks are the hooks of a store applied by setCookie to the session
+// cookies it writes, set by StoreOption functions.
+type cookieHooks struct {
+	// consent, if set, reports whether the client consented to
+	// non-essential cookies. Without consent, saving a session follows
+	// withoutConsent. Cookies deleting sessions are always sent.
+	consent        ConsentChecker
+	withoutConsent ConsentFallback
+	// writer, if set, receives session cookies instead of the response
+	// headers. Options.Format is then ignored.
+	writer CookieWriter
+	// sameSiteFallback, if set, reports whether the client of a request
+	// mishandles SameSite=None, in which case the attribute is omitted.
+	sameSiteFallback func(r *http.Request) bool
+}
+
+// storeHooks returns the cookie hooks of store, or of the first store it
+// wraps that has some, or nil.
+func storeHooks(store Store) *cookieHooks {
+	for ; store != nil; store = Unwrap(store) {
+		switch s := store.(type) {
+		case *CookieStore:
+			return &s.hooks
+		case *FilesystemStore:
+			return &s.hooks
+		case interface{ storeCookieHooks() *cookieHooks }:
+			return s.storeCookieHooks()
+		}
+	}
+	return nil
+}
+
+// ConsentChecker reports whether the client of r consented to
+// non-essential cookies.
+type ConsentChecker func(r *http.Request) bool
+
+// ConsentFallback selects what happens to a session cookie when the client
+// didn't consent to non-essential cookies.
+type ConsentFallback int
+
+const (
+	// ConsentSuppress doesn't send the cookie. This is the default.
+	ConsentSuppress ConsentFallback = iota
+	// ConsentSessionOnly sends the cookie without Max-Age and Expires, so
+	// it is discarded when the browser closes.
+	ConsentSessionOnly
+)
+
+// maxAge returns the effective Max-Age at now, in seconds: MaxAge, or the
+// time left until Expires if it is set. It returns -1 if Expires has
+// passed.
+func (o *Options) maxAge(now time.Time) int {
+	if o.Expires.IsZero() || o.MaxAge < 0 {
+		return o.MaxAge
+	}
+	left := o.Expires.Sub(now)
+	if left <= 0 {
+		return -1
+	}
+	// Round up so the cookie doesn't expire before Expires, and stay
+	// within the range of int on 32-bit platforms.
+	secs := (left + time.Second - 1) / time.Second
+	if secs > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int(secs)
+}
+
+// maxAgeDuration converts a maximum age in seconds to a Duration, clamped
+// to the largest Duration instead of overflowing.
+func maxAgeDuration(age int) time.Duration {
+	if int64(age) > int64(math.MaxInt64/time.Second) {
+		return math.MaxInt64
+	}
+	return time.Duration(age) * time.Second
+}
+
+// expiresAt returns the time age seconds after now, without overflowing.
+func expiresAt(now time.Time, age int) time.Time {
+	return now.Add(maxAgeDuration(age))
+}
+
+// StoreOption configures a store created by NewCookieStoreWithOptions or
+// NewFilesystemStoreWithOptions.
+type StoreOption func(*storeConfig)
+
+// KeyProvider supplies the key pairs used to create the codecs of a store.
+//
+// See NewCookieStore() for a description of key pairs.
+type KeyProvider interface {
+	KeyPairs() [][]byte
+}
+
+// storeConfig collects the settings applied by StoreOption functions.
+type storeConfig struct {
+	keyPairs   [][]byte
+	options    *Options
+	serializer securecookie.Serializer
+	maxLength  *int
+	limits     *DecodeLimits
+	entropy    io.Reader
+	flashKey   string
+	fsys       WritableFS
+
+	signatureSuffix      string
+	alternateNames       map[string][]string
+	expireAlternateNames bool
+	cookiePolicy         CookiePolicy
+	skipUnchanged        bool
+	idEncoding           IDEncoding
+	notBefore            time.Time
+	deterministic        *time.Duration
+	async                *AsyncWriter
+	paseto               []*PASETOCodec
+	packing              *CookiePacking
+	passphrase           *PassphraseCodec
+	hooks                cookieHooks
+}
+
+// newStoreConfig applies opts over the given default options.
+func newStoreConfig(defaults *Options, opts []StoreOption) *storeConfig {
+	cfg := &storeConfig{options: defaults}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// codecs creates securecookie codecs from the configured key pairs.
+func (c *storeConfig) codecs() []securecookie.Codec {
+	var codecs []securecookie.Codec
+	switch {
+	case c.passphrase != nil:
+		codecs = []securecookie.Codec{c.passphrase}
+	case len(c.paseto) > 0:
+		codecs = make([]securecookie.Codec, len(c.paseto))
+		for i, pc := range c.paseto {
+			codecs[i] = pc
+		}
+	case c.deterministic != nil:
+		codecs = c.deterministicCodecs()
+	default:
+		codecs = securecookie.CodecsFromPairs(c.keyPairs...)
+	}
+	setSerializer(codecs, c.serializer, c.limits)
+	if c.maxLength != nil {
+		for _, codec := range codecs {
+			switch cc := codec.(type) {
+			case *securecookie.SecureCookie:
+				cc.MaxLength(*c.maxLength)
+			case *DeterministicCodec:
+				cc.MaxLength(*c.maxLength)
+			case *PASETOCodec:
+				cc.MaxLength(*c.maxLength)
+			case *PassphraseCodec:
+				cc.MaxLength(*c.maxLength)
+			}
+		}
+	}
+	return codecs
+}
+
+// deterministicCodecs creates DeterministicCodecs from the configured key
+// pairs.
+func (c *storeConfig) deterministicCodecs() []securecookie.Codec {
+	var codecs []securecookie.Codec
+	for i := 0; i < len(c.keyPairs); i += 2 {
+		var blockKey []byte
+		if i+1 < len(c.keyPairs) {
+			blockKey = c.keyPairs[i+1]
+		}
+		codecs = append(codecs, NewDeterministicCodec(c.keyPairs[i], blockKey, *c.deterministic))
+	}
+	return codecs
+}
+
+// WithKeyPairs sets the authentication and encryption key pairs.
+//
+// See NewCookieStore() for a description of key pairs.
+func WithKeyPairs(keyPairs ...[]byte) StoreOption {
+	return func(c *storeConfig) {
+		c.keyPairs = keyPairs
+	}
+}
+
+// WithKeyProvider sets the key pairs from a KeyProvider. The provider is
+// consulted once, when the store is created.
+func WithKeyProvider(p KeyProvider) StoreOption {
+	return func(c *storeConfig) {
+		c.keyPairs = p.KeyPairs()
+	}
+}
+
+// WithPath sets the default cookie path.
+func WithPath(path string) StoreOption {
+	return func(c *storeConfig) {
+		c.options.Path = path
+	}
+}
+
+// WithDomain sets the default cookie domain.
+func WithDomain(domain string) StoreOption {
+	return func(c *storeConfig) {
+		c.options.Domain = domain
+	}
+}
+
+// WithDomainFunc sets the function deriving the cookie domain from the
+// request. See Options.DomainFunc.
+func WithDomainFunc(fn func(r *http.Request) string) StoreOption {
+	return func(c *storeConfig) {
+		c.options.DomainFunc = fn
+	}
+}
+
+// WithMaxAge sets the default maximum age, in seconds, of sessions and
+// cookies. See Options.MaxAge.
+func WithMaxAge(age int) StoreOption {
+	return func(c *storeConfig) {
+		c.options.MaxAge = age
+	}
+}
+
+// WithIdleLock sets Options.IdleLock, locking sessions idle for longer than
+// d.
+func WithIdleLock(d time.Duration) StoreOption {
+	return func(c *storeConfig) {
+		c.options.IdleLock = d
+	}
+}
+
+// WithConsent makes sessions persist only with the consent of the client
+// to non-essential cookies, as reported by checker, for example by asking
+// a consent manager. Without consent, saving a session follows fallback.
+// Cookies deleting sessions are always sent.
+func WithConsent(checker ConsentChecker, fallback ConsentFallback) StoreOption {
+	return func(c *storeConfig) {
+		c.hooks.consent = checker
+		c.hooks.withoutConsent = fallback
+	}
+}
+
+// WithRelaxLocalhost sets Options.RelaxLocalhost.
+func WithRelaxLocalhost(relax bool) StoreOption {
+	return func(c *storeConfig) {
+		c.options.RelaxLocalhost = relax
+	}
+}
+
+// WithSecure sets the default Secure cookie attribute.
+func WithSecure(secure bool) StoreOption {
+	return func(c *storeConfig) {
+		c.options.Secure = secure
+	}
+}
+
+// WithHttpOnly sets the default HttpOnly cookie attribute.
+func WithHttpOnly(httpOnly bool) StoreOption {
+	return func(c *storeConfig) {
+		c.options.HttpOnly = httpOnly
+	}
+}
+
+// WithPartitioned sets the default Partitioned cookie attribute.
+func WithPartitioned(partitioned bool) StoreOption {
+	return func(c *storeConfig) {
+		c.options.Partitioned = partitioned
+	}
+}
+
+// WithSameSite sets the default SameSite cookie attribute.
+func WithSameSite(sameSite http.SameSite) StoreOption {
+	return func(c *storeConfig) {
+		c.options.SameSite = sameSite
+	}
+}
+
+// WithSerializer sets the serializer used to encode session data.
+// The default is securecookie.GobEncoder.
+func WithSerializer(sz securecookie.Serializer) StoreOption {
+	return func(c *storeConfig) {
+		c.serializer = sz
+	}
+}
+
+// WithMaxLength restricts the maximum length of encoded values.
+// See FilesystemStore.MaxLength().
+func WithMaxLength(l int) StoreOption {
+	return func(c *storeConfig) {
+		c.maxLength = &l
+	}
+}
+
+// WithDecodeLimits restricts the size and shape of decoded sessions.
+// See CookieStore.LimitDecoding().
+func WithDecodeLimits(limits DecodeLimits) StoreOption {
+	return func(c *storeConfig) {
+		c.limits = &limits
+	}
+}
+
+// WithCookieFormat sets the default serialization of Set-Cookie headers.
+// See Options.Format.
+func WithCookieFormat(format *CookieFormat) StoreOption {
+	return func(c *storeConfig) {
+		c.options.Format = format
+	}
+}
+
+// WithCookieWriter makes the store pass session cookies to writer instead
+// of adding Set-Cookie headers to the response, for platforms or tests that
+// don't use a ResponseWriter. Options.Format is then ignored.
+func WithCookieWriter(writer CookieWriter) StoreOption {
+	return func(c *storeConfig) {
+		c.hooks.writer = writer
+	}
+}
+
+// WithSameSiteFallback sets the detector of clients mishandling
+// SameSite=None: when fn reports so for a request, the attribute is omitted
+// from the session cookie. SameSiteNoneIncompatible detects known clients.
+func WithSameSiteFallback(fn func(r *http.Request) bool) StoreOption {
+	return func(c *storeConfig) {
+		c.hooks.sameSiteFallback = fn
+	}
+}
+
+// WithEntropy sets the source of random bytes used to generate session IDs
+// in server-side stores. The default is crypto/rand.
+func WithEntropy(r io.Reader) StoreOption {
+	return func(c *storeConfig) {
+		c.entropy = r
+	}
+}
+
+// WithIDEncoding sets the encoding of FilesystemStore session IDs. See
+// FilesystemStore.IDEncoding.
+func WithIDEncoding(enc IDEncoding) StoreOption {
+	return func(c *storeConfig) {
+		c.idEncoding = enc
+	}
+}
+
+// WithNotBefore rejects session cookies issued before t. See
+// CookieStore.NotBefore.
+func WithNotBefore(t time.Time) StoreOption {
+	return func(c *storeConfig) {
+		c.notBefore = t
+	}
+}
+
+// WithDeterministicEncoding makes the store encode sessions with
+// DeterministicCodecs created from the key pairs, rounding timestamps down
+// to window, so unchanged sessions keep identical cookie bytes. A custom
+// serializer must be deterministic too.
+func WithDeterministicEncoding(window time.Duration) StoreOption {
+	return func(c *storeConfig) {
+		c.deterministic = &window
+	}
+}
+
+// WithAsyncWriter makes a FilesystemStore persist sessions in the
+// background through a. See AsyncWriter.
+func WithAsyncWriter(a *AsyncWriter) StoreOption {
+	return func(c *storeConfig) {
+		c.async = a
+	}
+}
+
+// WithPASETO makes the store encode sessions as PASETO tokens with the
+// given codecs instead of the key pairs. The first codec encodes and all
+// are tried to decode, for key rotation. See PASETOCodec.
+func WithPASETO(codecs ...*PASETOCodec) StoreOption {
+	return func(c *storeConfig) {
+		c.paseto = codecs
+	}
+}
+
+// WithCookiePacking makes a CookieStore evict values by priority when the
+// session cookie would be too long. See CookiePacking.
+func WithCookiePacking(p *CookiePacking) StoreOption {
+	return func(c *storeConfig) {
+		c.packing = p
+	}
+}
+
+// WithFlashKey sets the default flashes key of sessions, which is "_flash"
+// if not set.
+func WithFlashKey(key string) StoreOption {
+	return func(c *storeConfig) {
+		c.flashKey = key
+	}
+}
+
+// WithFS sets the file system of a FilesystemStore, replacing the directory
+// passed to NewFilesystemStoreWithOptions().
+func WithFS(fsys WritableFS) StoreOption {
+	return func(c *storeConfig) {
+		c.fsys = fsys
+	}
+}
+
+// WithSignatureCookie makes a CookieStore send the signature of each
+// session in a separate cookie, named after the session with suffix
+// appended. See CookieStore.SignatureSuffix.
+func WithSignatureCookie(suffix string) StoreOption {
+	return func(c *storeConfig) {
+		c.signatureSuffix = suffix
+	}
+}
+
+// WithAlternateNames sets former cookie names of the session called name,
+// read when the request has no cookie with the new name. If expire is set,
+// cookies with a former name are expired when the session is saved. See
+// CookieStore.AlternateNames.
+func WithAlternateNames(name string, expire bool, alternates ...string) StoreOption {
+	return func(c *storeConfig) {
+		if c.alternateNames == nil {
+			c.alternateNames = make(map[string][]string)
+		}
+		c.alternateNames[name] = append(c.alternateNames[name], alternates...)
+		c.expireAlternateNames = c.expireAlternateNames || expire
+	}
+}
+
+// WithCookiePolicy sets the cookie decoded by New when a request has
+// several cookies with the session name. See CookiePolicy.
+func WithCookiePolicy(policy CookiePolicy) StoreOption {
+	return func(c *storeConfig) {
+		c.cookiePolicy = policy
+	}
 }
@@ -0,0 +1,119 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type staticKeys [][]byte
+
+func (k staticKeys) KeyPairs() [][]byte { return k }
+
+func TestStoreOptions(t *testing.T) {
+	store := NewCookieStoreWithOptions(
+		WithKeyProvider(staticKeys{[]byte("secret-key")}),
+		WithPath("/app"),
+		WithDomain("example.com"),
+		WithMaxAge(3600),
+		WithHttpOnly(true),
+		WithSameSite(http.SameSiteStrictMode),
+	)
+	if store.Options.Path != "/app" {
+		t.Fatalf("bad path: got %q, want %q", store.Options.Path, "/app")
+	}
+	if store.Options.Domain != "example.com" {
+		t.Fatalf("bad domain: got %q, want %q", store.Options.Domain, "example.com")
+	}
+	if store.Options.MaxAge != 3600 {
+		t.Fatalf("bad max age: got %v, want %v", store.Options.MaxAge, 3600)
+	}
+	if !store.Options.Secure || !store.Options.HttpOnly {
+		t.Fatalf("bad flags: got %+v", store.Options)
+	}
+	if store.Options.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("bad same site: got %v", store.Options.SameSite)
+	}
+	if len(store.Codecs) != 1 {
+		t.Fatalf("bad codecs: got %d, want 1", len(store.Codecs))
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	session, err := store.New(req, "opts")
+	if err != nil {
+		t.Fatal("failed to create session", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Path != "/app" || cookies[0].MaxAge != 3600 {
+		t.Fatalf("bad cookie: %+v", cookies)
+	}
+}
+
+func TestFilesystemStoreOptions(t *testing.T) {
+	store := NewFilesystemStoreWithOptions(t.TempDir(),
+		WithKeyPairs([]byte("secret-key")),
+		WithMaxLength(8192),
+		WithDecodeLimits(DecodeLimits{MaxValues: 1}),
+	)
+	if store.Options.Path != "/" || store.Options.MaxAge != 86400*30 {
+		t.Fatalf("bad default options: got %+v", store.Options)
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	session, err := store.New(req, "opts")
+	if err != nil {
+		t.Fatal("failed to create session", err)
+	}
+	session.Values["big"] = make([]byte, 4000)
+	session.Values["other"] = 1
+	if err = session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	req.Header.Add("Cookie", w.Header().Get("Set-Cookie"))
+	if _, err = store.New(req, "opts"); err == nil {
+		t.Fatal("expected decode limit error, got nil")
+	}
+}
+
+func TestDevOptions(t *testing.T) {
+	store := NewCookieStore([]byte("secret-key"))
+	store.SetOptions(DevOptions())
+	for _, tc := range []struct {
+		url    string
+		remote string
+		secure bool
+	}{
+		{"http://localhost:8080/", "127.0.0.1:5000", false},
+		{"http://127.0.0.1/", "[::1]:5000", false},
+		{"http://app.localhost/", "127.0.0.1:5000", false},
+		{"http://www.example.com/", "127.0.0.1:5000", true},
+		// The Host header is set by the client.
+		{"http://localhost:8080/", "203.0.113.7:5000", true},
+		{"http://localhost:8080/", "", true},
+	} {
+		req, _ := http.NewRequest("GET", tc.url, nil)
+		req.RemoteAddr = tc.remote
+		w := httptest.NewRecorder()
+		session, _ := store.New(req, "s")
+		if err := session.Save(req, w); err != nil {
+			t.Fatal("failed to save session", err)
+		}
+		c := w.Result().Cookies()[0]
+		if c.Secure != tc.secure || !c.HttpOnly || c.SameSite != http.SameSiteLaxMode {
+			t.Fatalf("bad cookie for %s: %v", tc.url, c)
+		}
+	}
+	if opts := ProdOptions(); opts.RelaxLocalhost || !opts.Secure {
+		t.Fatalf("bad production options: %+v", opts)
+	}
+}
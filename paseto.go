@@ -0,0 +1,316 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+const (
+	pasetoLocal  = "v4.local."
+	pasetoPublic = "v4.public."
+)
+
+// errPASETOSerializer is returned by PASETOCodec.Encode when the serializer
+// doesn't produce JSON.
+var errPASETOSerializer = errors.New("sessions: PASETO serializer must produce JSON")
+
+// NewPASETOLocalCodec returns a PASETOCodec encrypting values as
+// v4.local tokens with key, which must be 32 bytes.
+//
+// Like securecookie.New, it doesn't fail: an invalid key is reported by
+// Encode and Decode.
+func NewPASETOLocalCodec(key []byte) *PASETOCodec {
+	c := newPASETOCodec(pasetoLocal)
+	c.key = key
+	if len(key) != 32 {
+		c.err = fmt.Errorf("sessions: invalid PASETO v4.local key size %d", len(key))
+	}
+	return c
+}
+
+// NewPASETOPublicCodec returns a PASETOCodec signing values as v4.public
+// tokens with privateKey and verifying them with the matching public key.
+// With a nil privateKey, the codec only verifies tokens with publicKey,
+// for services reading sessions issued by another one.
+//
+// v4.public tokens are signed but not encrypted: their payload is readable
+// by clients.
+func NewPASETOPublicCodec(privateKey ed25519.PrivateKey, publicKey ed25519.PublicKey) *PASETOCodec {
+	c := newPASETOCodec(pasetoPublic)
+	switch {
+	case privateKey != nil && len(privateKey) != ed25519.PrivateKeySize:
+		c.err = fmt.Errorf("sessions: invalid PASETO v4.public private key size %d", len(privateKey))
+	case privateKey != nil:
+		c.privateKey = privateKey
+		c.publicKey = privateKey.Public().(ed25519.PublicKey)
+	case len(publicKey) != ed25519.PublicKeySize:
+		c.err = fmt.Errorf("sessions: invalid PASETO v4.public public key size %d", len(publicKey))
+	default:
+		c.publicKey = publicKey
+	}
+	return c
+}
+
+func newPASETOCodec(header string) *PASETOCodec {
+	return &PASETOCodec{
+		header:    header,
+		maxAge:    86400 * 30,
+		maxLength: 4096,
+		sz:        TypedJSONEncoder{},
+		rand:      rand.Reader,
+	}
+}
+
+// PASETOCodec is a securecookie.Codec encoding values as PASETO version 4
+// tokens, an alternative to the securecookie format for interoperability
+// with other PASETO consumers.
+//
+// The payload is a JSON object with the serialized value in the "data"
+// claim, and the "iat" and, if MaxAge is set, "exp" claims in RFC 3339
+// format. The cookie name is the implicit assertion of the token, so
+// consumers must pass it to verify the token, and tokens can't be replayed
+// under another name. Tokens have no footer.
+type PASETOCodec struct {
+	header     string
+	key        []byte
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+	maxAge     int
+	maxLength  int
+	sz         securecookie.Serializer
+	rand       io.Reader
+	err        error
+}
+
+// pasetoClaims is the payload of the tokens of PASETOCodec.
+type pasetoClaims struct {
+	Data json.RawMessage `json:"data"`
+	Iat  string          `json:"iat"`
+	Exp  string          `json:"exp,omitempty"`
+}
+
+// MaxAge sets the maximum age of tokens in seconds, set in their "exp"
+// claim. A value of 0 disables expiration.
+func (c *PASETOCodec) MaxAge(age int) *PASETOCodec {
+	c.maxAge = age
+	return c
+}
+
+// MaxLength sets the maximum length of tokens. A value of 0 disables the
+// check. The default is 4096.
+func (c *PASETOCodec) MaxLength(l int) *PASETOCodec {
+	c.maxLength = l
+	return c
+}
+
+// SetSerializer sets the serializer of values, which must produce JSON,
+// such as TypedJSONEncoder, the default, or securecookie.JSONEncoder.
+func (c *PASETOCodec) SetSerializer(sz securecookie.Serializer) *PASETOCodec {
+	c.sz = sz
+	return c
+}
+
+// Encode encodes value as a token with name as implicit assertion.
+func (c *PASETOCodec) Encode(name string, value interface{}) (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	if c.header == pasetoPublic && c.privateKey == nil {
+		return "", errors.New("sessions: PASETO codec has no private key")
+	}
+	data, err := c.sz.Serialize(value)
+	if err != nil {
+		return "", err
+	}
+	if !json.Valid(data) {
+		return "", errPASETOSerializer
+	}
+	now := time.Now().UTC()
+	claims := pasetoClaims{Data: data, Iat: now.Format(time.RFC3339)}
+	if c.maxAge > 0 {
+		claims.Exp = now.Add(time.Duration(c.maxAge) * time.Second).Format(time.RFC3339)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	var body []byte
+	if c.header == pasetoLocal {
+		body, err = c.encrypt(payload, []byte(name))
+	} else {
+		body = c.sign(payload, []byte(name))
+	}
+	if err != nil {
+		return "", err
+	}
+	token := c.header + base64.RawURLEncoding.EncodeToString(body)
+	if c.maxLength != 0 && len(token) > c.maxLength {
+		return "", fmt.Errorf("sessions: encoded value is too long (%d)", len(token))
+	}
+	return token, nil
+}
+
+// Decode verifies token with name as implicit assertion and decodes its
+// value into dst. It returns securecookie.ErrMacInvalid for tokens that
+// fail authentication.
+func (c *PASETOCodec) Decode(name, token string, dst interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.maxLength != 0 && len(token) > c.maxLength {
+		return fmt.Errorf("sessions: value is too long (%d)", len(token))
+	}
+	encoded, ok := strings.CutPrefix(token, c.header)
+	if !ok || strings.Contains(encoded, ".") {
+		// Tokens with a footer are not issued by this codec.
+		return securecookie.ErrMacInvalid
+	}
+	body, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return securecookie.ErrMacInvalid
+	}
+	var payload []byte
+	if c.header == pasetoLocal {
+		payload, err = c.decrypt(body, []byte(name))
+	} else {
+		payload, err = c.verify(body, []byte(name))
+	}
+	if err != nil {
+		return err
+	}
+	var claims pasetoClaims
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return err
+	}
+	if claims.Exp != "" {
+		exp, err := time.Parse(time.RFC3339, claims.Exp)
+		if err != nil {
+			return err
+		}
+		if !time.Now().Before(exp) {
+			return errTimestampExpired
+		}
+	}
+	if c.maxAge > 0 && claims.Iat != "" {
+		iat, err := time.Parse(time.RFC3339, claims.Iat)
+		if err != nil {
+			return err
+		}
+		if time.Since(iat) > time.Duration(c.maxAge)*time.Second {
+			return errTimestampExpired
+		}
+	}
+	return c.sz.Deserialize(claims.Data, dst)
+}
+
+// encrypt returns the nonce, ciphertext and tag of a v4.local token.
+func (c *PASETOCodec) encrypt(payload, implicit []byte) ([]byte, error) {
+	nonce := make([]byte, 32)
+	if _, err := io.ReadFull(c.rand, nonce); err != nil {
+		return nil, err
+	}
+	ek, n2, ak := c.localKeys(nonce)
+	stream, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return nil, err
+	}
+	body := make([]byte, 32+len(payload), 32+len(payload)+32)
+	copy(body, nonce)
+	stream.XORKeyStream(body[32:], payload)
+	return append(body, c.localTag(ak, nonce, body[32:], implicit)...), nil
+}
+
+// decrypt authenticates and decrypts the body of a v4.local token.
+func (c *PASETOCodec) decrypt(body, implicit []byte) ([]byte, error) {
+	if len(body) < 64 {
+		return nil, securecookie.ErrMacInvalid
+	}
+	nonce, ciphertext, tag := body[:32], body[32:len(body)-32], body[len(body)-32:]
+	ek, n2, ak := c.localKeys(nonce)
+	if !hmac.Equal(tag, c.localTag(ak, nonce, ciphertext, implicit)) {
+		return nil, securecookie.ErrMacInvalid
+	}
+	stream, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, len(ciphertext))
+	stream.XORKeyStream(payload, ciphertext)
+	return payload, nil
+}
+
+// localKeys derives the encryption key, XChaCha20 nonce and authentication
+// key of a v4.local token from its nonce.
+func (c *PASETOCodec) localKeys(nonce []byte) (ek, n2, ak []byte) {
+	h, _ := blake2b.New(56, c.key)
+	h.Write([]byte("paseto-encryption-key"))
+	h.Write(nonce)
+	tmp := h.Sum(nil)
+	h, _ = blake2b.New(32, c.key)
+	h.Write([]byte("paseto-auth-key-for-aead"))
+	h.Write(nonce)
+	return tmp[:32], tmp[32:], h.Sum(nil)
+}
+
+// localTag returns the authentication tag of a v4.local token.
+func (c *PASETOCodec) localTag(ak, nonce, ciphertext, implicit []byte) []byte {
+	h, _ := blake2b.New(32, ak)
+	h.Write(pae([]byte(pasetoLocal), nonce, ciphertext, nil, implicit))
+	return h.Sum(nil)
+}
+
+// sign returns the payload and signature of a v4.public token.
+func (c *PASETOCodec) sign(payload, implicit []byte) []byte {
+	sig := ed25519.Sign(c.privateKey, pae([]byte(pasetoPublic), payload, nil, implicit))
+	return append(payload[:len(payload):len(payload)], sig...)
+}
+
+// verify checks the signature of the body of a v4.public token and returns
+// its payload.
+func (c *PASETOCodec) verify(body, implicit []byte) ([]byte, error) {
+	if len(body) < ed25519.SignatureSize {
+		return nil, securecookie.ErrMacInvalid
+	}
+	payload, sig := body[:len(body)-ed25519.SignatureSize], body[len(body)-ed25519.SignatureSize:]
+	if !ed25519.Verify(c.publicKey, pae([]byte(pasetoPublic), payload, nil, implicit), sig) {
+		return nil, securecookie.ErrMacInvalid
+	}
+	return payload, nil
+}
+
+// pae is the pre-authentication encoding of PASETO.
+func pae(pieces ...[]byte) []byte {
+	var b bytes.Buffer
+	b.Write(le64(len(pieces)))
+	for _, p := range pieces {
+		b.Write(le64(len(p)))
+		b.Write(p)
+	}
+	return b.Bytes()
+}
+
+// le64 encodes n as 64-bit little endian with the most significant bit
+// cleared.
+func le64(n int) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(n)&(1<<63-1))
+	return b
+}
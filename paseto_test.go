@@ -0,0 +1,118 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+)
+
+// Test vectors 4-E-1 and 4-S-1 of the PASETO specification.
+func TestPASETOVectors(t *testing.T) {
+	key, _ := hex.DecodeString("707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f")
+	local := NewPASETOLocalCodec(key)
+	local.rand = bytes.NewReader(make([]byte, 32))
+	body, err := local.encrypt([]byte(`{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`), nil)
+	if err != nil {
+		t.Fatal("failed to encrypt", err)
+	}
+	want := "v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg"
+	if got := pasetoLocal + base64.RawURLEncoding.EncodeToString(body); got != want {
+		t.Fatalf("bad v4.local token:\n got %s\nwant %s", got, want)
+	}
+
+	sk, _ := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a37741eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2")
+	public := NewPASETOPublicCodec(ed25519.PrivateKey(sk), nil)
+	body = public.sign([]byte(`{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`), nil)
+	want = "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA"
+	if got := pasetoPublic + base64.RawURLEncoding.EncodeToString(body); got != want {
+		t.Fatalf("bad v4.public token:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestPASETOCodec(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("failed to generate key", err)
+	}
+	codecs := []*PASETOCodec{
+		NewPASETOLocalCodec(bytes.Repeat([]byte("k"), 32)),
+		NewPASETOPublicCodec(priv, nil),
+	}
+	for _, c := range codecs {
+		var body []byte
+		token, err := c.Encode("s", map[interface{}]interface{}{"user": "gopher"})
+		if err != nil {
+			t.Fatal("failed to encode", err)
+		}
+		if !strings.HasPrefix(token, c.header) {
+			t.Fatalf("bad token header: %s", token)
+		}
+		var dst map[interface{}]interface{}
+		if err = c.Decode("s", token, &dst); err != nil || dst["user"] != "gopher" {
+			t.Fatalf("failed to decode: %v %v", dst, err)
+		}
+		if err = c.Decode("other", token, &dst); !errors.Is(err, securecookie.ErrMacInvalid) {
+			t.Fatalf("expected ErrMacInvalid for another name, got %v", err)
+		}
+		tampered := []byte(token)
+		tampered[len(tampered)/2] ^= 'A' ^ 'B'
+		if err = c.Decode("s", string(tampered), &dst); !errors.Is(err, securecookie.ErrMacInvalid) {
+			t.Fatalf("expected ErrMacInvalid for a tampered token, got %v", err)
+		}
+		if err = c.Decode("s", token+".Zm9vdGVy", &dst); !errors.Is(err, securecookie.ErrMacInvalid) {
+			t.Fatalf("expected ErrMacInvalid for a token with a footer, got %v", err)
+		}
+		expired := []byte(`{"data":{},"iat":"2020-01-01T00:00:00Z","exp":"2020-01-02T00:00:00Z"}`)
+		if c.header == pasetoLocal {
+			body, _ = c.encrypt(expired, []byte("s"))
+		} else {
+			body = c.sign(expired, []byte("s"))
+		}
+		token = c.header + base64.RawURLEncoding.EncodeToString(body)
+		if err = c.Decode("s", token, &dst); !errors.Is(err, errTimestampExpired) {
+			t.Fatalf("expected errTimestampExpired, got %v", err)
+		}
+	}
+
+	verifier := NewPASETOPublicCodec(nil, pub)
+	token, _ := codecs[1].MaxAge(60).Encode("s", map[interface{}]interface{}{"user": "gopher"})
+	var dst map[interface{}]interface{}
+	if err = verifier.Decode("s", token, &dst); err != nil || dst["user"] != "gopher" {
+		t.Fatalf("failed to verify: %v %v", dst, err)
+	}
+	if _, err = verifier.Encode("s", dst); err == nil {
+		t.Fatal("expected a verify-only codec to fail encoding")
+	}
+	if _, err = NewPASETOLocalCodec([]byte("short")).Encode("s", dst); err == nil {
+		t.Fatal("expected an invalid key to fail encoding")
+	}
+	gob := NewPASETOLocalCodec(bytes.Repeat([]byte("k"), 32)).SetSerializer(securecookie.GobEncoder{})
+	if _, err = gob.Encode("s", dst); !errors.Is(err, errPASETOSerializer) {
+		t.Fatalf("expected errPASETOSerializer, got %v", err)
+	}
+}
+
+func TestPASETOCookieStore(t *testing.T) {
+	store := NewCookieStoreWithOptions(WithPASETO(NewPASETOLocalCodec(bytes.Repeat([]byte("k"), 32))))
+	value := encodeCookie(t, store, "s", "gopher")
+	if !strings.HasPrefix(value, "v4.local.") {
+		t.Fatalf("expected a PASETO token, got %s", value)
+	}
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: value})
+	session, err := store.New(req, "s")
+	if err != nil || session.IsNew || session.Values["user"] != "gopher" {
+		t.Fatalf("failed to load session: %v %v", session.Values, err)
+	}
+}
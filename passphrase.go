@@ -0,0 +1,209 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/securecookie"
+	"golang.org/x/crypto/argon2"
+)
+
+var (
+	// ErrUnknownKDFVersion is returned by PassphraseCodec.Decode for values
+	// whose key derivation version is not known to this release.
+	ErrUnknownKDFVersion = errors.New("sessions: unknown key derivation version")
+	// ErrNoPassphraseContext is returned by a PassphraseCodec created with
+	// an empty context.
+	ErrNoPassphraseContext = errors.New("sessions: passphrase codec has no context")
+)
+
+// kdfParams are the parameters of a key derivation version. Versions are
+// never changed once released: stronger parameters get a new version, so
+// cookies encoded with the former ones are still decoded.
+type kdfParams struct {
+	salt string
+	// context appends the context of the codec to salt.
+	context bool
+	time    uint32
+	memory  uint32 // in KiB
+	threads uint8
+}
+
+// kdfVersions lists the key derivation versions, the last being used to
+// encode values.
+var kdfVersions = []kdfParams{
+	// Version 1 used the same salt for all applications. Its values are
+	// still decoded.
+	1: {salt: "gorilla/sessions passphrase v1", time: 1, memory: 64 * 1024, threads: 4},
+	2: {salt: "gorilla/sessions passphrase v2", context: true, time: 1, memory: 64 * 1024, threads: 4},
+}
+
+// NewCookieStoreFromPassphrase returns a new CookieStore authenticating and
+// encrypting sessions with keys derived from passphrase and context, for
+// applications configured with a passphrase rather than random keys. See
+// PassphraseCodec.
+//
+// The other options are applied as by NewCookieStoreWithOptions; key pair
+// options are ignored.
+func NewCookieStoreFromPassphrase(passphrase, context string,
+	opts ...StoreOption) *CookieStore {
+	opts = append(opts, func(c *storeConfig) {
+		c.passphrase = NewPassphraseCodec(passphrase, context)
+	})
+	return NewCookieStoreWithOptions(opts...)
+}
+
+// NewPassphraseCodec returns a PassphraseCodec deriving its keys from
+// passphrase and context, which must not be empty.
+func NewPassphraseCodec(passphrase, context string) *PassphraseCodec {
+	return &PassphraseCodec{
+		passphrase: passphrase,
+		context:    context,
+		maxAge:     86400 * 30,
+		maxLength:  4096,
+		codecs:     make([]*securecookie.SecureCookie, len(kdfVersions)),
+	}
+}
+
+// PassphraseCodec is a securecookie.Codec authenticating values with
+// HMAC-SHA256 and encrypting them with AES-256, using keys derived from a
+// passphrase with Argon2id.
+//
+// Encoded values are prefixed with the version of the key derivation
+// parameters, such as "p1.", so the parameters can be strengthened in a
+// later release while cookies encoded with the former ones are still
+// decoded. Keys are derived when a version is first used, which takes a
+// fraction of a second and 64 MiB of memory.
+//
+// The salt is made of a constant of the version and of the context, a
+// string identifying the application, such as "example.com sessions",
+// which every instance of the application must share to derive the same
+// keys. Applications using the same passphrase then still get different
+// keys, and guesses computed against one don't apply to the others. The
+// passphrase must still be long and random enough to resist guessing.
+type PassphraseCodec struct {
+	passphrase string
+	context    string
+
+	mu        sync.Mutex // guards the fields below
+	maxAge    int
+	maxLength int
+	sz        securecookie.Serializer
+	// codecs holds the codec of each version once its keys are derived.
+	codecs []*securecookie.SecureCookie
+}
+
+// MaxAge sets the maximum age of values in seconds. A value of 0 disables
+// the check.
+func (c *PassphraseCodec) MaxAge(age int) *PassphraseCodec {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxAge = age
+	for _, sc := range c.codecs {
+		if sc != nil {
+			sc.MaxAge(age)
+		}
+	}
+	return c
+}
+
+// MaxLength sets the maximum length of encoded values. A value of 0
+// disables the check. The default is 4096.
+func (c *PassphraseCodec) MaxLength(l int) *PassphraseCodec {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxLength = l
+	for _, sc := range c.codecs {
+		if sc != nil {
+			sc.MaxLength(l)
+		}
+	}
+	return c
+}
+
+// SetSerializer sets the serializer of values. The default is
+// securecookie.GobEncoder.
+func (c *PassphraseCodec) SetSerializer(sz securecookie.Serializer) *PassphraseCodec {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sz = sz
+	for _, sc := range c.codecs {
+		if sc != nil {
+			sc.SetSerializer(sz)
+		}
+	}
+	return c
+}
+
+// Encode encodes value under name with the keys of the current version.
+func (c *PassphraseCodec) Encode(name string, value interface{}) (string, error) {
+	version := len(kdfVersions) - 1
+	sc, err := c.codec(version)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := sc.Encode(name, value)
+	if err != nil {
+		return "", err
+	}
+	return "p" + strconv.Itoa(version) + "." + encoded, nil
+}
+
+// Decode decodes value, encoded under name, into dst with the keys of the
+// version in its prefix.
+func (c *PassphraseCodec) Decode(name, value string, dst interface{}) error {
+	prefix, encoded, ok := strings.Cut(value, ".")
+	if !ok || !strings.HasPrefix(prefix, "p") {
+		return securecookie.ErrMacInvalid
+	}
+	version, err := strconv.Atoi(prefix[1:])
+	if err != nil {
+		return securecookie.ErrMacInvalid
+	}
+	if version < 1 || version >= len(kdfVersions) {
+		return fmt.Errorf("%w: %d", ErrUnknownKDFVersion, version)
+	}
+	sc, err := c.codec(version)
+	if err != nil {
+		return err
+	}
+	return sc.Decode(name, encoded, dst)
+}
+
+// codec returns the codec of a version, deriving its keys if needed.
+func (c *PassphraseCodec) codec(version int) (*securecookie.SecureCookie, error) {
+	p := kdfVersions[version]
+	salt := p.salt
+	if p.context {
+		if c.context == "" {
+			return nil, ErrNoPassphraseContext
+		}
+		salt += "\x00" + c.context
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sc := c.codecs[version]; sc != nil {
+		return sc, nil
+	}
+	var hashKey, blockKey []byte
+	if c.passphrase != "" {
+		key := argon2.IDKey([]byte(c.passphrase), []byte(salt), p.time,
+			p.memory, p.threads, 64)
+		hashKey, blockKey = key[:32], key[32:]
+	}
+	// With an empty passphrase, securecookie reports that the hash key is
+	// not set when encoding and decoding.
+	sc := securecookie.New(hashKey, blockKey).MaxAge(c.maxAge).MaxLength(c.maxLength)
+	if c.sz != nil {
+		sc.SetSerializer(c.sz)
+	}
+	c.codecs[version] = sc
+	return sc, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCookieStoreFromPassphrase(t *testing.T) {
+	store := NewCookieStoreFromPassphrase("correct horse battery staple", "example.com",
+		WithNotBefore(time.Now().Add(-time.Minute)))
+	value := encodeCookie(t, store, "s", "gopher")
+	if !strings.HasPrefix(value, "p2.") {
+		t.Fatalf("expected a versioned value, got %s", value)
+	}
+
+	// Another instance derives the same keys.
+	other := NewCookieStoreFromPassphrase("correct horse battery staple", "example.com")
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: value})
+	for _, s := range []*CookieStore{store, other} {
+		session, err := s.New(req, "s")
+		if err != nil || session.Values["user"] != "gopher" {
+			t.Fatalf("failed to decode session: %v %v", session.Values, err)
+		}
+		if session.IssuedAt().IsZero() {
+			t.Fatal("expected the issue time to be known")
+		}
+	}
+
+	var dst map[interface{}]interface{}
+	codec := other.Codecs[0]
+	if err := NewPassphraseCodec("another passphrase", "example.com").Decode("s", value, &dst); err == nil {
+		t.Fatal("expected another passphrase to fail")
+	}
+	// Applications sharing a passphrase derive different keys.
+	if err := NewPassphraseCodec("correct horse battery staple", "example.org").Decode("s", value, &dst); err == nil {
+		t.Fatal("expected another context to fail")
+	}
+	if err := codec.Decode("s", "p9."+value[3:], &dst); !errors.Is(err, ErrUnknownKDFVersion) {
+		t.Fatalf("expected ErrUnknownKDFVersion, got %v", err)
+	}
+	if err := codec.Decode("s", value[3:], &dst); err == nil {
+		t.Fatal("expected a value without version to fail")
+	}
+	if _, err := NewPassphraseCodec("", "example.com").Encode("s", dst); err == nil {
+		t.Fatal("expected an empty passphrase to fail")
+	}
+	if _, err := NewPassphraseCodec("correct horse battery staple", "").Encode("s", dst); !errors.Is(err, ErrNoPassphraseContext) {
+		t.Fatalf("expected ErrNoPassphraseContext, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+)
+
+// Session values key for the persisted cookie attributes.
+const optionsKey = "_opts"
+
+func init() {
+	RegisterType[CookieAttributes]("sessions.CookieAttributes")
+}
+
+// CookieAttributes are the cookie attributes of a session persisted by
+// server-side stores with PersistOptions set.
+type CookieAttributes struct {
+	Path        string
+	Domain      string
+	Secure      bool
+	HttpOnly    bool
+	Partitioned bool
+	SameSite    http.SameSite
+}
+
+// attachOptions adds the cookie attributes of the session options to its
+// values, to be saved with them, and returns a function removing them.
+func attachOptions(session *Session) func() {
+	o := session.Options
+	session.initValues()
+	session.Values[optionsKey] = CookieAttributes{
+		Path:        o.Path,
+		Domain:      o.Domain,
+		Secure:      o.Secure,
+		HttpOnly:    o.HttpOnly,
+		Partitioned: o.Partitioned,
+		SameSite:    o.SameSite,
+	}
+	return func() { delete(session.Values, optionsKey) }
+}
+
+// restoreOptions applies the cookie attributes saved with the session
+// values to its options, and removes them from the values.
+func restoreOptions(session *Session) {
+	attrs, ok := session.Values[optionsKey].(CookieAttributes)
+	delete(session.Values, optionsKey)
+	if !ok || session.Options == nil {
+		return
+	}
+	o := session.Options
+	o.Path = attrs.Path
+	o.Domain = attrs.Domain
+	o.Secure = attrs.Secure
+	o.HttpOnly = attrs.HttpOnly
+	o.Partitioned = attrs.Partitioned
+	o.SameSite = attrs.SameSite
+}
@@ -0,0 +1,43 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPersistOptions(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	store.PersistOptions = true
+	store.Options.Path = "/app"
+	store.Options.SameSite = http.SameSiteStrictMode
+	cookie := encodeCookie(t, store, "s", "gopher")
+
+	// The defaults change after the session was created.
+	store.Options.Path = "/"
+	store.Options.SameSite = http.SameSiteLaxMode
+
+	req, _ := http.NewRequest("GET", "http://www.example.com/app", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to load session", err)
+	}
+	if session.Options.Path != "/app" || session.Options.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("bad restored options: %+v", session.Options)
+	}
+	if _, ok := session.Values[optionsKey]; ok || len(session.Values) != 1 {
+		t.Fatalf("expected the attributes to be removed from the values: %v", session.Values)
+	}
+	w := httptest.NewRecorder()
+	if err = store.Delete(req, w, session); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+	if c := w.Result().Cookies()[0]; c.Path != "/app" || c.MaxAge >= 0 {
+		t.Fatalf("expected the deletion cookie to match the browser cookie: %v", c)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// ErrWriteDenied is wrapped by the errors of Session.Set and Save when a
+// WritePolicy rejects a change.
+var ErrWriteDenied = errors.New("sessions: session write denied")
+
+// WritePolicy decides whether a session value may change from oldValue to
+// newValue during request r, returning an error to veto the change. Both
+// values are nil for missing keys.
+type WritePolicy func(key, oldValue, newValue interface{}, r *http.Request) error
+
+// NewPolicyStore returns a PolicyStore wrapping store and enforcing policy.
+func NewPolicyStore(store Store, policy WritePolicy) *PolicyStore {
+	return &PolicyStore{
+		Store:  store,
+		Policy: policy,
+	}
+}
+
+// PolicyStore wraps a Store and enforces a WritePolicy on the values of
+// its sessions, as defense in depth for applications where many handlers
+// share sessions: for example, only the handlers of the login service may
+// set a "role" key.
+//
+// Session.Set checks the policy before changing a value. Values assigned
+// directly to Session.Values, or modified in place, are checked when the
+// session is saved, by comparing them with reflect.DeepEqual to deep copies
+// of the values last loaded, saved or set; Save fails if any change is
+// vetoed. Unexported struct fields are not copied, so changes made through
+// them are not detected. The keys used internally by
+// this package are not checked, and deleting a session is always allowed.
+type PolicyStore struct {
+	Store  Store
+	Policy WritePolicy
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *PolicyStore) Get(r *http.Request, name string) (*Session, error) {
+	return GetRegistry(r).Get(s, name)
+}
+
+// Unwrap returns the wrapped store.
+func (s *PolicyStore) Unwrap() Store {
+	return s.Store
+}
+
+// New returns a session for the given name without adding it to the
+// registry, binding the policy to r for Session.Set.
+func (s *PolicyStore) New(r *http.Request, name string) (*Session, error) {
+	session, err := s.Store.New(r, name)
+	if session == nil {
+		return nil, err
+	}
+	session.store = s
+	session.approvedValues = copyValues(session.Values)
+	session.writePolicy = func(key, oldValue, newValue interface{}) error {
+		return s.check(r, key, oldValue, newValue)
+	}
+	return session, err
+}
+
+// Save checks the values changed since they were last approved, and saves
+// the session in the wrapped store if none is vetoed.
+func (s *PolicyStore) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if session.Options.MaxAge >= 0 {
+		for key, value := range session.Values {
+			old := session.approvedValues[key]
+			if !session.isReserved(key) && !reflect.DeepEqual(old, value) {
+				if err := s.check(r, key, old, value); err != nil {
+					return err
+				}
+			}
+		}
+		for key, old := range session.approvedValues {
+			if _, ok := session.Values[key]; !ok && !session.isReserved(key) {
+				if err := s.check(r, key, old, nil); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := s.Store.Save(r, w, session); err != nil {
+		return err
+	}
+	session.approvedValues = copyValues(session.Values)
+	return nil
+}
+
+// Delete deletes the session from the wrapped store.
+func (s *PolicyStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	return deleteSession(s.Store, r, w, session)
+}
+
+// check calls the policy, wrapping its error with ErrWriteDenied.
+func (s *PolicyStore) check(r *http.Request, key, oldValue, newValue interface{}) error {
+	if s.Policy == nil {
+		return nil
+	}
+	if err := s.Policy(key, oldValue, newValue, r); err != nil {
+		return fmt.Errorf("%w: key %v: %w", ErrWriteDenied, key, err)
+	}
+	return nil
+}
+
+// copyValues returns a deep copy of values.
+func copyValues(values map[interface{}]interface{}) map[interface{}]interface{} {
+	c := make(map[interface{}]interface{}, len(values))
+	for k, v := range values {
+		c[k] = copyValue(v)
+	}
+	return c
+}
+
+// copyValue returns a deep copy of v, so changes made in place to the maps,
+// slices and pointers it holds don't affect the copy.
+func copyValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return deepCopy(reflect.ValueOf(v), make(map[uintptr]reflect.Value)).Interface()
+}
+
+// deepCopy copies v, recursing into the exported fields of structs. Pointers
+// already copied are looked up in seen, to preserve cycles.
+func deepCopy(v reflect.Value, seen map[uintptr]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		if c, ok := seen[v.Pointer()]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		seen[v.Pointer()] = c
+		c.Elem().Set(deepCopy(v.Elem(), seen))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem(), seen))
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value(), seen))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i), seen))
+			}
+		}
+		return c
+	}
+	return v
+}
@@ -0,0 +1,87 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPolicyStore(t *testing.T) {
+	errNotAuth := errors.New("only the auth service may set the role")
+	var calls int
+	store := NewPolicyStore(NewCookieStore([]byte("secret-key")),
+		func(key, oldValue, newValue interface{}, r *http.Request) error {
+			calls++
+			if key == "role" && r.URL.Path != "/auth" {
+				return errNotAuth
+			}
+			return nil
+		})
+
+	req, _ := http.NewRequest("GET", "http://www.example.com/auth", nil)
+	session, _ := store.New(req, "s")
+	if err := session.Set("role", "admin"); err != nil {
+		t.Fatal("failed to set role", err)
+	}
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	// The value approved by Set is not checked again.
+	if calls != 1 {
+		t.Fatalf("expected 1 policy call, got %d", calls)
+	}
+
+	req, _ = http.NewRequest("GET", "http://www.example.com/profile", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to decode session", err)
+	}
+	if err = session.Set("theme", "dark"); err != nil {
+		t.Fatal("failed to set theme", err)
+	}
+	if err = session.Set("role", "root"); !errors.Is(err, ErrWriteDenied) || !errors.Is(err, errNotAuth) {
+		t.Fatalf("expected the role to be denied, got %v", err)
+	}
+	if session.Values["role"] != "admin" {
+		t.Fatalf("expected the role to be unchanged, got %v", session.Values["role"])
+	}
+
+	// Direct changes and deletions are checked at Save time.
+	session.Values["role"] = "root"
+	if err = session.Save(req, httptest.NewRecorder()); !errors.Is(err, ErrWriteDenied) {
+		t.Fatalf("expected Save to be denied, got %v", err)
+	}
+	delete(session.Values, "role")
+	if err = session.Save(req, httptest.NewRecorder()); !errors.Is(err, ErrWriteDenied) {
+		t.Fatalf("expected Save to be denied, got %v", err)
+	}
+	session.Values["role"] = "admin"
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+
+	// Values modified in place are checked at Save time too.
+	req.URL.Path = "/auth"
+	if err = session.Set("role", []string{"admin"}); err != nil {
+		t.Fatal("failed to set role", err)
+	}
+	req.URL.Path = "/profile"
+	session.Values["role"].([]string)[0] = "root"
+	if err = session.Save(req, httptest.NewRecorder()); !errors.Is(err, ErrWriteDenied) {
+		t.Fatalf("expected Save to be denied, got %v", err)
+	}
+	session.Values["role"].([]string)[0] = "admin"
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if err = store.Delete(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+}
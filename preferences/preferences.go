@@ -0,0 +1,250 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package preferences stores the locale, time zone and theme of visitors in
+a session, with typed accessors and fallbacks for visitors who haven't
+chosen yet: the Accept-Language header for the locale, and the
+Sec-CH-Prefers-Color-Scheme client hint for the theme.
+
+	var prefs = &preferences.Config{
+		Locales: []string{"en", "fr", "pt-BR"},
+		Themes:  []string{"light", "dark"},
+	}
+
+	func handler(w http.ResponseWriter, r *http.Request) {
+		session, _ := store.Get(r, "session-name")
+		p := prefs.For(r, session)
+		if locale := r.FormValue("locale"); locale != "" {
+			if err := p.SetLocale(locale); err != nil { ... }
+			session.Save(r, w)
+		}
+		render(w, p.Locale(), p.Location(), p.Theme())
+	}
+
+Values are stored as strings under LocaleKey, TimezoneKey and ThemeKey,
+so they work with any serializer. They are set with Session.Set, so the
+changes are checked by a sessions.PolicyStore.
+*/
+package preferences
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// Session values keys of the preferences.
+const (
+	LocaleKey   = "locale"
+	TimezoneKey = "timezone"
+	ThemeKey    = "theme"
+)
+
+var (
+	// ErrUnsupportedLocale is returned by SetLocale for locales not listed
+	// in Config.Locales.
+	ErrUnsupportedLocale = errors.New("preferences: unsupported locale")
+	// ErrUnknownTimezone is returned by SetTimezone for names not found in
+	// the time zone database.
+	ErrUnknownTimezone = errors.New("preferences: unknown time zone")
+	// ErrUnsupportedTheme is returned by SetTheme for themes not listed in
+	// Config.Themes.
+	ErrUnsupportedTheme = errors.New("preferences: unsupported theme")
+)
+
+// Config holds the supported preferences of an application. It must not be
+// modified once in use.
+type Config struct {
+	// Locales lists the supported locales as BCP 47 tags, such as "en" or
+	// "pt-BR", the first being the default. If empty, any locale can be
+	// set and the Accept-Language fallback is disabled.
+	Locales []string
+	// Timezone is the default time zone. The default is UTC.
+	Timezone *time.Location
+	// Themes lists the supported themes, the first being the default. If
+	// empty, any theme can be set.
+	Themes []string
+}
+
+// For returns the preferences stored in session, falling back to the
+// headers of r.
+func (c *Config) For(r *http.Request, session *sessions.Session) *Preferences {
+	return &Preferences{config: c, r: r, session: session}
+}
+
+// Preferences gives typed access to the preferences stored in a session.
+type Preferences struct {
+	config  *Config
+	r       *http.Request
+	session *sessions.Session
+}
+
+// Locale returns the locale stored in the session if it is still
+// supported, otherwise the supported locale best matching the
+// Accept-Language header, otherwise the default locale.
+func (p *Preferences) Locale() string {
+	if locale, ok := p.session.Values[LocaleKey].(string); ok {
+		if len(p.config.Locales) == 0 {
+			return locale
+		}
+		if supported, ok := match(p.config.Locales, locale); ok {
+			return supported
+		}
+	}
+	for _, tag := range acceptLanguages(p.r) {
+		if supported, ok := match(p.config.Locales, tag); ok {
+			return supported
+		}
+	}
+	if len(p.config.Locales) > 0 {
+		return p.config.Locales[0]
+	}
+	return ""
+}
+
+// SetLocale stores locale, which must match one of Config.Locales, in the
+// session. The matching supported locale is stored, so "en-us" is stored
+// as "en-US" and "fr-CA" as "fr" if only "en-US" and "fr" are supported.
+func (p *Preferences) SetLocale(locale string) error {
+	if len(p.config.Locales) > 0 {
+		supported, ok := match(p.config.Locales, locale)
+		if !ok {
+			return ErrUnsupportedLocale
+		}
+		locale = supported
+	}
+	return p.session.Set(LocaleKey, locale)
+}
+
+// Timezone returns the name of the time zone of Location.
+func (p *Preferences) Timezone() string {
+	return p.Location().String()
+}
+
+// Location returns the time zone stored in the session, otherwise the
+// default time zone.
+func (p *Preferences) Location() *time.Location {
+	if name, ok := p.session.Values[TimezoneKey].(string); ok {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	if p.config.Timezone != nil {
+		return p.config.Timezone
+	}
+	return time.UTC
+}
+
+// SetTimezone stores the IANA time zone name, such as "Europe/Paris", in
+// the session. Browsers report it with
+// Intl.DateTimeFormat().resolvedOptions().timeZone.
+func (p *Preferences) SetTimezone(name string) error {
+	// LoadLocation returns UTC for "" and the local time zone for "Local",
+	// which are not what a visitor chose.
+	if name == "" || name == "Local" {
+		return ErrUnknownTimezone
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return ErrUnknownTimezone
+	}
+	return p.session.Set(TimezoneKey, name)
+}
+
+// Theme returns the theme stored in the session if it is still supported,
+// otherwise the supported theme requested by the
+// Sec-CH-Prefers-Color-Scheme client hint, otherwise the default theme.
+func (p *Preferences) Theme() string {
+	if theme, ok := p.session.Values[ThemeKey].(string); ok && p.supportsTheme(theme) {
+		return theme
+	}
+	if hint := strings.Trim(p.r.Header.Get("Sec-CH-Prefers-Color-Scheme"), `"`); p.supportsTheme(hint) {
+		return hint
+	}
+	if len(p.config.Themes) > 0 {
+		return p.config.Themes[0]
+	}
+	return ""
+}
+
+// SetTheme stores theme, which must be one of Config.Themes, in the
+// session.
+func (p *Preferences) SetTheme(theme string) error {
+	if !p.supportsTheme(theme) {
+		return ErrUnsupportedTheme
+	}
+	return p.session.Set(ThemeKey, theme)
+}
+
+// supportsTheme reports whether theme is supported.
+func (p *Preferences) supportsTheme(theme string) bool {
+	if len(p.config.Themes) == 0 {
+		return theme != ""
+	}
+	for _, t := range p.config.Themes {
+		if t == theme {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the supported locale matching tag: the locale equal to tag
+// ignoring case, otherwise the first one with the same language, such as
+// "fr" or "fr-FR" for "fr-CA".
+func match(supported []string, tag string) (string, bool) {
+	for _, s := range supported {
+		if strings.EqualFold(s, tag) {
+			return s, true
+		}
+	}
+	lang, _, _ := strings.Cut(tag, "-")
+	if lang == "" || lang == "*" {
+		return "", false
+	}
+	for _, s := range supported {
+		if l, _, _ := strings.Cut(s, "-"); strings.EqualFold(l, lang) {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// acceptLanguages returns the tags of the Accept-Language header of r, by
+// decreasing quality, ignoring those with a quality of 0.
+func acceptLanguages(r *http.Request) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, header := range r.Header.Values("Accept-Language") {
+		for _, part := range strings.Split(header, ",") {
+			tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			q := 1.0
+			if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				var err error
+				if q, err = strconv.ParseFloat(v, 64); err != nil {
+					continue
+				}
+			}
+			if tag = strings.TrimSpace(tag); tag != "" && q > 0 {
+				tags = append(tags, weighted{tag, q})
+			}
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
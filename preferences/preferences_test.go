@@ -0,0 +1,78 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package preferences
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestPreferences(t *testing.T) {
+	config := &Config{
+		Locales: []string{"en-US", "fr", "pt-BR"},
+		Themes:  []string{"light", "dark"},
+	}
+	store := sessions.NewCookieStore([]byte("secret-key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	p := config.For(req, session)
+
+	// Defaults.
+	if p.Locale() != "en-US" || p.Theme() != "light" || p.Timezone() != "UTC" {
+		t.Fatalf("bad defaults: %s %s %s", p.Locale(), p.Theme(), p.Timezone())
+	}
+
+	// Header fallbacks.
+	req.Header.Set("Accept-Language", "de-DE, fr-CA;q=0.8, pt;q=0.9, en;q=0")
+	req.Header.Set("Sec-CH-Prefers-Color-Scheme", `"dark"`)
+	if p.Locale() != "pt-BR" || p.Theme() != "dark" {
+		t.Fatalf("bad fallbacks: %s %s", p.Locale(), p.Theme())
+	}
+
+	// Stored preferences.
+	if err := p.SetLocale("FR-ca"); err != nil {
+		t.Fatal("failed to set locale", err)
+	}
+	if err := p.SetTimezone("Europe/Paris"); err != nil {
+		t.Fatal("failed to set time zone", err)
+	}
+	if err := p.SetTheme("light"); err != nil {
+		t.Fatal("failed to set theme", err)
+	}
+	if session.Values[LocaleKey] != "fr" {
+		t.Fatalf("expected the supported locale to be stored, got %v", session.Values[LocaleKey])
+	}
+	if p.Locale() != "fr" || p.Theme() != "light" || p.Location().String() != "Europe/Paris" {
+		t.Fatalf("bad preferences: %s %s %s", p.Locale(), p.Theme(), p.Location())
+	}
+
+	if err := p.SetLocale("de"); !errors.Is(err, ErrUnsupportedLocale) {
+		t.Fatalf("expected ErrUnsupportedLocale, got %v", err)
+	}
+	for _, name := range []string{"", "Local", "Mars/Olympus"} {
+		if err := p.SetTimezone(name); !errors.Is(err, ErrUnknownTimezone) {
+			t.Fatalf("expected ErrUnknownTimezone for %q, got %v", name, err)
+		}
+	}
+	if err := p.SetTheme("solarized"); !errors.Is(err, ErrUnsupportedTheme) {
+		t.Fatalf("expected ErrUnsupportedTheme, got %v", err)
+	}
+}
+
+func TestPreferencesPolicy(t *testing.T) {
+	errDenied := errors.New("denied")
+	store := sessions.NewPolicyStore(sessions.NewCookieStore([]byte("secret-key")),
+		func(key, oldValue, newValue interface{}, r *http.Request) error {
+			return errDenied
+		})
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	if err := (&Config{}).For(req, session).SetTheme("dark"); !errors.Is(err, errDenied) {
+		t.Fatalf("expected the policy to veto the theme, got %v", err)
+	}
+}
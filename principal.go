@@ -0,0 +1,424 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrTooManySessions is returned by PrincipalLimiter.Save when a principal
+// already has the maximum number of sessions and the policy is RejectNew.
+var ErrTooManySessions = errors.New("sessions: too many sessions for principal")
+
+// Session values keys for the slot assigned by PrincipalLimiter and the
+// principal owning it.
+const (
+	slotKey          = "_slot"
+	slotPrincipalKey = "_slot_principal"
+)
+
+// IndexedSession is a session slot tracked by a PrincipalIndex.
+type IndexedSession struct {
+	ID      string
+	Created time.Time
+	// Expires is the time the slot stops counting toward the limit, after
+	// its session cookie expired. The zero time means it doesn't expire.
+	Expires time.Time
+}
+
+// expired reports whether the slot expired at now.
+func (s IndexedSession) expired(now time.Time) bool {
+	return !s.Expires.IsZero() && !now.Before(s.Expires)
+}
+
+// unexpired returns the slots of sessions that didn't expire at now.
+func unexpired(sessions []IndexedSession, now time.Time) []IndexedSession {
+	list := sessions[:0:0]
+	for _, s := range sessions {
+		if !s.expired(now) {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// PrincipalIndex tracks the sessions of each principal, typically a user.
+//
+// Implementations must be safe for concurrent use.
+type PrincipalIndex interface {
+	// Add records a session for principal. Adding a session with the ID
+	// of a recorded session of principal replaces it.
+	Add(principal string, s IndexedSession) error
+	// Remove forgets a session of principal. Removing an unknown session
+	// is not an error.
+	Remove(principal, id string) error
+	// Sessions returns the sessions of principal, oldest first. It may
+	// include expired sessions, which callers ignore.
+	Sessions(principal string) ([]IndexedSession, error)
+}
+
+// LimitedPrincipalIndex is a PrincipalIndex that can enforce a maximum
+// number of sessions per principal atomically. Indexes shared by several
+// processes should implement it, so concurrent logins can't exceed the
+// limit.
+type LimitedPrincipalIndex interface {
+	PrincipalIndex
+	// AddLimited records a session for principal if it has fewer than max
+	// unexpired sessions. Otherwise it removes its oldest sessions to make room if
+	// policy is EvictOldest, or returns ErrTooManySessions if it is
+	// RejectNew.
+	AddLimited(principal string, s IndexedSession, max int, policy LimitPolicy) error
+}
+
+// LimitPolicy selects what PrincipalLimiter does when a principal reaches
+// the maximum number of sessions.
+type LimitPolicy int
+
+const (
+	// EvictOldest ends the oldest session of the principal.
+	EvictOldest LimitPolicy = iota
+	// RejectNew makes saving the new session fail with ErrTooManySessions.
+	RejectNew
+)
+
+// NewPrincipalLimiter returns a PrincipalLimiter allowing at most max
+// concurrent sessions per principal, identified by session.Values[key].
+func NewPrincipalLimiter(store Store, index PrincipalIndex, key interface{},
+	max int) *PrincipalLimiter {
+	return &PrincipalLimiter{
+		Store: store,
+		Index: index,
+		Key:   key,
+		Max:   max,
+	}
+}
+
+// PrincipalLimiter wraps a Store and enforces a maximum number of
+// concurrent sessions per principal.
+//
+// A session belongs to a principal when Values[Key] is set, which usually
+// happens on login. When the session is saved it is assigned a slot in the
+// index; sessions whose slot was evicted are returned as new sessions by
+// New and Get, so they are logged out on their next request. This works
+// with any store, including CookieStore.
+//
+// Slots expire with the session cookie, at the time given by the MaxAge
+// or Expires options of the session when it is saved, so abandoned
+// sessions stop counting toward the limit. Saving the session again
+// extends the slot once half of its lifetime has passed. Slots of browser
+// session cookies, without a MaxAge, only end on logout or eviction.
+//
+// If Index implements LimitedPrincipalIndex, slots are assigned with
+// AddLimited. Otherwise the slots of a principal are assigned one at a
+// time within the process, which doesn't prevent processes sharing the
+// index from exceeding the limit when logging in concurrently.
+type PrincipalLimiter struct {
+	Store  Store
+	Index  PrincipalIndex
+	Key    interface{}
+	Max    int
+	Policy LimitPolicy
+	// Entropy is the source of random bytes for slot IDs. If nil,
+	// crypto/rand is used.
+	Entropy io.Reader
+
+	locks [lockStripes]sync.Mutex
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (l *PrincipalLimiter) Get(r *http.Request, name string) (*Session, error) {
+	return GetRegistry(r).Get(l, name)
+}
+
+// Unwrap returns the wrapped store.
+func (l *PrincipalLimiter) Unwrap() Store {
+	return l.Store
+}
+
+// New returns a session for the given name without adding it to the
+// registry. If the session was evicted, a new session is returned.
+func (l *PrincipalLimiter) New(r *http.Request, name string) (*Session, error) {
+	session, err := l.Store.New(r, name)
+	if session == nil {
+		return nil, err
+	}
+	session.store = l
+	principal, ok := l.principal(session)
+	if err != nil || !ok {
+		return session, err
+	}
+	slot, _ := session.Values[slotKey].(string)
+	_, found, err := l.findSlot(principal, slot)
+	if err != nil {
+		return session, err
+	}
+	if !found {
+		session.Values = make(map[interface{}]interface{})
+		session.IsNew = true
+	}
+	return session, nil
+}
+
+// Save assigns a slot to sessions of a new principal, enforcing the
+// limit, and saves the session in the wrapped store.
+//
+// Deleting a session, removing its principal or switching to another
+// principal frees its slot.
+func (l *PrincipalLimiter) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	principal, ok := l.principal(session)
+	deleted := session.Options.MaxAge < 0
+	slot, _ := session.Values[slotKey].(string)
+	owner, _ := session.Values[slotPrincipalKey].(string)
+	if slot != "" && (!ok || deleted || owner != principal) {
+		if err := l.release(session); err != nil {
+			return err
+		}
+		slot = ""
+	}
+	if ok && !deleted {
+		now := time.Now()
+		expires := slotExpiry(session, now)
+		indexed, found, err := l.findSlot(principal, slot)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !found:
+			if slot, err = generateID(l.Entropy, 20); err != nil {
+				return err
+			}
+			err = l.add(principal, IndexedSession{ID: slot, Created: now, Expires: expires})
+			if err != nil {
+				return err
+			}
+			session.Values[slotKey] = slot
+			session.Values[slotPrincipalKey] = principal
+		case extendSlot(indexed, expires, now):
+			indexed.Expires = expires
+			if err = l.Index.Add(principal, indexed); err != nil {
+				return err
+			}
+		}
+	}
+	return l.Store.Save(r, w, session)
+}
+
+// extendSlot reports whether the expiry of slot must be updated to
+// expires, the expiry of its session cookie saved at now: the cookie
+// became a browser session cookie or the reverse, or less than half of
+// the lifetime of the cookie is left to the slot.
+func extendSlot(slot IndexedSession, expires, now time.Time) bool {
+	if slot.Expires.IsZero() || expires.IsZero() {
+		return slot.Expires.IsZero() != expires.IsZero()
+	}
+	return slot.Expires.Sub(now) < expires.Sub(now)/2
+}
+
+// slotExpiry returns the time the cookie of session expires if it is
+// saved at now, or the zero time for browser session cookies.
+func slotExpiry(session *Session, now time.Time) time.Time {
+	maxAge := session.Options.maxAge(now)
+	if maxAge <= 0 {
+		return time.Time{}
+	}
+	return now.Add(time.Duration(maxAge) * time.Second)
+}
+
+// Delete frees the slot of the session and deletes it from the wrapped
+// store.
+func (l *PrincipalLimiter) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if err := l.release(session); err != nil {
+		return err
+	}
+	return deleteSession(l.Store, r, w, session)
+}
+
+// release frees the slot of the session, if any.
+func (l *PrincipalLimiter) release(session *Session) error {
+	slot, _ := session.Values[slotKey].(string)
+	if slot == "" {
+		return nil
+	}
+	owner, _ := session.Values[slotPrincipalKey].(string)
+	if err := l.Index.Remove(owner, slot); err != nil {
+		return err
+	}
+	delete(session.Values, slotKey)
+	delete(session.Values, slotPrincipalKey)
+	return nil
+}
+
+// add records a new session of principal, making room for it according
+// to the policy.
+func (l *PrincipalLimiter) add(principal string, s IndexedSession) error {
+	if l.Max <= 0 {
+		return l.Index.Add(principal, s)
+	}
+	if index, ok := l.Index.(LimitedPrincipalIndex); ok {
+		return index.AddLimited(principal, s, l.Max, l.Policy)
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(principal))
+	mu := &l.locks[h.Sum32()%lockStripes]
+	mu.Lock()
+	defer mu.Unlock()
+	if err := l.reserve(principal); err != nil {
+		return err
+	}
+	return l.Index.Add(principal, s)
+}
+
+// reserve makes room for a new session of principal according to the
+// policy.
+func (l *PrincipalLimiter) reserve(principal string) error {
+	sessions, err := l.Index.Sessions(principal)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, s := range sessions {
+		if s.expired(now) {
+			if err = l.Index.Remove(principal, s.ID); err != nil {
+				return err
+			}
+		}
+	}
+	sessions = unexpired(sessions, now)
+	for len(sessions) >= l.Max {
+		if l.Policy == RejectNew {
+			return ErrTooManySessions
+		}
+		if err = l.Index.Remove(principal, sessions[0].ID); err != nil {
+			return err
+		}
+		sessions = sessions[1:]
+	}
+	return nil
+}
+
+// principal returns the principal of session as a string.
+func (l *PrincipalLimiter) principal(session *Session) (string, bool) {
+	v, ok := session.Values[l.Key]
+	if !ok || v == nil {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// findSlot returns slot and true if it is tracked for principal and
+// didn't expire.
+func (l *PrincipalLimiter) findSlot(principal, slot string) (IndexedSession, bool, error) {
+	if slot == "" {
+		return IndexedSession{}, false, nil
+	}
+	sessions, err := l.Index.Sessions(principal)
+	if err != nil {
+		return IndexedSession{}, false, err
+	}
+	for _, s := range sessions {
+		if s.ID == slot {
+			return s, !s.expired(time.Now()), nil
+		}
+	}
+	return IndexedSession{}, false, nil
+}
+
+// NewMemoryPrincipalIndex returns a PrincipalIndex kept in memory. It is
+// suitable for a single process.
+func NewMemoryPrincipalIndex() *MemoryPrincipalIndex {
+	return &MemoryPrincipalIndex{
+		sessions: make(map[string][]IndexedSession),
+	}
+}
+
+// MemoryPrincipalIndex is an in-memory PrincipalIndex.
+type MemoryPrincipalIndex struct {
+	mu       sync.Mutex
+	sessions map[string][]IndexedSession
+}
+
+// Add records a session for principal, replacing the session with the
+// same ID if any.
+func (m *MemoryPrincipalIndex) Add(principal string, s IndexedSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := m.sessions[principal]
+	for i := range list {
+		if list[i].ID == s.ID {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	m.set(principal, append(list, s))
+	return nil
+}
+
+// AddLimited records a session for principal, enforcing max atomically.
+// Expired sessions are removed first.
+func (m *MemoryPrincipalIndex) AddLimited(principal string, s IndexedSession,
+	max int, policy LimitPolicy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := unexpired(m.sessions[principal], time.Now())
+	if max > 0 && len(list) >= max {
+		if policy == RejectNew {
+			return ErrTooManySessions
+		}
+		list = list[len(list)-max+1:]
+	}
+	m.set(principal, append(list[:len(list):len(list)], s))
+	return nil
+}
+
+// set sorts list and records it as the sessions of principal. m.mu must
+// be held.
+func (m *MemoryPrincipalIndex) set(principal string, list []IndexedSession) {
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Created.Before(list[j].Created)
+	})
+	m.sessions[principal] = list
+}
+
+// Remove forgets a session of principal.
+func (m *MemoryPrincipalIndex) Remove(principal, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := m.sessions[principal]
+	for i, s := range list {
+		if s.ID == id {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(m.sessions, principal)
+	} else {
+		m.sessions[principal] = list
+	}
+	return nil
+}
+
+// Sessions returns the unexpired sessions of principal, oldest first, and
+// forgets the expired ones.
+func (m *MemoryPrincipalIndex) Sessions(principal string) ([]IndexedSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := unexpired(m.sessions[principal], time.Now())
+	if len(list) == 0 {
+		delete(m.sessions, principal)
+		return nil, nil
+	}
+	m.sessions[principal] = list
+	return append([]IndexedSession(nil), list...), nil
+}
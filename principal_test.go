@@ -0,0 +1,191 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// login saves a new session for user and returns its cookie.
+func login(t *testing.T, store Store, user string) (string, error) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to create session", err)
+	}
+	session.Values["user"] = user
+	if err = session.Save(req, w); err != nil {
+		return "", err
+	}
+	return w.Header().Get("Set-Cookie"), nil
+}
+
+// loadUser returns the user of the session in cookie.
+func loadUser(t *testing.T, store Store, cookie string) interface{} {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.Header.Add("Cookie", cookie)
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to load session", err)
+	}
+	return session.Values["user"]
+}
+
+func TestPrincipalLimiter(t *testing.T) {
+	index := NewMemoryPrincipalIndex()
+	store := NewPrincipalLimiter(NewCookieStore([]byte("secret-key")), index, "user", 2)
+
+	var cookies []string
+	for i := 0; i < 3; i++ {
+		cookie, err := login(t, store, "alice")
+		if err != nil {
+			t.Fatal("failed to login", err)
+		}
+		cookies = append(cookies, cookie)
+	}
+	if _, err := login(t, store, "bob"); err != nil {
+		t.Fatal("failed to login", err)
+	}
+	if user := loadUser(t, store, cookies[0]); user != nil {
+		t.Fatalf("expected oldest session to be evicted, got user %v", user)
+	}
+	for _, cookie := range cookies[1:] {
+		if user := loadUser(t, store, cookie); user != "alice" {
+			t.Fatalf("bad user: got %v, want alice", user)
+		}
+	}
+
+	store.Policy = RejectNew
+	if _, err := login(t, store, "alice"); !errors.Is(err, ErrTooManySessions) {
+		t.Fatalf("expected ErrTooManySessions, got %v", err)
+	}
+
+	// Logging out frees a slot.
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.Header.Add("Cookie", cookies[1])
+	session, _ := store.New(req, "s")
+	delete(session.Values, "user")
+	if err := session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to logout", err)
+	}
+	if _, err := login(t, store, "alice"); err != nil {
+		t.Fatal("failed to login", err)
+	}
+	if list, _ := index.Sessions("alice"); len(list) != 2 {
+		t.Fatalf("bad number of sessions: %d", len(list))
+	}
+}
+
+func TestPrincipalLimiterConcurrentLogins(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		index PrincipalIndex
+	}{
+		{"limited", NewMemoryPrincipalIndex()},
+		{"serialized", struct{ PrincipalIndex }{NewMemoryPrincipalIndex()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewPrincipalLimiter(NewCookieStore([]byte("secret-key")), tc.index, "user", 2)
+			store.Policy = RejectNew
+			var wg sync.WaitGroup
+			errs := make(chan error, 20)
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+					session, _ := store.New(req, "s")
+					session.Values["user"] = "alice"
+					errs <- session.Save(req, httptest.NewRecorder())
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			saved := 0
+			for err := range errs {
+				if err == nil {
+					saved++
+				} else if !errors.Is(err, ErrTooManySessions) {
+					t.Fatal("failed to save session", err)
+				}
+			}
+			sessions, _ := tc.index.Sessions("alice")
+			if saved != 2 || len(sessions) != 2 {
+				t.Fatalf("expected 2 sessions, got %d saved and %d indexed", saved, len(sessions))
+			}
+		})
+	}
+}
+
+func TestPrincipalLimiterExpiry(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		index PrincipalIndex
+	}{
+		{"limited", NewMemoryPrincipalIndex()},
+		{"serialized", struct{ PrincipalIndex }{NewMemoryPrincipalIndex()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewPrincipalLimiter(NewCookieStore([]byte("secret-key")), tc.index, "user", 2)
+			store.Policy = RejectNew
+			var cookies []string
+			for i := 0; i < 2; i++ {
+				cookie, err := login(t, store, "alice")
+				if err != nil {
+					t.Fatal("failed to login", err)
+				}
+				cookies = append(cookies, cookie)
+			}
+			sessions, _ := tc.index.Sessions("alice")
+			if len(sessions) != 2 || time.Until(sessions[0].Expires) < 29*24*time.Hour {
+				t.Fatalf("bad sessions: %v", sessions)
+			}
+			if _, err := login(t, store, "alice"); !errors.Is(err, ErrTooManySessions) {
+				t.Fatalf("expected ErrTooManySessions, got %v", err)
+			}
+
+			// The first session was abandoned and its cookie expired.
+			expired := sessions[0]
+			expired.Expires = time.Now().Add(-time.Second)
+			if err := tc.index.Add("alice", expired); err != nil {
+				t.Fatal("failed to update session", err)
+			}
+			if _, err := login(t, store, "alice"); err != nil {
+				t.Fatal("failed to login", err)
+			}
+			if user := loadUser(t, store, cookies[0]); user != nil {
+				t.Fatalf("expected expired session to be logged out, got user %v", user)
+			}
+			if sessions, _ = tc.index.Sessions("alice"); len(sessions) != 2 {
+				t.Fatalf("bad number of sessions: %d", len(sessions))
+			}
+
+			// Saving a session extends its slot once half of it is used.
+			slot := sessions[0]
+			slot.Expires = time.Now().Add(time.Hour)
+			if err := tc.index.Add("alice", slot); err != nil {
+				t.Fatal("failed to update session", err)
+			}
+			req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+			req.Header.Add("Cookie", cookies[1])
+			session, _ := store.New(req, "s")
+			if err := session.Save(req, httptest.NewRecorder()); err != nil {
+				t.Fatal("failed to save session", err)
+			}
+			sessions, _ = tc.index.Sessions("alice")
+			if len(sessions) != 2 || time.Until(sessions[0].Expires) < 29*24*time.Hour {
+				t.Fatalf("expected the slot to be extended, got %v", sessions)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Session values key for the link ID.
+const linkKey = "_link"
+
+// NewPromoter returns a Promoter carrying over the values of the given
+// keys, such as a shopping cart.
+func NewPromoter(carryOver ...interface{}) *Promoter {
+	return &Promoter{CarryOver: carryOver}
+}
+
+// Promoter promotes anonymous sessions to authenticated ones at login.
+//
+// The authenticated session is always a new session with a new ID, so a
+// session planted before login can't be used to take over the account
+// (session fixation). Only the CarryOver values are copied, with the link
+// ID of the anonymous session: LinkID returns the same ID before and after
+// login, so analytics can stitch the activity of a visitor without
+// recording session IDs.
+type Promoter struct {
+	// CarryOver lists the keys whose values are copied to the
+	// authenticated session.
+	CarryOver []interface{}
+	// KeepAnonymous keeps the anonymous session when the authenticated
+	// session has another name, for applications using both side by side.
+	// Otherwise the anonymous session is deleted.
+	KeepAnonymous bool
+	// OnPromote, if set, is called after promotion with the link ID shared
+	// by both sessions, for example to record the link.
+	OnPromote func(r *http.Request, linkID string, session *Session)
+}
+
+// Promote returns the authenticated session named name, created in the
+// store of anon with the CarryOver values and the link ID of anon, after
+// deleting anon and saving the new session. The new session is registered,
+// so later calls to Get return it.
+//
+// name can be the name of anon, to replace its cookie.
+func (p *Promoter) Promote(r *http.Request, w http.ResponseWriter,
+	anon *Session, name string) (*Session, error) {
+	store := anon.Store()
+	if store == nil {
+		return nil, errors.New("sessions: missing store for anonymous session")
+	}
+	linkID, err := anon.LinkID()
+	if err != nil {
+		return nil, err
+	}
+	// Start from a new session whatever the request carries, ignoring
+	// decoding errors.
+	session, err := store.New(r, name)
+	if session == nil {
+		return nil, err
+	}
+	session.ID = ""
+	session.Values = make(map[interface{}]interface{})
+	session.IsNew = true
+	for _, key := range p.CarryOver {
+		if v, ok := anon.Values[key]; ok {
+			session.Values[key] = v
+		}
+	}
+	session.Values[linkKey] = linkID
+
+	if !p.KeepAnonymous || name == anon.Name() {
+		if err = deleteSession(store, r, w, anon); err != nil {
+			return nil, err
+		}
+	}
+	GetRegistry(r).Register(session, nil)
+	if err = session.Save(r, w); err != nil {
+		return nil, err
+	}
+	if p.OnPromote != nil {
+		p.OnPromote(r, linkID, session)
+	}
+	return session, nil
+}
+
+// LinkID returns the random ID linking the anonymous and authenticated
+// sessions of a visitor, creating it if the session has none. The session
+// must be saved for a new ID to persist. See Promoter.
+func (s *Session) LinkID() (string, error) {
+	if id, ok := s.Values[linkKey].(string); ok {
+		return id, nil
+	}
+	id, err := generateID(nil, 16)
+	if err != nil {
+		return "", err
+	}
+	s.initValues()
+	s.Values[linkKey] = id
+	return id, nil
+}
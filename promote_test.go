@@ -0,0 +1,95 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPromote(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	anon, err := store.Get(req, "anon")
+	if err != nil {
+		t.Fatal("failed to get session", err)
+	}
+	anon.Values["cart"] = []string{"book"}
+	anon.Values["tracking"] = "planted"
+	linkID, err := anon.LinkID()
+	if err != nil {
+		t.Fatal("failed to get link ID", err)
+	}
+	if err = anon.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	anonID := anon.ID
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	anon, err = store.Get(req, "anon")
+	if err != nil || anon.IsNew {
+		t.Fatal("failed to load session", err)
+	}
+
+	var promoted string
+	p := NewPromoter("cart")
+	p.OnPromote = func(r *http.Request, id string, session *Session) {
+		promoted = id
+	}
+	w = httptest.NewRecorder()
+	auth, err := p.Promote(req, w, anon, "auth")
+	if err != nil {
+		t.Fatal("failed to promote session", err)
+	}
+	if auth.ID == "" || auth.ID == anonID {
+		t.Fatalf("expected a new saved session, got ID %q", auth.ID)
+	}
+	if cart, _ := auth.Values["cart"].([]string); len(cart) != 1 || auth.Values["tracking"] != nil {
+		t.Fatalf("bad carried over values: %v", auth.Values)
+	}
+	if id, _ := auth.LinkID(); id != linkID || promoted != linkID {
+		t.Fatalf("bad link ID: got %q and %q, want %q", id, promoted, linkID)
+	}
+	if got, _ := store.Get(req, "auth"); got != auth {
+		t.Fatal("expected the promoted session to be registered")
+	}
+
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	if anon, _ = store.New(req, "anon"); !anon.IsNew {
+		t.Fatal("expected the anonymous session to be deleted")
+	}
+	if auth, _ = store.New(req, "auth"); auth.IsNew || auth.Values[linkKey] != linkID {
+		t.Fatalf("failed to load the promoted session: %v", auth.Values)
+	}
+}
+
+func TestPromoteSameName(t *testing.T) {
+	store := NewCookieStore([]byte("some key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: encodeCookie(t, store, "s", "anonymous")})
+	anon, err := store.Get(req, "s")
+	if err != nil {
+		t.Fatal("failed to get session", err)
+	}
+	w := httptest.NewRecorder()
+	auth, err := NewPromoter().Promote(req, w, anon, "s")
+	if err != nil {
+		t.Fatal("failed to promote session", err)
+	}
+	if auth == anon || auth.Values["user"] != nil {
+		t.Fatalf("expected a new session, got %v", auth.Values)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge <= 0 {
+		t.Fatalf("expected the cookie to be replaced: %v", cookies)
+	}
+}
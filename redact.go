@@ -0,0 +1,118 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces the values of sensitive keys in the output of
+// Session.Redacted.
+const Redacted = "[REDACTED]"
+
+var sensitiveKeys = struct {
+	sync.RWMutex
+	keys map[interface{}]bool
+}{keys: make(map[interface{}]bool)}
+
+// RegisterSensitiveKeys marks the given session keys as sensitive, such as
+// keys holding tokens or personal data, so their values are masked when
+// sessions are logged. The keys used internally by this package are always
+// masked.
+//
+// It should be called during initialization.
+func RegisterSensitiveKeys(keys ...interface{}) {
+	sensitiveKeys.Lock()
+	defer sensitiveKeys.Unlock()
+	for _, key := range keys {
+		sensitiveKeys.keys[key] = true
+	}
+}
+
+// isSensitive reports whether the value of key must be masked.
+func (s *Session) isSensitive(key interface{}) bool {
+	if s.isReserved(key) {
+		return true
+	}
+	sensitiveKeys.RLock()
+	defer sensitiveKeys.RUnlock()
+	return sensitiveKeys.keys[key]
+}
+
+// Redacted returns a copy of Values where the values of the keys
+// registered with RegisterSensitiveKeys and of the keys used internally by
+// this package are replaced with the Redacted string. Other values are
+// copied as is, so sensitive data must not be nested in them.
+func (s *Session) Redacted() map[interface{}]interface{} {
+	values := make(map[interface{}]interface{}, len(s.Values))
+	for k, v := range s.Values {
+		if s.isSensitive(k) {
+			v = Redacted
+		}
+		values[k] = v
+	}
+	return values
+}
+
+// String returns a description of the session for logs, with the values
+// returned by Redacted. The session ID is never included, since it
+// authenticates the session in server-side stores.
+func (s *Session) String() string {
+	values := s.Redacted()
+	keys := redactedKeys(values)
+	var b strings.Builder
+	fmt.Fprintf(&b, "sessions.Session{Name:%q IsNew:%t Values:map[", s.name, s.IsNew)
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s:%v", k, values[k.key])
+	}
+	b.WriteString("]}")
+	return b.String()
+}
+
+// LogValue implements slog.LogValuer, logging the name of the session,
+// IsNew and the values returned by Redacted as a group. Like String, it
+// doesn't include the session ID.
+func (s *Session) LogValue() slog.Value {
+	values := s.Redacted()
+	attrs := make([]slog.Attr, 0, len(values))
+	for _, k := range redactedKeys(values) {
+		attrs = append(attrs, slog.Any(k.name, values[k.key]))
+	}
+	return slog.GroupValue(
+		slog.String("name", s.name),
+		slog.Bool("new", s.IsNew),
+		slog.Attr{Key: "values", Value: slog.GroupValue(attrs...)},
+	)
+}
+
+// redactedKey is a Values key with its formatted name.
+type redactedKey struct {
+	key  interface{}
+	name string
+}
+
+func (k redactedKey) String() string {
+	return k.name
+}
+
+// redactedKeys returns the keys of values sorted by name, so the output
+// is stable.
+func redactedKeys(values map[interface{}]interface{}) []redactedKey {
+	keys := make([]redactedKey, 0, len(values))
+	for k := range values {
+		keys = append(keys, redactedKey{k, fmt.Sprint(k)})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].name < keys[j].name
+	})
+	return keys
+}
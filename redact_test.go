@@ -0,0 +1,52 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedacted(t *testing.T) {
+	RegisterSensitiveKeys("access_token")
+	session := NewSession(nil, "s")
+	session.ID = "secret-id"
+	session.Values["user"] = "gopher"
+	session.Values["access_token"] = "secret-token"
+	session.Values[csrfKey] = "secret-csrf"
+	session.AddFlash("secret-flash")
+
+	redacted := session.Redacted()
+	want := map[interface{}]interface{}{
+		"user":         "gopher",
+		"access_token": Redacted,
+		csrfKey:        Redacted,
+		flashesKey:     Redacted,
+	}
+	if fmt.Sprint(redacted) != fmt.Sprint(want) {
+		t.Fatalf("bad redacted values: got %v, want %v", redacted, want)
+	}
+	if session.Values["access_token"] != "secret-token" {
+		t.Fatal("Redacted modified the session values")
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	logger.Info("request", "session", session)
+	for _, out := range []string{fmt.Sprint(session), fmt.Sprintf("%v", session), buf.String()} {
+		if strings.Contains(out, "secret") {
+			t.Fatalf("leaked a secret: %s", out)
+		}
+		if !strings.Contains(out, "gopher") {
+			t.Fatalf("missing value in: %s", out)
+		}
+	}
+	if !strings.Contains(buf.String(), "session.values.access_token="+Redacted) {
+		t.Fatalf("unexpected log output: %s", buf.String())
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"time"
+)
+
+// requestCookie returns the cookie named name in r selected by policy or,
+// if there is none, a cookie named after one of the alternates of name.
+func requestCookie(r *http.Request, name string, policy CookiePolicy,
+	alternates map[string][]string) (*http.Cookie, error) {
+	if c := pickCookie(r.CookiesNamed(name), policy); c != nil {
+		return c, nil
+	}
+	for _, alt := range alternates[name] {
+		if c := pickCookie(r.CookiesNamed(alt), policy); c != nil {
+			return c, nil
+		}
+	}
+	return nil, http.ErrNoCookie
+}
+
+// expireAlternates expires the cookies of r named after the alternates of
+// name, applying the cookie hooks of the store.
+func expireAlternates(r *http.Request, w http.ResponseWriter, name string,
+	alternates map[string][]string, options *Options, hooks *cookieHooks) error {
+	if r == nil {
+		return nil
+	}
+	for _, alt := range alternates[name] {
+		if _, err := r.Cookie(alt); err != nil {
+			continue
+		}
+		opts := *options
+		opts.MaxAge = -1
+		opts.Expires = time.Time{}
+		if err := setCookie(r, w, alt, "", &opts, hooks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAlternateNames(t *testing.T) {
+	cs := NewCookieStoreWithOptions(WithKeyPairs([]byte("some key")),
+		WithAlternateNames("__Host-s", true, "s"))
+	fs := NewFilesystemStoreWithOptions(t.TempDir(), WithKeyPairs([]byte("some key")),
+		WithAlternateNames("__Host-s", true, "s"))
+	for _, stores := range [][2]Store{
+		{NewCookieStore([]byte("some key")), cs},
+		{NewFilesystemStore(string(fs.fsys.(dirFS)), []byte("some key")), fs},
+	} {
+		old, store := stores[0], stores[1]
+		value := encodeCookie(t, old, "s", "gopher")
+
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(&http.Cookie{Name: "s", Value: value})
+		session, err := store.New(req, "__Host-s")
+		if err != nil || session.IsNew || session.Values["user"] != "gopher" {
+			t.Fatalf("failed to read the session from its former name: %v, %v", session.Values, err)
+		}
+		w := httptest.NewRecorder()
+		if err = session.Save(req, w); err != nil {
+			t.Fatal("failed to save session", err)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 2 || cookies[0].Name != "__Host-s" ||
+			cookies[1].Name != "s" || cookies[1].MaxAge >= 0 {
+			t.Fatalf("bad cookies: %v", cookies)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Session values key for the post-login redirect target.
+const returnToKey = "_return_to"
+
+// ErrUnsafeRedirect is returned by Session.SetReturnTo for targets that
+// could redirect users to another site.
+var ErrUnsafeRedirect = errors.New("sessions: unsafe redirect target")
+
+// SetReturnTo stores the target to redirect the user to after login,
+// typically the page that required it, replacing any target stored before.
+//
+// To prevent open redirects, target must be a path on the same site, such
+// as "/account?tab=billing", or an absolute http or https URL whose host is
+// one of allowedHosts, compared case-insensitively and with the port if
+// the entry has one. Other targets, including scheme-relative URLs such as
+// "//evil.example" and targets containing backslashes or control
+// characters, which browsers may interpret as another host, are rejected
+// with ErrUnsafeRedirect.
+func (s *Session) SetReturnTo(target string, allowedHosts ...string) error {
+	if !safeRedirect(target, allowedHosts) {
+		return ErrUnsafeRedirect
+	}
+	s.initValues()
+	s.Values[returnToKey] = target
+	return nil
+}
+
+// TakeReturnTo removes and returns the target stored by SetReturnTo, or
+// fallback if there is none, so a target is used only once.
+func (s *Session) TakeReturnTo(fallback string) string {
+	target, ok := s.Values[returnToKey].(string)
+	delete(s.Values, returnToKey)
+	if !ok {
+		return fallback
+	}
+	return target
+}
+
+// safeRedirect reports whether target is a local path or an http or https
+// URL on one of allowedHosts.
+func safeRedirect(target string, allowedHosts []string) bool {
+	if target == "" || strings.ContainsAny(target, "\\") {
+		return false
+	}
+	for _, r := range target {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" && u.Host == "" {
+		// A path on the same site, but not "//host" or a relative path
+		// such as "evil.example/x", which some clients resolve as a host.
+		return strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.User != nil || u.Host == "" {
+		return false
+	}
+	for _, host := range allowedHosts {
+		if strings.EqualFold(host, u.Host) ||
+			(!strings.Contains(host, ":") && strings.EqualFold(host, u.Hostname())) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"testing"
+)
+
+func TestReturnTo(t *testing.T) {
+	allowed := []string{"app.example.com", "admin.example.com:8443"}
+	for target, safe := range map[string]bool{
+		"/account":                        true,
+		"/account?tab=billing#invoices":   true,
+		"https://app.example.com/account": true,
+		"https://APP.example.com:443/x":   true,
+		"https://admin.example.com:8443/": true,
+		"https://admin.example.com/":      false,
+		"https://evil.example/":           false,
+		"//evil.example/":                 false,
+		"/\\evil.example/":                false,
+		"evil.example/path":               false,
+		"javascript:alert(1)":             false,
+		"https://user@app.example.com/":   false,
+		"/account\r\nSet-Cookie: x=y":     false,
+		"":                                false,
+	} {
+		session := NewSession(nil, "s")
+		err := session.SetReturnTo(target, allowed...)
+		if (err == nil) != safe {
+			t.Fatalf("SetReturnTo(%q) = %v, want safe=%v", target, err, safe)
+		}
+		want := "/home"
+		if safe {
+			want = target
+		}
+		if got := session.TakeReturnTo("/home"); got != want {
+			t.Fatalf("TakeReturnTo() = %q, want %q", got, want)
+		}
+		if got := session.TakeReturnTo("/home"); got != "/home" {
+			t.Fatalf("expected the target to be used once, got %q", got)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Session values keys for the revocation ID and key generation assigned by
+// RevocableCookieStore.
+const (
+	revocationIDKey  = "_rid"
+	revocationGenKey = "_rgen"
+)
+
+// RevocationList records revoked sessions for RevocableCookieStore.
+//
+// Implementations must be safe for concurrent use.
+type RevocationList interface {
+	// Revoke revokes a session ID. The entry is only needed until
+	// expires, when the cookie has expired anyway, and may be dropped
+	// afterwards.
+	Revoke(id string, expires time.Time) error
+	// RevokeGeneration revokes all sessions issued with a key generation
+	// lower than or equal to gen.
+	RevokeGeneration(gen int64) error
+	// IsRevoked reports whether the session with the given ID and key
+	// generation was revoked.
+	IsRevoked(id string, gen int64) (bool, error)
+}
+
+// NewRevocableCookieStore returns a RevocableCookieStore keeping sessions
+// in cookies created with the given key pairs.
+//
+// See NewCookieStore() for a description of key pairs.
+func NewRevocableCookieStore(list RevocationList, keyPairs ...[]byte) *RevocableCookieStore {
+	return &RevocableCookieStore{
+		Store: NewCookieStore(keyPairs...),
+		List:  list,
+	}
+}
+
+// RevocableCookieStore keeps session values in cookies, like CookieStore,
+// but checks a server-side revocation list when a session is decoded. This
+// gives stateless sessions the ability to log out everywhere while only
+// storing revoked sessions.
+//
+// Each session is assigned a random ID and the current key generation when
+// it is first saved. Deleting a session revokes its ID, so the cookie can't
+// be replayed. Revoked sessions are returned as new sessions by New and Get.
+type RevocableCookieStore struct {
+	Store Store
+	List  RevocationList
+	// Generation is the key generation assigned to new sessions. Increase
+	// it together with List.RevokeGeneration, for example when rotating
+	// keys, to revoke all sessions issued before.
+	Generation int64
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *RevocableCookieStore) Get(r *http.Request, name string) (*Session, error) {
+	return GetRegistry(r).Get(s, name)
+}
+
+// Unwrap returns the wrapped store.
+func (s *RevocableCookieStore) Unwrap() Store {
+	return s.Store
+}
+
+// New returns a session for the given name without adding it to the
+// registry. If the session was revoked, a new session is returned.
+func (s *RevocableCookieStore) New(r *http.Request, name string) (*Session, error) {
+	session, err := s.Store.New(r, name)
+	if session == nil {
+		return nil, err
+	}
+	session.store = s
+	if err != nil || session.IsNew {
+		return session, err
+	}
+	// Sessions issued before revocation was enabled are assigned an ID
+	// when saved.
+	id, _ := session.Values[revocationIDKey].(string)
+	if id == "" {
+		return session, nil
+	}
+	gen, _ := session.Values[revocationGenKey].(int64)
+	revoked, err := s.List.IsRevoked(id, gen)
+	if err != nil {
+		return session, err
+	}
+	if revoked {
+		session.Values = make(map[interface{}]interface{})
+		session.IsNew = true
+		return session, nil
+	}
+	session.ID = id
+	return session, nil
+}
+
+// Save assigns an ID to new sessions and saves the session in the wrapped
+// store. Deleting a session revokes its ID.
+func (s *RevocableCookieStore) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.List.Revoke(session.ID, s.expires()); err != nil {
+				return err
+			}
+		}
+		return s.Store.Save(r, w, session)
+	}
+	if session.ID == "" {
+		id, err := generateID(nil, 16)
+		if err != nil {
+			return err
+		}
+		session.ID = id
+		session.Values[revocationIDKey] = id
+		session.Values[revocationGenKey] = s.Generation
+	}
+	return s.Store.Save(r, w, session)
+}
+
+// Delete revokes the session and deletes it from the wrapped store.
+func (s *RevocableCookieStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if err := s.Revoke(session); err != nil {
+		return err
+	}
+	return deleteSession(s.Store, r, w, session)
+}
+
+// Revoke revokes a session, so its cookie is no longer accepted.
+func (s *RevocableCookieStore) Revoke(session *Session) error {
+	if session.ID == "" {
+		return nil
+	}
+	return s.List.Revoke(session.ID, s.expires())
+}
+
+// expires returns the time when cookies issued now expire, or the zero
+// time if the wrapped store has no known maximum age.
+func (s *RevocableCookieStore) expires() time.Time {
+	if cs, ok := s.Store.(*CookieStore); ok {
+		if maxAge := cs.options().MaxAge; maxAge > 0 {
+			return expiresAt(time.Now(), maxAge)
+		}
+	}
+	return time.Time{}
+}
+
+// NewMemoryRevocationList returns a RevocationList kept in memory. It is
+// suitable for a single process.
+func NewMemoryRevocationList() *MemoryRevocationList {
+	return &MemoryRevocationList{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// MemoryRevocationList is an in-memory RevocationList. Entries are dropped
+// once they expire.
+type MemoryRevocationList struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	minGen  int64
+	hasGen  bool
+}
+
+// Revoke revokes a session ID until expires. A zero expires keeps the
+// entry forever.
+func (m *MemoryRevocationList) Revoke(id string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for k, t := range m.revoked {
+		if !t.IsZero() && now.After(t) {
+			delete(m.revoked, k)
+		}
+	}
+	m.revoked[id] = expires
+	return nil
+}
+
+// RevokeGeneration revokes all sessions issued with a key generation lower
+// than or equal to gen.
+func (m *MemoryRevocationList) RevokeGeneration(gen int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.hasGen || gen > m.minGen {
+		m.minGen, m.hasGen = gen, true
+	}
+	return nil
+}
+
+// IsRevoked reports whether the session with the given ID and key
+// generation was revoked.
+func (m *MemoryRevocationList) IsRevoked(id string, gen int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.hasGen && gen <= m.minGen {
+		return true, nil
+	}
+	expires, ok := m.revoked[id]
+	return ok && (expires.IsZero() || time.Now().Before(expires)), nil
+}
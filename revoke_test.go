@@ -0,0 +1,73 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// loadRevocable returns the session carried by a cookie.
+func loadRevocable(t *testing.T, store *RevocableCookieStore, cookie *http.Cookie) *Session {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(cookie)
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to load session", err)
+	}
+	return session
+}
+
+// saveRevocable saves a new session for user and returns its cookie.
+func saveRevocable(t *testing.T, store *RevocableCookieStore, user string) *http.Cookie {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	session, _ := store.New(req, "s")
+	session.Values["user"] = user
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	return w.Result().Cookies()[0]
+}
+
+func TestRevocableCookieStore(t *testing.T) {
+	store := NewRevocableCookieStore(NewMemoryRevocationList(), []byte("some key"))
+	first := saveRevocable(t, store, "first")
+	second := saveRevocable(t, store, "second")
+
+	session := loadRevocable(t, store, first)
+	if session.IsNew || session.ID == "" || session.Values["user"] != "first" {
+		t.Fatalf("bad session: %v", session.Values)
+	}
+
+	// Deleting the session revokes the cookie.
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session.Options.MaxAge = -1
+	if err := session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+	if session = loadRevocable(t, store, first); !session.IsNew || len(session.Values) != 0 {
+		t.Fatalf("expected a new session, got %v", session.Values)
+	}
+	if session = loadRevocable(t, store, second); session.IsNew {
+		t.Fatal("expected the other session to be kept")
+	}
+
+	// Revoking the generation logs out everywhere.
+	if err := store.List.RevokeGeneration(store.Generation); err != nil {
+		t.Fatal("failed to revoke generation", err)
+	}
+	store.Generation++
+	if session = loadRevocable(t, store, second); !session.IsNew {
+		t.Fatal("expected the session to be revoked")
+	}
+	third := saveRevocable(t, store, "third")
+	if session = loadRevocable(t, store, third); session.IsNew {
+		t.Fatal("expected a session of the new generation to be kept")
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"net/http"
+	"sync/atomic"
+)
+
+// Session values key for rollout assignments.
+const rolloutKey = "_rollout"
+
+func init() {
+	gob.Register(map[string]bool{})
+}
+
+// NewRollout returns a Rollout calling apply on the options of percent
+// percent of new sessions.
+func NewRollout(name string, percent float64, apply func(*Options)) *Rollout {
+	return &Rollout{
+		Name:    name,
+		Percent: percent,
+		Apply:   apply,
+	}
+}
+
+// Rollout gradually enables a change of cookie attributes, for example
+// SameSite=Strict, for a percentage of sessions, and counts how many
+// sessions of each group are issued and come back, so the change can be
+// measured before it is enabled for all sessions.
+type Rollout struct {
+	// Name identifies the rollout in sessions and stats. It must be
+	// unique among the rollouts of a store.
+	Name string
+	// Percent is the percentage of new sessions, from 0 to 100, enrolled
+	// in the rollout. Raising it enrolls more new sessions; sessions keep
+	// the group they were assigned to.
+	Percent float64
+	// Apply changes the options of enrolled sessions.
+	Apply func(*Options)
+
+	issued   [2]atomic.Int64
+	returned [2]atomic.Int64
+}
+
+// RolloutStats counts the sessions of a rollout. Sessions saved while new
+// are issued, and sessions loaded again are returned: a lower return rate
+// in the enrolled group means browsers drop or don't send its cookies.
+type RolloutStats struct {
+	Name            string
+	Issued          int64
+	Returned        int64
+	ControlIssued   int64
+	ControlReturned int64
+}
+
+// Stats returns the counts of the rollout.
+func (r *Rollout) Stats() RolloutStats {
+	return RolloutStats{
+		Name:            r.Name,
+		Issued:          r.issued[1].Load(),
+		Returned:        r.returned[1].Load(),
+		ControlIssued:   r.issued[0].Load(),
+		ControlReturned: r.returned[0].Load(),
+	}
+}
+
+// enrolls reports whether a session with the given key is enrolled. Keys
+// are hashed with the rollout name, so rollouts enroll distinct sessions.
+func (r *Rollout) enrolls(key []byte) bool {
+	h := sha256.New()
+	h.Write([]byte(r.Name))
+	h.Write([]byte{0})
+	h.Write(key)
+	n := binary.BigEndian.Uint64(h.Sum(nil))
+	return float64(n)/(1<<64)*100 < r.Percent
+}
+
+// group returns the index of the counters of a group.
+func group(enrolled bool) int {
+	if enrolled {
+		return 1
+	}
+	return 0
+}
+
+// NewRolloutStore returns a RolloutStore wrapping store.
+func NewRolloutStore(store Store, rollouts ...*Rollout) *RolloutStore {
+	return &RolloutStore{
+		Store:    store,
+		Rollouts: rollouts,
+	}
+}
+
+// RolloutStore wraps a Store and applies rollouts to the options of its
+// sessions.
+//
+// New sessions are assigned to the enrolled or the control group of each
+// rollout by a hash of their ID, or of random bytes when the store hasn't
+// assigned an ID yet, and the assignment is kept in the session values so
+// a session stays in its group.
+type RolloutStore struct {
+	Store    Store
+	Rollouts []*Rollout
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *RolloutStore) Get(r *http.Request, name string) (*Session, error) {
+	return GetRegistry(r).Get(s, name)
+}
+
+// Unwrap returns the wrapped store.
+func (s *RolloutStore) Unwrap() Store {
+	return s.Store
+}
+
+// New returns a session for the given name without adding it to the
+// registry, with the options of the rollouts it is enrolled in applied.
+func (s *RolloutStore) New(r *http.Request, name string) (*Session, error) {
+	session, err := s.Store.New(r, name)
+	if session == nil {
+		return nil, err
+	}
+	session.store = s
+	assigned, _ := session.Values[rolloutKey].(map[string]bool)
+	if assigned == nil {
+		assigned = make(map[string]bool, len(s.Rollouts))
+	}
+	var key []byte
+	for _, rollout := range s.Rollouts {
+		enrolled, ok := assigned[rollout.Name]
+		if ok && !session.IsNew {
+			rollout.returned[group(enrolled)].Add(1)
+		} else if !ok {
+			if key == nil {
+				key = rolloutKeyOf(session)
+			}
+			enrolled = rollout.enrolls(key)
+			assigned[rollout.Name] = enrolled
+		}
+		if enrolled && rollout.Apply != nil {
+			rollout.Apply(session.Options)
+		}
+	}
+	if len(assigned) > 0 {
+		session.initValues()
+		session.Values[rolloutKey] = assigned
+	}
+	return session, err
+}
+
+// Save saves the session in the wrapped store, counting new sessions as
+// issued.
+func (s *RolloutStore) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if err := s.Store.Save(r, w, session); err != nil {
+		return err
+	}
+	if session.IsNew && session.Options.MaxAge >= 0 {
+		assigned, _ := session.Values[rolloutKey].(map[string]bool)
+		for _, rollout := range s.Rollouts {
+			if enrolled, ok := assigned[rollout.Name]; ok {
+				rollout.issued[group(enrolled)].Add(1)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete deletes the session from the wrapped store.
+func (s *RolloutStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	return deleteSession(s.Store, r, w, session)
+}
+
+// Stats returns the counts of the rollouts.
+func (s *RolloutStore) Stats() []RolloutStats {
+	stats := make([]RolloutStats, len(s.Rollouts))
+	for i, rollout := range s.Rollouts {
+		stats[i] = rollout.Stats()
+	}
+	return stats
+}
+
+// rolloutKeyOf returns the key assigning session to rollout groups.
+func rolloutKeyOf(session *Session) []byte {
+	if session.ID != "" {
+		return []byte(session.ID)
+	}
+	key := make([]byte, 16)
+	_, _ = rand.Read(key)
+	return key
+}
@@ -0,0 +1,64 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRolloutStore(t *testing.T) {
+	strict := NewRollout("strict", 50, func(o *Options) {
+		o.SameSite = http.SameSiteStrictMode
+	})
+	store := NewRolloutStore(NewCookieStore([]byte("some key")), strict,
+		NewRollout("none", 0, nil))
+
+	var enrolled, control *http.Cookie
+	for i := 0; i < 200; i++ {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		w := httptest.NewRecorder()
+		session, _ := store.New(req, "s")
+		if err := session.Save(req, w); err != nil {
+			t.Fatal("failed to save session", err)
+		}
+		header := w.Header().Get("Set-Cookie")
+		isStrict := strings.Contains(header, "SameSite=Strict")
+		if isStrict != session.Values[rolloutKey].(map[string]bool)["strict"] {
+			t.Fatalf("cookie doesn't match the assignment: %s", header)
+		}
+		if isStrict {
+			enrolled = w.Result().Cookies()[0]
+		} else {
+			control = w.Result().Cookies()[0]
+		}
+	}
+	stats := strict.Stats()
+	if stats.Issued+stats.ControlIssued != 200 || stats.Issued < 60 || stats.Issued > 140 {
+		t.Fatalf("bad rollout stats: %+v", stats)
+	}
+	if none := store.Stats()[1]; none.Issued != 0 || none.ControlIssued != 200 {
+		t.Fatalf("bad stats of an empty rollout: %+v", none)
+	}
+
+	// Sessions keep their group when loaded again.
+	for _, c := range []*http.Cookie{enrolled, control} {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(c)
+		session, err := store.New(req, "s")
+		if err != nil {
+			t.Fatal("failed to decode session", err)
+		}
+		want := c == enrolled
+		if (session.Options.SameSite == http.SameSiteStrictMode) != want {
+			t.Fatalf("expected enrolled=%v, got options %+v", want, session.Options)
+		}
+	}
+	if stats = strict.Stats(); stats.Returned != 1 || stats.ControlReturned != 1 {
+		t.Fatalf("bad returned counts: %+v", stats)
+	}
+}
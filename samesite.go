@@ -0,0 +1,71 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+var (
+	iosVersionRe      = regexp.MustCompile(`\(iP.+; CPU .*OS (\d+)[_\d]*.*\) AppleWebKit/`)
+	macVersionRe      = regexp.MustCompile(`\(Macintosh;.*Mac OS X (\d+)_(\d+)[_\d]*.*\) AppleWebKit/`)
+	safariRe          = regexp.MustCompile(`Version/.* Safari/`)
+	chromiumRe        = regexp.MustCompile(`Chrom(e|ium)`)
+	chromiumVersionRe = regexp.MustCompile(`Chrom[^ /]+/(\d+)[\.\d]* `)
+	macEmbeddedRe     = regexp.MustCompile(`^Mozilla/[\.\d]+ \(Macintosh;.*Mac OS X [_\d]+\) AppleWebKit/[\.\d]+ \(KHTML, like Gecko\)$`)
+	ucBrowserRe       = regexp.MustCompile(`UCBrowser/(\d+)\.(\d+)\.(\d+)[\.\d]* `)
+)
+
+// SameSiteNoneIncompatible reports whether the client of r is known to
+// mishandle cookies with SameSite=None, judging from its User-Agent: iOS 12
+// and Safari on macOS 10.14 treat them as SameSite=Strict, and Chrome 51
+// to 66 and UC Browser before 12.13.2 reject them.
+//
+// It can be passed to WithSameSiteFallback.
+func SameSiteNoneIncompatible(r *http.Request) bool {
+	ua := r.UserAgent()
+	return hasSameSiteBug(ua) || dropsUnknownSameSite(ua)
+}
+
+// hasSameSiteBug reports whether ua treats SameSite=None as Strict.
+func hasSameSiteBug(ua string) bool {
+	if m := iosVersionRe.FindStringSubmatch(ua); m != nil {
+		return m[1] == "12"
+	}
+	if m := macVersionRe.FindStringSubmatch(ua); m != nil && m[1] == "10" && m[2] == "14" {
+		isSafari := safariRe.MatchString(ua) && !chromiumRe.MatchString(ua)
+		return isSafari || macEmbeddedRe.MatchString(ua)
+	}
+	return false
+}
+
+// dropsUnknownSameSite reports whether ua rejects cookies with an unknown
+// SameSite value, which None was to it.
+func dropsUnknownSameSite(ua string) bool {
+	if m := ucBrowserRe.FindStringSubmatch(ua); m != nil {
+		return versionLess(m[1:], 12, 13, 2)
+	}
+	if chromiumRe.MatchString(ua) {
+		if m := chromiumVersionRe.FindStringSubmatch(ua); m != nil {
+			major, _ := strconv.Atoi(m[1])
+			return major >= 51 && major <= 66
+		}
+	}
+	return false
+}
+
+// versionLess reports whether the version with the given components is
+// lower than want.
+func versionLess(components []string, want ...int) bool {
+	for i, c := range components {
+		n, _ := strconv.Atoi(c)
+		if n != want[i] {
+			return n < want[i]
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSameSiteNoneIncompatible(t *testing.T) {
+	for _, tc := range []struct {
+		ua   string
+		want bool
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 12_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.0 Mobile/15E148 Safari/604.1", true},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 13_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0 Mobile/15E148 Safari/604.1", false},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.1.2 Safari/605.1.15", true},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.132 Safari/537.36", false},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/65.0.3325.181 Safari/537.36", true},
+		{"Mozilla/5.0 (Linux; U; Android 9; en-US; SM-G960F) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/57.0.2987.108 UCBrowser/12.13.0.1207 Mobile Safari/537.36", true},
+		{"Mozilla/5.0 (Linux; U; Android 9; en-US; SM-G960F) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/57.0.2987.108 UCBrowser/12.13.2.1208 Mobile Safari/537.36", false},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0", false},
+	} {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.Header.Set("User-Agent", tc.ua)
+		if got := SameSiteNoneIncompatible(req); got != tc.want {
+			t.Fatalf("SameSiteNoneIncompatible(%q) = %v, want %v", tc.ua, got, tc.want)
+		}
+	}
+}
+
+func TestSameSiteFallback(t *testing.T) {
+	store := NewCookieStoreWithOptions(WithKeyPairs([]byte("secret-key")),
+		WithSameSiteFallback(SameSiteNoneIncompatible))
+	for _, tc := range []struct {
+		ua       string
+		sameSite bool
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 12_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.0 Mobile/15E148 Safari/604.1", false},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0", true},
+	} {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.Header.Set("User-Agent", tc.ua)
+		w := httptest.NewRecorder()
+		session, _ := store.New(req, "s")
+		if err := session.Save(req, w); err != nil {
+			t.Fatal("failed to save session", err)
+		}
+		header := w.Header().Get("Set-Cookie")
+		if strings.Contains(header, "SameSite=None") != tc.sameSite {
+			t.Fatalf("bad header for %q: %s", tc.ua, header)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrUnserializable is returned when saving a session holding values that
+// can't be serialized, or that would silently lose data, such as a struct
+// keeping a pointer in an unexported field. The error lists the offending
+// types and fields.
+var ErrUnserializable = errors.New("sessions: unserializable session values")
+
+// gobTypes caches whether types stored in interfaces are registered with
+// encoding/gob.
+var gobTypes sync.Map
+
+// marshalerTypes are the interfaces of types serializing themselves, whose
+// fields are not inspected.
+var marshalerTypes = []reflect.Type{
+	reflect.TypeOf((*gob.GobEncoder)(nil)).Elem(),
+	reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem(),
+	reflect.TypeOf((*json.Marshaler)(nil)).Elem(),
+}
+
+// checkValues walks v and returns an ErrUnserializable error listing the
+// values that can't be serialized or would lose data.
+//
+// Unexported fields holding pointers, maps, slices or interfaces are always
+// reported, since every serializer drops them. If full is set, types
+// stored in interfaces that are not registered with encoding/gob, and
+// types that no serializer can handle, are reported as well; this is used
+// to explain encoding errors.
+func checkValues(v interface{}, full bool) error {
+	problems := make(map[string]bool)
+	scanValue(reflect.ValueOf(v), full, problems, make(map[uintptr]bool))
+	if len(problems) == 0 {
+		return nil
+	}
+	list := make([]string, 0, len(problems))
+	for p := range problems {
+		list = append(list, p)
+	}
+	sort.Strings(list)
+	return fmt.Errorf("%w: %s", ErrUnserializable, strings.Join(list, ", "))
+}
+
+// scanValue records the problems found in v. seen holds the pointers
+// already visited.
+func scanValue(v reflect.Value, full bool, problems map[string]bool, seen map[uintptr]bool) {
+	if !v.IsValid() {
+		return
+	}
+	t := v.Type()
+	if isMarshaler(t) {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		elem := v.Elem()
+		if full && !gobRegistered(elem.Type()) {
+			problems[elem.Type().String()+" (not registered with gob)"] = true
+		}
+		scanValue(elem, full, problems, seen)
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		scanValue(v.Elem(), full, problems, seen)
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			scanValue(iter.Key(), full, problems, seen)
+			scanValue(iter.Value(), full, problems, seen)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			scanValue(v.Index(i), full, problems, seen)
+		}
+	case reflect.Struct:
+		exported := 0
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.IsExported() {
+				exported++
+				scanValue(v.Field(i), full, problems, seen)
+				continue
+			}
+			switch f.Type.Kind() {
+			case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+				if !v.Field(i).IsNil() {
+					problems[t.String()+"."+f.Name+" (unexported field)"] = true
+				}
+			}
+		}
+		if full && exported == 0 && t.NumField() > 0 {
+			problems[t.String()+" (no exported fields)"] = true
+		}
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		if full {
+			problems[t.String()+" (unsupported kind)"] = true
+		}
+	}
+}
+
+// isMarshaler reports whether t or *t serializes itself.
+func isMarshaler(t reflect.Type) bool {
+	for _, m := range marshalerTypes {
+		if t.Implements(m) || (t.Kind() != reflect.Ptr && reflect.PointerTo(t).Implements(m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// gobRegistered reports whether values of type t can be encoded by
+// encoding/gob when stored in an interface.
+func gobRegistered(t reflect.Type) bool {
+	if ok, cached := gobTypes.Load(t); cached {
+		return ok.(bool)
+	}
+	var zero reflect.Value
+	if t.Kind() == reflect.Ptr {
+		zero = reflect.New(t.Elem())
+	} else {
+		zero = reflect.New(t).Elem()
+	}
+	wrapper := struct{ V interface{} }{zero.Interface()}
+	err := gob.NewEncoder(io.Discard).Encode(&wrapper)
+	ok := err == nil || !strings.Contains(err.Error(), "not registered")
+	gobTypes.Store(t, ok)
+	return ok
+}
@@ -0,0 +1,53 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type scanConfig struct {
+	ClientID string
+}
+
+type scanToken struct {
+	AccessToken string
+	Expiry      time.Time
+	config      *scanConfig
+}
+
+type scanUnregistered struct {
+	Name string
+}
+
+func TestSaveUnserializable(t *testing.T) {
+	RegisterType[*scanToken]("scanToken")
+	store := NewCookieStore([]byte("some key"))
+	save := func(v interface{}) error {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		session, _ := store.New(req, "s")
+		session.Values["v"] = v
+		return session.Save(req, httptest.NewRecorder())
+	}
+
+	if err := save(&scanToken{AccessToken: "x", Expiry: time.Now()}); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	err := save(&scanToken{AccessToken: "x", config: &scanConfig{}})
+	if !errors.Is(err, ErrUnserializable) || !strings.Contains(err.Error(), "sessions.scanToken.config (unexported field)") {
+		t.Fatalf("expected the unexported field to be reported, got %v", err)
+	}
+	err = save([]interface{}{scanUnregistered{}, func() {}})
+	if !errors.Is(err, ErrUnserializable) ||
+		!strings.Contains(err.Error(), "sessions.scanUnregistered (not registered with gob)") ||
+		!strings.Contains(err.Error(), "func() (not registered with gob)") {
+		t.Fatalf("expected the unregistered types to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"github.com/gorilla/securecookie"
+)
+
+// UseCodecs makes the session encoded with codecs instead of the codecs of
+// its store, for example to give an administrator session stronger keys
+// than other sessions of the same CookieStore. Calling it without codecs
+// restores the codecs of the store.
+//
+// The store must list codecs in its SessionCodecs to decode the session
+// again.
+func (s *Session) UseCodecs(codecs ...securecookie.Codec) {
+	s.codecs = codecs
+}
+
+// Codecs returns the codecs selected with UseCodecs, or the codecs that
+// decoded the session if they are not those of its store, and nil
+// otherwise. Handlers requiring a stronger configuration can check it
+// before trusting the values.
+func (s *Session) Codecs() []securecookie.Codec {
+	return s.codecs
+}
+
+// sessionCodecs returns the codecs encoding session: its own codecs if set,
+// or the default ones.
+func sessionCodecs(session *Session, defaults []securecookie.Codec) []securecookie.Codec {
+	if len(session.codecs) > 0 {
+		return session.codecs
+	}
+	return defaults
+}
+
+// NeedsReissue reports whether the session cookie was decoded with former
+// keys of the store, that is by a codec other than the first one. Saving
+// the session re-encodes it with the current keys, even if the store skips
+// unchanged sessions, so key rotation converges faster; Middleware saves
+// all the sessions of a request. It is reset once the session is saved.
+func (s *Session) NeedsReissue() bool {
+	return s.needsReissue
+}
@@ -0,0 +1,83 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestUseCodecs(t *testing.T) {
+	admin := securecookie.CodecsFromPairs([]byte("admin-hash-key"),
+		[]byte("0123456789abcdef0123456789abcdef"))
+	store := NewCookieStore([]byte("secret-key"))
+	store.SessionCodecs = [][]securecookie.Codec{admin}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	session.Values["role"] = "admin"
+	session.UseCodecs(admin...)
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	// The default codecs can't decode the cookie.
+	var values map[interface{}]interface{}
+	if err := securecookie.DecodeMulti("s", cookie.Value, &values, store.Codecs...); err == nil {
+		t.Fatal("expected the default codecs to fail")
+	}
+
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(cookie)
+	session, err := store.New(req, "s")
+	if err != nil || session.Values["role"] != "admin" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+	if codecs := session.Codecs(); len(codecs) != 1 || codecs[0] != admin[0] {
+		t.Fatalf("expected the admin codecs, got %v", codecs)
+	}
+
+	store.SessionCodecs = nil
+	if _, err = store.New(req, "s"); err == nil {
+		t.Fatal("expected an error without the session codecs")
+	}
+}
+
+func TestNeedsReissue(t *testing.T) {
+	old := NewCookieStoreWithOptions(WithKeyPairs([]byte("old-key")), WithSkipUnchanged())
+	rotated := NewCookieStoreWithOptions(WithKeyPairs([]byte("new-key"), nil,
+		[]byte("old-key"), nil), WithSkipUnchanged())
+	cookie := encodeCookie(t, old, "s", "gopher")
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+	session, err := rotated.New(req, "s")
+	if err != nil || !session.NeedsReissue() {
+		t.Fatalf("expected the session to need reissue: %v", err)
+	}
+	w := httptest.NewRecorder()
+	if err = session.Save(req, w); err != nil || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("expected the session to be reissued: %v", err)
+	}
+	if session.NeedsReissue() {
+		t.Fatal("expected NeedsReissue to be reset")
+	}
+
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	session, err = rotated.New(req, "s")
+	if err != nil || session.NeedsReissue() {
+		t.Fatalf("expected the reissued session to use the current keys: %v", err)
+	}
+	w = httptest.NewRecorder()
+	if err = session.Save(req, w); err != nil || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("expected the unchanged session to be skipped: %v", err)
+	}
+}
@@ -6,15 +6,55 @@ package sessions
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
+
+	"github.com/gorilla/securecookie"
 )
 
 // Default flashes key.
 const flashesKey = "_flash"
 
+// ErrNilValues is returned when saving a session whose Values map is nil,
+// which usually means a custom store created it without NewSession.
+var ErrNilValues = errors.New("sessions: session Values is nil; create sessions with NewSession")
+
+// ErrReservedKey is returned by Session.Set for keys used internally by
+// this package.
+var ErrReservedKey = errors.New("sessions: reserved session key")
+
+// reservedKeys lists the Values keys used internally by this package, in
+// addition to the flashes key of the session.
+var reservedKeys = []string{
+	flashesKey,
+	elevationKey,
+	slotKey,
+	slotPrincipalKey,
+	revocationIDKey,
+	revocationGenKey,
+	lockoutKey,
+	channelKey,
+	lockedKey,
+	lastActiveKey,
+	impersonationKey,
+	impersonationOrigKey,
+	encryptedValuesKey,
+	hintsKey,
+	versionKey,
+	optionsKey,
+	csrfKey,
+	idempotencyKey,
+	authzKey,
+	rolloutKey,
+	valueTTLKey,
+	returnToKey,
+	linkKey,
+}
+
 // Session --------------------------------------------------------------------
 
 // NewSession is called by session stores to create a new session instance.
@@ -35,18 +75,51 @@ type Session struct {
 	// Values contains the user-data for the session.
 	Values  map[interface{}]interface{}
 	Options *Options
-	IsNew   bool
-	store   Store
-	name    string
+	// IsNew is false only when the built-in stores decoded a valid,
+	// unexpired session cookie and, for server-side stores, found the
+	// session data. Sessions that fail to load are new, with no ID or
+	// values.
+	IsNew bool
+	store Store
+	name  string
+	// flashKey is the default flashes key, set by the store.
+	flashKey string
+	// fieldDigests holds the digests of the values as loaded by a
+	// FieldStore, to write only the values that changed.
+	fieldDigests map[string][sha256.Size]byte
+	// loadedIdentity holds the values of the identity keys as loaded by an
+	// IdentityStore, to report the keys that changed.
+	loadedIdentity map[interface{}]interface{}
+	// loadedDigest holds the digest of the session as decoded or last
+	// saved by a CookieStore with SkipUnchanged set.
+	loadedDigest []byte
+	// codecs overrides the codecs of the store. See UseCodecs.
+	codecs []securecookie.Codec
+	// needsReissue is set when the session cookie was decoded with former
+	// keys. See NeedsReissue.
+	needsReissue bool
+	// backendSize is the size in bytes of the session data last read or
+	// written by a server-side store.
+	backendSize int
+	// issuedAt is the timestamp of the decoded session cookie. See
+	// IssuedAt.
+	issuedAt time.Time
+	// approvedValues holds the values last loaded, saved or set through a
+	// PolicyStore, to check the values that changed when saving.
+	approvedValues map[interface{}]interface{}
+	// writePolicy checks the changes made by Set, if the session was
+	// loaded by a PolicyStore.
+	writePolicy func(key, oldValue, newValue interface{}) error
 }
 
 // Flashes returns a slice of flash messages from the session.
 //
 // A single variadic argument is accepted, and it is optional: it defines
-// the flash key. If not defined "_flash" is used by default.
+// the flash key. If not defined the flash key of the store is used, which
+// is "_flash" by default.
 func (s *Session) Flashes(vars ...string) []interface{} {
 	var flashes []interface{}
-	key := flashesKey
+	key := s.flashesKey()
 	if len(vars) > 0 {
 		key = vars[0]
 	}
@@ -61,9 +134,10 @@ func (s *Session) Flashes(vars ...string) []interface{} {
 // AddFlash adds a flash message to the session.
 //
 // A single variadic argument is accepted, and it is optional: it defines
-// the flash key. If not defined "_flash" is used by default.
+// the flash key. If not defined the flash key of the store is used, which
+// is "_flash" by default.
 func (s *Session) AddFlash(value interface{}, vars ...string) {
-	key := flashesKey
+	key := s.flashesKey()
 	if len(vars) > 0 {
 		key = vars[0]
 	}
@@ -71,13 +145,84 @@ func (s *Session) AddFlash(value interface{}, vars ...string) {
 	if v, ok := s.Values[key]; ok {
 		flashes = v.([]interface{})
 	}
+	s.initValues()
 	s.Values[key] = append(flashes, value)
 }
 
+// flashesKey returns the default flashes key of the session.
+func (s *Session) flashesKey() string {
+	if s.flashKey != "" {
+		return s.flashKey
+	}
+	return flashesKey
+}
+
+// Set sets a value in the session. Unlike assigning to Values directly, it
+// returns ErrReservedKey if key is used internally by this package, such as
+// the flashes key, so internal state can't be overwritten by accident. For
+// sessions of a PolicyStore, it returns an error wrapping ErrWriteDenied
+// if the policy vetoes the change.
+func (s *Session) Set(key, value interface{}) error {
+	if s.isReserved(key) {
+		return ErrReservedKey
+	}
+	if s.writePolicy != nil {
+		if err := s.writePolicy(key, s.Values[key], value); err != nil {
+			return err
+		}
+		s.approvedValues[key] = copyValue(value)
+	}
+	s.initValues()
+	s.Values[key] = value
+	s.clearValueTTL(key)
+	return nil
+}
+
+// isReserved reports whether key is used internally by this package.
+func (s *Session) isReserved(key interface{}) bool {
+	k, ok := key.(string)
+	if !ok {
+		return false
+	}
+	if k == s.flashesKey() {
+		return true
+	}
+	for _, reserved := range reservedKeys {
+		if k == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// initValues creates the Values map if it is nil.
+func (s *Session) initValues() {
+	if s.Values == nil {
+		s.Values = make(map[interface{}]interface{})
+	}
+}
+
 // Save is a convenience method to save this session. It is the same as calling
 // store.Save(request, response, session). You should call Save before writing to
 // the response or returning from the handler.
+//
+// It returns ErrNilValues if Values is nil.
 func (s *Session) Save(r *http.Request, w http.ResponseWriter) error {
+	if s.Values == nil {
+		return ErrNilValues
+	}
+	return s.store.Save(r, w, s)
+}
+
+// Touch refreshes the expiry of this session without writing its values.
+//
+// If the store implements Toucher its Touch method is called; otherwise it
+// is the same as calling Save. Like Save, it must be called before writing
+// to the response.
+func (s *Session) Touch(r *http.Request, w http.ResponseWriter) error {
+	if t, ok := s.store.(Toucher); ok {
+		return t.Touch(r, w, s)
+	}
 	return s.store.Save(r, w, s)
 }
 
@@ -99,51 +244,79 @@ type sessionInfo struct {
 	e error
 }
 
-// contextKey is the type used to store the registry in the context.
-type contextKey int
-
-// registryKey is the key used to store the registry in the context.
-const registryKey contextKey = 0
+// registryKey is the context key of the registry. Keys of distinct struct
+// types can't collide with keys of other packages.
+type registryKey struct{}
 
 // GetRegistry returns a registry instance for the current request.
 func GetRegistry(r *http.Request) *Registry {
-	var ctx = r.Context()
-	registry := ctx.Value(registryKey)
-	if registry != nil {
-		return registry.(*Registry)
+	if registry, ok := r.Context().Value(registryKey{}).(*Registry); ok {
+		return registry
 	}
-	newRegistry := &Registry{
-		request:  r,
+	rc, registry := NewRegistry(r)
+	*r = *rc
+	return registry
+}
+
+// NewRegistry returns an empty registry and a shallow copy of r carrying
+// it, replacing any registry r carries.
+//
+// It is an extension point for frameworks: sessions loaded by other means,
+// for example from a non net/http request, can be added with Register
+// before handlers call GetRegistry with the returned request.
+func NewRegistry(r *http.Request) (*http.Request, *Registry) {
+	registry := &Registry{
 		sessions: make(map[string]sessionInfo),
 	}
-	*r = *r.WithContext(context.WithValue(ctx, registryKey, newRegistry))
-	return newRegistry
+	registry.request = r.WithContext(context.WithValue(r.Context(), registryKey{}, registry))
+	return registry.request, registry
 }
 
 // Registry stores sessions used during a request.
 type Registry struct {
-	request  *http.Request
-	sessions map[string]sessionInfo
+	// ErrorHandler, if set, is called by Save when saving fails, so errors
+	// can be turned into application responses in one place. Save still
+	// returns the error.
+	ErrorHandler ErrorHandler
+	request      *http.Request
+	sessions     map[string]sessionInfo
 }
 
 // Get registers and returns a session for the given name and session store.
 //
 // It returns a new session if there are no sessions registered for the name.
 func (s *Registry) Get(store Store, name string) (session *Session, err error) {
+	return s.get(store, name, func() (*Session, error) {
+		return store.New(s.request, name)
+	})
+}
+
+// get registers and returns a session, calling newSession to create it if
+// there are no sessions registered for the name.
+func (s *Registry) get(store Store, name string,
+	newSession func() (*Session, error)) (session *Session, err error) {
 	if !isCookieNameValid(name) {
 		return nil, fmt.Errorf("sessions: invalid character in cookie name: %s", name)
 	}
 	if info, ok := s.sessions[name]; ok {
 		session, err = info.s, info.e
 	} else {
-		session, err = store.New(s.request, name)
+		session, err = newSession()
 		session.name = name
+		session.initValues()
 		s.sessions[name] = sessionInfo{s: session, e: err}
 	}
 	session.store = store
 	return
 }
 
+// Register adds session to the registry, as if Get had returned it along
+// with err, replacing a session registered with the same name.
+func (s *Registry) Register(session *Session, err error) {
+	session.initValues()
+	s.sessions[session.Name()] = sessionInfo{s: session, e: err}
+}
+
 // Save saves all sessions registered for the current request.
 func (s *Registry) Save(w http.ResponseWriter) error {
 	var errMulti MultiError
@@ -152,12 +325,18 @@ func (s *Registry) Save(w http.ResponseWriter) error {
 		if session.store == nil {
 			errMulti = append(errMulti, fmt.Errorf(
 				"sessions: missing store for session %q", name))
+		} else if session.Values == nil {
+			errMulti = append(errMulti, fmt.Errorf(
+				"%w: session %q", ErrNilValues, name))
 		} else if err := session.store.Save(s.request, w, session); err != nil {
 			errMulti = append(errMulti, fmt.Errorf(
 				"sessions: error saving session %q -- %v", name, err))
 		}
 	}
 	if errMulti != nil {
+		if s.ErrorHandler != nil {
+			s.ErrorHandler(w, s.request, errMulti)
+		}
 		return errMulti
 	}
 	return nil
@@ -169,20 +348,84 @@ func init() {
 	gob.Register([]interface{}{})
 }
 
+// afterDecode is called by the built-in stores after the values of a
+// session are decoded, to drop expired metadata and lock idle sessions.
+func afterDecode(s *Session) {
+	pruneElevations(s)
+	pruneExpiredValues(s)
+	enforceIdleLock(s)
+}
+
+// loaded sets IsNew after a store decoded session from a cookie and, for
+// server-side stores, loaded its data, with err the error of doing so.
+//
+// A session is only not new if it was decoded and found without error and
+// has not expired according to Options.Expires. Otherwise its ID and
+// values are cleared, so saving it starts a new session, and the error is
+// returned.
+func loaded(session *Session, err error) error {
+	if err == nil && !session.Options.Expires.IsZero() &&
+		!time.Now().Before(session.Options.Expires) {
+		err = errSessionExpired
+	}
+	if err != nil {
+		session.ID = ""
+		session.Values = make(map[interface{}]interface{})
+		session.fieldDigests = nil
+		session.IsNew = true
+		return err
+	}
+	session.IsNew = false
+	return nil
+}
+
+// runHooks calls each hook with s, stopping at the first error.
+func runHooks(hooks []func(*Session) error, s *Session) error {
+	for _, hook := range hooks {
+		if err := hook(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Save saves all sessions used during the current request.
 func Save(r *http.Request, w http.ResponseWriter) error {
 	return GetRegistry(r).Save(w)
 }
 
+// Destroy deletes a session. If its store implements Deleter, its Delete
+// method is called; otherwise the session values are cleared and the
+// session is saved with Options.MaxAge set to -1.
+func Destroy(r *http.Request, w http.ResponseWriter, s *Session) error {
+	return deleteSession(s.store, r, w, s)
+}
+
+// deleteSession deletes a session using store.
+func deleteSession(store Store, r *http.Request, w http.ResponseWriter,
+	s *Session) error {
+	if d, ok := store.(Deleter); ok {
+		return d.Delete(r, w, s)
+	}
+	s.Values = make(map[interface{}]interface{})
+	s.Options.MaxAge = -1
+	return store.Save(r, w, s)
+}
+
 // NewCookie returns an http.Cookie with the options set. It also sets
 // the Expires field calculated based on the MaxAge value, for Internet
-// Explorer compatibility.
+// Explorer compatibility, or to Options.Expires if it is set.
 func NewCookie(name, value string, options *Options) *http.Cookie {
 	cookie := newCookieFromOptions(name, value, options)
-	if options.MaxAge > 0 {
-		d := time.Duration(options.MaxAge) * time.Second
-		cookie.Expires = time.Now().Add(d)
-	} else if options.MaxAge < 0 {
+	now := time.Now()
+	cookie.MaxAge = options.maxAge(now)
+	if cookie.MaxAge > 0 {
+		if options.Expires.IsZero() {
+			cookie.Expires = expiresAt(now, cookie.MaxAge)
+		} else {
+			cookie.Expires = options.Expires
+		}
+	} else if cookie.MaxAge < 0 {
 		// Set it to the past to expire now.
 		cookie.Expires = time.Unix(1, 0)
 	}
@@ -214,6 +214,83 @@ func TestCookieStoreMapPanic(t *testing.T) {
 	}
 }
 
+func TestFlashKeyAndReservedKeys(t *testing.T) {
+	store := NewCookieStoreWithOptions(WithKeyPairs([]byte("some key")), WithFlashKey("_notice"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to create session", err)
+	}
+	session.AddFlash("saved")
+	if _, ok := session.Values["_notice"]; !ok {
+		t.Fatalf("expected flashes under the configured key: %v", session.Values)
+	}
+	for _, key := range []string{"_notice", flashesKey, elevationKey} {
+		if err = session.Set(key, "x"); err != ErrReservedKey {
+			t.Fatalf("%s: expected ErrReservedKey, got %v", key, err)
+		}
+	}
+	if err = session.Set("user", "gopher"); err != nil || session.Values["user"] != "gopher" {
+		t.Fatalf("failed to set value: %v, %v", session.Values, err)
+	}
+	if flashes := session.Flashes(); len(flashes) != 1 || flashes[0] != "saved" {
+		t.Fatalf("bad flashes: %v", flashes)
+	}
+}
+
+// nilValuesStore is a CookieStore returning sessions without Values.
+type nilValuesStore struct {
+	*CookieStore
+}
+
+func (s nilValuesStore) New(r *http.Request, name string) (*Session, error) {
+	return &Session{store: s, Options: &Options{}, IsNew: true}, nil
+}
+
+func TestNilValues(t *testing.T) {
+	store := nilValuesStore{NewCookieStore([]byte("some key"))}
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+
+	session, _ := store.New(req, "s")
+	if err := session.Save(req, httptest.NewRecorder()); err != ErrNilValues {
+		t.Fatalf("expected ErrNilValues, got %v", err)
+	}
+	session.AddFlash("hello")
+	if err := session.Set("user", "gopher"); err != nil {
+		t.Fatal("failed to set value", err)
+	}
+	if len(session.Values) != 2 {
+		t.Fatalf("bad values: %v", session.Values)
+	}
+
+	// Sessions from the registry always have Values.
+	session, err := GetRegistry(req).Get(store, "s")
+	if err != nil || session.Values == nil {
+		t.Fatalf("bad registered session: %v, %v", session.Values, err)
+	}
+}
+
 func init() {
 	gob.Register(FlashMessage{})
 }
+
+func TestNewRegistry(t *testing.T) {
+	store := NewCookieStore([]byte("secret-key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	preloaded := NewSession(store, "s")
+	preloaded.Values["user"] = "gopher"
+	req, registry := NewRegistry(req)
+	registry.Register(preloaded, nil)
+
+	if GetRegistry(req) != registry {
+		t.Fatal("expected the request to carry the registry")
+	}
+	session, err := store.Get(req, "s")
+	if err != nil || session != preloaded {
+		t.Fatalf("expected the registered session: %v, %v", session, err)
+	}
+	w := httptest.NewRecorder()
+	if err = Save(req, w); err != nil || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("failed to save registered session: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// Divergence describes an operation whose result differs between the
+// primary and candidate stores of a ShadowStore.
+type Divergence struct {
+	// Op is the operation: "New", "Save" or "Delete".
+	Op   string
+	Name string
+	// Primary and Candidate are the sessions returned by New. For Save
+	// and Delete, Primary is the saved session and Candidate is nil.
+	Primary   *Session
+	Candidate *Session
+	// PrimaryErr and CandidateErr are the errors returned by each store.
+	PrimaryErr   error
+	CandidateErr error
+}
+
+// NewShadowStore returns a ShadowStore serving sessions from primary and
+// mirroring operations to candidate.
+func NewShadowStore(primary, candidate Store, fn func(Divergence)) *ShadowStore {
+	return &ShadowStore{
+		Primary:      primary,
+		Candidate:    candidate,
+		OnDivergence: fn,
+	}
+}
+
+// ShadowStore serves sessions from a primary store while mirroring every
+// operation to a candidate store in the background, to compare them under
+// real traffic before migrating.
+//
+// The candidate reads the cookies issued by the primary, so it must use
+// the same cookie format and keys; server-side stores are written with the
+// session IDs assigned by the primary. Responses of the candidate are
+// discarded and its errors never reach the client.
+type ShadowStore struct {
+	Primary   Store
+	Candidate Store
+	// OnDivergence is called from a background goroutine when the
+	// candidate returns different values, a different error or fails.
+	OnDivergence func(Divergence)
+
+	wg sync.WaitGroup
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *ShadowStore) Get(r *http.Request, name string) (*Session, error) {
+	return GetRegistry(r).Get(s, name)
+}
+
+// Unwrap returns the primary store.
+func (s *ShadowStore) Unwrap() Store {
+	return s.Primary
+}
+
+// New returns a session from the primary store, and compares it with the
+// session returned by the candidate in the background.
+func (s *ShadowStore) New(r *http.Request, name string) (*Session, error) {
+	session, err := s.Primary.New(r, name)
+	if session == nil {
+		return nil, err
+	}
+	session.store = s
+	primary := copySession(session)
+	rc := r.Clone(context.WithoutCancel(r.Context()))
+	s.mirror(func() {
+		candidate, cerr := s.Candidate.New(rc, name)
+		if (err == nil) != (cerr == nil) || candidate == nil ||
+			candidate.IsNew != primary.IsNew ||
+			!reflect.DeepEqual(candidate.Values, primary.Values) {
+			s.report(Divergence{Op: "New", Name: name, Primary: primary,
+				Candidate: candidate, PrimaryErr: err, CandidateErr: cerr})
+		}
+	})
+	return session, err
+}
+
+// Save saves the session in the primary store, then in the candidate
+// store in the background.
+func (s *ShadowStore) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if err := s.Primary.Save(r, w, session); err != nil {
+		return err
+	}
+	s.mirrorWrite("Save", r, session, s.Candidate.Save)
+	return nil
+}
+
+// Delete deletes the session from the primary store, then from the
+// candidate store in the background.
+func (s *ShadowStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	mirrored := copySession(session)
+	if err := deleteSession(s.Primary, r, w, session); err != nil {
+		return err
+	}
+	s.mirrorWrite("Delete", r, mirrored, func(r *http.Request,
+		w http.ResponseWriter, session *Session) error {
+		return deleteSession(s.Candidate, r, w, session)
+	})
+	return nil
+}
+
+// Wait waits for the operations mirrored so far to complete.
+func (s *ShadowStore) Wait() {
+	s.wg.Wait()
+}
+
+// mirrorWrite calls fn with a copy of session in the background, and
+// reports an error.
+func (s *ShadowStore) mirrorWrite(op string, r *http.Request, session *Session,
+	fn func(*http.Request, http.ResponseWriter, *Session) error) {
+	primary := copySession(session)
+	mirrored := copySession(session)
+	rc := r.Clone(context.WithoutCancel(r.Context()))
+	s.mirror(func() {
+		if err := fn(rc, discardResponse{make(http.Header)}, mirrored); err != nil {
+			s.report(Divergence{Op: op, Name: session.Name(), Primary: primary,
+				CandidateErr: err})
+		}
+	})
+}
+
+// mirror runs fn in the background.
+func (s *ShadowStore) mirror(fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { _ = recover() }()
+		fn()
+	}()
+}
+
+// report calls OnDivergence, if set.
+func (s *ShadowStore) report(d Divergence) {
+	if s.OnDivergence != nil {
+		s.OnDivergence(d)
+	}
+}
+
+// copySession returns a copy of session with a shallow copy of its values
+// and options.
+func copySession(session *Session) *Session {
+	c := *session
+	c.Values = make(map[interface{}]interface{}, len(session.Values))
+	for k, v := range session.Values {
+		c.Values[k] = v
+	}
+	if session.Options != nil {
+		opts := *session.Options
+		c.Options = &opts
+	}
+	return &c
+}
+
+// discardResponse is an http.ResponseWriter discarding the response.
+type discardResponse struct {
+	header http.Header
+}
+
+func (w discardResponse) Header() http.Header         { return w.header }
+func (w discardResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (w discardResponse) WriteHeader(int)             {}
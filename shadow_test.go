@@ -0,0 +1,62 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestShadowStore(t *testing.T) {
+	var mu sync.Mutex
+	var divergences []Divergence
+	primary := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	candidate := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	store := NewShadowStore(primary, candidate, func(d Divergence) {
+		mu.Lock()
+		defer mu.Unlock()
+		divergences = append(divergences, d)
+	})
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to create session", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	store.Wait()
+
+	// The candidate holds the session written by the primary.
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	if session, err = store.New(req, "s"); err != nil || session.Values["foo"] != "bar" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+	store.Wait()
+	if len(divergences) != 0 {
+		t.Fatalf("unexpected divergences: %+v", divergences)
+	}
+
+	// Values changed behind the back of the shadow store diverge.
+	session.Values["foo"] = "baz"
+	if err = primary.save(context.Background(), session); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if _, err = store.New(req, "s"); err != nil {
+		t.Fatal("failed to load session", err)
+	}
+	store.Wait()
+	if len(divergences) != 1 || divergences[0].Op != "New" ||
+		divergences[0].Candidate.Values["foo"] != "bar" {
+		t.Fatalf("bad divergences: %+v", divergences)
+	}
+}
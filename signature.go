@@ -0,0 +1,115 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/http"
+)
+
+// errSplitSignature is returned when a session cookie or its signature
+// cookie is malformed or missing.
+var errSplitSignature = errors.New("sessions: malformed split signature cookie")
+
+// splitSignature splits a value encoded by securecookie into a payload and
+// a signature.
+//
+// securecookie values are the base64 encoding of "date|value|mac", where
+// mac is the HMAC of "name|date|value". The payload is the base64 encoding
+// of "date|value" and the signature the base64 encoding of mac, so a
+// verifier knowing the hash key can check
+//
+//	HMAC(hashKey, name + "|" + base64decode(payload)) == base64decode(signature)
+//
+// without decoding the session values.
+func splitSignature(encoded string) (payload, sig string, err error) {
+	b, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", err
+	}
+	// The MAC is raw bytes that may contain '|', so split after the
+	// second separator.
+	i := bytes.IndexByte(b, '|')
+	j := -1
+	if i >= 0 {
+		j = bytes.IndexByte(b[i+1:], '|')
+	}
+	if j < 0 {
+		return "", "", errSplitSignature
+	}
+	i += j + 1
+	payload = base64.URLEncoding.EncodeToString(b[:i])
+	sig = base64.URLEncoding.EncodeToString(b[i+1:])
+	return payload, sig, nil
+}
+
+// joinSignature reverses splitSignature.
+func joinSignature(payload, sig string) (string, error) {
+	p, err := base64.URLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", err
+	}
+	m, err := base64.URLEncoding.DecodeString(sig)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, 0, len(p)+len(m)+1)
+	b = append(b, p...)
+	b = append(b, '|')
+	b = append(b, m...)
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+// signatureCookie returns the name of the cookie carrying the signature of
+// the session cookie with the given name, or "" if signatures are not split.
+func (s *CookieStore) signatureCookie(name string) string {
+	if s.SignatureSuffix == "" {
+		return ""
+	}
+	return name + s.SignatureSuffix
+}
+
+// joinCookie returns c with the signature from the signature cookie of the
+// request appended, if signatures are split.
+func (s *CookieStore) joinCookie(r *http.Request, c *http.Cookie) (*http.Cookie, error) {
+	sigName := s.signatureCookie(c.Name)
+	if sigName == "" {
+		return c, nil
+	}
+	sc, err := r.Cookie(sigName)
+	if err != nil {
+		return nil, errSplitSignature
+	}
+	value, err := joinSignature(c.Value, sc.Value)
+	if err != nil {
+		return nil, errSplitSignature
+	}
+	joined := *c
+	joined.Value = value
+	return &joined, nil
+}
+
+// setSessionCookie sets the session cookie, and its signature cookie if
+// signatures are split.
+func (s *CookieStore) setSessionCookie(r *http.Request, w http.ResponseWriter,
+	name, encoded string, options *Options) error {
+	sigName := s.signatureCookie(name)
+	if sigName == "" {
+		return setCookie(r, w, name, encoded, options, &s.hooks)
+	}
+	var payload, sig string
+	if encoded != "" {
+		var err error
+		if payload, sig, err = splitSignature(encoded); err != nil {
+			return err
+		}
+	}
+	if err := setCookie(r, w, name, payload, options, &s.hooks); err != nil {
+		return err
+	}
+	return setCookie(r, w, sigName, sig, options, &s.hooks)
+}
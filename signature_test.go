@@ -0,0 +1,65 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSignatureCookie(t *testing.T) {
+	store := NewCookieStoreWithOptions(WithKeyPairs([]byte("some key")),
+		WithSignatureCookie("_sig"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	session, _ := store.New(req, "s")
+	session.Values["user"] = "gopher"
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 2 || cookies[0].Name != "s" || cookies[1].Name != "s_sig" {
+		t.Fatalf("bad cookies: %v", cookies)
+	}
+	payload, sig := cookies[0], cookies[1]
+
+	// The signature can be checked without decoding the payload.
+	p, _ := base64.URLEncoding.DecodeString(payload.Value)
+	m, _ := base64.URLEncoding.DecodeString(sig.Value)
+	mac := hmac.New(sha256.New, []byte("some key"))
+	mac.Write(append([]byte("s|"), p...))
+	if !hmac.Equal(mac.Sum(nil), m) {
+		t.Fatal("signature cookie doesn't verify the payload")
+	}
+
+	load := func(cookies ...*http.Cookie) (*Session, error) {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		return store.New(req, "s")
+	}
+	if session, err := load(payload, sig); err != nil || session.Values["user"] != "gopher" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+	forged := &http.Cookie{Name: "s_sig", Value: base64.URLEncoding.EncodeToString(make([]byte, len(m)))}
+	for _, cookies := range [][]*http.Cookie{{payload}, {payload, forged}} {
+		if session, err := load(cookies...); err == nil || !session.IsNew {
+			t.Fatalf("expected session to be rejected: %v", cookies)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	if err := Destroy(req, w, session); err != nil {
+		t.Fatal("failed to destroy session", err)
+	}
+	if cookies = w.Result().Cookies(); len(cookies) != 2 || cookies[1].MaxAge >= 0 {
+		t.Fatalf("expected both cookies to be expired: %v", cookies)
+	}
+}
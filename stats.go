@@ -0,0 +1,279 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// NewStats returns an empty Stats.
+func NewStats() *Stats {
+	return &Stats{}
+}
+
+// Stats collects operational statistics of a store and serves them over
+// HTTP, as JSON or in the Prometheus text format.
+//
+// Stats implements Tracer: wrap the store with NewTracedStore(store, stats)
+// to record loads, decode failures, payload sizes, and the size
+// distributions of saved sessions, served as histograms. Garbage collection
+// runs are recorded with RecordGC or RecordGCReport, and the number of active sessions is
+// read from Active, if set.
+type Stats struct {
+	// Active returns the number of active sessions, for example by
+	// counting them with AdminStore.Walk. It is called on each request to
+	// the handler.
+	Active func() (int, error)
+
+	mu             sync.Mutex
+	loads          int64
+	decodeFailures int64
+	saves          int64
+	payloadBytes   int64
+	gcRuns         int64
+	gcDeleted      int64
+	gcFailed       int64
+	cookieSizes    histogram
+	backendSizes   histogram
+	valueCounts    histogram
+}
+
+// Upper bounds of the buckets of the histograms of Stats.
+var (
+	cookieSizeBounds  = []float64{256, 512, 1024, 2048, 3072, 4096, 8192}
+	backendSizeBounds = []float64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+	valueCountBounds  = []float64{1, 2, 5, 10, 20, 50, 100}
+)
+
+// HistogramSnapshot holds the observations of a histogram of Stats.
+type HistogramSnapshot struct {
+	Name string `json:"name"`
+	// Bounds are the upper bounds of the buckets.
+	Bounds []float64 `json:"bounds"`
+	// Counts are the cumulative counts of observations less than or
+	// equal to each bound, followed by the total count.
+	Counts []int64 `json:"counts"`
+	Sum    float64 `json:"sum"`
+}
+
+// histogram counts observations in buckets.
+type histogram struct {
+	counts []int64
+	sum    float64
+}
+
+// observe records v in a histogram with the given bounds.
+func (h *histogram) observe(bounds []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]int64, len(bounds)+1)
+	}
+	i := 0
+	for i < len(bounds) && v > bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sum += v
+}
+
+// snapshot returns the cumulative counts of h.
+func (h *histogram) snapshot(name string, bounds []float64) HistogramSnapshot {
+	snap := HistogramSnapshot{
+		Name:   name,
+		Bounds: bounds,
+		Counts: make([]int64, len(bounds)+1),
+		Sum:    h.sum,
+	}
+	var total int64
+	for i := range snap.Counts {
+		if h.counts != nil {
+			total += h.counts[i]
+		}
+		snap.Counts[i] = total
+	}
+	return snap
+}
+
+// StatsSnapshot holds the statistics served by Stats.
+type StatsSnapshot struct {
+	// Active is the number of active sessions, or -1 if unknown.
+	Active int `json:"active"`
+	// Loads counts requests carrying a session cookie.
+	Loads int64 `json:"loads"`
+	// DecodeFailures counts loads that failed.
+	DecodeFailures int64 `json:"decode_failures"`
+	// DecodeFailureRate is DecodeFailures divided by Loads.
+	DecodeFailureRate float64 `json:"decode_failure_rate"`
+	Saves             int64   `json:"saves"`
+	// AveragePayloadSize is the average size in bytes of saved cookies.
+	AveragePayloadSize float64 `json:"average_payload_size"`
+	GCRuns             int64   `json:"gc_runs"`
+	GCDeleted          int64   `json:"gc_deleted"`
+	GCFailed           int64   `json:"gc_failed"`
+}
+
+// Start starts a span recording a store operation. See Tracer.
+func (s *Stats) Start(ctx context.Context, op string) (context.Context, Span) {
+	return ctx, &statsSpan{stats: s, op: op}
+}
+
+// RecordGC records a garbage collection run that deleted n sessions, such
+// as a call to FilesystemStore.GC.
+func (s *Stats) RecordGC(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gcRuns++
+	s.gcDeleted += int64(n)
+}
+
+// RecordGCReport records a garbage collection run described by report,
+// such as one returned by the RunGC method of a store. Dry runs are
+// ignored.
+func (s *Stats) RecordGCReport(report *GCReport) {
+	if report == nil || report.DryRun {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gcRuns++
+	s.gcDeleted += int64(report.Deleted)
+	s.gcFailed += int64(report.Failed)
+}
+
+// Histograms returns the distributions of saved sessions: the size in
+// bytes of their cookies ("sessions_cookie_bytes"), the size in bytes of
+// the data written by server-side stores ("sessions_backend_bytes"), and
+// their number of values ("sessions_values").
+func (s *Stats) Histograms() []HistogramSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return []HistogramSnapshot{
+		s.cookieSizes.snapshot("sessions_cookie_bytes", cookieSizeBounds),
+		s.backendSizes.snapshot("sessions_backend_bytes", backendSizeBounds),
+		s.valueCounts.snapshot("sessions_values", valueCountBounds),
+	}
+}
+
+// Snapshot returns the current statistics.
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	snap := StatsSnapshot{
+		Active:         -1,
+		Loads:          s.loads,
+		DecodeFailures: s.decodeFailures,
+		Saves:          s.saves,
+		GCRuns:         s.gcRuns,
+		GCDeleted:      s.gcDeleted,
+		GCFailed:       s.gcFailed,
+	}
+	payloadBytes := s.payloadBytes
+	s.mu.Unlock()
+	if snap.Loads > 0 {
+		snap.DecodeFailureRate = float64(snap.DecodeFailures) / float64(snap.Loads)
+	}
+	if snap.Saves > 0 {
+		snap.AveragePayloadSize = float64(payloadBytes) / float64(snap.Saves)
+	}
+	if s.Active != nil {
+		if n, err := s.Active(); err == nil {
+			snap.Active = n
+		}
+	}
+	return snap
+}
+
+// ServeHTTP writes the statistics as JSON, or in the Prometheus text
+// format if the format query parameter is "prometheus".
+func (s *Stats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snap := s.Snapshot()
+	if r.URL.Query().Get("format") != "prometheus" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(snap)
+		return
+	}
+	var b strings.Builder
+	metric := func(name, typ, help string, v interface{}) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, typ, name, v)
+	}
+	if snap.Active >= 0 {
+		metric("sessions_active", "gauge", "Number of active sessions.", snap.Active)
+	}
+	metric("sessions_loads_total", "counter", "Requests carrying a session cookie.", snap.Loads)
+	metric("sessions_decode_failures_total", "counter", "Sessions that failed to load.", snap.DecodeFailures)
+	metric("sessions_saves_total", "counter", "Saved sessions.", snap.Saves)
+	metric("sessions_payload_bytes_average", "gauge", "Average size of saved cookies in bytes.", snap.AveragePayloadSize)
+	metric("sessions_gc_runs_total", "counter", "Garbage collection runs.", snap.GCRuns)
+	metric("sessions_gc_deleted_total", "counter", "Sessions deleted by garbage collection.", snap.GCDeleted)
+	metric("sessions_gc_failed_total", "counter", "Sessions garbage collection failed to delete.", snap.GCFailed)
+	help := map[string]string{
+		"sessions_cookie_bytes":  "Size of saved session cookies in bytes.",
+		"sessions_backend_bytes": "Size of session data saved by server-side stores in bytes.",
+		"sessions_values":        "Number of values of saved sessions.",
+	}
+	for _, h := range s.Histograms() {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s histogram\n", h.Name, help[h.Name], h.Name)
+		for i, bound := range h.Bounds {
+			fmt.Fprintf(&b, "%s_bucket{le=\"%v\"} %d\n", h.Name, bound, h.Counts[i])
+		}
+		count := h.Counts[len(h.Counts)-1]
+		fmt.Fprintf(&b, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %v\n%s_count %d\n",
+			h.Name, count, h.Name, h.Sum, h.Name, count)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// statsSpan records a store operation in Stats.
+type statsSpan struct {
+	stats       *Stats
+	op          string
+	size        int
+	backendSize int
+	values      int
+}
+
+func (sp *statsSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		switch a.Key {
+		case "session.payload_size":
+			sp.size, _ = a.Value.(int)
+		case "session.backend_size":
+			sp.backendSize, _ = a.Value.(int)
+		case "session.values":
+			sp.values, _ = a.Value.(int)
+		}
+	}
+}
+
+func (sp *statsSpan) End(err error) {
+	s := sp.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch sp.op {
+	case "Get", "New":
+		if sp.size > 0 {
+			s.loads++
+			if err != nil {
+				s.decodeFailures++
+			}
+		}
+	case "Save":
+		if err == nil {
+			s.saves++
+			s.payloadBytes += int64(sp.size)
+			if sp.size > 0 {
+				s.cookieSizes.observe(cookieSizeBounds, float64(sp.size))
+			}
+			if sp.backendSize > 0 {
+				s.backendSizes.observe(backendSizeBounds, float64(sp.backendSize))
+			}
+			s.valueCounts.observe(valueCountBounds, float64(sp.values))
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	stats := NewStats()
+	stats.Active = func() (int, error) { return 3, nil }
+	store := NewTracedStore(NewCookieStore([]byte("some key")), stats)
+
+	value := encodeCookie(t, store, "s", "gopher")
+	for _, v := range []string{value, "invalid"} {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(&http.Cookie{Name: "s", Value: v})
+		_, _ = store.New(req, "s")
+	}
+	stats.RecordGC(2)
+
+	req, _ := http.NewRequest("GET", "http://www.example.com/stats", nil)
+	w := httptest.NewRecorder()
+	stats.ServeHTTP(w, req)
+	var snap StatsSnapshot
+	if err := json.NewDecoder(w.Body).Decode(&snap); err != nil {
+		t.Fatal("failed to decode stats", err)
+	}
+	want := StatsSnapshot{
+		Active:             3,
+		Loads:              2,
+		DecodeFailures:     1,
+		DecodeFailureRate:  0.5,
+		Saves:              1,
+		AveragePayloadSize: float64(len(value)),
+		GCRuns:             1,
+		GCDeleted:          2,
+	}
+	if snap != want {
+		t.Fatalf("bad stats: got %+v, want %+v", snap, want)
+	}
+
+	req, _ = http.NewRequest("GET", "http://www.example.com/stats?format=prometheus", nil)
+	w = httptest.NewRecorder()
+	stats.ServeHTTP(w, req)
+	for _, line := range []string{"sessions_active 3\n", "sessions_decode_failures_total 1\n", "sessions_gc_deleted_total 2\n"} {
+		if !strings.Contains(w.Body.String(), line) {
+			t.Fatalf("missing %q in:\n%s", line, w.Body.String())
+		}
+	}
+}
+
+func TestStatsHistograms(t *testing.T) {
+	stats := NewStats()
+	bucket := &memBucket{objects: make(map[string][]byte)}
+	store := NewTracedStore(NewObjectStore(bucket, []byte("some key")), stats)
+	encodeCookie(t, store, "s", "gopher")
+
+	hists := stats.Histograms()
+	if len(hists) != 3 {
+		t.Fatalf("expected 3 histograms, got %d", len(hists))
+	}
+	for _, h := range hists {
+		if total := h.Counts[len(h.Counts)-1]; total != 1 || h.Sum <= 0 {
+			t.Fatalf("expected a single observation in %s: %+v", h.Name, h)
+		}
+	}
+	if values := hists[2]; values.Counts[0] != 1 || values.Sum != 1 {
+		t.Fatalf("expected a single value to be observed: %+v", values)
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com/stats?format=prometheus", nil)
+	w := httptest.NewRecorder()
+	stats.ServeHTTP(w, req)
+	for _, line := range []string{
+		"# TYPE sessions_cookie_bytes histogram\n",
+		"sessions_backend_bytes_bucket{le=\"1024\"} 1\n",
+		"sessions_values_bucket{le=\"+Inf\"} 1\n",
+		"sessions_values_count 1\n",
+	} {
+		if !strings.Contains(w.Body.String(), line) {
+			t.Fatalf("missing %q in:\n%s", line, w.Body.String())
+		}
+	}
+}
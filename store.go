@@ -5,11 +5,17 @@
 package sessions
 
 import (
-	"encoding/base32"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/securecookie"
 )
@@ -19,6 +25,12 @@ const (
 	sessionFilePrefix = "session_"
 )
 
+var (
+	errSessionFileExpired = errors.New("sessions: session file expired")
+	errSessionExpired     = errors.New("sessions: session expired")
+	errSessionGeneration  = errors.New("sessions: session generation revoked")
+)
+
 // Store is an interface for custom session stores.
 //
 // See CookieStore and FilesystemStore for examples.
@@ -36,6 +48,23 @@ type Store interface {
 	Save(r *http.Request, w http.ResponseWriter, s *Session) error
 }
 
+// Toucher is implemented by stores that can refresh the expiry of a session
+// without re-serializing its values.
+type Toucher interface {
+	// Touch should re-issue the session cookie and update the last access
+	// time in the underlying store, if any.
+	Touch(r *http.Request, w http.ResponseWriter, s *Session) error
+}
+
+// Deleter is implemented by stores that can delete a session. Delete
+// should remove any server-side data of the session, clear its values and
+// expire the session cookie.
+//
+// Use Destroy() to delete a session with any store.
+type Deleter interface {
+	Delete(r *http.Request, w http.ResponseWriter, s *Session) error
+}
+
 // CookieStore ----------------------------------------------------------------
 
 // NewCookieStore returns a new CookieStore.
@@ -51,14 +80,33 @@ type Store interface {
 // The encryption key, if set, must be either 16, 24, or 32 bytes to select
 // AES-128, AES-192, or AES-256 modes.
 func NewCookieStore(keyPairs ...[]byte) *CookieStore {
+	return NewCookieStoreWithOptions(WithKeyPairs(keyPairs...))
+}
+
+// NewCookieStoreWithOptions returns a new CookieStore configured by opts.
+//
+// Options not set default to the values used by NewCookieStore().
+func NewCookieStoreWithOptions(opts ...StoreOption) *CookieStore {
+	cfg := newStoreConfig(&Options{
+		Path:     "/",
+		MaxAge:   86400 * 30,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   true,
+	}, opts)
 	cs := &CookieStore{
-		Codecs: securecookie.CodecsFromPairs(keyPairs...),
-		Options: &Options{
-			Path:     "/",
-			MaxAge:   86400 * 30,
-			SameSite: http.SameSiteNoneMode,
-			Secure:   true,
-		},
+		Codecs:          cfg.codecs(),
+		Options:         cfg.options,
+		FlashKey:        cfg.flashKey,
+		SignatureSuffix: cfg.signatureSuffix,
+
+		AlternateNames:       cfg.alternateNames,
+		ExpireAlternateNames: cfg.expireAlternateNames,
+		CookiePolicy:         cfg.cookiePolicy,
+		SkipUnchanged:        cfg.skipUnchanged,
+		NotBefore:            cfg.notBefore,
+		Packing:              cfg.packing,
+		serializer:           cfg.serializer,
+		hooks:                cfg.hooks,
 	}
 
 	cs.MaxAge(cs.Options.MaxAge)
@@ -69,6 +117,52 @@ func NewCookieStore(keyPairs ...[]byte) *CookieStore {
 type CookieStore struct {
 	Codecs  []securecookie.Codec
 	Options *Options // default configuration
+	// FlashKey is the default flashes key of sessions. If empty, "_flash"
+	// is used.
+	FlashKey string
+	// SignatureSuffix, if set, moves the signature of session cookies to a
+	// separate cookie named after the session with this suffix appended,
+	// for example "_sig". Edge servers can then validate sessions, or key
+	// caches on them, without parsing the payload. See WithSignatureCookie.
+	SignatureSuffix string
+	// AlternateNames maps session names to former cookie names, which are
+	// read when the request has no cookie with the session name, so a
+	// cookie can be renamed without logging users out. Sessions are always
+	// saved under their name. See WithAlternateNames.
+	AlternateNames map[string][]string
+	// ExpireAlternateNames makes Save expire the cookies of the request
+	// named after alternate names.
+	ExpireAlternateNames bool
+	// CookiePolicy selects the cookie decoded by New when the request has
+	// several cookies with the session name. The default is CookieFirst.
+	CookiePolicy CookiePolicy
+	// ExactLimits bounds the cookies decoded by NewExact and QueryExact.
+	ExactLimits ExactLimits
+	// SkipUnchanged makes Save skip the Set-Cookie header when the values
+	// and options of a session are unchanged since it was decoded, saving
+	// header bytes and keeping responses cacheable. The cookie is then not
+	// refreshed, so the session expires MaxAge after its last change
+	// rather than its last save. See WithSkipUnchanged.
+	SkipUnchanged bool
+	// SessionCodecs lists the codecs that sessions may select with
+	// Session.UseCodecs, which are tried when the codecs of the store fail
+	// to decode a cookie.
+	SessionCodecs [][]securecookie.Codec
+	// NotBefore, if set, rejects session cookies issued before it with
+	// ErrIssuedBeforeNotBefore, so all sessions can be invalidated at once,
+	// for example after a security incident. See Session.IssuedAt.
+	NotBefore time.Time
+	// Packing, if set, evicts values by priority when the session cookie
+	// would be too long, instead of failing Save. See CookiePacking.
+	Packing *CookiePacking
+	// decodeTelemetry provides OnDecodeFailure and DecodeFailures().
+	decodeTelemetry
+	current    atomic.Pointer[Options]
+	beforeSave []func(*Session) error
+	afterLoad  []func(*Session) error
+	// serializer is the serializer set by WithSerializer, if any.
+	serializer securecookie.Serializer
+	hooks      cookieHooks
 }
 
 // Get returns a session for the given name after adding it to the registry.
@@ -88,31 +182,205 @@ func (s *CookieStore) Get(r *http.Request, name string) (*Session, error) {
 // decode the session data twice, while Get() registers and reuses the same
 // decoded session after the first call.
 func (s *CookieStore) New(r *http.Request, name string) (*Session, error) {
+	session := s.newSession(name)
+	var err error
+	if c, errCookie := requestCookie(r, name, s.CookiePolicy, s.AlternateNames); errCookie == nil {
+		err = loaded(session, s.decodeRequestCookie(r, session, c))
+	}
+	return session, err
+}
+
+// Lookup returns the session for the given name and true if the request
+// carries a valid session cookie, without creating a session otherwise.
+//
+// See the Lookup function.
+func (s *CookieStore) Lookup(r *http.Request, name string) (*Session, bool, error) {
+	return lookup(s, r, name)
+}
+
+// NewExact returns a session for the given name without adding it to the
+// registry, selecting it with match when the request carries several
+// cookies with that name.
+//
+// Cookies are tried from the most to the least recently issued, and the
+// first session accepted by match is returned. If none is accepted, a new
+// session is returned along with the first decoding error, if any.
+func (s *CookieStore) NewExact(r *http.Request, name string,
+	match Matcher) (*Session, error) {
+	return s.QueryExact(r, name, match.Indexed())
+}
+
+// QueryExact is like NewExact but match also receives the index of the
+// cookie among the cookies with that name, in request order.
+func (s *CookieStore) QueryExact(r *http.Request, name string,
+	match IndexMatcher) (*Session, error) {
+	return newExact(r, name, match, s.ExactLimits, func() *Session {
+		return s.newSession(name)
+	}, func(session *Session, c *http.Cookie) error {
+		return s.decodeRequestCookie(r, session, c)
+	})
+}
+
+// GetExact is like NewExact but adds the session to the registry, and
+// returns the registered session if there is one.
+func (s *CookieStore) GetExact(r *http.Request, name string,
+	match Matcher) (*Session, error) {
+	return GetRegistry(r).get(s, name, func() (*Session, error) {
+		return s.NewExact(r, name, match)
+	})
+}
+
+// newSession returns an empty session using a copy of the store options.
+func (s *CookieStore) newSession(name string) *Session {
 	session := NewSession(s, name)
-	opts := *s.Options
+	opts := *s.options()
 	session.Options = &opts
 	session.IsNew = true
-	var err error
-	if c, errCookie := r.Cookie(name); errCookie == nil {
-		err = securecookie.DecodeMulti(name, c.Value, &session.Values,
-			s.Codecs...)
-		if err == nil {
-			session.IsNew = false
+	session.flashKey = s.FlashKey
+	return session
+}
+
+// decodeRequestCookie decodes the cookie value into session.Values,
+// joining it with its signature cookie if needed, and records failures.
+func (s *CookieStore) decodeRequestCookie(r *http.Request, session *Session,
+	c *http.Cookie) error {
+	c, err := s.joinCookie(r, c)
+	if err != nil {
+		s.recordDecodeFailure(session.Name(), DecodeMalformed, err)
+		return err
+	}
+	primary, err := decodeMultiPrimary(c.Name, c.Value, &session.Values, s.Codecs...)
+	session.needsReissue = err == nil && !primary
+	if err != nil {
+		for _, codecs := range s.SessionCodecs {
+			if decodeMulti(c.Name, c.Value, &session.Values, codecs...) == nil {
+				session.codecs = codecs
+				err = nil
+				break
+			}
 		}
 	}
-	return session, err
+	if err == nil {
+		err = checkIssuedAt(session, c.Value, s.NotBefore)
+		if err != nil {
+			session.Values = make(map[interface{}]interface{})
+		}
+	}
+	if err != nil {
+		s.recordDecodeFailure(session.Name(), "", err)
+		return err
+	}
+	afterDecode(session)
+	if err = runHooks(s.afterLoad, session); err != nil {
+		session.Values = make(map[interface{}]interface{})
+		s.recordDecodeFailure(session.Name(), DecodeRejected, err)
+		return err
+	}
+	if s.SkipUnchanged && c.Name == session.Name() && !session.needsReissue {
+		session.loadedDigest, _ = sessionDigest(session)
+	}
+	return nil
 }
 
 // Save adds a single session to the response.
 func (s *CookieStore) Save(r *http.Request, w http.ResponseWriter,
 	session *Session) error {
-	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values,
-		s.Codecs...)
+	if session.Options.MaxAge >= 0 {
+		if err := runHooks(s.beforeSave, session); err != nil {
+			return err
+		}
+		if s.SkipUnchanged && unchanged(session) {
+			return nil
+		}
+	}
+	codecs := sessionCodecs(session, s.Codecs)
+	encode := func() (string, error) {
+		return encodeMulti(session.Name(), session.Values, codecs...)
+	}
+	var encoded string
+	var err error
+	if s.Packing != nil && session.Options.MaxAge >= 0 {
+		encoded, err = s.Packing.pack(r, session, encode)
+	} else {
+		encoded, err = encode()
+	}
 	if err != nil {
 		return err
 	}
-	http.SetCookie(w, NewCookie(session.Name(), encoded, session.Options))
-	return nil
+	if s.SkipUnchanged {
+		session.loadedDigest, _ = sessionDigest(session)
+	}
+	session.needsReissue = false
+	if err = s.setSessionCookie(r, w, session.Name(), encoded, session.Options); err != nil {
+		return err
+	}
+	return s.expireAlternates(r, w, session)
+}
+
+// expireAlternates expires cookies named after the alternate names of the
+// session, if ExpireAlternateNames is set.
+func (s *CookieStore) expireAlternates(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if !s.ExpireAlternateNames {
+		return nil
+	}
+	return expireAlternates(r, w, session.Name(), s.AlternateNames, session.Options, &s.hooks)
+}
+
+// Cookie returns the cookie Save would set for session, without writing
+// it to a response, for frameworks managing headers themselves.
+//
+// Options.DomainFunc is not applied, since there is no request. If
+// SignatureSuffix is set, only the payload cookie is returned.
+func (s *CookieStore) Cookie(session *Session) (*http.Cookie, error) {
+	return savedCookie(s, session)
+}
+
+// Delete clears the session values and expires the session cookie.
+func (s *CookieStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	session.Values = make(map[interface{}]interface{})
+	session.Options.MaxAge = -1
+	return s.setSessionCookie(r, w, session.Name(), "", session.Options)
+}
+
+// BeforeSave registers fn to be called with each session before it is
+// encoded, for example to strip nil values or normalize types. If fn
+// returns an error the session is not saved. Hooks are not called for
+// sessions being deleted.
+//
+// Hooks must be registered before the store is used.
+func (s *CookieStore) BeforeSave(fn func(*Session) error) {
+	s.beforeSave = append(s.beforeSave, fn)
+}
+
+// AfterLoad registers fn to be called with each session after it is
+// decoded, for example to backfill defaults. If fn returns an error the
+// session is discarded as if it couldn't be decoded.
+//
+// Hooks must be registered before the store is used.
+func (s *CookieStore) AfterLoad(fn func(*Session) error) {
+	s.afterLoad = append(s.afterLoad, fn)
+}
+
+// SetOptions atomically replaces the default options of the store with a
+// copy of opts, so configuration can change while requests are served.
+//
+// Sessions created afterwards use the new options; existing sessions keep
+// their own copy. Once SetOptions has been called the Options field is no
+// longer consulted. The maximum age of the underlying codecs is not
+// changed; see MaxAge().
+func (s *CookieStore) SetOptions(opts *Options) {
+	o := *opts
+	s.current.Store(&o)
+}
+
+// options returns the current default options.
+func (s *CookieStore) options() *Options {
+	if o := s.current.Load(); o != nil {
+		return o
+	}
+	return s.Options
 }
 
 // MaxAge sets the maximum age for the store and the underlying cookie
@@ -120,36 +388,84 @@ func (s *CookieStore) Save(r *http.Request, w http.ResponseWriter,
 // = -1 for that session.
 func (s *CookieStore) MaxAge(age int) {
 	s.Options.MaxAge = age
+	if o := s.current.Load(); o != nil {
+		opts := *o
+		opts.MaxAge = age
+		s.current.Store(&opts)
+	}
+	setCodecsMaxAge(s.Codecs, age)
+}
 
-	// Set the maxAge for each securecookie instance.
-	for _, codec := range s.Codecs {
-		if sc, ok := codec.(*securecookie.SecureCookie); ok {
-			sc.MaxAge(age)
+// setCodecsMaxAge sets the maximum age of the codecs that have one.
+func setCodecsMaxAge(codecs []securecookie.Codec, age int) {
+	for _, codec := range codecs {
+		switch c := codec.(type) {
+		case *securecookie.SecureCookie:
+			c.MaxAge(age)
+		case *DeterministicCodec:
+			c.MaxAge(age)
+		case *PASETOCodec:
+			c.MaxAge(age)
+		case *PassphraseCodec:
+			c.MaxAge(age)
 		}
 	}
 }
 
-// FilesystemStore ------------------------------------------------------------
+// LimitDecoding restricts the size and shape of decoded sessions.
+//
+// It wraps the serializer of the codecs with one that enforces limits;
+// decoding a session that exceeds them fails with ErrDecodeLimitExceeded.
+// The serializer of securecookie codecs can't be read back, so it is
+// assumed to be the one set by WithSerializer, or gob.
+func (s *CookieStore) LimitDecoding(limits DecodeLimits) {
+	setSerializer(s.Codecs, s.serializer, &limits)
+}
 
-var fileMutex sync.RWMutex
+// FilesystemStore ------------------------------------------------------------
 
 // NewFilesystemStore returns a new FilesystemStore.
 //
 // The path argument is the directory where sessions will be saved. If empty
-// it will use os.TempDir().
+// it will use os.TempDir(). Another file system can be used with
+// NewFilesystemStoreWithOptions() and WithFS().
 //
 // See NewCookieStore() for a description of the other parameters.
 func NewFilesystemStore(path string, keyPairs ...[]byte) *FilesystemStore {
+	return NewFilesystemStoreWithOptions(path, WithKeyPairs(keyPairs...))
+}
+
+// NewFilesystemStoreWithOptions returns a new FilesystemStore configured by
+// opts.
+//
+// Options not set default to the values used by NewFilesystemStore().
+func NewFilesystemStoreWithOptions(path string, opts ...StoreOption) *FilesystemStore {
 	if path == "" {
 		path = os.TempDir()
 	}
+	cfg := newStoreConfig(&Options{
+		Path:   "/",
+		MaxAge: 86400 * 30,
+	}, opts)
+	fsys := cfg.fsys
+	if fsys == nil {
+		fsys = DirFS(path)
+	}
 	fs := &FilesystemStore{
-		Codecs: securecookie.CodecsFromPairs(keyPairs...),
-		Options: &Options{
-			Path:   "/",
-			MaxAge: 86400 * 30,
-		},
-		path: path,
+		Codecs:   cfg.codecs(),
+		Options:  cfg.options,
+		Entropy:  cfg.entropy,
+		FlashKey: cfg.flashKey,
+		fsys:     fsys,
+
+		AlternateNames:       cfg.alternateNames,
+		ExpireAlternateNames: cfg.expireAlternateNames,
+		CookiePolicy:         cfg.cookiePolicy,
+		IDEncoding:           cfg.idEncoding,
+		NotBefore:            cfg.notBefore,
+		Async:                cfg.async,
+		serializer:           cfg.serializer,
+		hooks:                cfg.hooks,
 	}
 
 	fs.MaxAge(fs.Options.MaxAge)
@@ -164,7 +480,50 @@ func NewFilesystemStore(path string, keyPairs ...[]byte) *FilesystemStore {
 type FilesystemStore struct {
 	Codecs  []securecookie.Codec
 	Options *Options // default configuration
-	path    string
+	// Entropy is the source of random bytes for session IDs. If nil,
+	// crypto/rand is used. Save fails with ErrNoEntropy if it can't be read.
+	Entropy io.Reader
+	// IDEncoding encodes the random bytes of new session IDs. If nil,
+	// unpadded base32 is used. It must only produce letters, digits, '-',
+	// '_' and '=', such as base64.RawURLEncoding; other IDs are rejected
+	// with ErrInvalidSessionID.
+	IDEncoding IDEncoding
+	// PersistOptions saves the cookie attributes of sessions, such as
+	// Path, Domain and SameSite, with their values, so the cookies of
+	// loaded sessions match the ones the browser holds even if the store
+	// defaults changed since the sessions were created.
+	PersistOptions bool
+	// FlashKey is the default flashes key of sessions. If empty, "_flash"
+	// is used.
+	FlashKey string
+	// AlternateNames and ExpireAlternateNames allow renaming the session
+	// cookie; see CookieStore.AlternateNames.
+	AlternateNames       map[string][]string
+	ExpireAlternateNames bool
+	// CookiePolicy selects the cookie decoded by New when the request has
+	// several cookies with the session name. The default is CookieFirst.
+	CookiePolicy CookiePolicy
+	// ExactLimits bounds the cookies decoded by NewExact and QueryExact.
+	ExactLimits ExactLimits
+	// NotBefore rejects session cookies issued before it; see
+	// CookieStore.NotBefore.
+	NotBefore time.Time
+	// Async, if set, writes and removes session files in the background.
+	// See AsyncWriter.
+	Async *AsyncWriter
+	// decodeTelemetry provides OnDecodeFailure and DecodeFailures().
+	decodeTelemetry
+	current    atomic.Pointer[Options]
+	generation atomic.Int64
+	fsys       WritableFS
+	shards     int
+	locks      [lockStripes]sync.Mutex
+	onExpire   *ExpireCallback
+	beforeSave []func(*Session) error
+	afterLoad  []func(*Session) error
+	// serializer is the serializer set by WithSerializer, if any.
+	serializer securecookie.Serializer
+	hooks      cookieHooks
 }
 
 // MaxLength restricts the maximum length of new sessions to l.
@@ -178,6 +537,13 @@ func (s *FilesystemStore) MaxLength(l int) {
 	}
 }
 
+// LimitDecoding restricts the size and shape of decoded sessions.
+//
+// See CookieStore.LimitDecoding().
+func (s *FilesystemStore) LimitDecoding(limits DecodeLimits) {
+	setSerializer(s.Codecs, s.serializer, &limits)
+}
+
 // Get returns a session for the given name after adding it to the registry.
 //
 // See CookieStore.Get().
@@ -189,25 +555,99 @@ func (s *FilesystemStore) Get(r *http.Request, name string) (*Session, error) {
 //
 // See CookieStore.New().
 func (s *FilesystemStore) New(r *http.Request, name string) (*Session, error) {
+	session := s.newSession(name)
+	var err error
+	if c, errCookie := requestCookie(r, name, s.CookiePolicy, s.AlternateNames); errCookie == nil {
+		err = loaded(session, s.decodeCookie(r.Context(), session, c))
+	}
+	return session, err
+}
+
+// Lookup returns the session for the given name and true if the request
+// carries a session cookie whose file exists, without creating a session
+// otherwise.
+//
+// See the Lookup function.
+func (s *FilesystemStore) Lookup(r *http.Request, name string) (*Session, bool, error) {
+	return lookup(s, r, name)
+}
+
+// NewExact returns a session for the given name without adding it to the
+// registry, selecting it with match when the request carries several
+// cookies with that name.
+//
+// See CookieStore.NewExact().
+func (s *FilesystemStore) NewExact(r *http.Request, name string,
+	match Matcher) (*Session, error) {
+	return s.QueryExact(r, name, match.Indexed())
+}
+
+// QueryExact is like NewExact but match also receives the index of the
+// cookie among the cookies with that name, in request order.
+//
+// See CookieStore.QueryExact().
+func (s *FilesystemStore) QueryExact(r *http.Request, name string,
+	match IndexMatcher) (*Session, error) {
+	return newExact(r, name, match, s.ExactLimits, func() *Session {
+		return s.newSession(name)
+	}, func(session *Session, c *http.Cookie) error {
+		return s.decodeCookie(r.Context(), session, c)
+	})
+}
+
+// GetExact is like NewExact but adds the session to the registry, and
+// returns the registered session if there is one.
+func (s *FilesystemStore) GetExact(r *http.Request, name string,
+	match Matcher) (*Session, error) {
+	return GetRegistry(r).get(s, name, func() (*Session, error) {
+		return s.NewExact(r, name, match)
+	})
+}
+
+// newSession returns an empty session using a copy of the store options.
+func (s *FilesystemStore) newSession(name string) *Session {
 	session := NewSession(s, name)
-	opts := *s.Options
+	opts := *s.options()
 	session.Options = &opts
 	session.IsNew = true
-	var err error
-	if c, errCookie := r.Cookie(name); errCookie == nil {
-		err = securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...)
+	session.flashKey = s.FlashKey
+	return session
+}
+
+// decodeCookie decodes the session ID from the cookie value and loads the
+// session file.
+func (s *FilesystemStore) decodeCookie(ctx context.Context, session *Session,
+	c *http.Cookie) error {
+	var value string
+	primary, err := decodeMultiPrimary(c.Name, c.Value, &value, s.Codecs...)
+	if err == nil {
+		session.needsReissue = !primary
+		id, gen := parseCookieID(value)
+		switch {
+		case gen < s.generation.Load():
+			err = errSessionGeneration
+		case !validSessionID(id):
+			err = ErrInvalidSessionID
+		default:
+			err = checkIssuedAt(session, c.Value, s.NotBefore)
+		}
 		if err == nil {
-			err = s.load(session)
-			if err == nil {
-				session.IsNew = false
-			}
+			session.ID = id
+			err = s.load(ctx, session)
 		}
 	}
-	return session, err
+	if err != nil {
+		s.recordDecodeFailure(session.Name(), "", err)
+		return err
+	}
+	if err = runHooks(s.afterLoad, session); err != nil {
+		session.ID = ""
+		session.Values = make(map[interface{}]interface{})
+		s.recordDecodeFailure(session.Name(), DecodeRejected, err)
+	}
+	return err
 }
 
-var base32RawStdEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
-
 // Save adds a single session to the response.
 //
 // If the Options.MaxAge of the session is <= 0 then the session file will be
@@ -217,30 +657,153 @@ var base32RawStdEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
 func (s *FilesystemStore) Save(r *http.Request, w http.ResponseWriter,
 	session *Session) error {
 	// Delete if max-age is <= 0
-	if session.Options.MaxAge <= 0 {
-		if err := s.erase(session); err != nil && !os.IsNotExist(err) {
+	if session.Options.maxAge(time.Now()) <= 0 {
+		if err := s.eraseAsync(requestContext(r), session.ID); err != nil {
 			return err
 		}
-		http.SetCookie(w, NewCookie(session.Name(), "", session.Options))
-		return nil
+		return setCookie(r, w, session.Name(), "", session.Options, &s.hooks)
 	}
 
+	if err := runHooks(s.beforeSave, session); err != nil {
+		return err
+	}
 	if session.ID == "" {
-		// Because the ID is used in the filename, encode it to
+		// Because the ID is used in the filename, it is encoded to
 		// use alphanumeric characters only.
-		session.ID = base32RawStdEncoding.EncodeToString(
-			securecookie.GenerateRandomKey(32))
+		id, err := generateEncodedID(s.Entropy, 32, s.IDEncoding)
+		if err != nil {
+			return err
+		}
+		session.ID = id
 	}
-	if err := s.save(session); err != nil {
+	if !validSessionID(session.ID) {
+		return ErrInvalidSessionID
+	}
+	if s.PersistOptions {
+		defer attachOptions(session)()
+	}
+	if err := s.save(requestContext(r), session); err != nil {
 		return err
 	}
-	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID,
-		s.Codecs...)
+	encoded, err := encodeMulti(session.Name(),
+		formatCookieID(session.ID, s.generation.Load()), s.Codecs...)
 	if err != nil {
 		return err
 	}
-	http.SetCookie(w, NewCookie(session.Name(), encoded, session.Options))
-	return nil
+	if err = setCookie(r, w, session.Name(), encoded, session.Options, &s.hooks); err != nil {
+		return err
+	}
+	session.needsReissue = false
+	return s.expireAlternates(r, w, session)
+}
+
+// expireAlternates expires cookies named after the alternate names of the
+// session, if ExpireAlternateNames is set.
+func (s *FilesystemStore) expireAlternates(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if !s.ExpireAlternateNames {
+		return nil
+	}
+	return expireAlternates(r, w, session.Name(), s.AlternateNames, session.Options, &s.hooks)
+}
+
+// Cookie saves session like Save and returns the cookie Save would set,
+// without writing it to a response, for frameworks managing headers
+// themselves. Options.DomainFunc is not applied, since there is no request.
+func (s *FilesystemStore) Cookie(session *Session) (*http.Cookie, error) {
+	return savedCookie(s, session)
+}
+
+// Delete removes the session file and its blobs, clears the session values
+// and ID, and expires the session cookie.
+func (s *FilesystemStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if session.ID != "" {
+		if err := s.eraseAsync(requestContext(r), session.ID); err != nil {
+			return err
+		}
+	}
+	session.ID = ""
+	session.Values = make(map[interface{}]interface{})
+	session.Options.MaxAge = -1
+	return setCookie(r, w, session.Name(), "", session.Options, &s.hooks)
+}
+
+// Touch refreshes the expiry of a session.
+//
+// For an existing session it updates the modification time of the session
+// file and re-issues the cookie holding the session ID, without encoding
+// session.Values. New or deleted sessions are handled by Save.
+func (s *FilesystemStore) Touch(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	if session.ID == "" || session.Options.MaxAge <= 0 {
+		return s.Save(r, w, session)
+	}
+	now := time.Now()
+	mu := s.lock(session.ID)
+	mu.Lock()
+	err := s.fsys.Chtimes(s.filename(session.ID), now, now)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = s.fsys.Chtimes(s.legacyFilename(session.ID), now, now)
+	}
+	mu.Unlock()
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return s.Save(r, w, session)
+		}
+		return err
+	}
+	encoded, err := encodeMulti(session.Name(),
+		formatCookieID(session.ID, s.generation.Load()), s.Codecs...)
+	if err != nil {
+		return err
+	}
+	if err = setCookie(r, w, session.Name(), encoded, session.Options, &s.hooks); err != nil {
+		return err
+	}
+	session.needsReissue = false
+	return s.expireAlternates(r, w, session)
+}
+
+// SetGeneration sets the key generation encoded with session IDs in
+// cookies. Sessions whose cookie carries an older generation are rejected,
+// so increasing it, for example when rotating keys, logs out all sessions
+// at once without touching the session files. Cookies issued before a
+// generation was set have generation 0.
+func (s *FilesystemStore) SetGeneration(gen int64) {
+	s.generation.Store(gen)
+}
+
+// BeforeSave registers fn to be called with each session before it is
+// saved. See CookieStore.BeforeSave().
+func (s *FilesystemStore) BeforeSave(fn func(*Session) error) {
+	s.beforeSave = append(s.beforeSave, fn)
+}
+
+// AfterLoad registers fn to be called with each session after it is
+// loaded. See CookieStore.AfterLoad().
+func (s *FilesystemStore) AfterLoad(fn func(*Session) error) {
+	s.afterLoad = append(s.afterLoad, fn)
+}
+
+// SetOptions atomically replaces the default options of the store with a
+// copy of opts, so configuration can change while requests are served.
+//
+// Sessions created afterwards use the new options; existing sessions keep
+// their own copy. Once SetOptions has been called the Options field is no
+// longer consulted. The maximum age of the underlying codecs is not
+// changed; see MaxAge().
+func (s *FilesystemStore) SetOptions(opts *Options) {
+	o := *opts
+	s.current.Store(&o)
+}
+
+// options returns the current default options.
+func (s *FilesystemStore) options() *Options {
+	if o := s.current.Load(); o != nil {
+		return o
+	}
+	return s.Options
 }
 
 // MaxAge sets the maximum age for the store and the underlying cookie
@@ -248,51 +811,152 @@ func (s *FilesystemStore) Save(r *http.Request, w http.ResponseWriter,
 // = -1 for that session.
 func (s *FilesystemStore) MaxAge(age int) {
 	s.Options.MaxAge = age
-
-	// Set the maxAge for each securecookie instance.
-	for _, codec := range s.Codecs {
-		if sc, ok := codec.(*securecookie.SecureCookie); ok {
-			sc.MaxAge(age)
-		}
+	if o := s.current.Load(); o != nil {
+		opts := *o
+		opts.MaxAge = age
+		s.current.Store(&opts)
 	}
+	setCodecsMaxAge(s.Codecs, age)
 }
 
 // save writes encoded session.Values to a file.
-func (s *FilesystemStore) save(session *Session) error {
-	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values,
+//
+// The file is replaced atomically, so concurrent readers never observe a
+// partially written session.
+//
+// The values are encoded synchronously; the file is written through Async.
+func (s *FilesystemStore) save(ctx context.Context, session *Session) error {
+	encoded, err := encodeMulti(session.Name(), session.Values,
+		s.Codecs...)
+	if err != nil {
+		return err
+	}
+	id := session.ID
+	err = s.Async.do(ctx, func(ctx context.Context) error {
+		mu := s.lock(id)
+		mu.Lock()
+		defer mu.Unlock()
+		return s.write(ctx, id, encoded)
+	})
+	if err != nil {
+		return err
+	}
+	session.backendSize = len(encoded)
+	return nil
+}
+
+// saveLocked is like save but writes the file synchronously and must be
+// called with the lock of the session held.
+func (s *FilesystemStore) saveLocked(ctx context.Context, session *Session) error {
+	encoded, err := encodeMulti(session.Name(), session.Values,
 		s.Codecs...)
 	if err != nil {
 		return err
 	}
-	filename := filepath.Join(s.path, sessionFilePrefix+filepath.Base(session.ID))
-	fileMutex.Lock()
-	defer fileMutex.Unlock()
-	return os.WriteFile(filename, []byte(encoded), 0600)
+	if err = s.write(ctx, session.ID, encoded); err != nil {
+		return err
+	}
+	session.backendSize = len(encoded)
+	return nil
+}
+
+// write replaces the file of the session with the given ID. It must be
+// called with the lock of the session held.
+func (s *FilesystemStore) write(ctx context.Context, id, encoded string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := s.fsys.WriteFile(s.filename(id), contextReader{ctx, strings.NewReader(encoded)})
+	if err != nil {
+		return err
+	}
+	if s.shards > 0 {
+		_ = s.fsys.Remove(s.legacyFilename(id))
+	}
+	return nil
 }
 
 // load reads a file and decodes its content into session.Values.
-func (s *FilesystemStore) load(session *Session) error {
-	filename := filepath.Join(s.path, sessionFilePrefix+filepath.Base(session.ID))
-	fileMutex.RLock()
-	defer fileMutex.RUnlock()
-	fdata, err := os.ReadFile(filepath.Clean(filename))
+//
+// The session expires when the file was not modified within MaxAge, so
+// that Touch extends its lifetime without re-encoding the values.
+func (s *FilesystemStore) load(ctx context.Context, session *Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f, err := s.openFile(session.ID)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
 	if err != nil {
 		return err
 	}
-	if err = securecookie.DecodeMulti(session.Name(), string(fdata),
-		&session.Values, s.Codecs...); err != nil {
+	if maxAge := s.options().MaxAge; maxAge > 0 &&
+		time.Since(info.ModTime()) > maxAgeDuration(maxAge) {
+		return errSessionFileExpired
+	}
+	fdata, err := io.ReadAll(contextReader{ctx, f})
+	if err != nil {
 		return err
 	}
+	// Files are encoded with the session name, which may be a former one.
+	codecs := withoutMaxAge(s.Codecs)
+	err = decodeMulti(session.Name(), string(fdata), &session.Values, codecs...)
+	for _, alt := range s.AlternateNames[session.Name()] {
+		if err == nil {
+			break
+		}
+		if decodeMulti(alt, string(fdata), &session.Values, codecs...) == nil {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	session.backendSize = len(fdata)
+	restoreOptions(session)
+	afterDecode(session)
 	return nil
 }
 
-// delete session file
-func (s *FilesystemStore) erase(session *Session) error {
-	filename := filepath.Join(s.path, sessionFilePrefix+filepath.Base(session.ID))
+// eraseAsync erases the session with the given ID through Async, ignoring
+// sessions without a file.
+func (s *FilesystemStore) eraseAsync(ctx context.Context, id string) error {
+	return s.Async.do(ctx, func(ctx context.Context) error {
+		err := s.erase(ctx, &Session{ID: id})
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil
+		}
+		return err
+	})
+}
 
-	fileMutex.RLock()
-	defer fileMutex.RUnlock()
+// erase removes the file and blobs of a session under the lock of its ID,
+// so it doesn't interleave with a concurrent save. It returns an error
+// wrapping ErrSessionNotFound and fs.ErrNotExist if the session has no
+// file, and other errors as is.
+func (s *FilesystemStore) erase(ctx context.Context, session *Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if session.ID == "" {
+		return ErrSessionNotFound
+	}
+	mu := s.lock(session.ID)
+	mu.Lock()
+	defer mu.Unlock()
 
-	err := os.Remove(filename)
+	err := s.fsys.Remove(s.filename(session.ID))
+	if errors.Is(err, fs.ErrNotExist) && s.shards > 0 {
+		err = s.fsys.Remove(s.legacyFilename(session.ID))
+	}
+	if rerr := s.removeBlobs(session.ID); err == nil {
+		err = rerr
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %w", ErrSessionNotFound, err)
+	}
 	return err
 }
@@ -6,9 +6,14 @@ package sessions
 
 import (
 	"encoding/base64"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 // Test for GH-8 for CookieStore
@@ -131,3 +136,278 @@ func TestGH8FilesystemStoreDelete2(t *testing.T) {
 		t.Fatal("failed to delete session", err)
 	}
 }
+
+func TestDestroy(t *testing.T) {
+	fs := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	for _, store := range []Store{NewCookieStore([]byte("some key")), fs} {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		session, err := store.New(req, "hello")
+		if err != nil {
+			t.Fatal("failed to create session", err)
+		}
+		session.Values["foo"] = "bar"
+		if err = session.Save(req, httptest.NewRecorder()); err != nil {
+			t.Fatal("failed to save session", err)
+		}
+		id := session.ID
+
+		w := httptest.NewRecorder()
+		if err = Destroy(req, w, session); err != nil {
+			t.Fatal("failed to destroy session", err)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].MaxAge >= 0 || len(session.Values) != 0 {
+			t.Fatalf("bad destroyed session: %v, %v", cookies, session.Values)
+		}
+		if id != "" {
+			if _, err = os.Stat(fs.osPath(fs.filename(id))); !os.IsNotExist(err) {
+				t.Fatalf("expected session file to be deleted: %v", err)
+			}
+		}
+	}
+}
+
+func TestFilesystemStoreGeneration(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	load := func(value string) (*Session, error) {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(&http.Cookie{Name: "s", Value: value})
+		return store.New(req, "s")
+	}
+	rejected := func(value string) bool {
+		session, err := load(value)
+		return err != nil && session.IsNew && session.ID == ""
+	}
+
+	legacy := encodeCookie(t, store, "s", "legacy")
+	if rejected(legacy) {
+		t.Fatal("failed to load session")
+	}
+	store.SetGeneration(1)
+	current := encodeCookie(t, store, "s", "current")
+	if !rejected(legacy) || rejected(current) {
+		t.Fatal("expected only sessions of generation 0 to be rejected")
+	}
+	store.SetGeneration(2)
+	if !rejected(current) {
+		t.Fatal("expected sessions of generation 1 to be rejected")
+	}
+}
+
+func TestStoreHooks(t *testing.T) {
+	cs := NewCookieStore([]byte("some key"))
+	fs := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	for _, store := range []interface {
+		Store
+		BeforeSave(func(*Session) error)
+		AfterLoad(func(*Session) error)
+	}{cs, fs} {
+		store.BeforeSave(func(s *Session) error {
+			for k, v := range s.Values {
+				if v == nil {
+					delete(s.Values, k)
+				}
+			}
+			return nil
+		})
+		store.AfterLoad(func(s *Session) error {
+			if _, ok := s.Values["theme"]; !ok {
+				s.Values["theme"] = "light"
+			}
+			if s.Values["banned"] == true {
+				return errors.New("banned")
+			}
+			return nil
+		})
+
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		w := httptest.NewRecorder()
+		session, _ := store.New(req, "s")
+		session.Values["empty"] = nil
+		if err := session.Save(req, w); err != nil {
+			t.Fatal("failed to save session", err)
+		}
+		req.AddCookie(w.Result().Cookies()[0])
+		session, err := store.New(req, "s")
+		if err != nil || len(session.Values) != 1 || session.Values["theme"] != "light" {
+			t.Fatalf("bad loaded session: %v, %v", session.Values, err)
+		}
+
+		session.Values["banned"] = true
+		w = httptest.NewRecorder()
+		if err = session.Save(req, w); err != nil {
+			t.Fatal("failed to save session", err)
+		}
+		req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(w.Result().Cookies()[0])
+		session, err = store.New(req, "s")
+		if err == nil || !session.IsNew || len(session.Values) != 0 {
+			t.Fatalf("expected the session to be rejected: %v, %v", session.Values, err)
+		}
+	}
+}
+
+func TestFilesystemStoreTouch(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+
+	session, err := store.New(req, "hello")
+	if err != nil {
+		t.Fatal("failed to create session", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+
+	filename := store.osPath(store.filename(session.ID))
+	past := time.Now().Add(-time.Hour)
+	if err = os.Chtimes(filename, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	// Touch must not write values.
+	session.Values["foo"] = "baz"
+	w = httptest.NewRecorder()
+	if err = session.Touch(req, w); err != nil {
+		t.Fatal("failed to touch session", err)
+	}
+	if len(w.Result().Cookies()) != 1 {
+		t.Fatal("expected a cookie")
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().After(past) {
+		t.Fatalf("modification time not updated: %v", info.ModTime())
+	}
+
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.Header.Add("Cookie", w.Header().Get("Set-Cookie"))
+	session, err = store.New(req, "hello")
+	if err != nil {
+		t.Fatal("failed to load session", err)
+	}
+	if session.Values["foo"] != "bar" {
+		t.Fatalf("bad value: got %v, want %v", session.Values["foo"], "bar")
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	store := NewCookieStore([]byte("secret-key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			store.SetOptions(&Options{Path: "/", SameSite: http.SameSiteStrictMode})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := store.New(req, "s"); err != nil {
+			t.Fatal("failed to create session", err)
+		}
+	}
+	<-done
+
+	opts := &Options{Path: "/app", SameSite: http.SameSiteStrictMode}
+	store.SetOptions(opts)
+	opts.Path = "/changed"
+	store.MaxAge(60)
+	session, _ := store.New(req, "s")
+	if session.Options.Path != "/app" || session.Options.MaxAge != 60 ||
+		session.Options.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("bad session options: %+v", session.Options)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("no entropy")
+}
+
+func TestFilesystemStoreNoEntropy(t *testing.T) {
+	store := NewFilesystemStoreWithOptions(t.TempDir(),
+		WithKeyPairs([]byte("some key")), WithEntropy(failingReader{}))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	session, err := store.New(req, "hello")
+	if err != nil {
+		t.Fatal("failed to create session", err)
+	}
+	if err = session.Save(req, w); !errors.Is(err, ErrNoEntropy) {
+		t.Fatalf("expected ErrNoEntropy, got %v", err)
+	}
+	if session.ID != "" || len(w.Header()["Set-Cookie"]) != 0 {
+		t.Fatalf("expected no session to be saved: %q, %v", session.ID, w.Header())
+	}
+
+	store.Entropy = strings.NewReader(strings.Repeat("x", 32))
+	if err = session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if want := base32RawStdEncoding.EncodeToString([]byte(strings.Repeat("x", 32))); session.ID != want {
+		t.Fatalf("bad session ID: got %q, want %q", session.ID, want)
+	}
+}
+
+func TestFilesystemStoreEraseConcurrent(t *testing.T) {
+	store := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	if err := session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+
+	const n = 8
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			errs <- store.erase(req.Context(), &Session{ID: session.ID})
+		}()
+	}
+	removed := 0
+	for i := 0; i < n; i++ {
+		switch err := <-errs; {
+		case err == nil:
+			removed++
+		case !errors.Is(err, ErrSessionNotFound) || !errors.Is(err, os.ErrNotExist):
+			t.Fatal("unexpected error erasing session", err)
+		}
+	}
+	if removed != 1 {
+		t.Fatalf("expected the file to be removed once, got %d", removed)
+	}
+
+	// Deleting a session that is already gone is not an error.
+	if err := store.Delete(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+}
+
+// failingRemoveFS is a memFS whose Remove fails with an I/O error.
+type failingRemoveFS struct {
+	*memFS
+}
+
+func (failingRemoveFS) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: errors.New("input/output error")}
+}
+
+func TestFilesystemStoreDeleteError(t *testing.T) {
+	fsys := failingRemoveFS{&memFS{files: make(map[string]*fstest.MapFile)}}
+	store := NewFilesystemStoreWithOptions("", WithKeyPairs([]byte("some key")), WithFS(fsys))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	if err := session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	err := store.Delete(req, httptest.NewRecorder(), session)
+	if err == nil || errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected the I/O error, got %v", err)
+	}
+}
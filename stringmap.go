@@ -0,0 +1,171 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedValue is returned by FlattenValues and StringMapSerializer
+// for keys or values that can't be represented as strings.
+var ErrUnsupportedValue = errors.New("sessions: value not supported in a string map")
+
+// FlattenValues converts session values to a map of strings, for backends
+// and consumers in other languages that only handle string pairs, such as
+// Redis hashes or PHP.
+//
+// Keys must be strings. Each value is written as its type, a colon and the
+// value, for example "string:gopher", "int64:42" or "bool:true", so
+// UnflattenValues restores it with its type. Supported types are the Go
+// string, boolean and numeric types, []byte ("bytes:" followed by base64)
+// and time.Time ("time:" followed by RFC 3339). Other values, such as
+// flashes or the maps kept by Elevate, fail with ErrUnsupportedValue.
+func FlattenValues(values map[interface{}]interface{}) (map[string]string, error) {
+	flat := make(map[string]string, len(values))
+	for k, v := range values {
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: key of type %T", ErrUnsupportedValue, k)
+		}
+		s, err := flattenValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: value of type %T for key %q", ErrUnsupportedValue, v, key)
+		}
+		flat[key] = s
+	}
+	return flat, nil
+}
+
+// UnflattenValues converts a map written by FlattenValues back to session
+// values.
+func UnflattenValues(flat map[string]string) (map[interface{}]interface{}, error) {
+	values := make(map[interface{}]interface{}, len(flat))
+	for k, s := range flat {
+		v, err := unflattenValue(s)
+		if err != nil {
+			return nil, fmt.Errorf("sessions: decoding value for key %q: %w", k, err)
+		}
+		values[k] = v
+	}
+	return values, nil
+}
+
+// StringMapSerializer is a securecookie.Serializer encoding session values
+// with FlattenValues, as a JSON object of strings. Stores using it hold
+// data that other languages can read without knowing Go types.
+//
+// Other values, such as the session IDs encoded in the cookies of
+// server-side stores, must be strings, and are encoded as JSON strings.
+type StringMapSerializer struct{}
+
+// Serialize encodes src, session values or a string, as JSON.
+func (StringMapSerializer) Serialize(src interface{}) ([]byte, error) {
+	switch v := src.(type) {
+	case map[interface{}]interface{}:
+		flat, err := FlattenValues(v)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(flat)
+	case string:
+		return json.Marshal(v)
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedValue, src)
+}
+
+// Deserialize decodes JSON written by Serialize into dst, which must be a
+// *map[interface{}]interface{} or a *string.
+func (StringMapSerializer) Deserialize(src []byte, dst interface{}) error {
+	switch d := dst.(type) {
+	case *map[interface{}]interface{}:
+		var flat map[string]string
+		if err := json.Unmarshal(src, &flat); err != nil {
+			return err
+		}
+		values, err := UnflattenValues(flat)
+		if err != nil {
+			return err
+		}
+		*d = values
+		return nil
+	case *string:
+		return json.Unmarshal(src, d)
+	}
+	return fmt.Errorf("sessions: cannot deserialize into %T", dst)
+}
+
+// flattenValue returns the string form of v.
+func flattenValue(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case []byte:
+		return "bytes:" + base64.StdEncoding.EncodeToString(x), nil
+	case time.Time:
+		return "time:" + x.Format(time.RFC3339Nano), nil
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || rv.Type().PkgPath() != "" {
+		return "", ErrUnsupportedValue
+	}
+	kind := rv.Kind()
+	var s string
+	switch kind {
+	case reflect.String:
+		s = rv.String()
+	case reflect.Bool:
+		s = strconv.FormatBool(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		s = strconv.FormatFloat(rv.Float(), 'g', -1, rv.Type().Bits())
+	default:
+		return "", ErrUnsupportedValue
+	}
+	return kind.String() + ":" + s, nil
+}
+
+// unflattenValue parses a string written by flattenValue.
+func unflattenValue(s string) (interface{}, error) {
+	tag, v, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("missing type in %q", s)
+	}
+	switch tag {
+	case "string":
+		return v, nil
+	case "bool":
+		return strconv.ParseBool(v)
+	case "bytes":
+		return base64.StdEncoding.DecodeString(v)
+	case "time":
+		return time.Parse(time.RFC3339Nano, v)
+	case "float32":
+		f, err := strconv.ParseFloat(v, 32)
+		return float32(f), err
+	case "float64":
+		return strconv.ParseFloat(v, 64)
+	}
+	for _, t := range []interface{}{int(0), int8(0), int16(0), int32(0), int64(0)} {
+		if rt := reflect.TypeOf(t); tag == rt.Kind().String() {
+			i, err := strconv.ParseInt(v, 10, rt.Bits())
+			return reflect.ValueOf(i).Convert(rt).Interface(), err
+		}
+	}
+	for _, t := range []interface{}{uint(0), uint8(0), uint16(0), uint32(0), uint64(0)} {
+		if rt := reflect.TypeOf(t); tag == rt.Kind().String() {
+			u, err := strconv.ParseUint(v, 10, rt.Bits())
+			return reflect.ValueOf(u).Convert(rt).Interface(), err
+		}
+	}
+	return nil, fmt.Errorf("unknown type %q", tag)
+}
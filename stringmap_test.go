@@ -0,0 +1,76 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFlattenValues(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 5, time.UTC)
+	values := map[interface{}]interface{}{
+		"name":  "gopher",
+		"admin": true,
+		"id":    int64(42),
+		"age":   7,
+		"score": 1.5,
+		"small": uint8(3),
+		"raw":   []byte{1, 2, 3},
+		"seen":  now,
+	}
+	flat, err := FlattenValues(values)
+	if err != nil {
+		t.Fatal("failed to flatten values", err)
+	}
+	if flat["name"] != "string:gopher" || flat["id"] != "int64:42" || flat["admin"] != "bool:true" {
+		t.Fatalf("bad flat values: %v", flat)
+	}
+	got, err := UnflattenValues(flat)
+	if err != nil {
+		t.Fatal("failed to unflatten values", err)
+	}
+	for k, v := range values {
+		if b, ok := v.([]byte); ok {
+			if !bytes.Equal(got[k].([]byte), b) {
+				t.Fatalf("bad value for %v: %v", k, got[k])
+			}
+			continue
+		}
+		if got[k] != v {
+			t.Fatalf("bad value for %v: %#v, expected %#v", k, got[k], v)
+		}
+	}
+
+	for _, bad := range []map[interface{}]interface{}{
+		{1: "non-string key"},
+		{"nested": map[string]int{}},
+		{"flashes": []interface{}{"hello"}},
+	} {
+		if _, err := FlattenValues(bad); !errors.Is(err, ErrUnsupportedValue) {
+			t.Fatalf("expected ErrUnsupportedValue for %v, got %v", bad, err)
+		}
+	}
+}
+
+func TestStringMapSerializer(t *testing.T) {
+	store := NewFilesystemStoreWithOptions(t.TempDir(),
+		WithKeyPairs([]byte("some key")), WithSerializer(StringMapSerializer{}))
+	cookie := encodeCookie(t, store, "s", "gopher")
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+	session, err := store.New(req, "s")
+	if err != nil || session.Values["user"] != "gopher" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+	session.AddFlash("hello")
+	if err = session.Save(req, httptest.NewRecorder()); !errors.Is(err, ErrUnsupportedValue) {
+		t.Fatalf("expected ErrUnsupportedValue, got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrEntityNotFound is returned by TableClient.GetEntity when there is no
+// entity with the given keys.
+var ErrEntityNotFound = errors.New("sessions: entity not found")
+
+// TableClient is an Azure Table Storage table used by TableStore. Its
+// methods follow those of aztables.Client, so an adapter mostly translates
+// errors, for example:
+//
+//	type table struct{ c *aztables.Client }
+//
+//	func (t table) GetEntity(ctx context.Context, partitionKey, rowKey string) ([]byte, error) {
+//		resp, err := t.c.GetEntity(ctx, partitionKey, rowKey, nil)
+//		var re *azcore.ResponseError
+//		if errors.As(err, &re) && re.StatusCode == http.StatusNotFound {
+//			return nil, sessions.ErrEntityNotFound
+//		}
+//		return resp.Value, err
+//	}
+//
+//	func (t table) UpsertEntity(ctx context.Context, entity []byte) error {
+//		_, err := t.c.UpsertEntity(ctx, entity, nil)
+//		return err
+//	}
+//
+//	func (t table) DeleteEntity(ctx context.Context, partitionKey, rowKey string) error {
+//		_, err := t.c.DeleteEntity(ctx, partitionKey, rowKey, nil)
+//		var re *azcore.ResponseError
+//		if errors.As(err, &re) && re.StatusCode == http.StatusNotFound {
+//			return nil
+//		}
+//		return err
+//	}
+//
+//	func (t table) ListEntities(ctx context.Context, before time.Time,
+//		fn func(partitionKey, rowKey string, modified time.Time) error) error {
+//		filter := "Timestamp lt datetime'" + before.UTC().Format(time.RFC3339) + "'"
+//		sel := "PartitionKey,RowKey,Timestamp"
+//		pager := t.c.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+//			Filter: &filter,
+//			Select: &sel,
+//		})
+//		for pager.More() {
+//			page, err := pager.NextPage(ctx)
+//			if err != nil {
+//				return err
+//			}
+//			for _, data := range page.Entities {
+//				var e struct {
+//					PartitionKey, RowKey string
+//					Timestamp            time.Time
+//				}
+//				if err = json.Unmarshal(data, &e); err != nil {
+//					return err
+//				}
+//				if err = fn(e.PartitionKey, e.RowKey, e.Timestamp); err != nil {
+//					return err
+//				}
+//			}
+//		}
+//		return nil
+//	}
+//
+// This package doesn't depend on the Azure SDK: creating and authenticating
+// the client is left to the application, for example with the azidentity
+// credential chain:
+//
+//	cred, err := azidentity.NewDefaultAzureCredential(nil)
+//	client, err := aztables.NewClient(tableURL, cred, nil)
+type TableClient interface {
+	// GetEntity returns the JSON entity with the given keys, or an error
+	// wrapping ErrEntityNotFound.
+	GetEntity(ctx context.Context, partitionKey, rowKey string) ([]byte, error)
+	// UpsertEntity creates or replaces a JSON entity.
+	UpsertEntity(ctx context.Context, entity []byte) error
+	// DeleteEntity deletes the entity with the given keys. Deleting an
+	// entity that doesn't exist is not an error.
+	DeleteEntity(ctx context.Context, partitionKey, rowKey string) error
+	// ListEntities calls fn with the keys and the Timestamp of each entity
+	// last modified before the given time, stopping at the first error.
+	ListEntities(ctx context.Context, before time.Time,
+		fn func(partitionKey, rowKey string, modified time.Time) error) error
+}
+
+// tableEntity is the entity of a session in a table.
+type tableEntity struct {
+	PartitionKey string
+	RowKey       string
+	Data         string
+}
+
+// NewTableStore returns a new TableStore keeping sessions in table.
+//
+// See NewCookieStore() for a description of the other parameters.
+func NewTableStore(table TableClient, keyPairs ...[]byte) *TableStore {
+	return NewTableStoreWithOptions(table, WithKeyPairs(keyPairs...))
+}
+
+// NewTableStoreWithOptions returns a new TableStore keeping sessions in
+// table, configured by opts.
+//
+// Options not set default to the values used by NewTableStore().
+func NewTableStoreWithOptions(table TableClient, opts ...StoreOption) *TableStore {
+	s := &TableStore{Table: table}
+	s.backendStore = newBackendStore(s, newBackendConfig(opts))
+	return s
+}
+
+// TableStore stores sessions in an Azure Table Storage table, one entity
+// per session, partitioned by session ID.
+//
+// The encoded values carry the time they were saved, so sessions expire
+// after MaxAge even if their entity remains. Table Storage has no time to
+// live, so the entities of expired sessions are deleted by GC, which
+// applications should call periodically.
+type TableStore struct {
+	// backendStore provides Codecs, Options, Entropy, PersistOptions,
+	// FlashKey and the Store methods.
+	backendStore
+	Table TableClient
+}
+
+// saveSession writes the entity of a session.
+func (s *TableStore) saveSession(ctx context.Context, session *Session, maxAge int) error {
+	encoded, err := s.encodeValues(session)
+	if err != nil {
+		return err
+	}
+	entity, err := json.Marshal(tableEntity{PartitionKey: session.ID, Data: encoded})
+	if err != nil {
+		return err
+	}
+	if err = s.Table.UpsertEntity(ctx, entity); err != nil {
+		return err
+	}
+	session.backendSize = len(encoded)
+	return nil
+}
+
+// deleteSession deletes the entity of a session.
+func (s *TableStore) deleteSession(ctx context.Context, id string) error {
+	return s.Table.DeleteEntity(ctx, id, "")
+}
+
+// loadSession reads the entity of a session and decodes it into
+// session.Values.
+func (s *TableStore) loadSession(ctx context.Context, session *Session) error {
+	data, err := s.Table.GetEntity(ctx, session.ID, "")
+	if err != nil {
+		return err
+	}
+	var entity tableEntity
+	if err = json.Unmarshal(data, &entity); err != nil {
+		return err
+	}
+	return s.decodeValues(session, entity.Data)
+}
+
+// GC deletes the entities not modified within the store MaxAge. It returns
+// the number of deleted sessions.
+func (s *TableStore) GC(ctx context.Context) (int, error) {
+	report, err := s.RunGC(ctx, GCOptions{})
+	return report.Deleted, err
+}
+
+// RunGC is like GC but returns a report of the run, and can run without
+// deleting anything. Scanned counts the expired entities listed. Entities
+// that fail to be deleted are counted, and the first error is returned
+// once all entities have been listed.
+//
+// A session saved between the listing of its entity and the deletion is
+// deleted too, as if it had expired.
+func (s *TableStore) RunGC(ctx context.Context, opts GCOptions) (*GCReport, error) {
+	report := newGCReport(opts)
+	maxAge := s.Options.MaxAge
+	if maxAge <= 0 {
+		return report, nil
+	}
+	now := time.Now()
+	var first error
+	err := s.Table.ListEntities(ctx, now.Add(-maxAgeDuration(maxAge)),
+		func(partitionKey, rowKey string, modified time.Time) error {
+			report.Scanned++
+			if !opts.DryRun {
+				if err := s.Table.DeleteEntity(ctx, partitionKey, rowKey); err != nil {
+					report.Failed++
+					if first == nil {
+						first = err
+					}
+					return nil
+				}
+			}
+			report.Deleted++
+			report.observe(now.Sub(modified))
+			return nil
+		})
+	if err == nil {
+		err = first
+	}
+	return report, err
+}
@@ -0,0 +1,137 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memTable is an in-memory TableClient.
+type memTable struct {
+	mu       sync.Mutex
+	entities map[[2]string][]byte
+	modified map[[2]string]time.Time
+}
+
+func (t *memTable) GetEntity(ctx context.Context, partitionKey, rowKey string) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entity, ok := t.entities[[2]string{partitionKey, rowKey}]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrEntityNotFound, partitionKey)
+	}
+	return entity, nil
+}
+
+func (t *memTable) UpsertEntity(ctx context.Context, entity []byte) error {
+	var keys struct{ PartitionKey, RowKey string }
+	if err := json.Unmarshal(entity, &keys); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.modified == nil {
+		t.modified = make(map[[2]string]time.Time)
+	}
+	t.entities[[2]string{keys.PartitionKey, keys.RowKey}] = entity
+	t.modified[[2]string{keys.PartitionKey, keys.RowKey}] = time.Now()
+	return nil
+}
+
+func (t *memTable) DeleteEntity(ctx context.Context, partitionKey, rowKey string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entities, [2]string{partitionKey, rowKey})
+	delete(t.modified, [2]string{partitionKey, rowKey})
+	return nil
+}
+
+func (t *memTable) ListEntities(ctx context.Context, before time.Time,
+	fn func(partitionKey, rowKey string, modified time.Time) error) error {
+	t.mu.Lock()
+	listed := make(map[[2]string]time.Time)
+	for k := range t.entities {
+		if t.modified[k].Before(before) {
+			listed[k] = t.modified[k]
+		}
+	}
+	t.mu.Unlock()
+	for k, modified := range listed {
+		if err := fn(k[0], k[1], modified); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestTableStore(t *testing.T) {
+	table := &memTable{entities: make(map[[2]string][]byte)}
+	store := NewTableStore(table, []byte("some key"))
+	cookie := encodeCookie(t, store, "s", "gopher")
+	if len(table.entities) != 1 {
+		t.Fatalf("bad entities: %v", table.entities)
+	}
+	for keys := range table.entities {
+		if keys[0] == "" || keys[1] != "" {
+			t.Fatalf("bad entity keys: %q", keys)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+	session, err := store.Get(req, "s")
+	if err != nil || session.IsNew || session.Values["user"] != "gopher" {
+		t.Fatalf("bad session: %v, %v", session.Values, err)
+	}
+
+	session.Options.MaxAge = -1
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+	if len(table.entities) != 0 {
+		t.Fatalf("expected the entity to be deleted: %v", table.entities)
+	}
+	session, err = store.New(req, "s")
+	if err == nil || !session.IsNew {
+		t.Fatalf("expected a new session and an error: %v, %v", session.Values, err)
+	}
+}
+
+func TestTableStoreGC(t *testing.T) {
+	table := &memTable{entities: make(map[[2]string][]byte)}
+	store := NewTableStore(table, []byte("some key"))
+	store.MaxAge(60)
+	encodeCookie(t, store, "s", "expired")
+	encodeCookie(t, store, "s", "expired")
+	for k := range table.entities {
+		table.modified[k] = time.Now().Add(-2 * time.Hour)
+	}
+	encodeCookie(t, store, "s", "fresh")
+
+	report, err := store.RunGC(context.Background(), GCOptions{
+		DryRun:     true,
+		AgeBuckets: []time.Duration{time.Hour},
+	})
+	if err != nil || report.Scanned != 2 || report.Deleted != 2 || report.AgeCounts[1] != 2 {
+		t.Fatalf("bad report: %+v, %v", report, err)
+	}
+	if len(table.entities) != 3 {
+		t.Fatalf("expected a dry run to keep the entities: %v", table.entities)
+	}
+	n, err := store.GC(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("bad number of deleted sessions: %d, %v", n, err)
+	}
+	if len(table.entities) != 1 {
+		t.Fatalf("expected the expired entities to be deleted: %v", table.entities)
+	}
+}
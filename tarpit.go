@@ -0,0 +1,161 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RemoteIP returns the IP address of the client of r, from RemoteAddr. It
+// is the default keyer of TarpitStore; applications behind a proxy should
+// use a keyer reading the address set by the proxy.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// NewTarpitStore returns a TarpitStore wrapping store with the default
+// settings.
+func NewTarpitStore(store Store) *TarpitStore {
+	return &TarpitStore{
+		Store:   store,
+		Keyer:   RemoteIP,
+		Burst:   5,
+		Refill:  time.Minute,
+		Delay:   time.Second,
+		MaxKeys: 10000,
+	}
+}
+
+// TarpitStore wraps a Store and slows down clients that repeatedly send
+// cookies failing to decode, to hinder brute-force attempts against the
+// keys.
+//
+// Failures are counted per client, as identified by Keyer, with a token
+// bucket: each client may fail Burst times, and regains one failure every
+// Refill. Beyond that, each failing request is delayed by a random
+// duration up to Delay before New returns. Counters are kept in memory,
+// so each instance of an application counts its own failures.
+type TarpitStore struct {
+	Store Store
+	// Keyer identifies the client of a request. If nil, RemoteIP is used.
+	Keyer func(r *http.Request) string
+	// Burst is the number of failures allowed before requests are delayed.
+	Burst int
+	// Refill is the time after which one more failure is allowed.
+	Refill time.Duration
+	// Delay is the maximum delay of a failing request.
+	Delay time.Duration
+	// MaxKeys bounds the number of clients tracked. If zero, there is no
+	// bound.
+	MaxKeys int
+
+	mu      sync.Mutex
+	buckets map[string]*tarpitBucket
+}
+
+// tarpitBucket counts the failures allowed to a client.
+type tarpitBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *TarpitStore) Get(r *http.Request, name string) (*Session, error) {
+	return GetRegistry(r).Get(s, name)
+}
+
+// Unwrap returns the wrapped store.
+func (s *TarpitStore) Unwrap() Store {
+	return s.Store
+}
+
+// New returns a session for the given name without adding it to the
+// registry. If the session cookie fails to decode and the client exceeded
+// its failures, New is delayed, or until the request is canceled.
+func (s *TarpitStore) New(r *http.Request, name string) (*Session, error) {
+	session, err := s.Store.New(r, name)
+	if session != nil {
+		session.store = s
+	}
+	if err != nil && s.fail(r) {
+		d := time.Duration(rand.Int64N(int64(s.Delay) + 1))
+		_ = sleepUntil(r.Context(), time.Now().Add(d))
+	}
+	return session, err
+}
+
+// Save saves the session in the wrapped store.
+func (s *TarpitStore) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	return s.Store.Save(r, w, session)
+}
+
+// Delete deletes the session from the wrapped store.
+func (s *TarpitStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	return deleteSession(s.Store, r, w, session)
+}
+
+// fail records a failure for the client of r and reports whether it must
+// be delayed.
+func (s *TarpitStore) fail(r *http.Request) bool {
+	keyer := s.Keyer
+	if keyer == nil {
+		keyer = RemoteIP
+	}
+	key := keyer(r)
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets == nil {
+		s.buckets = make(map[string]*tarpitBucket)
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		if s.MaxKeys > 0 && len(s.buckets) >= s.MaxKeys {
+			s.prune(now)
+		}
+		b = &tarpitBucket{tokens: float64(s.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	s.refill(b, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return false
+	}
+	return true
+}
+
+// refill adds the failures regained by a client since its last update.
+func (s *TarpitStore) refill(b *tarpitBucket, now time.Time) {
+	if s.Refill > 0 {
+		b.tokens += float64(now.Sub(b.updated)) / float64(s.Refill)
+	}
+	if b.tokens > float64(s.Burst) {
+		b.tokens = float64(s.Burst)
+	}
+	b.updated = now
+}
+
+// prune forgets clients whose bucket is full again, or all clients if none
+// is.
+func (s *TarpitStore) prune(now time.Time) {
+	for key, b := range s.buckets {
+		if s.refill(b, now); b.tokens >= float64(s.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+	if len(s.buckets) >= s.MaxKeys {
+		s.buckets = make(map[string]*tarpitBucket)
+	}
+}
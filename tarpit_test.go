@@ -0,0 +1,50 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTarpitStore(t *testing.T) {
+	store := NewTarpitStore(NewCookieStore([]byte("secret-key")))
+	store.Burst = 2
+	store.Delay = 50 * time.Millisecond
+	store.Refill = time.Hour
+
+	attempt := func(addr string) time.Duration {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.RemoteAddr = addr
+		req.AddCookie(&http.Cookie{Name: "s", Value: "forged"})
+		start := time.Now()
+		if _, err := store.New(req, "s"); err == nil {
+			t.Fatal("expected a decoding error")
+		}
+		return time.Since(start)
+	}
+	for i := 0; i < 2; i++ {
+		if d := attempt("192.0.2.1:1234"); d >= store.Delay {
+			t.Fatalf("expected no delay within the burst, got %v", d)
+		}
+	}
+	var total time.Duration
+	for i := 0; i < 5; i++ {
+		total += attempt("192.0.2.1:1234")
+	}
+	if total == 0 {
+		t.Fatal("expected failing requests to be delayed")
+	}
+	if d := attempt("198.51.100.7:1234"); d >= store.Delay {
+		t.Fatalf("expected other clients not to be delayed, got %v", d)
+	}
+
+	store.MaxKeys = 1
+	attempt("203.0.113.9:1234")
+	if n := len(store.buckets); n != 1 {
+		t.Fatalf("expected a single tracked client, got %d", n)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/securecookie"
+)
+
+// DecodeFailureReason classifies why a session cookie could not be decoded.
+type DecodeFailureReason string
+
+// Decode failure reasons.
+const (
+	// DecodeInvalidMAC means the signature didn't verify: the cookie was
+	// tampered with or signed with another key. A wave of these after a
+	// deployment usually points to a key mismatch.
+	DecodeInvalidMAC DecodeFailureReason = "invalid_mac"
+	// DecodeExpired means the cookie timestamp is out of range.
+	DecodeExpired DecodeFailureReason = "expired"
+	// DecodeDecryptFailed means the cookie could not be decrypted.
+	DecodeDecryptFailed DecodeFailureReason = "decrypt_failed"
+	// DecodeMalformed means the cookie is not a valid encoded value.
+	DecodeMalformed DecodeFailureReason = "malformed"
+	// DecodeDeserialize means the values could not be deserialized, for
+	// example because of decode limits or unregistered types.
+	DecodeDeserialize DecodeFailureReason = "deserialize"
+	// DecodeNotFound means the server-side data of the session is gone.
+	DecodeNotFound DecodeFailureReason = "not_found"
+	// DecodeRevoked means the session was revoked, for example by a
+	// generation bump.
+	DecodeRevoked DecodeFailureReason = "revoked"
+	// DecodeRejected means an AfterLoad hook rejected the session.
+	DecodeRejected DecodeFailureReason = "rejected"
+	// DecodeOther is any other failure.
+	DecodeOther DecodeFailureReason = "other"
+)
+
+// DecodeFailure describes a session that could not be decoded.
+type DecodeFailure struct {
+	Name   string
+	Reason DecodeFailureReason
+	Err    error
+}
+
+// classifyDecodeError returns the reason of a decoding error.
+func classifyDecodeError(err error) DecodeFailureReason {
+	var errs []error
+	if multi, ok := err.(securecookie.MultiError); ok && len(multi) > 0 {
+		// With several codecs, the first one holds the current key.
+		errs = multi[:1]
+	} else {
+		errs = []error{err}
+	}
+	err = errs[0]
+	switch {
+	case errors.Is(err, ErrDecodeLimitExceeded), errors.Is(err, ErrUnregisteredType):
+		return DecodeDeserialize
+	case errors.Is(err, errSessionFileExpired), errors.Is(err, errSessionExpired),
+		errors.Is(err, errTimestampExpired):
+		return DecodeExpired
+	case isNotFound(err):
+		return DecodeNotFound
+	case errors.Is(err, errSessionGeneration), errors.Is(err, ErrIssuedBeforeNotBefore):
+		return DecodeRevoked
+	case errors.Is(err, ErrInvalidSessionID):
+		return DecodeMalformed
+	case err == securecookie.ErrMacInvalid:
+		return DecodeInvalidMAC
+	}
+	var cerr securecookie.Error
+	if !errors.As(err, &cerr) || !cerr.IsDecode() {
+		return DecodeOther
+	}
+	if c, ok := cerr.(interface{ Cause() error }); ok && c.Cause() != nil &&
+		!strings.Contains(cerr.Error(), "base64") {
+		return DecodeDeserialize
+	}
+	msg := cerr.Error()
+	switch {
+	case strings.Contains(msg, "timestamp"):
+		return DecodeExpired
+	case strings.Contains(msg, "decrypted"):
+		return DecodeDecryptFailed
+	}
+	return DecodeMalformed
+}
+
+// decodeTelemetry counts the decode failures of a store by reason. It is
+// embedded in the built-in stores.
+type decodeTelemetry struct {
+	// OnDecodeFailure, if set, is called each time a session cookie fails
+	// to decode, even if the handler ignores the error returned by Get.
+	OnDecodeFailure func(DecodeFailure)
+
+	mu       sync.Mutex
+	failures map[DecodeFailureReason]int64
+}
+
+// DecodeFailures returns the number of decode failures by reason since the
+// store was created.
+func (t *decodeTelemetry) DecodeFailures() map[DecodeFailureReason]int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := make(map[DecodeFailureReason]int64, len(t.failures))
+	for reason, n := range t.failures {
+		counts[reason] = n
+	}
+	return counts
+}
+
+// recordDecodeFailure counts a decode failure with the given reason, or
+// the reason of err if empty, and reports it to OnDecodeFailure.
+func (t *decodeTelemetry) recordDecodeFailure(name string, reason DecodeFailureReason,
+	err error) {
+	if reason == "" {
+		reason = classifyDecodeError(err)
+	}
+	t.mu.Lock()
+	if t.failures == nil {
+		t.failures = make(map[DecodeFailureReason]int64)
+	}
+	t.failures[reason]++
+	t.mu.Unlock()
+	if t.OnDecodeFailure != nil {
+		t.OnDecodeFailure(DecodeFailure{Name: name, Reason: reason, Err: err})
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestDecodeTelemetry(t *testing.T) {
+	store := NewCookieStore([]byte("some key"))
+	var failures []DecodeFailure
+	store.OnDecodeFailure = func(f DecodeFailure) {
+		failures = append(failures, f)
+	}
+	foreign := encodeCookie(t, NewCookieStore([]byte("other key")), "s", "gopher")
+	expired := encodeCookie(t, store, "s", "gopher")
+	store.MaxAge(-1)
+	for _, v := range []string{"!!!", foreign, expired} {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(&http.Cookie{Name: "s", Value: v})
+		if _, err := store.New(req, "s"); err == nil {
+			t.Fatalf("expected %q to fail to decode", v)
+		}
+	}
+
+	want := []DecodeFailureReason{DecodeMalformed, DecodeInvalidMAC, DecodeExpired}
+	if len(failures) != len(want) {
+		t.Fatalf("bad failures: %v", failures)
+	}
+	for i, f := range failures {
+		if f.Reason != want[i] || f.Name != "s" || f.Err == nil {
+			t.Fatalf("bad failure %d: got %+v, want reason %s", i, f, want[i])
+		}
+	}
+	counts := store.DecodeFailures()
+	if counts[DecodeMalformed] != 1 || counts[DecodeInvalidMAC] != 1 || counts[DecodeExpired] != 1 {
+		t.Fatalf("bad counts: %v", counts)
+	}
+
+	fs := NewFilesystemStore(t.TempDir(), []byte("some key"))
+	value := encodeCookie(t, fs, "s", "gopher")
+	fs.SetGeneration(1)
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(&http.Cookie{Name: "s", Value: value})
+	_, _ = fs.New(req, "s")
+	if counts := fs.DecodeFailures(); counts[DecodeRevoked] != 1 {
+		t.Fatalf("bad counts: %v", counts)
+	}
+}
+
+func TestClassifyNotFound(t *testing.T) {
+	for _, err := range []error{
+		os.ErrNotExist,
+		ErrSessionNotFound,
+		ErrObjectNotFound,
+		ErrRowNotFound,
+		ErrItemNotFound,
+		ErrEntityNotFound,
+	} {
+		if reason := classifyDecodeError(fmt.Errorf("load: %w", err)); reason != DecodeNotFound {
+			t.Fatalf("bad reason for %v: %s", err, reason)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// ErrInvalidToken is returned by TokenIssuer.RedeemToken for tokens that
+// are malformed, expired or were not issued with its keys.
+var ErrInvalidToken = errors.New("sessions: invalid session token")
+
+// tokenName is the name tokens are encoded under, so they can't be used as
+// cookies and the other way around.
+const tokenName = "sessions.token"
+
+// tokenPayload is the content of a session token: the session cookie the
+// token stands for.
+type tokenPayload struct {
+	Name  string
+	Value string
+}
+
+// NewTokenIssuer returns a TokenIssuer for sessions of store, with tokens
+// valid for ttl. See NewCookieStore() for a description of key pairs;
+// tokens typically end up in localStorage, so an encryption key should be
+// set.
+func NewTokenIssuer(store Store, ttl time.Duration, keyPairs ...[]byte) *TokenIssuer {
+	codecs := securecookie.CodecsFromPairs(keyPairs...)
+	for _, codec := range codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(int(ttl / time.Second))
+		}
+	}
+	return &TokenIssuer{
+		Store:  store,
+		Codecs: codecs,
+	}
+}
+
+// TokenIssuer converts sessions into bearer tokens and back, for parts of
+// an application that can't use cookies, such as webviews or browser
+// extensions, but need the same session.
+//
+// A token carries the session cookie the store would set, so it works
+// with any store: for server-side stores it refers to the stored session,
+// and for CookieStore it holds a snapshot of the values. Tokens are
+// authenticated, and encrypted if the key pairs have encryption keys,
+// independently of the cookie.
+type TokenIssuer struct {
+	Store  Store
+	Codecs []securecookie.Codec
+}
+
+// IssueToken saves session and returns a token standing for it. With
+// server-side stores the session data is written, as by Save, but no
+// cookie is sent. With split signature cookies only the payload is
+// carried, so such sessions can't be redeemed.
+func (t *TokenIssuer) IssueToken(session *Session) (string, error) {
+	c, err := savedCookie(t.Store, session)
+	if err != nil {
+		return "", err
+	}
+	return securecookie.EncodeMulti(tokenName, tokenPayload{Name: c.Name, Value: c.Value},
+		t.Codecs...)
+}
+
+// RedeemToken returns the session a token stands for, decoded by the store
+// as if r carried its cookie. The session is not added to the registry.
+// Saving it sends a cookie as usual; clients that can't use cookies call
+// IssueToken again instead.
+func (t *TokenIssuer) RedeemToken(r *http.Request, token string) (*Session, error) {
+	var payload tokenPayload
+	if err := securecookie.DecodeMulti(tokenName, token, &payload, t.Codecs...); err != nil {
+		return nil, ErrInvalidToken
+	}
+	rc := r.Clone(r.Context())
+	rc.Header.Del("Cookie")
+	rc.AddCookie(&http.Cookie{Name: payload.Name, Value: payload.Value})
+	session, err := t.Store.New(rc, payload.Name)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// BearerToken returns the token of the Authorization header of r, sent as
+// "Bearer <token>", or an empty string.
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,56 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenIssuer(t *testing.T) {
+	for name, store := range map[string]Store{
+		"cookie":     NewCookieStore([]byte("some key")),
+		"filesystem": NewFilesystemStore(t.TempDir(), []byte("some key")),
+		"traced":     NewTracedStore(NewCookieStore([]byte("some key")), &testTracer{}),
+	} {
+		issuer := NewTokenIssuer(store, time.Hour,
+			[]byte("token key"), []byte("0123456789abcdef"))
+
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		session, _ := store.New(req, "s")
+		session.Values["user"] = "gopher"
+		token, err := issuer.IssueToken(session)
+		if err != nil {
+			t.Fatalf("%s: failed to issue token: %v", name, err)
+		}
+
+		req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		redeemed, err := issuer.RedeemToken(req, BearerToken(req))
+		if err != nil {
+			t.Fatalf("%s: failed to redeem token: %v", name, err)
+		}
+		if redeemed.IsNew || redeemed.Values["user"] != "gopher" || redeemed.ID != session.ID {
+			t.Fatalf("%s: bad redeemed session: %+v", name, redeemed)
+		}
+
+		// Tokens and cookies are not interchangeable.
+		w := httptest.NewRecorder()
+		if err := session.Save(req, w); err != nil {
+			t.Fatalf("%s: failed to save session: %v", name, err)
+		}
+		if _, err := issuer.RedeemToken(req, w.Result().Cookies()[0].Value); err != ErrInvalidToken {
+			t.Fatalf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	req.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+	if token := BearerToken(req); token != "" {
+		t.Fatalf("expected no bearer token, got %q", token)
+	}
+}
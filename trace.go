@@ -0,0 +1,178 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Attribute is a key-value pair describing a traced store operation.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span is a traced store operation.
+type Span interface {
+	// SetAttributes records attributes of the operation.
+	SetAttributes(attrs ...Attribute)
+	// End completes the operation. err is the error it returned, if any.
+	End(err error)
+}
+
+// Tracer starts spans for store operations. It maps directly onto tracing
+// libraries such as OpenTelemetry: Start corresponds to starting a span
+// and returning the context carrying it.
+type Tracer interface {
+	Start(ctx context.Context, op string) (context.Context, Span)
+}
+
+// NewTracedStore returns a TracedStore wrapping store.
+func NewTracedStore(store Store, tracer Tracer) *TracedStore {
+	return &TracedStore{
+		Store:  store,
+		Tracer: tracer,
+	}
+}
+
+// TracedStore wraps a Store and traces its operations: "Get", "New",
+// "Save", and "Delete" for Delete and saves that delete the session.
+//
+// Spans are started from the request context, and the wrapped store
+// receives a request carrying the span context. Spans have the following
+// attributes:
+//
+//	session.store         type of the wrapped store, e.g. "*sessions.CookieStore"
+//	session.name          name of the session
+//	session.is_new        whether the session is new (Get, New, Save)
+//	session.payload_size  size in bytes of the cookie read or written
+//	session.backend_size  size in bytes of the data read or written by
+//	                      FilesystemStore, ObjectStore or CassandraStore
+//	session.values        number of session values (Get, New, Save)
+type TracedStore struct {
+	Store  Store
+	Tracer Tracer
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (t *TracedStore) Get(r *http.Request, name string) (*Session, error) {
+	registry := GetRegistry(r)
+	ctx, span := t.start(r, "Get", name)
+	session, err := registry.get(t, name, func() (*Session, error) {
+		return t.new(withContext(r, ctx), name)
+	})
+	t.end(span, session, cookieSize(r, name), err)
+	return session, err
+}
+
+// Unwrap returns the wrapped store.
+func (t *TracedStore) Unwrap() Store {
+	return t.Store
+}
+
+// New returns a session for the given name without adding it to the
+// registry.
+func (t *TracedStore) New(r *http.Request, name string) (*Session, error) {
+	ctx, span := t.start(r, "New", name)
+	session, err := t.new(withContext(r, ctx), name)
+	t.end(span, session, cookieSize(r, name), err)
+	return session, err
+}
+
+// Save saves the session in the wrapped store.
+func (t *TracedStore) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	op := "Save"
+	if session.Options != nil && session.Options.MaxAge < 0 {
+		op = "Delete"
+	}
+	ctx, span := t.start(r, op, session.Name())
+	err := t.Store.Save(withContext(r, ctx), w, session)
+	size := 0
+	if w != nil {
+		if c := setCookieHeader(w.Header(), session.Name()); c != nil {
+			size = len(c.Value)
+		}
+	}
+	t.end(span, session, size, err)
+	return err
+}
+
+// Delete deletes the session from the wrapped store.
+func (t *TracedStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	ctx, span := t.start(r, "Delete", session.Name())
+	err := deleteSession(t.Store, withContext(r, ctx), w, session)
+	t.end(span, session, 0, err)
+	return err
+}
+
+// new creates a session with the wrapped store and binds it to t.
+func (t *TracedStore) new(r *http.Request, name string) (*Session, error) {
+	session, err := t.Store.New(r, name)
+	if session != nil {
+		session.store = t
+	}
+	return session, err
+}
+
+// start starts a span for an operation on the session named name.
+func (t *TracedStore) start(r *http.Request, op, name string) (context.Context, Span) {
+	ctx, span := t.Tracer.Start(requestContext(r), op)
+	span.SetAttributes(
+		Attribute{Key: "session.store", Value: fmt.Sprintf("%T", t.Store)},
+		Attribute{Key: "session.name", Value: name},
+	)
+	return ctx, span
+}
+
+// end records the result of an operation and ends its span.
+func (t *TracedStore) end(span Span, session *Session, size int, err error) {
+	if session != nil {
+		span.SetAttributes(
+			Attribute{Key: "session.is_new", Value: session.IsNew},
+			Attribute{Key: "session.values", Value: len(session.Values)},
+		)
+		if session.backendSize > 0 {
+			span.SetAttributes(Attribute{Key: "session.backend_size", Value: session.backendSize})
+		}
+	}
+	span.SetAttributes(Attribute{Key: "session.payload_size", Value: size})
+	span.End(err)
+}
+
+// cookieSize returns the size of the value of the first cookie named name
+// in the request, or 0.
+func cookieSize(r *http.Request, name string) int {
+	if r == nil {
+		return 0
+	}
+	if c, err := r.Cookie(name); err == nil {
+		return len(c.Value)
+	}
+	return 0
+}
+
+// withContext returns a shallow copy of r with its context changed to ctx,
+// or nil if r is nil.
+func withContext(r *http.Request, ctx context.Context) *http.Request {
+	if r == nil {
+		return nil
+	}
+	return r.WithContext(ctx)
+}
+
+// setCookieHeader returns the last cookie named name set in h, or nil.
+func setCookieHeader(h http.Header, name string) *http.Cookie {
+	var found *http.Cookie
+	for _, v := range h.Values("Set-Cookie") {
+		if c, err := http.ParseSetCookie(v); err == nil && c.Name == name {
+			found = c
+		}
+	}
+	return found
+}
@@ -0,0 +1,121 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type spanKey struct{}
+
+// testSpan records the attributes of a span.
+type testSpan struct {
+	op    string
+	attrs map[string]interface{}
+	ended bool
+	err   error
+}
+
+func (s *testSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *testSpan) End(err error) {
+	s.ended, s.err = true, err
+}
+
+// testTracer records started spans.
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, op string) (context.Context, Span) {
+	span := &testSpan{op: op, attrs: make(map[string]interface{})}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// contextStore checks that the request carries a span.
+type contextStore struct {
+	*CookieStore
+	t *testing.T
+}
+
+func (s contextStore) New(r *http.Request, name string) (*Session, error) {
+	if r.Context().Value(spanKey{}) == nil {
+		s.t.Error("missing span in request context")
+	}
+	return s.CookieStore.New(r, name)
+}
+
+func TestTracedStore(t *testing.T) {
+	tracer := &testTracer{}
+	store := NewTracedStore(contextStore{NewCookieStore([]byte("some key")), t}, tracer)
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, err := store.Get(req, "s")
+	if err != nil {
+		t.Fatal("failed to get session", err)
+	}
+	session.Values["foo"] = "bar"
+	w := httptest.NewRecorder()
+	if err = session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	session.Options.MaxAge = -1
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+
+	ops := []string{"Get", "Save", "Delete"}
+	if len(tracer.spans) != len(ops) {
+		t.Fatalf("bad number of spans: %d", len(tracer.spans))
+	}
+	for i, span := range tracer.spans {
+		if span.op != ops[i] || !span.ended || span.err != nil {
+			t.Fatalf("bad span %d: %+v", i, span)
+		}
+		if span.attrs["session.name"] != "s" ||
+			span.attrs["session.store"] != "sessions.contextStore" {
+			t.Fatalf("bad span attributes %d: %v", i, span.attrs)
+		}
+	}
+	if tracer.spans[0].attrs["session.is_new"] != true {
+		t.Fatalf("expected a new session: %v", tracer.spans[0].attrs)
+	}
+	size := len(w.Result().Cookies()[0].Value)
+	if tracer.spans[1].attrs["session.payload_size"] != size {
+		t.Fatalf("bad payload size: %v, want %d", tracer.spans[1].attrs, size)
+	}
+}
+
+func TestTracedStoreWithoutRequest(t *testing.T) {
+	tracer := &testTracer{}
+	var cookies []*http.Cookie
+	writer := CookieWriterFunc(func(w http.ResponseWriter, c *http.Cookie) error {
+		cookies = append(cookies, c)
+		return nil
+	})
+	store := NewTracedStore(NewCookieStoreWithOptions(WithKeyPairs([]byte("some key")),
+		WithCookieWriter(writer)), tracer)
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	session.Values["foo"] = "bar"
+
+	// Stores accept a nil request and, with a CookieWriter, a nil writer.
+	if err := store.Save(nil, nil, session); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if err := store.Delete(nil, nil, session); err != nil {
+		t.Fatal("failed to delete session", err)
+	}
+	if len(cookies) != 2 || len(tracer.spans) != 3 {
+		t.Fatalf("bad cookies or spans: %v, %d", cookies, len(tracer.spans))
+	}
+}
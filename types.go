@@ -0,0 +1,306 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnregisteredType is returned when saving a session holding values of
+// types that were not registered with RegisterType. The error lists them.
+var ErrUnregisteredType = errors.New("sessions: unregistered type")
+
+// types maps the names given to RegisterType to types and back.
+var types = struct {
+	sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}{
+	byName: make(map[string]reflect.Type),
+	byType: make(map[reflect.Type]string),
+}
+
+// builtinTypes are the types encoded by TypedJSONEncoder without being
+// registered, keyed by their name.
+var builtinTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, v := range []interface{}{
+		"", false, 0, int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0), []byte(nil), []string(nil), time.Time{},
+		// Internal metadata.
+		map[string]int64(nil), map[string][]int64(nil),
+	} {
+		t := reflect.TypeOf(v)
+		builtinTypes[t.String()] = t
+	}
+}
+
+// RegisterType records the type T under name for all serializers: it is
+// registered with encoding/gob, like gob.Register, and name tags its values
+// in the output of TypedJSONEncoder.
+//
+// Like gob.Register, it should be called during initialization, and it
+// panics if name or T is already registered differently.
+func RegisterType[T any](name string) {
+	var zero T
+	t := reflect.TypeOf(&zero).Elem()
+	types.Lock()
+	defer types.Unlock()
+	if prev, ok := types.byName[name]; ok && prev != t {
+		panic(fmt.Sprintf("sessions: name %q registered for %v and %v", name, prev, t))
+	}
+	if prev, ok := types.byType[t]; ok && prev != name {
+		panic(fmt.Sprintf("sessions: type %v registered as %q and %q", t, prev, name))
+	}
+	if _, ok := builtinTypes[name]; ok || name == tagNil || name == tagMap || name == tagList {
+		panic(fmt.Sprintf("sessions: name %q is reserved", name))
+	}
+	types.byName[name] = t
+	types.byType[t] = name
+	gob.Register(zero)
+}
+
+// typeName returns the name of a type for TypedJSONEncoder.
+func typeName(t reflect.Type) (string, bool) {
+	if b, ok := builtinTypes[t.String()]; ok && b == t {
+		return t.String(), true
+	}
+	types.RLock()
+	defer types.RUnlock()
+	name, ok := types.byType[t]
+	return name, ok
+}
+
+// lookupType returns the type of a name written by TypedJSONEncoder.
+func lookupType(name string) (reflect.Type, bool) {
+	if t, ok := builtinTypes[name]; ok {
+		return t, true
+	}
+	types.RLock()
+	defer types.RUnlock()
+	t, ok := types.byName[name]
+	return t, ok
+}
+
+// Type tags of values that are not registered types.
+const (
+	tagNil  = "nil"
+	tagMap  = "map"
+	tagList = "list"
+)
+
+// TypedJSONEncoder is a securecookie.Serializer encoding values as JSON
+// tagged with their type, so they are decoded with the type they were
+// saved with, unlike securecookie.JSONEncoder.
+//
+// Session values maps and []interface{} values, such as flashes, are
+// tagged element by element, and map entries are sorted so equal values
+// have equal encodings; other values must have a builtin type or a
+// type registered with RegisterType. Serializing values of other types
+// fails with ErrUnregisteredType, listing them.
+type TypedJSONEncoder struct{}
+
+// taggedValue is the JSON form of a value written by TypedJSONEncoder.
+type taggedValue struct {
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v,omitempty"`
+}
+
+// taggedEntry is the JSON form of a map entry.
+type taggedEntry struct {
+	Key   taggedValue `json:"k"`
+	Value taggedValue `json:"v"`
+}
+
+// Serialize encodes src as tagged JSON.
+func (e TypedJSONEncoder) Serialize(src interface{}) ([]byte, error) {
+	missing := make(map[string]bool)
+	tv, err := tagValue(src, missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%w: %s", ErrUnregisteredType, strings.Join(names, ", "))
+	}
+	return json.Marshal(tv)
+}
+
+// Deserialize decodes tagged JSON into dst, which must be a pointer.
+func (e TypedJSONEncoder) Deserialize(src []byte, dst interface{}) error {
+	return e.deserialize(src, dst, nil)
+}
+
+// deserialize decodes tagged JSON into dst, checking the limits of w, if
+// not nil, as nested values are decoded.
+func (e TypedJSONEncoder) deserialize(src []byte, dst interface{}, w *limitWalker) error {
+	var tv taggedValue
+	if err := json.Unmarshal(src, &tv); err != nil {
+		return err
+	}
+	v, err := untagValue(tv, w, 0)
+	if err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("sessions: cannot deserialize into %T", dst)
+	}
+	if v == nil {
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+		return nil
+	}
+	val := reflect.ValueOf(v)
+	if !val.Type().AssignableTo(rv.Elem().Type()) {
+		return fmt.Errorf("sessions: cannot deserialize %T into %T", v, dst)
+	}
+	rv.Elem().Set(val)
+	return nil
+}
+
+// tagValue returns the tagged form of v, recording the names of
+// unregistered types in missing.
+func tagValue(v interface{}, missing map[string]bool) (taggedValue, error) {
+	var raw interface{}
+	tag := tagNil
+	switch x := v.(type) {
+	case nil:
+		return taggedValue{Type: tagNil}, nil
+	case map[interface{}]interface{}:
+		entries := make([]taggedEntry, 0, len(x))
+		for k, v := range x {
+			tk, err := tagValue(k, missing)
+			if err != nil {
+				return taggedValue{}, err
+			}
+			tv, err := tagValue(v, missing)
+			if err != nil {
+				return taggedValue{}, err
+			}
+			entries = append(entries, taggedEntry{Key: tk, Value: tv})
+		}
+		// Sort entries so equal maps have equal encodings.
+		sort.Slice(entries, func(i, j int) bool {
+			a, b := entries[i].Key, entries[j].Key
+			if a.Type != b.Type {
+				return a.Type < b.Type
+			}
+			return string(a.Value) < string(b.Value)
+		})
+		tag, raw = tagMap, entries
+	case []interface{}:
+		elems := make([]taggedValue, 0, len(x))
+		for _, v := range x {
+			tv, err := tagValue(v, missing)
+			if err != nil {
+				return taggedValue{}, err
+			}
+			elems = append(elems, tv)
+		}
+		tag, raw = tagList, elems
+	default:
+		name, ok := typeName(reflect.TypeOf(v))
+		if !ok {
+			missing[reflect.TypeOf(v).String()] = true
+			return taggedValue{}, nil
+		}
+		tag, raw = name, v
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return taggedValue{}, err
+	}
+	return taggedValue{Type: tag, Value: b}, nil
+}
+
+// untagValue decodes a tagged value at the given depth. If w is not nil,
+// the depth of maps and lists is checked before decoding them, and their
+// length before decoding their elements.
+func untagValue(tv taggedValue, w *limitWalker, depth int) (interface{}, error) {
+	switch tv.Type {
+	case tagNil:
+		return nil, nil
+	case tagMap:
+		if w != nil {
+			if err := w.enter(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		var entries []taggedEntry
+		if err := json.Unmarshal(tv.Value, &entries); err != nil {
+			return nil, err
+		}
+		if w != nil {
+			if err := w.count(len(entries)); err != nil {
+				return nil, err
+			}
+		}
+		m := make(map[interface{}]interface{}, len(entries))
+		for _, e := range entries {
+			k, err := untagValue(e.Key, w, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := untagValue(e.Value, w, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case tagList:
+		if w != nil {
+			if err := w.enter(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		var elems []taggedValue
+		if err := json.Unmarshal(tv.Value, &elems); err != nil {
+			return nil, err
+		}
+		if w != nil {
+			if err := w.count(len(elems)); err != nil {
+				return nil, err
+			}
+		}
+		l := make([]interface{}, 0, len(elems))
+		for _, e := range elems {
+			v, err := untagValue(e, w, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		return l, nil
+	}
+	t, ok := lookupType(tv.Type)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnregisteredType, tv.Type)
+	}
+	p := reflect.New(t)
+	if err := json.Unmarshal(tv.Value, p.Interface()); err != nil {
+		return nil, err
+	}
+	if w != nil {
+		if err := w.walk(p.Elem(), depth); err != nil {
+			return nil, err
+		}
+	}
+	return p.Elem().Interface(), nil
+}
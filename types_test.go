@@ -0,0 +1,60 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type registeredUser struct {
+	Name  string
+	Admin bool
+}
+
+type unregisteredCart struct {
+	Items []string
+}
+
+func init() {
+	RegisterType[registeredUser]("sessions.user")
+}
+
+func TestTypedJSONEncoder(t *testing.T) {
+	store := NewCookieStoreWithOptions(WithKeyPairs([]byte("some key")),
+		WithSerializer(TypedJSONEncoder{}))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	w := httptest.NewRecorder()
+	session, _ := store.New(req, "s")
+	session.Values["user"] = registeredUser{Name: "gopher", Admin: true}
+	session.Values[42] = int64(43)
+	session.AddFlash(registeredUser{Name: "flash"})
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	loaded, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to load session", err)
+	}
+	if !reflect.DeepEqual(loaded.Values, session.Values) {
+		t.Fatalf("bad values: got %#v, want %#v", loaded.Values, session.Values)
+	}
+
+	// Unregistered types are listed when saving.
+	session.Values["cart"] = unregisteredCart{}
+	session.Values["carts"] = []interface{}{&unregisteredCart{}}
+	err = session.Save(req, httptest.NewRecorder())
+	if !errors.Is(err, ErrUnregisteredType) ||
+		!strings.Contains(err.Error(), "*sessions.unregisteredCart, sessions.unregisteredCart") {
+		t.Fatalf("expected ErrUnregisteredType listing types, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+)
+
+// WithSkipUnchanged makes a CookieStore skip the Set-Cookie header when a
+// session is saved unchanged. See CookieStore.SkipUnchanged.
+func WithSkipUnchanged() StoreOption {
+	return func(c *storeConfig) {
+		c.skipUnchanged = true
+	}
+}
+
+// sessionDigest returns a digest of the values and cookie attributes of
+// session. Values encoding differently, such as maps iterated in another
+// order, yield different digests, so changes are never missed.
+func sessionDigest(session *Session) ([]byte, error) {
+	digests := make([][]byte, 0, len(session.Values))
+	for k, v := range session.Values {
+		_, digest, err := fieldDigest(k, v)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, digest[:])
+	}
+	sort.Slice(digests, func(i, j int) bool {
+		return bytes.Compare(digests[i], digests[j]) < 0
+	})
+	h := sha256.New()
+	for _, digest := range digests {
+		h.Write(digest)
+	}
+	if o := session.Options; o != nil {
+		fmt.Fprintf(h, "%q %q %d %d %t %t %t %d", o.Path, o.Domain, o.MaxAge,
+			o.Expires.UnixNano(), o.Secure, o.HttpOnly, o.Partitioned, o.SameSite)
+	}
+	return h.Sum(nil), nil
+}
+
+// unchanged reports whether session has the digest recorded when it was
+// decoded.
+func unchanged(session *Session) bool {
+	if session.loadedDigest == nil {
+		return false
+	}
+	digest, err := sessionDigest(session)
+	return err == nil && bytes.Equal(digest, session.loadedDigest)
+}
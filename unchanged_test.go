@@ -0,0 +1,54 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSkipUnchanged(t *testing.T) {
+	store := NewCookieStoreWithOptions(WithKeyPairs([]byte("secret-key")),
+		WithSkipUnchanged())
+	cookie := encodeCookie(t, store, "s", "gopher")
+
+	load := func() *Session {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		req.AddCookie(&http.Cookie{Name: "s", Value: cookie})
+		session, err := store.New(req, "s")
+		if err != nil || session.IsNew {
+			t.Fatalf("failed to decode session: %v", err)
+		}
+		return session
+	}
+	save := func(session *Session) int {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		w := httptest.NewRecorder()
+		if err := session.Save(req, w); err != nil {
+			t.Fatal("failed to save session", err)
+		}
+		return len(w.Result().Cookies())
+	}
+
+	if n := save(load()); n != 0 {
+		t.Fatalf("expected no cookie for an unchanged session, got %d", n)
+	}
+	session := load()
+	session.Values["theme"] = "dark"
+	if n := save(session); n != 1 {
+		t.Fatalf("expected a cookie for a changed session, got %d", n)
+	}
+	session = load()
+	session.Options.MaxAge = 3600
+	if n := save(session); n != 1 {
+		t.Fatalf("expected a cookie for changed options, got %d", n)
+	}
+	session = load()
+	session.Options.MaxAge = -1
+	if n := save(session); n != 1 {
+		t.Fatalf("expected a cookie deleting the session, got %d", n)
+	}
+}
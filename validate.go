@@ -0,0 +1,56 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"github.com/gorilla/securecookie"
+)
+
+// Validator is implemented by stores that can check that a session would
+// be saved, by serializing and encoding it as Save does, without writing
+// anything.
+type Validator interface {
+	Validate(s *Session) error
+}
+
+// Validate reports whether the session can be saved, without writing a
+// cookie or any server-side data, so handlers can fail before committing
+// other side effects, and tests can check that values are encodable.
+//
+// It returns ErrNilValues if Values is nil, an error wrapping
+// ErrUnserializable for unregistered or unsupported types, and the error
+// of the codecs for sessions exceeding their maximum length. Decorators
+// are unwrapped to find a store implementing Validator; if there is none,
+// the values are serialized with gob, which doesn't catch size limits.
+func (s *Session) Validate() error {
+	if s.Values == nil {
+		return ErrNilValues
+	}
+	if v, ok := StoreAs[Validator](s.store); ok {
+		return v.Validate(s)
+	}
+	if _, err := (securecookie.GobEncoder{}).Serialize(s.Values); err != nil {
+		if cause := checkValues(s.Values, true); cause != nil {
+			return cause
+		}
+		return err
+	}
+	return checkValues(s.Values, false)
+}
+
+// Validate encodes session as Save would, without writing a cookie.
+// BeforeSave hooks are not called.
+func (s *CookieStore) Validate(session *Session) error {
+	_, err := encodeMulti(session.Name(), session.Values,
+		sessionCodecs(session, s.Codecs)...)
+	return err
+}
+
+// Validate encodes session as Save would, without writing a file.
+// BeforeSave hooks are not called.
+func (s *FilesystemStore) Validate(session *Session) error {
+	_, err := encodeMulti(session.Name(), session.Values, s.Codecs...)
+	return err
+}
@@ -0,0 +1,46 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type unregisteredValue struct{ N int }
+
+func TestSessionValidate(t *testing.T) {
+	for name, store := range map[string]Store{
+		"cookie":     NewCookieStore([]byte("some key")),
+		"filesystem": NewFilesystemStore(t.TempDir(), []byte("some key")),
+		"wrapped":    NewRolloutStore(NewCookieStore([]byte("some key"))),
+	} {
+		req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+		session, _ := store.New(req, "s")
+		session.Values["user"] = "gopher"
+		if err := session.Validate(); err != nil {
+			t.Fatalf("%s: failed to validate session: %v", name, err)
+		}
+
+		session.Values["bad"] = unregisteredValue{1}
+		if err := session.Validate(); !errors.Is(err, ErrUnserializable) {
+			t.Fatalf("%s: expected ErrUnserializable, got %v", name, err)
+		}
+		delete(session.Values, "bad")
+
+		// Size limits are only checked by stores implementing Validator.
+		session.Values["big"] = strings.Repeat("x", 8192)
+		if _, ok := store.(Validator); ok && session.Validate() == nil {
+			t.Fatalf("%s: expected an error for an oversized session", name)
+		}
+
+		session.Values = nil
+		if err := session.Validate(); err != ErrNilValues {
+			t.Fatalf("%s: expected ErrNilValues, got %v", name, err)
+		}
+	}
+}
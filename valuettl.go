@@ -0,0 +1,79 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"time"
+)
+
+// Session values key for the expiry times of values.
+const valueTTLKey = "_ttl"
+
+// SetWithTTL is like Set but the value expires after ttl, for short-lived
+// items such as one-time codes or pending redirects. Expired values are
+// dropped when the session is decoded by the built-in stores, so handlers
+// don't have to check timestamps.
+//
+// Expiry times are kept in the session values, so they are authenticated
+// like any other value. Setting the key again with Set makes the value
+// permanent.
+func (s *Session) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	if err := s.Set(key, value); err != nil {
+		return err
+	}
+	expiries, _ := s.Values[valueTTLKey].(map[string]int64)
+	if expiries == nil {
+		expiries = make(map[string]int64)
+	}
+	expiries[key] = time.Now().Add(ttl).Unix()
+	s.Values[valueTTLKey] = expiries
+	return nil
+}
+
+// ValueExpiry returns the time the value for key expires, if it was set
+// with SetWithTTL.
+func (s *Session) ValueExpiry(key string) (time.Time, bool) {
+	expiries, _ := s.Values[valueTTLKey].(map[string]int64)
+	expires, ok := expiries[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(expires, 0), true
+}
+
+// clearValueTTL makes the value for key permanent.
+func (s *Session) clearValueTTL(key interface{}) {
+	k, ok := key.(string)
+	if !ok {
+		return
+	}
+	expiries, _ := s.Values[valueTTLKey].(map[string]int64)
+	delete(expiries, k)
+	if len(expiries) == 0 {
+		delete(s.Values, valueTTLKey)
+	}
+}
+
+// pruneExpiredValues removes expired values and the expiry times of
+// values that were deleted.
+func pruneExpiredValues(s *Session) {
+	expiries, ok := s.Values[valueTTLKey].(map[string]int64)
+	if !ok {
+		delete(s.Values, valueTTLKey)
+		return
+	}
+	now := time.Now().Unix()
+	for key, expires := range expiries {
+		if _, exists := s.Values[key]; !exists {
+			delete(expiries, key)
+		} else if now >= expires {
+			delete(s.Values, key)
+			delete(expiries, key)
+		}
+	}
+	if len(expiries) == 0 {
+		delete(s.Values, valueTTLKey)
+	}
+}
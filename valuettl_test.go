@@ -0,0 +1,59 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetWithTTL(t *testing.T) {
+	store := NewCookieStore([]byte("some key"))
+	req, _ := http.NewRequest("GET", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	if err := session.SetWithTTL("otp", "123456", -time.Second); err != nil {
+		t.Fatal("failed to set value", err)
+	}
+	if err := session.SetWithTTL("redirect", "/next", time.Hour); err != nil {
+		t.Fatal("failed to set value", err)
+	}
+	if err := session.SetWithTTL("permanent", true, -time.Second); err != nil {
+		t.Fatal("failed to set value", err)
+	}
+	if err := session.Set("permanent", true); err != nil {
+		t.Fatal("failed to set value", err)
+	}
+	if _, ok := session.ValueExpiry("permanent"); ok {
+		t.Fatal("expected Set to clear the expiry")
+	}
+	if err := session.SetWithTTL(flashesKey, nil, time.Hour); err != ErrReservedKey {
+		t.Fatalf("expected ErrReservedKey, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	req, _ = http.NewRequest("GET", "http://www.example.com", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	session, err := store.New(req, "s")
+	if err != nil {
+		t.Fatal("failed to decode session", err)
+	}
+	if _, ok := session.Values["otp"]; ok {
+		t.Fatal("expected the expired value to be dropped")
+	}
+	if _, ok := session.ValueExpiry("otp"); ok {
+		t.Fatal("expected the expiry of the dropped value to be removed")
+	}
+	if session.Values["redirect"] != "/next" || session.Values["permanent"] != true {
+		t.Fatalf("expected unexpired values to be kept: %v", session.Values)
+	}
+	if expires, ok := session.ValueExpiry("redirect"); !ok || expires.Before(time.Now()) {
+		t.Fatalf("bad expiry %v", expires)
+	}
+}
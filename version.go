@@ -0,0 +1,145 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// ErrVersionConflict is returned by VersionStore.Save when the session
+// changed since the client, or the handler, read it.
+var ErrVersionConflict = errors.New("sessions: session version conflict")
+
+// DefaultVersionHeader is the header used by VersionStore when Header is
+// empty.
+const DefaultVersionHeader = "X-Session-Version"
+
+// Session values key for the session version.
+const versionKey = "_ver"
+
+// SessionVersion returns the version of a session managed by a
+// VersionStore: the number of times it was saved, or 0 for a new session.
+func SessionVersion(session *Session) int64 {
+	v, _ := session.Values[versionKey].(int64)
+	return v
+}
+
+// NewVersionStore returns a VersionStore wrapping store.
+func NewVersionStore(store Store) *VersionStore {
+	return &VersionStore{Store: store}
+}
+
+// VersionStore wraps a Store and versions sessions, to detect lost updates
+// when single-page applications send parallel requests mutating the same
+// session.
+//
+// Each save increments the version of the session and reports it in a
+// response header. Clients send the last version they saw in the same
+// header with mutating requests (other than GET, HEAD, OPTIONS and TRACE).
+// Save then fails with ErrVersionConflict if that version is stale, or if
+// the stored session was saved by another request since it was loaded.
+// The latter check reads the session again from the wrapped store, so it
+// only detects concurrent saves with server-side stores, and leaves a
+// short window between the check and the write.
+type VersionStore struct {
+	Store Store
+	// Header is the name of the version header. If empty,
+	// DefaultVersionHeader is used.
+	Header string
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *VersionStore) Get(r *http.Request, name string) (*Session, error) {
+	return GetRegistry(r).Get(s, name)
+}
+
+// Unwrap returns the wrapped store.
+func (s *VersionStore) Unwrap() Store {
+	return s.Store
+}
+
+// New returns a session for the given name without adding it to the
+// registry.
+func (s *VersionStore) New(r *http.Request, name string) (*Session, error) {
+	session, err := s.Store.New(r, name)
+	if session == nil {
+		return nil, err
+	}
+	session.store = s
+	return session, err
+}
+
+// Save checks the version of the session for mutating requests, then
+// increments it, saves the session in the wrapped store, and sets the
+// version header of the response.
+func (s *VersionStore) Save(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	version := SessionVersion(session)
+	if r != nil && !isSafeMethod(r.Method) {
+		if err := s.check(r, session, version); err != nil {
+			return err
+		}
+	}
+	session.initValues()
+	session.Values[versionKey] = version + 1
+	if err := s.Store.Save(r, w, session); err != nil {
+		session.Values[versionKey] = version
+		return err
+	}
+	s.WriteHeader(w, session)
+	return nil
+}
+
+// Delete deletes the session from the wrapped store.
+func (s *VersionStore) Delete(r *http.Request, w http.ResponseWriter,
+	session *Session) error {
+	return deleteSession(s.Store, r, w, session)
+}
+
+// WriteHeader sets the version header of the response to the version of
+// session, for handlers that read a session without saving it.
+func (s *VersionStore) WriteHeader(w http.ResponseWriter, session *Session) {
+	if w != nil {
+		w.Header().Set(s.header(), strconv.FormatInt(SessionVersion(session), 10))
+	}
+}
+
+// check returns ErrVersionConflict if the version sent by the client, or
+// the version of the stored session, is not version.
+func (s *VersionStore) check(r *http.Request, session *Session, version int64) error {
+	if h := r.Header.Get(s.header()); h != "" {
+		v, err := strconv.ParseInt(h, 10, 64)
+		if err != nil || v != version {
+			return ErrVersionConflict
+		}
+	}
+	if session.IsNew {
+		return nil
+	}
+	stored, err := s.Store.New(r, session.Name())
+	if err == nil && !stored.IsNew && SessionVersion(stored) != version {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// header returns the name of the version header.
+func (s *VersionStore) header() string {
+	if s.Header == "" {
+		return DefaultVersionHeader
+	}
+	return s.Header
+}
+
+// isSafeMethod reports whether method is safe, as defined by RFC 9110.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersionStore(t *testing.T) {
+	bucket := &memBucket{objects: make(map[string][]byte)}
+	store := NewVersionStore(NewObjectStore(bucket, []byte("some key")))
+
+	req, _ := http.NewRequest("POST", "http://www.example.com", nil)
+	session, _ := store.New(req, "s")
+	w := httptest.NewRecorder()
+	if err := session.Save(req, w); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	if v := w.Header().Get(DefaultVersionHeader); v != "1" {
+		t.Fatalf("expected version 1, got %q", v)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	request := func(version string) *http.Request {
+		req, _ := http.NewRequest("POST", "http://www.example.com", nil)
+		req.AddCookie(cookie)
+		req.Header.Set(DefaultVersionHeader, version)
+		return req
+	}
+
+	// Two parallel requests load version 1; the second save conflicts.
+	reqA, reqB := request("1"), request("1")
+	a, _ := store.New(reqA, "s")
+	b, _ := store.New(reqB, "s")
+	a.Values["cart"] = "apples"
+	if err := a.Save(reqA, httptest.NewRecorder()); err != nil {
+		t.Fatal("failed to save session", err)
+	}
+	b.Values["cart"] = "pears"
+	if err := b.Save(reqB, httptest.NewRecorder()); err != ErrVersionConflict {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+
+	// A client sending a stale version conflicts.
+	reqC := request("1")
+	c, _ := store.New(reqC, "s")
+	if SessionVersion(c) != 2 || c.Values["cart"] != "apples" {
+		t.Fatalf("bad session: %v", c.Values)
+	}
+	if err := c.Save(reqC, httptest.NewRecorder()); err != ErrVersionConflict {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+	reqC = request("2")
+	w = httptest.NewRecorder()
+	if err := c.Save(reqC, w); err != nil || w.Header().Get(DefaultVersionHeader) != "3" {
+		t.Fatalf("failed to save session: %v", err)
+	}
+}